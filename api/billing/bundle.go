@@ -0,0 +1,83 @@
+package billing
+
+import (
+	"errors"
+	"math"
+)
+
+// ============================================================
+// PACKS — prix d'une offre groupée et répartition sur ses composants
+// ============================================================
+
+// BundleLine est un composant de pack : prix catalogue unitaire pour la période du pack.
+type BundleLine struct {
+	PrixUnitaire float64
+	Quantite     int
+}
+
+// BundleTotals récapitule un pack ; Unitaires[i] est le prix unitaire réparti du composant i,
+// celui de la tarification privée de son abonnement.
+type BundleTotals struct {
+	SousTotal float64   `json:"subtotal"` // somme des prix catalogue
+	Remise    float64   `json:"discount"`
+	Total     float64   `json:"total"` // montant facturé par période
+	Unitaires []float64 `json:"-"`
+}
+
+var (
+	ErrBundleEmpty    = errors.New("pack components have no catalog price")
+	ErrBundlePricing  = errors.New("pack needs either a price or a discount percentage")
+	ErrBundleDiscount = errors.New("discount percentage must be between 0 and 100 (exclusive)")
+	ErrBundleTooHigh  = errors.New("pack price cannot exceed the sum of its components")
+)
+
+// ComputeBundle calcule le prix d'un pack (prix fixe ou remise en pourcentage, exactement
+// l'un des deux) et le répartit au prorata des prix catalogue. L'écart d'arrondi est porté
+// par le premier composant de quantité 1 ; sans composant unitaire, Total peut différer
+// du prix demandé de quelques centimes.
+func ComputeBundle(lines []BundleLine, prix, remisePct *float64) (BundleTotals, error) {
+	if (prix == nil) == (remisePct == nil) {
+		return BundleTotals{}, ErrBundlePricing
+	}
+	var sub float64
+	for _, l := range lines {
+		sub += l.PrixUnitaire * float64(l.Quantite)
+	}
+	sub = roundCents(sub)
+	if sub <= 0 {
+		return BundleTotals{}, ErrBundleEmpty
+	}
+
+	var target float64
+	if prix != nil {
+		if *prix < 0 || roundCents(*prix) > sub {
+			return BundleTotals{}, ErrBundleTooHigh
+		}
+		target = roundCents(*prix)
+	} else {
+		if *remisePct <= 0 || *remisePct >= 100 {
+			return BundleTotals{}, ErrBundleDiscount
+		}
+		target = roundCents(sub * (1 - *remisePct/100))
+	}
+
+	ratio := target / sub
+	t := BundleTotals{SousTotal: sub, Unitaires: make([]float64, len(lines))}
+	var total float64
+	for i, l := range lines {
+		t.Unitaires[i] = roundCents(l.PrixUnitaire * ratio)
+		total += t.Unitaires[i] * float64(l.Quantite)
+	}
+	if diff := roundCents(target - total); diff != 0 {
+		for i, l := range lines {
+			if l.Quantite == 1 && t.Unitaires[i]+diff >= 0 {
+				t.Unitaires[i] = roundCents(t.Unitaires[i] + diff)
+				total += diff
+				break
+			}
+		}
+	}
+	t.Total = roundCents(total)
+	t.Remise = roundCents(math.Max(sub-t.Total, 0))
+	return t, nil
+}
@@ -0,0 +1,59 @@
+package billing
+
+import "testing"
+
+func TestComputeBundle_Discount(t *testing.T) {
+	lines := []BundleLine{
+		{PrixUnitaire: 499, Quantite: 1},  // EDR
+		{PrixUnitaire: 1200, Quantite: 1}, // SOC
+		{PrixUnitaire: 90, Quantite: 3},   // formation
+	}
+	pct := 15.0
+	got, err := ComputeBundle(lines, nil, &pct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.SousTotal != 1969 || got.Total != 1673.65 || got.Remise != 295.35 {
+		t.Errorf("got %+v", got)
+	}
+	var sum float64
+	for i, l := range lines {
+		sum += got.Unitaires[i] * float64(l.Quantite)
+	}
+	if roundCents(sum) != got.Total {
+		t.Errorf("allocated prices sum to %v, want %v", sum, got.Total)
+	}
+}
+
+func TestComputeBundle_FixedPrice(t *testing.T) {
+	lines := []BundleLine{{PrixUnitaire: 100, Quantite: 1}, {PrixUnitaire: 200, Quantite: 1}}
+	prix := 250.0
+	got, err := ComputeBundle(lines, &prix, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Total != 250 || got.Remise != 50 || got.Unitaires[0]+got.Unitaires[1] != 250 {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestComputeBundle_Errors(t *testing.T) {
+	lines := []BundleLine{{PrixUnitaire: 100, Quantite: 1}}
+	prix, pct, tooHigh := 80.0, 100.0, 120.0
+	cases := []struct {
+		prix, pct *float64
+		lines     []BundleLine
+		want      error
+	}{
+		{nil, nil, lines, ErrBundlePricing},
+		{&prix, &pct, lines, ErrBundlePricing},
+		{nil, &pct, lines, ErrBundleDiscount},
+		{&tooHigh, nil, lines, ErrBundleTooHigh},
+		{&prix, nil, []BundleLine{{PrixUnitaire: 0, Quantite: 1}}, ErrBundleEmpty},
+	}
+	for i, c := range cases {
+		if _, err := ComputeBundle(c.lines, c.prix, c.pct); err != c.want {
+			t.Errorf("case %d: got %v, want %v", i, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package billing
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// CYCLE DE VIE DES ABONNEMENTS
+// actif → impaye → suspendu → resilie
+// ============================================================
+
+const (
+	StatutActif    = "actif"
+	StatutImpaye   = "impaye"
+	StatutSuspendu = "suspendu"
+	StatutResilie  = "resilie"
+)
+
+// Event déclenche une transition de statut d'abonnement.
+type Event string
+
+const (
+	EventPaymentSucceeded Event = "payment_succeeded"
+	EventPaymentFailed    Event = "payment_failed"
+	EventDunningExhausted Event = "dunning_exhausted"
+	EventGraceExpired     Event = "grace_expired"
+	EventTermEnded        Event = "term_ended"
+	EventCancelled        Event = "cancelled"
+)
+
+var transitions = map[string]map[Event]string{
+	StatutActif: {
+		EventPaymentSucceeded: StatutActif,
+		EventPaymentFailed:    StatutImpaye,
+		EventDunningExhausted: StatutSuspendu,
+		EventTermEnded:        StatutResilie,
+		EventCancelled:        StatutResilie,
+	},
+	StatutImpaye: {
+		EventPaymentSucceeded: StatutActif,
+		EventPaymentFailed:    StatutImpaye,
+		EventDunningExhausted: StatutSuspendu,
+		EventCancelled:        StatutResilie,
+	},
+	StatutSuspendu: {
+		EventPaymentSucceeded: StatutActif,
+		EventDunningExhausted: StatutSuspendu, // nouvel échec après un changement de moyen de paiement
+		EventGraceExpired:     StatutResilie,
+		EventCancelled:        StatutResilie,
+	},
+}
+
+// Transition retourne le statut atteint depuis `from` après `ev`.
+// Un abonnement résilié est terminal.
+func Transition(from string, ev Event) (string, error) {
+	if next, ok := transitions[from][ev]; ok {
+		return next, nil
+	}
+	return from, fmt.Errorf("transition %s invalide depuis le statut %q", ev, from)
+}
+
+// DunningSchedule liste les délais de relance après l'échéance d'un renouvellement
+// impayé (J+1, J+3, J+7). Au-delà, l'abonnement est suspendu.
+var DunningSchedule = []time.Duration{
+	24 * time.Hour,
+	3 * 24 * time.Hour,
+	7 * 24 * time.Hour,
+}
+
+// SuspensionGrace est la durée de suspension avant résiliation définitive.
+const SuspensionGrace = 14 * 24 * time.Hour
+
+// RenewalLead est l'avance avec laquelle la commande et la facture de
+// renouvellement sont générées avant date_fin.
+const RenewalLead = 3 * 24 * time.Hour
+
+// ExpiryNotice est l'avance avec laquelle le client est prévenu de la fin d'un
+// abonnement sans renouvellement automatique.
+const ExpiryNotice = 7 * 24 * time.Hour
+
+// NextRetry retourne la date de la prochaine tentative après `failures` échecs
+// pour une échéance `due`. ok=false quand les relances sont épuisées.
+func NextRetry(due time.Time, failures int) (time.Time, bool) {
+	if failures < 1 || failures > len(DunningSchedule) {
+		return time.Time{}, false
+	}
+	return due.Add(DunningSchedule[failures-1]), true
+}
+
+// AddPeriod avance une date d'une période de facturation (tarification.periodicite).
+// Les valeurs inconnues sont traitées comme mensuelles.
+func AddPeriod(t time.Time, periodicite string) time.Time {
+	return t.AddDate(0, periodMonths(periodicite), 0)
+}
+
+// PeriodStart retourne le début de la période qui se termine à `end`.
+func PeriodStart(end time.Time, periodicite string) time.Time {
+	return end.AddDate(0, -periodMonths(periodicite), 0)
+}
+
+// SamePeriod indique si deux libellés désignent la même période ("an" et "annuel", "mois" et "mensuel").
+func SamePeriod(a, b string) bool {
+	return periodMonths(a) == periodMonths(b)
+}
+
+func periodMonths(periodicite string) int {
+	switch strings.ToLower(strings.TrimSpace(periodicite)) {
+	case "annuel", "annuelle", "an", "year", "yearly":
+		return 12
+	case "trimestriel", "trimestrielle", "trimestre", "quarterly":
+		return 3
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,99 @@
+package billing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTransition_DunningPath(t *testing.T) {
+	statut := StatutActif
+	steps := []struct {
+		ev   Event
+		want string
+	}{
+		{EventPaymentFailed, StatutImpaye},
+		{EventPaymentFailed, StatutImpaye},
+		{EventDunningExhausted, StatutSuspendu},
+		{EventGraceExpired, StatutResilie},
+	}
+	for _, s := range steps {
+		next, err := Transition(statut, s.ev)
+		if err != nil {
+			t.Fatalf("%s from %s: unexpected error %v", s.ev, statut, err)
+		}
+		if next != s.want {
+			t.Fatalf("%s from %s: expected %s, got %s", s.ev, statut, s.want, next)
+		}
+		statut = next
+	}
+}
+
+func TestTransition_PaymentRecovers(t *testing.T) {
+	for _, from := range []string{StatutActif, StatutImpaye, StatutSuspendu} {
+		next, err := Transition(from, EventPaymentSucceeded)
+		if err != nil || next != StatutActif {
+			t.Errorf("payment from %s: expected actif, got %s (%v)", from, next, err)
+		}
+	}
+}
+
+func TestTransition_ResilieIsTerminal(t *testing.T) {
+	for _, ev := range []Event{EventPaymentSucceeded, EventPaymentFailed, EventCancelled} {
+		if next, err := Transition(StatutResilie, ev); err == nil || next != StatutResilie {
+			t.Errorf("%s from resilie: expected error and unchanged status, got %s (%v)", ev, next, err)
+		}
+	}
+}
+
+func TestTransition_TermEndedOnlyFromActif(t *testing.T) {
+	if next, _ := Transition(StatutActif, EventTermEnded); next != StatutResilie {
+		t.Errorf("expected actif to end as resilie, got %s", next)
+	}
+	if _, err := Transition(StatutImpaye, EventTermEnded); err == nil {
+		t.Error("expected term_ended to be invalid while impaye")
+	}
+}
+
+func TestNextRetry(t *testing.T) {
+	due := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	want := []time.Time{due.AddDate(0, 0, 1), due.AddDate(0, 0, 3), due.AddDate(0, 0, 7)}
+	for i, w := range want {
+		got, ok := NextRetry(due, i+1)
+		if !ok || !got.Equal(w) {
+			t.Errorf("failure %d: expected %v, got %v (ok=%v)", i+1, w, got, ok)
+		}
+	}
+	if _, ok := NextRetry(due, len(DunningSchedule)+1); ok {
+		t.Error("expected retries to be exhausted")
+	}
+}
+
+func TestAddPeriod(t *testing.T) {
+	start := time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)
+	cases := map[string]time.Time{
+		"mensuel":     start.AddDate(0, 1, 0),
+		"":            start.AddDate(0, 1, 0),
+		"Trimestriel": start.AddDate(0, 3, 0),
+		"annuel":      start.AddDate(1, 0, 0),
+	}
+	for p, want := range cases {
+		if got := AddPeriod(start, p); !got.Equal(want) {
+			t.Errorf("AddPeriod(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestSamePeriod(t *testing.T) {
+	if !SamePeriod("an", "annuel") || !SamePeriod("mois", "mensuel") || SamePeriod("trimestre", "annuel") {
+		t.Error("SamePeriod mismatch")
+	}
+}
+
+func TestTransition_SuspendedRetry(t *testing.T) {
+	if next, err := Transition(StatutSuspendu, EventDunningExhausted); err != nil || next != StatutSuspendu {
+		t.Errorf("failed retry while suspendu: expected suspendu, got %s (%v)", next, err)
+	}
+	if next, _ := Transition(StatutSuspendu, EventPaymentSucceeded); next != StatutActif {
+		t.Errorf("later payment must reactivate a suspended subscription, got %s", next)
+	}
+}
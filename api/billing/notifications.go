@@ -0,0 +1,75 @@
+package billing
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"api/config"
+	"api/notify"
+	"api/realtime"
+)
+
+// ===== NOTIFICATIONS CLIENT =====
+
+const (
+	linkInvoices      = "/mes-commandes.html"
+	linkSubscriptions = "/mes-abonnements.html"
+)
+
+// NotifyInvoice signale une nouvelle facture à l'utilisateur de la commande.
+func NotifyInvoice(userID, factureID int, montant float64) {
+	notify.SendAsync(userID, notify.TypeFacturation, notify.Payload{
+		Title:   "Nouvelle facture",
+		Message: fmt.Sprintf("La facture n°%d d'un montant de %.2f € est disponible.", factureID, montant),
+		Link:    linkInvoices,
+		Data:    map[string]interface{}{"invoiceId": factureID, "amount": montant},
+	})
+}
+
+// PublishOrderStatus pousse le nouveau statut d'une commande sur les flux temps réel de
+// son utilisateur.
+func PublishOrderStatus(userID, commandeID int, statut string) {
+	realtime.Publish(userID, realtime.EventOrderStatus, map[string]interface{}{
+		"orderId": commandeID,
+		"status":  statut,
+	})
+}
+
+// notifyCompany notifie les utilisateurs actifs d'une entreprise (abonnements).
+func notifyCompany(ctx context.Context, companyID int, typ string, p notify.Payload) {
+	rows, err := config.DB.QueryContext(ctx,
+		"SELECT id_utilisateur FROM utilisateur WHERE id_entreprise = $1 AND COALESCE(statut, 'actif') = 'actif'", companyID)
+	if err != nil {
+		log.Printf("[WARN] billing: notify company %d: %v", companyID, err)
+		return
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+	if err := notify.SendMany(ids, typ, p); err != nil {
+		log.Printf("[WARN] billing: notify company %d: %v", companyID, err)
+	}
+}
+
+// subscriptionEvent : abonnement concerné par une expiration ou une résiliation.
+type subscriptionEvent struct {
+	SubID     int
+	CompanyID int
+	Produit   string
+	DateFin   string
+}
+
+func (e subscriptionEvent) payload(title, message string) notify.Payload {
+	return notify.Payload{
+		Title:   title,
+		Message: message,
+		Link:    linkSubscriptions,
+		Data:    map[string]interface{}{"subscriptionId": e.SubID},
+	}
+}
@@ -0,0 +1,116 @@
+package billing
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"time"
+)
+
+// ============================================================
+// CHANGEMENT DE FORMULE — prorata sur la période en cours
+// ============================================================
+
+// Plan décrit une formule d'abonnement : tarification et nombre de postes.
+type Plan struct {
+	TarificationID int
+	Prix           float64 // prix unitaire par période
+	Periodicite    string
+	Quantite       int
+}
+
+// Total retourne le montant d'une période complète.
+func (p Plan) Total() float64 {
+	return roundCents(p.Prix * float64(p.Quantite))
+}
+
+// Proration est le résultat d'un changement de formule.
+type Proration struct {
+	Upgrade       bool      `json:"upgrade"`
+	EffectiveDate time.Time `json:"effectiveDate"`
+	PeriodDays    int       `json:"periodDays"`
+	RemainingDays int       `json:"remainingDays"`
+	Credit        float64   `json:"credit"`    // part non consommée de l'ancienne formule
+	Charge        float64   `json:"charge"`    // nouvelle formule sur les jours restants
+	AmountDue     float64   `json:"amountDue"` // Charge - Credit, facturé immédiatement
+}
+
+// Prorate calcule le changement de `from` vers `to` au moment `at` pour la période
+// [start, end). Une hausse du montant de période est appliquée immédiatement
+// avec prorata ; une baisse, ou un changement de périodicité, prend effet au
+// prochain renouvellement (end) sans montant dû.
+func Prorate(from, to Plan, start, end, at time.Time) Proration {
+	start, end, at = day(start), day(end), day(at)
+	if at.Before(start) {
+		at = start
+	}
+	if at.After(end) {
+		at = end
+	}
+	p := Proration{
+		PeriodDays:    days(start, end),
+		RemainingDays: days(at, end),
+	}
+
+	if !SamePeriod(from.Periodicite, to.Periodicite) || to.Total() <= from.Total() || p.RemainingDays == 0 || p.PeriodDays == 0 {
+		p.EffectiveDate = end
+		return p
+	}
+
+	ratio := float64(p.RemainingDays) / float64(p.PeriodDays)
+	p.Upgrade = true
+	p.EffectiveDate = at
+	p.Credit = roundCents(from.Total() * ratio)
+	p.Charge = roundCents(to.Total() * ratio)
+	p.AmountDue = roundCents(p.Charge - p.Credit)
+	return p
+}
+
+func day(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func days(from, to time.Time) int {
+	return int(math.Round(to.Sub(from).Hours() / 24))
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// ===== LIGNES DE FACTURE =====
+
+// Types de ligne de facture (facture_ligne.type_ligne).
+const (
+	LigneAbonnement    = "abonnement"
+	LigneProrataCredit = "prorata_credit"
+	LigneProrataDebit  = "prorata_debit"
+)
+
+// InvoiceLine est une ligne de facture_ligne.
+type InvoiceLine struct {
+	Type         string
+	Libelle      string
+	Quantite     float64
+	PrixUnitaire float64
+	Montant      float64
+	AbonnementID int
+}
+
+// AddInvoiceLines enregistre les lignes d'une facture dans la transaction courante.
+func AddInvoiceLines(ctx context.Context, tx *sql.Tx, factureID int, lines []InvoiceLine) error {
+	for _, l := range lines {
+		var subID interface{}
+		if l.AbonnementID != 0 {
+			subID = l.AbonnementID
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO facture_ligne (id_facture, type_ligne, libelle, quantite, prix_unitaire, montant, id_abonnement)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			factureID, l.Type, l.Libelle, l.Quantite, l.PrixUnitaire, l.Montant, subID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
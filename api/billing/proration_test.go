@@ -0,0 +1,78 @@
+package billing
+
+import (
+	"testing"
+	"time"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestProrate_UpgradeSeatsMidTerm(t *testing.T) {
+	from := Plan{Prix: 10, Periodicite: "mensuel", Quantite: 3}
+	to := Plan{Prix: 10, Periodicite: "mensuel", Quantite: 5}
+	// Avril : 30 jours, changement le 16 → 15 jours restants.
+	p := Prorate(from, to, date(2025, 4, 1), date(2025, 5, 1), date(2025, 4, 16))
+
+	if !p.Upgrade {
+		t.Fatal("expected an upgrade")
+	}
+	if p.PeriodDays != 30 || p.RemainingDays != 15 {
+		t.Fatalf("expected 15/30 days, got %d/%d", p.RemainingDays, p.PeriodDays)
+	}
+	if p.Credit != 15 || p.Charge != 25 || p.AmountDue != 10 {
+		t.Errorf("expected credit 15, charge 25, due 10; got %+v", p)
+	}
+	if !p.EffectiveDate.Equal(date(2025, 4, 16)) {
+		t.Errorf("expected immediate effect, got %v", p.EffectiveDate)
+	}
+}
+
+func TestProrate_DowngradeDeferredToRenewal(t *testing.T) {
+	from := Plan{Prix: 10, Periodicite: "mensuel", Quantite: 5}
+	to := Plan{Prix: 10, Periodicite: "mensuel", Quantite: 2}
+	end := date(2025, 5, 1)
+	p := Prorate(from, to, date(2025, 4, 1), end, date(2025, 4, 10))
+
+	if p.Upgrade || p.AmountDue != 0 || p.Credit != 0 {
+		t.Errorf("expected deferred downgrade with nothing due, got %+v", p)
+	}
+	if !p.EffectiveDate.Equal(end) {
+		t.Errorf("expected effect at renewal %v, got %v", end, p.EffectiveDate)
+	}
+}
+
+func TestProrate_PeriodicityChangeDeferred(t *testing.T) {
+	from := Plan{Prix: 10, Periodicite: "mensuel", Quantite: 1}
+	to := Plan{Prix: 100, Periodicite: "annuel", Quantite: 1}
+	p := Prorate(from, to, date(2025, 4, 1), date(2025, 5, 1), date(2025, 4, 10))
+	if p.Upgrade {
+		t.Errorf("expected periodicity change to wait for renewal, got %+v", p)
+	}
+}
+
+func TestProrate_EquivalentPeriodLabels(t *testing.T) {
+	from := Plan{Prix: 10, Periodicite: "mois", Quantite: 3}
+	to := Plan{Prix: 10, Periodicite: "mensuel", Quantite: 5}
+	p := Prorate(from, to, date(2025, 4, 1), date(2025, 5, 1), date(2025, 4, 16))
+	if !p.Upgrade || p.AmountDue != 10 {
+		t.Errorf("\"mois\" and \"mensuel\" are the same period, got %+v", p)
+	}
+}
+
+func TestProrate_RoundsToCents(t *testing.T) {
+	from := Plan{Prix: 9.99, Periodicite: "mensuel", Quantite: 1}
+	to := Plan{Prix: 19.99, Periodicite: "mensuel", Quantite: 1}
+	p := Prorate(from, to, date(2025, 1, 1), date(2025, 2, 1), date(2025, 1, 21))
+	// 11 jours restants sur 31.
+	if p.Credit != 3.54 || p.Charge != 7.09 || p.AmountDue != 3.55 {
+		t.Errorf("unexpected rounding: %+v", p)
+	}
+}
+
+func TestPeriodStart(t *testing.T) {
+	if got := PeriodStart(date(2025, 5, 1), "trimestriel"); !got.Equal(date(2025, 2, 1)) {
+		t.Errorf("expected 2025-02-01, got %v", got)
+	}
+}
@@ -0,0 +1,84 @@
+package billing
+
+// ============================================================
+// DEVIS — totaux et cycle de vie
+// demande → brouillon → envoye → accepte | refuse | expire ; annule
+// ============================================================
+
+const (
+	DevisDemande   = "demande"
+	DevisBrouillon = "brouillon"
+	DevisEnvoye    = "envoye"
+	DevisAccepte   = "accepte"
+	DevisRefuse    = "refuse"
+	DevisExpire    = "expire"
+	DevisAnnule    = "annule"
+
+	LigneFrais  = "frais"
+	LigneRemise = "remise"
+)
+
+var devisTransitions = map[string][]string{
+	DevisDemande:   {DevisBrouillon, DevisAnnule},
+	DevisBrouillon: {DevisBrouillon, DevisEnvoye, DevisAnnule},
+	DevisEnvoye:    {DevisBrouillon, DevisAccepte, DevisRefuse, DevisExpire, DevisAnnule},
+}
+
+// CanTransitionDevis indique si un devis peut passer de `from` à `to`.
+// Modifier un devis envoyé le repasse en brouillon (il doit être renvoyé).
+func CanTransitionDevis(from, to string) bool {
+	for _, s := range devisTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// QuoteLine est une ligne de devis : récurrente (facturée à chaque période) ou ponctuelle.
+type QuoteLine struct {
+	Quantite     float64
+	PrixUnitaire float64
+	Recurrent    bool
+}
+
+// Total retourne le montant de la ligne, arrondi au centime.
+func (l QuoteLine) Total() float64 {
+	return roundCents(l.Quantite * l.PrixUnitaire)
+}
+
+// QuoteTotals récapitule un devis. La remise s'applique à toutes les lignes.
+type QuoteTotals struct {
+	SousTotal float64 `json:"subtotal"`
+	Remise    float64 `json:"discount"`
+	Total     float64 `json:"total"`     // première facture (période 1 + frais ponctuels)
+	Recurrent float64 `json:"recurring"` // montant de chaque renouvellement, remise déduite
+	Ponctuel  float64 `json:"oneTime"`
+}
+
+func ComputeQuote(lines []QuoteLine, remisePct float64) QuoteTotals {
+	if remisePct < 0 {
+		remisePct = 0
+	}
+	if remisePct > 100 {
+		remisePct = 100
+	}
+	var recurrent, ponctuel float64
+	for _, l := range lines {
+		amount := l.Total()
+		if l.Recurrent {
+			recurrent += amount
+		} else {
+			ponctuel += amount
+		}
+	}
+	factor := 1 - remisePct/100
+	t := QuoteTotals{
+		SousTotal: roundCents(recurrent + ponctuel),
+		Recurrent: roundCents(recurrent * factor),
+		Ponctuel:  roundCents(ponctuel * factor),
+	}
+	t.Total = roundCents(t.Recurrent + t.Ponctuel)
+	t.Remise = roundCents(t.SousTotal - t.Total)
+	return t
+}
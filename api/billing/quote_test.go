@@ -0,0 +1,61 @@
+package billing
+
+import "testing"
+
+func TestComputeQuote(t *testing.T) {
+	lines := []QuoteLine{
+		{Quantite: 10, PrixUnitaire: 49.9, Recurrent: true}, // 499
+		{Quantite: 1, PrixUnitaire: 1500, Recurrent: false}, // frais de mise en service
+	}
+	got := ComputeQuote(lines, 10)
+	want := QuoteTotals{SousTotal: 1999, Recurrent: 449.1, Ponctuel: 1350, Total: 1799.1, Remise: 199.9}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestQuoteLineTotal_RoundsToCents(t *testing.T) {
+	if got := (QuoteLine{Quantite: 3, PrixUnitaire: 19.99}).Total(); got != 59.97 {
+		t.Errorf("3 x 19.99 = %v, want 59.97", got)
+	}
+	if got := (QuoteLine{Quantite: 7, PrixUnitaire: 0.1}).Total(); got != 0.7 {
+		t.Errorf("7 x 0.10 = %v, want 0.7", got)
+	}
+}
+
+func TestComputeQuote_ClampsDiscount(t *testing.T) {
+	lines := []QuoteLine{{Quantite: 1, PrixUnitaire: 100, Recurrent: true}}
+	if got := ComputeQuote(lines, -5); got.Total != 100 {
+		t.Errorf("negative discount should be ignored, got %+v", got)
+	}
+	if got := ComputeQuote(lines, 150); got.Total != 0 || got.Remise != 100 {
+		t.Errorf("discount should be capped at 100%%, got %+v", got)
+	}
+}
+
+func TestCanTransitionDevis(t *testing.T) {
+	allowed := [][2]string{
+		{DevisDemande, DevisBrouillon},
+		{DevisBrouillon, DevisEnvoye},
+		{DevisEnvoye, DevisAccepte},
+		{DevisEnvoye, DevisBrouillon},
+		{DevisEnvoye, DevisExpire},
+	}
+	for _, c := range allowed {
+		if !CanTransitionDevis(c[0], c[1]) {
+			t.Errorf("expected %s → %s to be allowed", c[0], c[1])
+		}
+	}
+	denied := [][2]string{
+		{DevisDemande, DevisAccepte},
+		{DevisBrouillon, DevisAccepte},
+		{DevisAccepte, DevisBrouillon},
+		{DevisExpire, DevisAccepte},
+		{DevisRefuse, DevisEnvoye},
+	}
+	for _, c := range denied {
+		if CanTransitionDevis(c[0], c[1]) {
+			t.Errorf("expected %s → %s to be denied", c[0], c[1])
+		}
+	}
+}
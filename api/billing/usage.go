@@ -0,0 +1,123 @@
+package billing
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// USAGE — facturation à l'usage (tarification.unite / prix_usage)
+// ============================================================
+
+const (
+	AgregationSomme = "sum" // volumes consommés (Go ingérés…)
+	AgregationMax   = "max" // jauges (endpoints surveillés, postes…)
+
+	LigneUsage = "usage"
+)
+
+// MaxUsageLead limite l'avance acceptée sur l'horodatage d'un événement (horloge des agents).
+const MaxUsageLead = 5 * time.Minute
+
+// UsagePeriod retourne la période de facturation à laquelle rattacher un événement
+// horodaté `ts` pour un abonnement [dateDebut, dateFin). Sont acceptées la période
+// en cours et la suivante (abonnement en attente de renouvellement) ; ok=false sinon.
+// Les périodes sont identifiées par leur date de fin, qui coïncide toujours avec une date_fin d'abonnement.
+func UsagePeriod(dateDebut, dateFin time.Time, periodicite string, ts time.Time) (start, end time.Time, ok bool) {
+	start = PeriodStart(dateFin, periodicite)
+	// Première période plus longue qu'une période nominale (ex. CURRENT_DATE+30 sur un mois court).
+	if dateDebut.Before(start) && dateDebut.After(PeriodStart(start, periodicite)) {
+		start = dateDebut
+	}
+	switch {
+	case !ts.Before(start) && ts.Before(dateFin):
+		return start, dateFin, true
+	case !ts.Before(dateFin) && ts.Before(AddPeriod(dateFin, periodicite)):
+		return dateFin, AddPeriod(dateFin, periodicite), true
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// UsageQuantity retourne la quantité facturable d'une période agrégée.
+func UsageQuantity(agregation string, total, maximum float64) float64 {
+	if strings.EqualFold(agregation, AgregationMax) {
+		return maximum
+	}
+	return total
+}
+
+// UsageAmount retourne le montant d'une quantité consommée au prix unitaire d'usage.
+func UsageAmount(quantity, prixUsage float64) float64 {
+	return roundCents(quantity * prixUsage)
+}
+
+// NormalizeMetric uniformise le nom d'une métrique (comparée à tarification.unite).
+func NormalizeMetric(m string) string {
+	return strings.ToLower(strings.TrimSpace(m))
+}
+
+// addUsageLine ajoute à la facture de renouvellement la ligne d'usage de la période
+// qui s'achève (periode_fin = début du renouvellement) et clôture cette période.
+// Retourne le montant ajouté.
+func addUsageLine(ctx context.Context, tx *sql.Tx, d *dueRenewal) (float64, error) {
+	var usageID int
+	var metrique, agregation string
+	var total, maximum, prixUsage float64
+	var periodeDebut time.Time
+	err := tx.QueryRowContext(ctx, `
+		SELECT u.id_usage_periode, u.metrique, u.periode_debut, u.total, u.maximum,
+		       COALESCE(t.agregation, 'sum'), COALESCE(t.prix_usage, 0)
+		FROM usage_periode u
+		JOIN abonnement a ON a.id_abonnement = u.id_abonnement
+		JOIN tarification t ON t.id_tarification = a.id_tarification
+		WHERE u.id_abonnement = $1 AND u.periode_fin = $2 AND u.statut = 'ouvert'
+		  AND u.metrique = LOWER(TRIM(COALESCE(t.unite, '')))
+		FOR UPDATE OF u`, d.SubID, d.PeriodeDebut).Scan(
+		&usageID, &metrique, &periodeDebut, &total, &maximum, &agregation, &prixUsage)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	qty := UsageQuantity(agregation, total, maximum)
+	amount := UsageAmount(qty, prixUsage)
+
+	var factureID int
+	if err := tx.QueryRowContext(ctx, "SELECT id_facture FROM facture WHERE id_commande = $1", d.CommandeID).Scan(&factureID); err != nil {
+		return 0, err
+	}
+	if amount > 0 {
+		line := InvoiceLine{
+			Type:         LigneUsage,
+			Libelle:      fmt.Sprintf("Usage %s — du %s au %s", metrique, periodeDebut.Format("02/01/2006"), d.PeriodeDebut.Format("02/01/2006")),
+			Quantite:     math.Round(qty*1000) / 1000,
+			PrixUnitaire: prixUsage,
+			Montant:      amount,
+			AbonnementID: d.SubID,
+		}
+		if err := AddInvoiceLines(ctx, tx, factureID, []InvoiceLine{line}); err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE facture SET montant = montant + $1 WHERE id_facture = $2", amount, factureID); err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE commande SET montant_total = montant_total + $1 WHERE id_commande = $2", amount, d.CommandeID); err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE abonnement_renouvellement SET montant = montant + $1 WHERE id_renouvellement = $2", amount, d.ID); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE usage_periode SET statut = 'facture', id_facture = $1 WHERE id_usage_periode = $2",
+		factureID, usageID); err != nil {
+		return 0, err
+	}
+	return amount, nil
+}
@@ -0,0 +1,55 @@
+package billing
+
+import "testing"
+
+func TestUsagePeriod_CurrentAndNext(t *testing.T) {
+	debut, fin := date(2025, 3, 1), date(2025, 5, 1)
+
+	start, end, ok := UsagePeriod(debut, fin, "mensuel", date(2025, 4, 20))
+	if !ok || !start.Equal(date(2025, 4, 1)) || !end.Equal(fin) {
+		t.Errorf("expected current period [04-01, 05-01), got [%v, %v) ok=%v", start, end, ok)
+	}
+
+	start, end, ok = UsagePeriod(debut, fin, "mensuel", date(2025, 5, 2))
+	if !ok || !start.Equal(fin) || !end.Equal(date(2025, 6, 1)) {
+		t.Errorf("expected next period [05-01, 06-01), got [%v, %v) ok=%v", start, end, ok)
+	}
+}
+
+func TestUsagePeriod_RejectsClosedAndFarFuture(t *testing.T) {
+	debut, fin := date(2025, 3, 1), date(2025, 5, 1)
+	if _, _, ok := UsagePeriod(debut, fin, "mensuel", date(2025, 3, 31)); ok {
+		t.Error("expected previous period to be rejected")
+	}
+	if _, _, ok := UsagePeriod(debut, fin, "mensuel", date(2025, 6, 1)); ok {
+		t.Error("expected events two periods ahead to be rejected")
+	}
+}
+
+func TestUsagePeriod_LongFirstPeriod(t *testing.T) {
+	// Abonnement créé le 30/01 avec date_fin = +30 jours (01/03) : la première
+	// période commence à date_debut et non au 01/02.
+	debut, fin := date(2025, 1, 30), date(2025, 3, 1)
+	start, _, ok := UsagePeriod(debut, fin, "mensuel", date(2025, 1, 31))
+	if !ok || !start.Equal(debut) {
+		t.Errorf("expected first period to start at date_debut, got %v ok=%v", start, ok)
+	}
+}
+
+func TestUsageQuantityAndAmount(t *testing.T) {
+	if q := UsageQuantity("sum", 42.5, 10); q != 42.5 {
+		t.Errorf("sum: expected 42.5, got %v", q)
+	}
+	if q := UsageQuantity("MAX", 42.5, 10); q != 10 {
+		t.Errorf("max: expected 10, got %v", q)
+	}
+	if a := UsageAmount(42.5, 0.333); a != 14.15 {
+		t.Errorf("expected 14.15, got %v", a)
+	}
+}
+
+func TestNormalizeMetric(t *testing.T) {
+	if got := NormalizeMetric("  Endpoints "); got != "endpoints" {
+		t.Errorf("got %q", got)
+	}
+}
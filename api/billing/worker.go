@@ -0,0 +1,737 @@
+package billing
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"api/config"
+	"api/mailer"
+	"api/models"
+	"api/notify"
+	"api/payments"
+)
+
+// workerLockID est la clé pg_advisory_lock partagée par toutes les réplicas :
+// un seul worker de facturation s'exécute à la fois.
+const workerLockID int64 = 0x0C1A_B111
+
+// Provider est le fournisseur utilisé pour débiter les renouvellements.
+// nil = payments.Default(), résolu à chaque passage (l'environnement est chargé après l'init des paquets).
+var Provider payments.Provider
+
+func provider() payments.Provider {
+	if Provider != nil {
+		return Provider
+	}
+	return payments.Default()
+}
+
+// InitWorker démarre le worker de facturation (intervalle BILLING_WORKER_INTERVAL_MINUTES, 60 par défaut).
+func InitWorker() {
+	minutes := 60
+	if m, err := strconv.Atoi(os.Getenv("BILLING_WORKER_INTERVAL_MINUTES")); err == nil && m > 0 {
+		minutes = m
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(minutes) * time.Minute)
+		defer ticker.Stop()
+		for {
+			if err := RunOnce(context.Background()); err != nil {
+				log.Printf("[WARN] billing worker: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+	log.Printf("[INFO] Billing worker ready (interval: %d minutes)", minutes)
+}
+
+// RunOnce exécute un passage complet : génération des renouvellements, débits,
+// relances et expirations. Sans effet si une autre réplica détient le verrou.
+func RunOnce(ctx context.Context) error {
+	if config.DB == nil {
+		return errors.New("db not initialized")
+	}
+	conn, err := config.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", workerLockID).Scan(&locked); err != nil {
+		return err
+	}
+	if !locked {
+		return nil
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", workerLockID)
+
+	now := time.Now()
+	generateRenewals(ctx, now)
+	chargeDueRenewals(ctx, now)
+	warnExpiring(ctx, now)
+	expireNonRenewing(ctx)
+	terminateSuspended(ctx, now)
+	expireQuotes(ctx)
+	return nil
+}
+
+// ===== 1. GÉNÉRATION DES RENOUVELLEMENTS =====
+
+// generateRenewals crée commande + facture + abonnement_renouvellement pour chaque
+// abonnement actif à renouvellement automatique arrivant à échéance.
+func generateRenewals(ctx context.Context, now time.Time) {
+	rows, err := config.DB.QueryContext(ctx, `
+		SELECT a.id_abonnement
+		FROM abonnement a
+		WHERE a.statut = 'actif' AND a.renouvellement_auto = TRUE
+		  AND a.date_fin IS NOT NULL AND a.date_fin <= $1::date
+		  AND NOT EXISTS (SELECT 1 FROM abonnement_renouvellement r
+		                  WHERE r.id_abonnement = a.id_abonnement AND r.periode_debut = a.date_fin)`,
+		now.Add(RenewalLead))
+	if err != nil {
+		log.Printf("[WARN] billing: renewal scan: %v", err)
+		return
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := generateRenewal(ctx, id); err != nil {
+			log.Printf("[WARN] billing: renewal abonnement %d: %v", id, err)
+		}
+	}
+}
+
+func generateRenewal(ctx context.Context, subID int) error {
+	tx, err := config.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Les changements de formule différés (quantite_prochaine, id_tarification_prochaine)
+	// s'appliquent à la nouvelle période.
+	var dateFin time.Time
+	var quantite, tarifID, companyID int
+	var prix float64
+	var periodicite, produit string
+	err = tx.QueryRowContext(ctx, `
+		SELECT a.date_fin, COALESCE(a.quantite_prochaine, a.quantite, 1), t.id_tarification, a.id_entreprise,
+		       COALESCE(t.prix, 0), COALESCE(t.periodicite, 'mensuel'), COALESCE(p.nom, '')
+		FROM abonnement a
+		JOIN tarification t ON t.id_tarification = COALESCE(a.id_tarification_prochaine, a.id_tarification)
+		LEFT JOIN produits p ON p.id_produit = a.id_produit
+		WHERE a.id_abonnement = $1 AND a.statut = 'actif' AND a.renouvellement_auto = TRUE
+		FOR UPDATE OF a SKIP LOCKED`, subID).Scan(&dateFin, &quantite, &tarifID, &companyID, &prix, &periodicite, &produit)
+	if err == sql.ErrNoRows {
+		return nil // traité par une autre réplica ou modifié entre-temps
+	}
+	if err != nil {
+		return err
+	}
+
+	var userID int
+	if err := tx.QueryRowContext(ctx,
+		"SELECT id_utilisateur FROM utilisateur WHERE id_entreprise = $1 ORDER BY id_utilisateur ASC LIMIT 1",
+		companyID).Scan(&userID); err != nil {
+		return fmt.Errorf("aucun utilisateur pour l'entreprise %d", companyID)
+	}
+
+	montant := Plan{Prix: prix, Quantite: quantite}.Total()
+	periodeFin := AddPeriod(dateFin, periodicite)
+	items := renewalItems(produit, prix, quantite, periodicite)
+
+	var commandeID int
+	if err := tx.QueryRowContext(ctx,
+		"INSERT INTO commande (montant_total, statut, items, id_utilisateur) VALUES ($1, 'attente', $2, $3) RETURNING id_commande",
+		montant, items, userID).Scan(&commandeID); err != nil {
+		return err
+	}
+	var factureID int
+	if err := tx.QueryRowContext(ctx,
+		"INSERT INTO facture (date_facture, montant, id_commande) VALUES (CURRENT_DATE, $1, $2) RETURNING id_facture",
+		montant, commandeID).Scan(&factureID); err != nil {
+		return err
+	}
+	if err := AddInvoiceLines(ctx, tx, factureID, []InvoiceLine{
+		renewalLine(subID, produit, dateFin, periodeFin, quantite, prix),
+	}); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO abonnement_renouvellement
+		    (id_abonnement, periode_debut, periode_fin, montant, quantite, id_tarification, id_commande, prochaine_tentative)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $2)
+		ON CONFLICT (id_abonnement, periode_debut) DO NOTHING`,
+		subID, dateFin, periodeFin, montant, quantite, tarifID, commandeID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil // déjà généré : rollback de la commande en double
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	NotifyInvoice(userID, factureID, montant)
+	return nil
+}
+
+func renewalItems(produit string, prix float64, quantite int, periodicite string) string {
+	items, _ := json.Marshal([]models.OrderItem{{
+		ProductName: produit, Price: prix, Quantity: quantite, Duration: periodicite,
+	}})
+	return string(items)
+}
+
+func renewalLine(subID int, produit string, debut, fin time.Time, quantite int, prix float64) InvoiceLine {
+	return InvoiceLine{
+		Type:         LigneAbonnement,
+		Libelle:      fmt.Sprintf("%s — du %s au %s", produit, debut.Format("02/01/2006"), fin.Format("02/01/2006")),
+		Quantite:     float64(quantite),
+		PrixUnitaire: prix,
+		Montant:      Plan{Prix: prix, Quantite: quantite}.Total(),
+		AbonnementID: subID,
+	}
+}
+
+// RefreshPendingRenewal recalcule un renouvellement déjà généré mais pas encore
+// débité après un changement de formule (commande, facture et lignes comprises).
+func RefreshPendingRenewal(ctx context.Context, tx *sql.Tx, subID int) error {
+	var renewalID, commandeID, quantite, tarifID int
+	var debut time.Time
+	var prix float64
+	var periodicite, produit string
+	err := tx.QueryRowContext(ctx, `
+		SELECT r.id_renouvellement, r.id_commande, r.periode_debut,
+		       COALESCE(a.quantite_prochaine, a.quantite, 1), t.id_tarification,
+		       COALESCE(t.prix, 0), COALESCE(t.periodicite, 'mensuel'), COALESCE(p.nom, '')
+		FROM abonnement_renouvellement r
+		JOIN abonnement a ON a.id_abonnement = r.id_abonnement
+		JOIN tarification t ON t.id_tarification = COALESCE(a.id_tarification_prochaine, a.id_tarification)
+		LEFT JOIN produits p ON p.id_produit = a.id_produit
+		WHERE r.id_abonnement = $1 AND r.statut = 'attente' AND r.tentatives = 0
+		  AND r.periode_debut = a.date_fin
+		FOR UPDATE OF r`, subID).Scan(&renewalID, &commandeID, &debut, &quantite, &tarifID, &prix, &periodicite, &produit)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fin := AddPeriod(debut, periodicite)
+	line := renewalLine(subID, produit, debut, fin, quantite, prix)
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE abonnement_renouvellement SET montant = $1, quantite = $2, id_tarification = $3, periode_fin = $4 WHERE id_renouvellement = $5",
+		line.Montant, quantite, tarifID, fin, renewalID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE commande SET montant_total = $1, items = $2 WHERE id_commande = $3",
+		line.Montant, renewalItems(produit, prix, quantite, periodicite), commandeID); err != nil {
+		return err
+	}
+	var factureID int
+	if err := tx.QueryRowContext(ctx, "UPDATE facture SET montant = $1 WHERE id_commande = $2 RETURNING id_facture",
+		line.Montant, commandeID).Scan(&factureID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM facture_ligne WHERE id_facture = $1 AND type_ligne = $2", factureID, LigneAbonnement); err != nil {
+		return err
+	}
+	return AddInvoiceLines(ctx, tx, factureID, []InvoiceLine{line})
+}
+
+// ===== 2. DÉBITS ET RELANCES =====
+
+// claimTimeout : au-delà, un débit réservé dont le résultat n'a pas été enregistré
+// (réplica arrêtée pendant l'appel au fournisseur) est repris avec la même clé d'idempotence.
+const claimTimeout = 15 * time.Minute
+
+func chargeDueRenewals(ctx context.Context, now time.Time) {
+	rows, err := config.DB.QueryContext(ctx, `
+		SELECT id_renouvellement FROM abonnement_renouvellement
+		WHERE (statut = 'attente' AND prochaine_tentative <= $1)
+		   OR (statut = 'en_cours' AND date_reservation < $2)
+		ORDER BY prochaine_tentative ASC`, now, now.Add(-claimTimeout))
+	if err != nil {
+		log.Printf("[WARN] billing: charge scan: %v", err)
+		return
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := chargeRenewal(ctx, id, now); err != nil {
+			if errors.Is(err, payments.ErrNotConfigured) {
+				log.Printf("[WARN] billing: payment provider not configured, %d renewals pending", len(ids))
+				return
+			}
+			log.Printf("[WARN] billing: renouvellement %d: %v", id, err)
+		}
+	}
+}
+
+type dueRenewal struct {
+	ID           int
+	SubID        int
+	CommandeID   int
+	UserID       int
+	Montant      float64
+	PeriodeDebut time.Time
+	PeriodeFin   time.Time
+	Tentatives   int
+	Quantite     int
+	TarifID      int
+	SubStatut    string
+	AutoRenew    bool
+	CustomerID   string
+	Email        string
+	Produit      string
+}
+
+// chargeRenewal réserve l'échéance, débite le client hors transaction puis enregistre
+// le résultat. Seul un refus du fournisseur compte comme une tentative de relance :
+// les autres erreurs (réseau, 5xx, fournisseur non configuré) laissent l'échéance en
+// attente pour le passage suivant.
+func chargeRenewal(ctx context.Context, renewalID int, now time.Time) error {
+	d, ok, err := claimRenewal(ctx, renewalID, now)
+	if err != nil || !ok {
+		return err
+	}
+
+	var chargeID string
+	if d.CustomerID == "" {
+		err = &payments.DeclinedError{Message: "aucun moyen de paiement enregistré"}
+	} else {
+		chargeID, err = provider().Charge(payments.ChargeRequest{
+			AmountCents:    payments.ToCents(d.Montant),
+			Currency:       "eur",
+			Customer:       d.CustomerID,
+			Description:    fmt.Sprintf("Renouvellement abonnement CYNA #%d", d.SubID),
+			IdempotencyKey: fmt.Sprintf("cyna-renouvellement-%d-%d", d.ID, d.Tentatives),
+		})
+	}
+	switch {
+	case err == nil:
+		return recordSuccess(ctx, d, chargeID)
+	case declined(err):
+		return recordFailure(ctx, d, now, err)
+	default:
+		if rerr := releaseClaim(ctx, d, err); rerr != nil {
+			log.Printf("[WARN] billing: release renouvellement %d: %v", d.ID, rerr)
+		}
+		return err
+	}
+}
+
+// declined indique un refus de paiement, compté comme une tentative de relance.
+func declined(err error) bool {
+	var de *payments.DeclinedError
+	return errors.As(err, &de)
+}
+
+// claimRenewal verrouille l'échéance, ajoute l'usage de la période écoulée puis la
+// passe en_cours et valide : aucun verrou n'est tenu pendant l'appel au fournisseur.
+// ok=false si l'échéance est déjà traitée ou annulée.
+func claimRenewal(ctx context.Context, renewalID int, now time.Time) (dueRenewal, bool, error) {
+	var d dueRenewal
+	tx, err := config.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return d, false, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		SELECT r.id_renouvellement, r.id_abonnement, r.id_commande, c.id_utilisateur, r.montant,
+		       r.periode_debut, r.periode_fin, r.tentatives,
+		       COALESCE(r.quantite, a.quantite, 1), COALESCE(r.id_tarification, a.id_tarification),
+		       COALESCE(a.statut, ''), COALESCE(a.renouvellement_auto, FALSE),
+		       COALESCE(e.stripe_customer_id, ''), COALESCE(u.email, ''), COALESCE(p.nom, '')
+		FROM abonnement_renouvellement r
+		JOIN abonnement a ON a.id_abonnement = r.id_abonnement
+		JOIN entreprise e ON e.id_entreprise = a.id_entreprise
+		JOIN commande c ON c.id_commande = r.id_commande
+		JOIN utilisateur u ON u.id_utilisateur = c.id_utilisateur
+		LEFT JOIN produits p ON p.id_produit = a.id_produit
+		WHERE r.id_renouvellement = $1
+		  AND (r.statut = 'attente' OR (r.statut = 'en_cours' AND r.date_reservation < $2))
+		FOR UPDATE OF r, a SKIP LOCKED`, renewalID, now.Add(-claimTimeout)).Scan(
+		&d.ID, &d.SubID, &d.CommandeID, &d.UserID, &d.Montant, &d.PeriodeDebut, &d.PeriodeFin, &d.Tentatives, &d.Quantite, &d.TarifID,
+		&d.SubStatut, &d.AutoRenew, &d.CustomerID, &d.Email, &d.Produit)
+	if err == sql.ErrNoRows {
+		return d, false, nil
+	}
+	if err != nil {
+		return d, false, err
+	}
+
+	// Résilié ou renouvellement désactivé depuis la génération : on annule l'échéance.
+	if d.SubStatut == StatutResilie || !d.AutoRenew {
+		tx.ExecContext(ctx, "UPDATE abonnement_renouvellement SET statut = 'annule', date_reservation = NULL WHERE id_renouvellement = $1", d.ID)
+		tx.ExecContext(ctx, "UPDATE commande SET statut = 'echec' WHERE id_commande = $1", d.CommandeID)
+		// Période déjà impayée et non renouvelée : l'abonnement prend fin.
+		if d.SubStatut == StatutImpaye || d.SubStatut == StatutSuspendu {
+			tx.ExecContext(ctx, "UPDATE abonnement SET statut = $1, date_statut = NOW() WHERE id_abonnement = $2", StatutResilie, d.SubID)
+		}
+		if err := tx.Commit(); err != nil {
+			return d, false, err
+		}
+		PublishOrderStatus(d.UserID, d.CommandeID, "echec")
+		return d, false, nil
+	}
+
+	// Usage de la période écoulée, facturé à terme échu sur la facture de renouvellement.
+	usage, err := addUsageLine(ctx, tx, &d)
+	if err != nil {
+		return d, false, err
+	}
+	d.Montant = roundCents(d.Montant + usage)
+
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE abonnement_renouvellement SET statut = 'en_cours', date_reservation = NOW() WHERE id_renouvellement = $1",
+		d.ID); err != nil {
+		return d, false, err
+	}
+	return d, true, tx.Commit()
+}
+
+// releaseClaim remet en attente une échéance dont le débit n'a pas abouti sans refus
+// du fournisseur, sans compter de tentative.
+func releaseClaim(ctx context.Context, d dueRenewal, cause error) error {
+	_, err := config.DB.ExecContext(ctx, `
+		UPDATE abonnement_renouvellement SET statut = 'attente', date_reservation = NULL, derniere_erreur = $1
+		WHERE id_renouvellement = $2 AND statut = 'en_cours'`, cause.Error(), d.ID)
+	return err
+}
+
+// lockClaimed ouvre la transaction d'enregistrement du résultat : l'échéance doit être
+// toujours en_cours, et le statut de l'abonnement est relu (il a pu changer pendant le débit).
+func lockClaimed(ctx context.Context, d *dueRenewal) (*sql.Tx, bool, error) {
+	tx, err := config.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	err = tx.QueryRowContext(ctx, `
+		SELECT COALESCE(a.statut, '')
+		FROM abonnement_renouvellement r
+		JOIN abonnement a ON a.id_abonnement = r.id_abonnement
+		WHERE r.id_renouvellement = $1 AND r.statut = 'en_cours'
+		FOR UPDATE OF r, a`, d.ID).Scan(&d.SubStatut)
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return tx, true, nil
+}
+
+func recordSuccess(ctx context.Context, d dueRenewal, chargeID string) error {
+	tx, ok, err := lockClaimed(ctx, &d)
+	if err != nil || !ok {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO paiement (moyen, statut, date_paiement, reference_externe, id_commande) VALUES ('CB', 'success', NOW(), $1, $2)",
+		chargeID, d.CommandeID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE commande SET statut = 'paye' WHERE id_commande = $1", d.CommandeID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE abonnement_renouvellement SET statut = 'paye', tentatives = tentatives + 1, prochaine_tentative = NULL, derniere_erreur = NULL, date_reservation = NULL WHERE id_renouvellement = $1",
+		d.ID); err != nil {
+		return err
+	}
+	// Un paiement réussi réactive l'abonnement impayé ou suspendu. Résilié pendant le
+	// débit : le paiement reste enregistré, l'abonnement n'est pas prolongé.
+	statut, err := Transition(d.SubStatut, EventPaymentSucceeded)
+	if err != nil {
+		log.Printf("[WARN] billing: abonnement %d payé mais non prolongé : %v", d.SubID, err)
+		return tx.Commit()
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE abonnement SET date_fin = $1, statut = $2,
+		       date_statut = CASE WHEN statut = $2 THEN date_statut ELSE NOW() END,
+		       quantite = $3, id_tarification = $4,
+		       quantite_prochaine = NULL, id_tarification_prochaine = NULL
+		WHERE id_abonnement = $5`, d.PeriodeFin, statut, d.Quantite, d.TarifID, d.SubID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("[INFO] billing: abonnement %d renouvelé jusqu'au %s (%s)", d.SubID, d.PeriodeFin.Format("2006-01-02"), chargeID)
+	PublishOrderStatus(d.UserID, d.CommandeID, "paye")
+	emailCustomer(d.Email, "Votre abonnement CYNA a été renouvelé", fmt.Sprintf(
+		`<p>Le paiement de <strong>%.2f €</strong> pour <strong>%s</strong> a bien été reçu.</p>
+		<p>Votre abonnement est prolongé jusqu'au <strong>%s</strong>.</p>`,
+		d.Montant, d.Produit, d.PeriodeFin.Format("02/01/2006")))
+	notify.SendAsync(d.UserID, notify.TypeAbonnement, d.payload("Abonnement renouvelé", fmt.Sprintf(
+		"Votre abonnement %s est prolongé jusqu'au %s.", d.Produit, d.PeriodeFin.Format("02/01/2006"))))
+	return nil
+}
+
+func recordFailure(ctx context.Context, d dueRenewal, now time.Time, cause error) error {
+	tx, ok, err := lockClaimed(ctx, &d)
+	if err != nil || !ok {
+		return err
+	}
+	defer tx.Rollback()
+
+	failures := d.Tentatives + 1
+	next, retry := NextRetry(d.PeriodeDebut, failures)
+	// Nouvelle tentative d'un abonnement déjà suspendu (RetrySuspended) : pas de relance.
+	wasSuspended := d.SubStatut == StatutSuspendu
+	if wasSuspended {
+		retry = false
+	}
+
+	ev := EventPaymentFailed
+	if !retry {
+		ev = EventDunningExhausted
+	}
+	statut, err := Transition(d.SubStatut, ev)
+	if err != nil {
+		return err
+	}
+
+	if retry {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE abonnement_renouvellement SET statut = 'attente', tentatives = $1, prochaine_tentative = $2, derniere_erreur = $3, date_reservation = NULL WHERE id_renouvellement = $4",
+			failures, next, cause.Error(), d.ID); err != nil {
+			return err
+		}
+	} else {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE abonnement_renouvellement SET statut = 'echec', tentatives = $1, prochaine_tentative = NULL, derniere_erreur = $2, date_reservation = NULL WHERE id_renouvellement = $3",
+			failures, cause.Error(), d.ID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE commande SET statut = 'echec' WHERE id_commande = $1", d.CommandeID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE abonnement SET statut = $1,
+		       date_statut = CASE WHEN statut = $1 THEN date_statut ELSE NOW() END
+		WHERE id_abonnement = $2`, statut, d.SubID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] billing: échec paiement abonnement %d (tentative %d) : %v", d.SubID, failures, cause)
+	if !retry {
+		PublishOrderStatus(d.UserID, d.CommandeID, "echec")
+	}
+	switch {
+	case retry:
+		emailCustomer(d.Email, "Échec du paiement de votre abonnement CYNA", fmt.Sprintf(
+			`<p>Le paiement de <strong>%.2f €</strong> pour <strong>%s</strong> n'a pas pu être effectué.</p>
+			<p>Nous réessaierons automatiquement le <strong>%s</strong>. Pensez à mettre à jour votre moyen de paiement
+			pour éviter la suspension de votre service.</p>`,
+			d.Montant, d.Produit, next.Format("02/01/2006")))
+		p := d.payload("Échec du paiement", fmt.Sprintf(
+			"Le paiement de %.2f € pour %s a échoué. Nouvelle tentative le %s.",
+			d.Montant, d.Produit, next.Format("02/01/2006")))
+		p.Urgent = true
+		notify.SendAsync(d.UserID, notify.TypeFacturation, p)
+	case wasSuspended:
+		emailCustomer(d.Email, "Échec du paiement de votre abonnement CYNA", fmt.Sprintf(
+			`<p>Le paiement de <strong>%.2f €</strong> pour <strong>%s</strong> a de nouveau échoué.</p>
+			<p>Votre abonnement reste suspendu. Sans régularisation sous %d jours après la suspension, il sera définitivement résilié.</p>`,
+			d.Montant, d.Produit, int(SuspensionGrace.Hours()/24)))
+		p := d.payload("Échec du paiement", fmt.Sprintf(
+			"Le paiement de %.2f € pour %s a de nouveau échoué : votre abonnement reste suspendu.",
+			d.Montant, d.Produit))
+		p.Urgent = true
+		notify.SendAsync(d.UserID, notify.TypeFacturation, p)
+	default:
+		emailCustomer(d.Email, "Votre abonnement CYNA est suspendu", fmt.Sprintf(
+			`<p>Après plusieurs tentatives, le paiement de <strong>%.2f €</strong> pour <strong>%s</strong> a échoué.</p>
+			<p>Votre abonnement est suspendu. Sans régularisation sous %d jours, il sera définitivement résilié.</p>`,
+			d.Montant, d.Produit, int(SuspensionGrace.Hours()/24)))
+		p := d.payload("Abonnement suspendu", fmt.Sprintf(
+			"Le paiement de %.2f € pour %s a échoué après plusieurs tentatives : votre abonnement est suspendu.",
+			d.Montant, d.Produit))
+		p.Urgent = true
+		notify.SendAsync(d.UserID, notify.TypeAbonnement, p)
+	}
+	return nil
+}
+
+// RetrySuspended reprogramme immédiatement le débit des renouvellements en échec des
+// abonnements suspendus de l'entreprise (nouveau moyen de paiement enregistré). Un
+// paiement réussi réactive l'abonnement.
+func RetrySuspended(ctx context.Context, companyID int) (int, error) {
+	res, err := config.DB.ExecContext(ctx, `
+		WITH relance AS (
+		    UPDATE abonnement_renouvellement r SET statut = 'attente', prochaine_tentative = NOW()
+		    FROM abonnement a
+		    WHERE a.id_abonnement = r.id_abonnement AND a.id_entreprise = $1
+		      AND a.statut = $2 AND a.renouvellement_auto = TRUE
+		      AND r.statut = 'echec' AND r.periode_debut = a.date_fin
+		    RETURNING r.id_commande)
+		UPDATE commande SET statut = 'attente' WHERE id_commande IN (SELECT id_commande FROM relance)`,
+		companyID, StatutSuspendu)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// payload : notification in-app d'un renouvellement, l'email dédié étant déjà envoyé.
+func (d dueRenewal) payload(title, message string) notify.Payload {
+	return notify.Payload{
+		Title:   title,
+		Message: message,
+		Link:    linkSubscriptions,
+		Data:    map[string]interface{}{"subscriptionId": d.SubID, "orderId": d.CommandeID},
+		NoEmail: true,
+	}
+}
+
+// ===== 3. EXPIRATIONS =====
+
+// warnExpiring prévient, ExpiryNotice avant la fin, les clients dont l'abonnement ne se
+// renouvelle pas automatiquement (une fois par date de fin).
+func warnExpiring(ctx context.Context, now time.Time) {
+	events, err := subscriptionEvents(ctx, `
+		UPDATE abonnement a SET date_rappel_fin = a.date_fin
+		WHERE a.statut = $1 AND a.renouvellement_auto = FALSE
+		  AND a.date_fin IS NOT NULL AND a.date_fin >= CURRENT_DATE AND a.date_fin <= $2::date
+		  AND a.date_rappel_fin IS DISTINCT FROM a.date_fin
+		RETURNING a.id_abonnement, COALESCE(a.id_entreprise, 0),
+		          COALESCE((SELECT p.nom FROM produits p WHERE p.id_produit = a.id_produit), ''), a.date_fin`,
+		StatutActif, now.Add(ExpiryNotice))
+	if err != nil {
+		log.Printf("[WARN] billing: expiry notice: %v", err)
+		return
+	}
+	for _, e := range events {
+		notifyCompany(ctx, e.CompanyID, notify.TypeAbonnement, e.payload("Abonnement bientôt expiré", fmt.Sprintf(
+			"Votre abonnement %s prend fin le %s et ne sera pas renouvelé automatiquement.", e.Produit, e.DateFin)))
+	}
+}
+
+// expireNonRenewing résilie les abonnements sans renouvellement automatique arrivés à terme.
+func expireNonRenewing(ctx context.Context) {
+	events, err := subscriptionEvents(ctx, `
+		UPDATE abonnement a SET statut = $1, date_statut = NOW()
+		WHERE a.statut = $2 AND a.renouvellement_auto = FALSE
+		  AND a.date_fin IS NOT NULL AND a.date_fin < CURRENT_DATE
+		RETURNING a.id_abonnement, COALESCE(a.id_entreprise, 0),
+		          COALESCE((SELECT p.nom FROM produits p WHERE p.id_produit = a.id_produit), ''), a.date_fin`,
+		StatutResilie, StatutActif)
+	if err != nil {
+		log.Printf("[WARN] billing: expiry: %v", err)
+		return
+	}
+	if len(events) > 0 {
+		log.Printf("[INFO] billing: %d abonnements arrivés à terme résiliés", len(events))
+	}
+	for _, e := range events {
+		notifyCompany(ctx, e.CompanyID, notify.TypeAbonnement, e.payload("Abonnement expiré", fmt.Sprintf(
+			"Votre abonnement %s a pris fin le %s.", e.Produit, e.DateFin)))
+	}
+}
+
+// terminateSuspended résilie les abonnements suspendus pour impayé depuis plus que SuspensionGrace.
+// Les suspensions manuelles (sans renouvellement en échec) ne sont pas concernées.
+func terminateSuspended(ctx context.Context, now time.Time) {
+	events, err := subscriptionEvents(ctx, `
+		UPDATE abonnement a SET statut = $1, renouvellement_auto = FALSE, date_statut = NOW()
+		WHERE a.statut = $2 AND a.date_statut < $3
+		  AND EXISTS (SELECT 1 FROM abonnement_renouvellement r
+		              WHERE r.id_abonnement = a.id_abonnement AND r.statut = 'echec')
+		RETURNING a.id_abonnement, COALESCE(a.id_entreprise, 0),
+		          COALESCE((SELECT p.nom FROM produits p WHERE p.id_produit = a.id_produit), ''), a.date_fin`,
+		StatutResilie, StatutSuspendu, now.Add(-SuspensionGrace))
+	if err != nil {
+		log.Printf("[WARN] billing: termination: %v", err)
+		return
+	}
+	if len(events) > 0 {
+		log.Printf("[INFO] billing: %d abonnements suspendus résiliés", len(events))
+	}
+	for _, e := range events {
+		notifyCompany(ctx, e.CompanyID, notify.TypeAbonnement, e.payload("Abonnement résilié",
+			fmt.Sprintf("Votre abonnement %s a été résilié faute de paiement.", e.Produit)))
+	}
+}
+
+// subscriptionEvents exécute une mise à jour d'abonnements retournant
+// (id_abonnement, id_entreprise, produit, date_fin).
+func subscriptionEvents(ctx context.Context, query string, args ...interface{}) ([]subscriptionEvent, error) {
+	rows, err := config.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []subscriptionEvent
+	for rows.Next() {
+		var e subscriptionEvent
+		var fin *time.Time
+		if err := rows.Scan(&e.SubID, &e.CompanyID, &e.Produit, &fin); err != nil {
+			return events, err
+		}
+		if fin != nil {
+			e.DateFin = fin.Format("02/01/2006")
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// expireQuotes passe en "expire" les devis envoyés dont la date de validité est dépassée.
+func expireQuotes(ctx context.Context) {
+	res, err := config.DB.ExecContext(ctx, `
+		UPDATE devis SET statut = $1, date_modification = NOW()
+		WHERE statut = $2 AND date_validite < CURRENT_DATE`, DevisExpire, DevisEnvoye)
+	if err != nil {
+		log.Printf("[WARN] billing: quote expiry: %v", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("[INFO] billing: %d devis expirés", n)
+	}
+}
+
+func emailCustomer(to, subject, body string) {
+	if to == "" {
+		return
+	}
+	go func() {
+		if err := mailer.Send(to, subject, mailer.Layout(subject, body)); err != nil {
+			log.Printf("[WARN] billing email to %s: %v", to, err)
+		}
+	}()
+}
@@ -0,0 +1,27 @@
+package billing
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"api/payments"
+)
+
+func TestDeclined_OnlyProviderRefusalsCount(t *testing.T) {
+	if !declined(&payments.DeclinedError{Message: "card_declined"}) {
+		t.Error("a declined card must count as a dunning attempt")
+	}
+	if !declined(fmt.Errorf("renouvellement: %w", &payments.DeclinedError{Message: "x"})) {
+		t.Error("a wrapped decline must count as a dunning attempt")
+	}
+	for _, err := range []error{
+		payments.ErrNotConfigured,
+		errors.New("stripe: 502 Bad Gateway"),
+		fmt.Errorf("stripe: %w", errors.New("connection reset by peer")),
+	} {
+		if declined(err) {
+			t.Errorf("%v must leave the renewal pending", err)
+		}
+	}
+}
@@ -168,11 +168,16 @@ const (
 	KeyAllCategories    = "categories:all"
 	KeyAllProduits      = "produits:all"
 	KeyAllTarifications = "tarifications:all"
+	KeySuggestIndex     = "suggest:index"
 )
 
-func KeyProduitsByCategory(slug string) string      { return "produits:category:" + slug }
-func KeySearchResults(query string) string          { return "search:" + query }
-func KeyTarification(id int) string                 { return fmt.Sprintf("tarification:%d", id) }
+// Les réponses publiques du catalogue dépendent de la langue : elle fait partie de la clé.
+func KeyActiveCategoriesLocale(locale string) string   { return KeyActiveCategories + ":" + locale }
+func KeyProduitsByCategory(locale, slug string) string { return "produits:category:" + locale + ":" + slug }
+func KeySearchResults(locale, query string) string     { return "search:" + locale + ":" + query }
+func KeySuggestIndexLocale(locale string) string       { return KeySuggestIndex + ":" + locale }
+func KeyTarification(id int) string                    { return fmt.Sprintf("tarification:%d", id) }
+func KeyCrossSell(productID int) string                { return fmt.Sprintf("produits:cross-sell:%d", productID) }
 
 // ===== CLÉS ADMIN =====
 
@@ -184,15 +189,18 @@ const (
 // ===== INVALIDATION =====
 
 func InvalidateCategories() {
-	CatalogCache.Delete(KeyActiveCategories)
+	CatalogCache.DeleteByPrefix(KeyActiveCategories)
 	CatalogCache.Delete(KeyAllCategories)
+	CatalogCache.DeleteByPrefix(KeySuggestIndex)
 	log.Println("Cache invalidated: categories")
 }
 
 func InvalidateProduits() {
 	CatalogCache.Delete(KeyAllProduits)
 	CatalogCache.DeleteByPrefix("produits:category:")
+	CatalogCache.DeleteByPrefix("produits:cross-sell:")
 	SearchCache.DeleteByPrefix("search:")
+	CatalogCache.DeleteByPrefix(KeySuggestIndex)
 	log.Println("Cache invalidated: produits + search")
 }
 
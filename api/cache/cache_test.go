@@ -194,10 +194,13 @@ func TestSetJSONWithTTL(t *testing.T) {
 }
 
 func TestKeyFunctions(t *testing.T) {
-	if got := KeyProduitsByCategory("cyber"); got != "produits:category:cyber" {
+	if got := KeyProduitsByCategory("fr", "cyber"); got != "produits:category:fr:cyber" {
 		t.Errorf("unexpected key: %s", got)
 	}
-	if got := KeySearchResults("test"); got != "search:test" {
+	if got := KeySearchResults("en", "test"); got != "search:en:test" {
+		t.Errorf("unexpected key: %s", got)
+	}
+	if got := KeyActiveCategoriesLocale("de"); got != "categories:active:de" {
 		t.Errorf("unexpected key: %s", got)
 	}
 	if got := KeyTarification(42); got != "tarification:42" {
@@ -221,6 +224,7 @@ func TestGlobalCaches(t *testing.T) {
 func TestInvalidateCategories(t *testing.T) {
 	Init()
 	CatalogCache.Set(KeyActiveCategories, []byte("data"))
+	CatalogCache.Set(KeyActiveCategoriesLocale("en"), []byte("data"))
 	CatalogCache.Set(KeyAllCategories, []byte("data"))
 
 	InvalidateCategories()
@@ -228,6 +232,9 @@ func TestInvalidateCategories(t *testing.T) {
 	if CatalogCache.Get(KeyActiveCategories) != nil {
 		t.Error("expected active categories to be invalidated")
 	}
+	if CatalogCache.Get(KeyActiveCategoriesLocale("en")) != nil {
+		t.Error("expected translated active categories to be invalidated")
+	}
 	if CatalogCache.Get(KeyAllCategories) != nil {
 		t.Error("expected all categories to be invalidated")
 	}
@@ -236,18 +243,26 @@ func TestInvalidateCategories(t *testing.T) {
 func TestInvalidateProduits(t *testing.T) {
 	Init()
 	CatalogCache.Set(KeyAllProduits, []byte("data"))
-	CatalogCache.Set(KeyProduitsByCategory("test"), []byte("data"))
-	SearchCache.Set(KeySearchResults("test"), []byte("data"))
+	CatalogCache.Set(KeyProduitsByCategory("de", "test"), []byte("data"))
+	SearchCache.Set(KeySearchResults("en", "test"), []byte("data"))
+	CatalogCache.Set(KeySuggestIndexLocale("en"), []byte("1"))
+	CatalogCache.Set(KeyCrossSell(7), []byte("[]"))
 
 	InvalidateProduits()
 
 	if CatalogCache.Get(KeyAllProduits) != nil {
 		t.Error("expected all produits to be invalidated")
 	}
-	if CatalogCache.Get(KeyProduitsByCategory("test")) != nil {
+	if CatalogCache.Get(KeyProduitsByCategory("de", "test")) != nil {
 		t.Error("expected category produits to be invalidated")
 	}
-	if SearchCache.Get(KeySearchResults("test")) != nil {
+	if SearchCache.Get(KeySearchResults("en", "test")) != nil {
 		t.Error("expected search results to be invalidated")
 	}
+	if CatalogCache.Get(KeySuggestIndexLocale("en")) != nil {
+		t.Error("expected suggest index to be invalidated")
+	}
+	if CatalogCache.Get(KeyCrossSell(7)) != nil {
+		t.Error("expected cross-sell to be invalidated")
+	}
 }
@@ -0,0 +1,84 @@
+package catalog
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// Brouillons du catalogue — cycle de vie et jetons de prévisualisation.
+// brouillon → planifie → publie | echec ; brouillon | planifie → annule
+// ============================================================
+
+const (
+	DraftBrouillon = "brouillon"
+	DraftPlanifie  = "planifie"
+	DraftPublie    = "publie"
+	DraftAnnule    = "annule"
+	DraftEchec     = "echec"
+
+	DraftProduit   = "produit"
+	DraftCategorie = "categorie"
+
+	// Actions : update remplace le contenu ; publish / unpublish ne touchent qu'à actif.
+	DraftUpdate    = "update"
+	DraftPublish   = "publish"
+	DraftUnpublish = "unpublish"
+)
+
+// DraftEditable indique si un brouillon peut encore être modifié, planifié ou publié.
+func DraftEditable(statut string) bool {
+	return statut == DraftBrouillon || statut == DraftPlanifie
+}
+
+// ValidDraftTarget vérifie le type de contenu et l'action d'un brouillon.
+func ValidDraftTarget(kind, action string) bool {
+	if kind != DraftProduit && kind != DraftCategorie {
+		return false
+	}
+	return action == DraftUpdate || action == DraftPublish || action == DraftUnpublish
+}
+
+var (
+	ErrPreviewInvalid = errors.New("invalid preview token")
+	ErrPreviewExpired = errors.New("preview token expired")
+)
+
+// SignPreview émet un jeton de prévisualisation "<brouillon>.<expiration>.<signature>"
+// (HMAC-SHA256, base64url) valable jusqu'à exp.
+func SignPreview(secret []byte, draftID int, exp time.Time) string {
+	payload := strconv.Itoa(draftID) + "." + strconv.FormatInt(exp.Unix(), 10)
+	return payload + "." + previewMAC(secret, payload)
+}
+
+// VerifyPreview contrôle la signature et l'expiration d'un jeton et retourne l'identifiant du brouillon.
+func VerifyPreview(secret []byte, token string, now time.Time) (int, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, ErrPreviewInvalid
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(previewMAC(secret, payload))) {
+		return 0, ErrPreviewInvalid
+	}
+	id, err := strconv.Atoi(parts[0])
+	exp, err2 := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || err2 != nil || id <= 0 {
+		return 0, ErrPreviewInvalid
+	}
+	if now.Unix() > exp {
+		return 0, ErrPreviewExpired
+	}
+	return id, nil
+}
+
+func previewMAC(secret []byte, payload string) string {
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte("catalog-preview:" + payload))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
@@ -0,0 +1,38 @@
+package catalog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPreviewToken(t *testing.T) {
+	secret := []byte("s3cret")
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	token := SignPreview(secret, 42, now.Add(time.Hour))
+
+	if id, err := VerifyPreview(secret, token, now); err != nil || id != 42 {
+		t.Fatalf("VerifyPreview = %d, %v", id, err)
+	}
+	if _, err := VerifyPreview(secret, token, now.Add(2*time.Hour)); err != ErrPreviewExpired {
+		t.Errorf("expired token: got %v", err)
+	}
+	if _, err := VerifyPreview([]byte("other"), token, now); err != ErrPreviewInvalid {
+		t.Errorf("wrong secret: got %v", err)
+	}
+	forged := "43" + token[2:]
+	if _, err := VerifyPreview(secret, forged, now); err != ErrPreviewInvalid {
+		t.Errorf("forged draft id: got %v", err)
+	}
+	if _, err := VerifyPreview(secret, "garbage", now); err != ErrPreviewInvalid {
+		t.Errorf("malformed token: got %v", err)
+	}
+}
+
+func TestDraftRules(t *testing.T) {
+	if !DraftEditable(DraftPlanifie) || DraftEditable(DraftPublie) || DraftEditable(DraftAnnule) {
+		t.Error("only brouillon and planifie drafts are editable")
+	}
+	if !ValidDraftTarget(DraftProduit, DraftUnpublish) || ValidDraftTarget("pack", DraftUpdate) || ValidDraftTarget(DraftCategorie, "delete") {
+		t.Error("unexpected ValidDraftTarget result")
+	}
+}
@@ -0,0 +1,108 @@
+package catalog
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// ============================================================
+// Historique du catalogue — comparaison des instantanés enregistrés
+// par les triggers de catalogue_version.
+// ============================================================
+
+const (
+	HistoryProduit       = "produit"
+	HistoryCategorie     = "categorie"
+	HistoryTarification  = "tarification"
+	HistoryCarouselImage = "carousel_image"
+
+	VersionCreate  = "create"
+	VersionUpdate  = "update"
+	VersionDelete  = "delete"
+	VersionRestore = "restore"
+)
+
+// ValidHistoryType vérifie un type de contenu historisé.
+func ValidHistoryType(kind string) bool {
+	switch kind {
+	case HistoryProduit, HistoryCategorie, HistoryTarification, HistoryCarouselImage:
+		return true
+	}
+	return false
+}
+
+// diffIgnored : champs mis à jour à chaque écriture, sans intérêt dans un diff.
+var diffIgnored = map[string]bool{"date_modification": true}
+
+// FieldChange décrit la modification d'un champ entre deux versions.
+type FieldChange struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// DiffSnapshots compare deux instantanés JSON (objets) champ par champ, par ordre
+// alphabétique. Un instantané vide (création, suppression) compte comme un objet vide :
+// les champs absents valent null.
+func DiffSnapshots(before, after []byte) ([]FieldChange, error) {
+	b, err := decodeSnapshot(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := decodeSnapshot(after)
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]string, 0, len(a))
+	for f := range a {
+		fields = append(fields, f)
+	}
+	for f := range b {
+		if _, ok := a[f]; !ok {
+			fields = append(fields, f)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []FieldChange{}
+	for _, f := range fields {
+		if diffIgnored[f] || sameJSON(b[f], a[f]) {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: f, Before: orNull(b[f]), After: orNull(a[f])})
+	}
+	return changes, nil
+}
+
+func decodeSnapshot(data []byte) (map[string]json.RawMessage, error) {
+	m := map[string]json.RawMessage{}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return m, nil
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// sameJSON compare deux valeurs JSON indépendamment de leur mise en forme.
+func sameJSON(x, y json.RawMessage) bool {
+	var vx, vy interface{}
+	if len(x) > 0 {
+		json.Unmarshal(x, &vx)
+	}
+	if len(y) > 0 {
+		json.Unmarshal(y, &vy)
+	}
+	jx, _ := json.Marshal(vx)
+	jy, _ := json.Marshal(vy)
+	return bytes.Equal(jx, jy)
+}
+
+func orNull(v json.RawMessage) json.RawMessage {
+	if len(v) == 0 {
+		return json.RawMessage("null")
+	}
+	return v
+}
@@ -0,0 +1,37 @@
+package catalog
+
+import "testing"
+
+func TestDiffSnapshots(t *testing.T) {
+	before := []byte(`{"id_produit": 7, "nom": "EDR", "prix": 49.9, "actif": true, "date_modification": "2026-01-01T10:00:00"}`)
+	after := []byte(`{"id_produit":7,"nom":"EDR Pro","prix":49.90,"actif":true,"tag":"Premium","date_modification":"2026-02-01T10:00:00"}`)
+
+	changes, err := DiffSnapshots(before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %+v", changes)
+	}
+	if changes[0].Field != "nom" || string(changes[0].Before) != `"EDR"` || string(changes[0].After) != `"EDR Pro"` {
+		t.Errorf("unexpected nom change: %+v", changes[0])
+	}
+	if changes[1].Field != "tag" || string(changes[1].Before) != "null" {
+		t.Errorf("added field should diff from null: %+v", changes[1])
+	}
+}
+
+func TestDiffSnapshotsCreateAndDelete(t *testing.T) {
+	row := []byte(`{"id_image": 3, "titre": "Promo"}`)
+	created, err := DiffSnapshots(nil, row)
+	if err != nil || len(created) != 2 {
+		t.Fatalf("create diff = %+v, %v", created, err)
+	}
+	deleted, err := DiffSnapshots(row, nil)
+	if err != nil || len(deleted) != 2 || string(deleted[1].After) != "null" {
+		t.Fatalf("delete diff = %+v, %v", deleted, err)
+	}
+	if _, err := DiffSnapshots([]byte("[1]"), row); err == nil {
+		t.Error("non-object snapshot should fail")
+	}
+}
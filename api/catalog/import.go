@@ -0,0 +1,325 @@
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	mw "api/middleware"
+)
+
+// ============================================================
+// Import / export du catalogue — lecture et upsert en base.
+// L'import s'exécute dans la transaction de l'appelant, ligne par
+// ligne sous savepoint : chaque ligne en erreur est signalée sans
+// interrompre les suivantes, et l'appelant n'enregistre que si
+// aucune ligne n'a échoué.
+// ============================================================
+
+const (
+	RowCreate = "create"
+	RowUpdate = "update"
+	RowError  = "error"
+)
+
+// ImportRow : résultat d'une ligne du fichier.
+type ImportRow struct {
+	Line        int      `json:"line"`
+	Type        string   `json:"type"`
+	Slug        string   `json:"slug"`
+	Periodicite string   `json:"periodicite,omitempty"`
+	Action      string   `json:"action"` // create | update | error
+	Errors      []string `json:"errors,omitempty"`
+}
+
+// ImportCounts : bilan d'un type de ligne.
+type ImportCounts struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Failed  int `json:"failed"`
+}
+
+type ImportReport struct {
+	DryRun    bool                    `json:"dryRun"`
+	Committed bool                    `json:"committed"`
+	Summary   map[string]ImportCounts `json:"summary"`
+	Rows      []ImportRow             `json:"rows"`
+}
+
+// Failed indique si au moins une ligne est en erreur.
+func (r ImportReport) Failed() bool {
+	for _, c := range r.Summary {
+		if c.Failed > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *ImportReport) add(row ImportRow, issues []string, err error) {
+	if err != nil {
+		issues = append(issues, err.Error())
+	}
+	c := r.Summary[row.Type]
+	switch {
+	case len(issues) > 0:
+		row.Action, row.Errors = RowError, issues
+		c.Failed++
+	case row.Action == RowCreate:
+		c.Created++
+	default:
+		c.Updated++
+	}
+	r.Summary[row.Type] = c
+	r.Rows = append(r.Rows, row)
+}
+
+// Import valide le fichier puis crée ou met à jour, par slug, les catégories, les
+// produits et leurs tarifs, dans cet ordre. Les lignes invalides ne sont pas écrites.
+// Une erreur n'est retournée que si la transaction elle-même est inutilisable.
+func Import(ctx context.Context, tx *sql.Tx, b Bundle) (ImportReport, error) {
+	rep := ImportReport{Summary: map[string]ImportCounts{
+		RecordCategorie: {}, RecordProduit: {}, RecordTarif: {},
+	}, Rows: []ImportRow{}}
+	b.Validate()
+
+	// row exécute fn sous savepoint : une erreur SQL n'annule que la ligne (rowErr) ;
+	// fatal signale une transaction devenue inutilisable.
+	row := func(issues []string, fn func() (string, error)) (action string, rowErr, fatal error) {
+		if len(issues) > 0 {
+			return "", nil, nil
+		}
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT import_ligne"); err != nil {
+			return "", nil, err
+		}
+		action, rowErr = fn()
+		if rowErr != nil {
+			_, fatal = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT import_ligne")
+			return "", rowErr, fatal
+		}
+		_, fatal = tx.ExecContext(ctx, "RELEASE SAVEPOINT import_ligne")
+		return action, nil, fatal
+	}
+
+	for _, c := range b.Categories {
+		c := c
+		action, err, fatal := row(c.issues, func() (string, error) { return upsertCategory(ctx, tx, c) })
+		if fatal != nil {
+			return rep, fatal
+		}
+		rep.add(ImportRow{Line: c.Line, Type: RecordCategorie, Slug: c.Slug, Action: action}, c.issues, err)
+	}
+	for _, p := range b.Produits {
+		p := p
+		action, err, fatal := row(p.issues, func() (string, error) { return upsertProduct(ctx, tx, p) })
+		if fatal != nil {
+			return rep, fatal
+		}
+		rep.add(ImportRow{Line: p.Line, Type: RecordProduit, Slug: p.Slug, Action: action}, p.issues, err)
+	}
+	for _, t := range b.Tarifs {
+		t := t
+		action, err, fatal := row(t.issues, func() (string, error) { return upsertPrice(ctx, tx, t) })
+		if fatal != nil {
+			return rep, fatal
+		}
+		rep.add(ImportRow{Line: t.Line, Type: RecordTarif, Slug: t.Produit, Periodicite: t.Periodicite, Action: action}, t.issues, err)
+	}
+	return rep, nil
+}
+
+func upsertCategory(ctx context.Context, tx *sql.Tx, c CategoryRecord) (string, error) {
+	var id int
+	err := tx.QueryRowContext(ctx, "SELECT id_categorie FROM categories WHERE slug = $1", c.Slug).Scan(&id)
+	if err == sql.ErrNoRows {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO categories (nom, slug, description, image, icone, couleur, ordre_affichage, actif)
+			VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, ''), 'bi bi-shield'), COALESCE(NULLIF($6, ''), '#7602F9'), $7, COALESCE($8, TRUE))`,
+			c.Nom, c.Slug, c.Description, c.Image, c.Icone, c.Couleur, c.OrdreAffichage, c.Actif)
+		return RowCreate, err
+	}
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE categories SET nom = $1, description = $2, image = $3,
+		    icone = COALESCE(NULLIF($4, ''), icone), couleur = COALESCE(NULLIF($5, ''), couleur),
+		    ordre_affichage = $6, actif = COALESCE($7, actif), date_modification = CURRENT_TIMESTAMP
+		WHERE id_categorie = $8`,
+		c.Nom, c.Description, c.Image, c.Icone, c.Couleur, c.OrdreAffichage, c.Actif, id)
+	return RowUpdate, err
+}
+
+// productBySlug retourne l'identifiant du produit ; sql.ErrNoRows s'il n'existe pas.
+func productBySlug(ctx context.Context, tx *sql.Tx, slug string) (int, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT id_produit FROM produits WHERE slug = $1 LIMIT 2", slug)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	switch len(ids) {
+	case 0:
+		return 0, sql.ErrNoRows
+	case 1:
+		return ids[0], rows.Err()
+	}
+	return 0, fmt.Errorf("slug %q porté par plusieurs produits (catégories différentes)", slug)
+}
+
+func upsertProduct(ctx context.Context, tx *sql.Tx, p ProductRecord) (string, error) {
+	var idCategorie int
+	if err := tx.QueryRowContext(ctx, "SELECT id_categorie FROM categories WHERE slug = $1", p.Categorie).Scan(&idCategorie); err == sql.ErrNoRows {
+		return "", fmt.Errorf("catégorie %q introuvable", p.Categorie)
+	} else if err != nil {
+		return "", err
+	}
+	images := p.Images
+	if images == "" {
+		images = "[]"
+	}
+	// Même échappement que la saisie dans le back-office (le HTML long passe par sa propre validation).
+	p.Nom = mw.SanitizeString(p.Nom)
+	p.DescriptionCourte = mw.SanitizeString(p.DescriptionCourte)
+	id, err := productBySlug(ctx, tx, p.Slug)
+	if err == sql.ErrNoRows {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO produits (nom, slug, description_courte, description_longue, description_html,
+			    images, prix, devise, duree, id_categorie, tag, statut, type_achat, ordre_affichage, actif)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, COALESCE(NULLIF($8, ''), 'EUR'), COALESCE(NULLIF($9, ''), 'mois'),
+			    $10, NULLIF($11, ''), COALESCE(NULLIF($12, ''), 'Disponible'), COALESCE(NULLIF($13, ''), 'panier'),
+			    $14, COALESCE($15, TRUE))`,
+			p.Nom, p.Slug, p.DescriptionCourte, p.DescriptionLongue, p.DescriptionHTML, images, p.Prix,
+			strings.ToUpper(p.Devise), p.Duree, idCategorie, p.Tag, p.Statut, p.TypeAchat, p.OrdreAffichage, p.Actif)
+		return RowCreate, err
+	}
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE produits SET nom = $1, description_courte = $2, description_longue = $3, description_html = $4,
+		    images = $5, prix = $6, devise = COALESCE(NULLIF($7, ''), devise), duree = COALESCE(NULLIF($8, ''), duree),
+		    id_categorie = $9, tag = NULLIF($10, ''), statut = COALESCE(NULLIF($11, ''), statut),
+		    type_achat = COALESCE(NULLIF($12, ''), type_achat), ordre_affichage = $13,
+		    actif = COALESCE($14, actif), date_modification = CURRENT_TIMESTAMP
+		WHERE id_produit = $15`,
+		p.Nom, p.DescriptionCourte, p.DescriptionLongue, p.DescriptionHTML, images, p.Prix,
+		strings.ToUpper(p.Devise), p.Duree, idCategorie, p.Tag, p.Statut, p.TypeAchat, p.OrdreAffichage, p.Actif, id)
+	return RowUpdate, err
+}
+
+func upsertPrice(ctx context.Context, tx *sql.Tx, t PriceRecord) (string, error) {
+	productID, err := productBySlug(ctx, tx, t.Produit)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("produit %q introuvable", t.Produit)
+	} else if err != nil {
+		return "", err
+	}
+	// Tarif catalogue actif pour la périodicité (les tarifs inactifs peuvent être des
+	// tarifs privés de devis ou de packs : jamais réécrits).
+	var id int
+	err = tx.QueryRowContext(ctx, `
+		SELECT id_tarification FROM tarification
+		WHERE id_produit = $1 AND id_variante IS NULL AND actif = TRUE AND LOWER(periodicite) = LOWER($2)
+		ORDER BY id_tarification DESC LIMIT 1`, productID, t.Periodicite).Scan(&id)
+	if err == sql.ErrNoRows {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO tarification (prix, unite, periodicite, actif, id_produit, prix_usage, agregation)
+			VALUES ($1, $2, $3, COALESCE($4, TRUE), $5, $6, COALESCE(NULLIF($7, ''), 'sum'))`,
+			t.Prix, t.Unite, t.Periodicite, t.Actif, productID, t.PrixUsage, t.Agregation)
+		return RowCreate, err
+	}
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE tarification SET prix = $1, unite = $2, actif = COALESCE($3, actif), prix_usage = $4,
+		    agregation = COALESCE(NULLIF($5, ''), agregation)
+		WHERE id_tarification = $6`,
+		t.Prix, t.Unite, t.Actif, t.PrixUsage, t.Agregation, id)
+	return RowUpdate, err
+}
+
+// Export lit le catalogue au format d'import : toutes les catégories et tous les
+// produits, et les tarifs catalogue actifs (hors variantes et tarifs privés).
+func Export(ctx context.Context, db *sql.DB) (Bundle, error) {
+	b := Bundle{Categories: []CategoryRecord{}, Produits: []ProductRecord{}, Tarifs: []PriceRecord{}}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT slug, nom, COALESCE(description,''), COALESCE(image,''), COALESCE(icone,''), COALESCE(couleur,''),
+		       COALESCE(ordre_affichage,0), COALESCE(actif,TRUE)
+		FROM categories ORDER BY ordre_affichage, slug`)
+	if err != nil {
+		return b, err
+	}
+	for rows.Next() {
+		var c CategoryRecord
+		var actif bool
+		if err := rows.Scan(&c.Slug, &c.Nom, &c.Description, &c.Image, &c.Icone, &c.Couleur, &c.OrdreAffichage, &actif); err != nil {
+			rows.Close()
+			return b, err
+		}
+		c.Actif = &actif
+		b.Categories = append(b.Categories, c)
+	}
+	rows.Close()
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT p.slug, COALESCE(c.slug,''), p.nom, COALESCE(p.description_courte,''), COALESCE(p.description_longue,''),
+		       COALESCE(p.description_html,''), COALESCE(p.images::text,'[]'), p.prix, COALESCE(p.devise,''),
+		       COALESCE(p.duree,''), COALESCE(p.tag,''), COALESCE(p.statut,''), COALESCE(p.type_achat,''),
+		       COALESCE(p.ordre_affichage,0), COALESCE(p.actif,TRUE)
+		FROM produits p LEFT JOIN categories c ON c.id_categorie = p.id_categorie
+		ORDER BY c.ordre_affichage, c.slug, p.ordre_affichage, p.slug`)
+	if err != nil {
+		return b, err
+	}
+	for rows.Next() {
+		var p ProductRecord
+		var prix sql.NullFloat64
+		var actif bool
+		if err := rows.Scan(&p.Slug, &p.Categorie, &p.Nom, &p.DescriptionCourte, &p.DescriptionLongue,
+			&p.DescriptionHTML, &p.Images, &prix, &p.Devise, &p.Duree, &p.Tag, &p.Statut, &p.TypeAchat,
+			&p.OrdreAffichage, &actif); err != nil {
+			rows.Close()
+			return b, err
+		}
+		if prix.Valid {
+			p.Prix = &prix.Float64
+		}
+		p.Actif = &actif
+		b.Produits = append(b.Produits, p)
+	}
+	rows.Close()
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT p.slug, COALESCE(t.periodicite,''), COALESCE(t.prix,0), COALESCE(t.unite,''), t.prix_usage,
+		       COALESCE(t.agregation,'sum')
+		FROM tarification t JOIN produits p ON p.id_produit = t.id_produit
+		WHERE t.actif = TRUE AND t.id_variante IS NULL
+		ORDER BY p.slug, t.periodicite, t.id_tarification`)
+	if err != nil {
+		return b, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t PriceRecord
+		var usage sql.NullFloat64
+		if err := rows.Scan(&t.Produit, &t.Periodicite, &t.Prix, &t.Unite, &usage, &t.Agregation); err != nil {
+			return b, err
+		}
+		if usage.Valid {
+			t.PrixUsage = &usage.Float64
+		}
+		b.Tarifs = append(b.Tarifs, t)
+	}
+	return b, rows.Err()
+}
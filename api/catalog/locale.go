@@ -0,0 +1,80 @@
+package catalog
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ============================================================
+// Langues du catalogue — le français est la langue de référence (colonnes
+// des tables produits, categories, carousel_images) ; les autres langues
+// sont des traductions champ par champ, avec repli sur le français.
+// ============================================================
+
+const DefaultLocale = "fr"
+
+// Locales : langues proposées, langue de référence en tête.
+var Locales = []string{"fr", "en", "de"}
+
+// ValidLocale vérifie une langue proposée par le catalogue.
+func ValidLocale(l string) bool {
+	for _, s := range Locales {
+		if s == l {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidTranslationLocale : langue pour laquelle une traduction peut être saisie (hors français).
+func ValidTranslationLocale(l string) bool {
+	return l != DefaultLocale && ValidLocale(l)
+}
+
+// TranslatableFields : champs traduisibles par type de contenu, dans l'ordre des colonnes
+// des tables de traduction.
+var TranslatableFields = map[string][]string{
+	HistoryProduit:       {"nom", "description_courte", "description_longue", "description_html"},
+	HistoryCategorie:     {"nom", "description"},
+	HistoryCarouselImage: {"titre", "description", "alt_text"},
+}
+
+// NegotiateLocale choisit la langue d'une réponse : ?lang= s'il est proposé, sinon la
+// meilleure langue d'Accept-Language (poids q, variantes régionales ramenées à la
+// langue : "de-CH" → "de"), sinon le français.
+func NegotiateLocale(param, acceptLanguage string) string {
+	if l := strings.ToLower(strings.TrimSpace(param)); ValidLocale(l) {
+		return l
+	}
+	best, bestQ := DefaultLocale, 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, q := parseLanguageRange(part)
+		if q <= bestQ {
+			continue
+		}
+		if i := strings.IndexByte(tag, '-'); i > 0 {
+			tag = tag[:i]
+		}
+		if ValidLocale(tag) {
+			best, bestQ = tag, q
+		}
+	}
+	return best
+}
+
+func parseLanguageRange(s string) (tag string, q float64) {
+	fields := strings.Split(s, ";")
+	tag = strings.ToLower(strings.TrimSpace(fields[0]))
+	q = 1
+	for _, f := range fields[1:] {
+		f = strings.TrimSpace(f)
+		if strings.HasPrefix(f, "q=") {
+			v, err := strconv.ParseFloat(f[2:], 64)
+			if err != nil || v < 0 || v > 1 {
+				return tag, 0
+			}
+			q = v
+		}
+	}
+	return tag, q
+}
@@ -0,0 +1,32 @@
+package catalog
+
+import "testing"
+
+func TestNegotiateLocale(t *testing.T) {
+	cases := []struct {
+		param, accept, want string
+	}{
+		{"", "", "fr"},
+		{"en", "de-DE,de;q=0.9", "en"},
+		{"EN", "", "en"},
+		{"it", "de-CH", "de"},
+		{"", "en-US,en;q=0.9,fr;q=0.8", "en"},
+		{"", "it-IT,it;q=0.9,de;q=0.5,en;q=0.4", "de"},
+		{"", "fr;q=0.5, en;q=0.7", "en"},
+		{"", "en;q=0", "fr"},
+		{"", "*", "fr"},
+		{"", "es, pt;q=0.8", "fr"},
+		{"", "en;q=abc, de;q=0.2", "de"},
+	}
+	for _, c := range cases {
+		if got := NegotiateLocale(c.param, c.accept); got != c.want {
+			t.Errorf("NegotiateLocale(%q, %q) = %q, want %q", c.param, c.accept, got, c.want)
+		}
+	}
+}
+
+func TestValidTranslationLocale(t *testing.T) {
+	if ValidTranslationLocale("fr") || ValidTranslationLocale("es") || !ValidTranslationLocale("de") {
+		t.Error("only non-default catalog locales can be translated")
+	}
+}
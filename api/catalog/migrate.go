@@ -0,0 +1,336 @@
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ============================================================
+// Catalogue unifié — migration du catalogue legacy
+// (categorie / service / produit) vers categories / produits.
+//
+// Les tarifications, abonnements et devis référencent désormais
+// produits(id_produit). La migration est idempotente : chaque
+// référence n'est réécrite que tant que sa contrainte pointe
+// encore vers la table legacy produit.
+// ============================================================
+
+// Schema garantit les colonnes de correspondance legacy → canonique
+// (identique à la section 27 de db/01_schema.sql).
+var Schema = []string{
+	`ALTER TABLE IF EXISTS categories ADD COLUMN IF NOT EXISTS id_categorie_legacy INT UNIQUE`,
+	`ALTER TABLE IF EXISTS produits ADD COLUMN IF NOT EXISTS id_produit_legacy INT UNIQUE`,
+}
+
+// References liste les colonnes qui pointaient vers la table legacy produit.
+var References = []struct{ Table, Column string }{
+	{"tarification", "id_produit"},
+	{"abonnement", "id_produit"},
+	{"devis", "id_produit"},
+}
+
+type Report struct {
+	DryRun            bool           `json:"dryRun"`
+	CategoriesMapped  int            `json:"categoriesMapped"`
+	CategoriesCreated int            `json:"categoriesCreated"`
+	ProductsMapped    int            `json:"productsMapped"`
+	ProductsCreated   int            `json:"productsCreated"`
+	Remapped          map[string]int `json:"remapped"` // table → lignes réécrites
+	Unmapped          []string       `json:"unmapped,omitempty"`
+}
+
+// MigrateLegacy rapproche (par nom) ou crée chaque catégorie et produit legacy dans le
+// catalogue canonique, puis réécrit les références et repointe les clés étrangères.
+// En dryRun, tout est exécuté puis annulé afin de produire le rapport.
+func MigrateLegacy(ctx context.Context, db *sql.DB, dryRun bool) (Report, error) {
+	rep := Report{DryRun: dryRun, Remapped: map[string]int{}}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return rep, err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range Schema {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return rep, err
+		}
+	}
+	// Sans table legacy, la base a été créée directement avec le catalogue unifié.
+	if tableExists(ctx, tx, "produit") {
+		if err := migrateCategories(ctx, tx, &rep); err != nil {
+			return rep, fmt.Errorf("categories: %w", err)
+		}
+		if err := migrateProducts(ctx, tx, &rep); err != nil {
+			return rep, fmt.Errorf("produits: %w", err)
+		}
+		for _, ref := range References {
+			n, err := repoint(ctx, tx, ref.Table, ref.Column, &rep)
+			if err != nil {
+				return rep, fmt.Errorf("%s.%s: %w", ref.Table, ref.Column, err)
+			}
+			if n >= 0 {
+				rep.Remapped[ref.Table] = n
+			}
+		}
+	}
+	if dryRun {
+		return rep, nil
+	}
+	return rep, tx.Commit()
+}
+
+func migrateCategories(ctx context.Context, tx *sql.Tx, rep *Report) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT c.id_categorie, c.nom, COALESCE(c.description, ''), COALESCE(c.actif, TRUE)
+		FROM categorie c
+		WHERE NOT EXISTS (SELECT 1 FROM categories w WHERE w.id_categorie_legacy = c.id_categorie)
+		ORDER BY c.id_categorie`)
+	if err != nil {
+		return err
+	}
+	type legacy struct {
+		id         int
+		nom, descr string
+		actif      bool
+	}
+	var todo []legacy
+	for rows.Next() {
+		var l legacy
+		if err := rows.Scan(&l.id, &l.nom, &l.descr, &l.actif); err != nil {
+			rows.Close()
+			return err
+		}
+		todo = append(todo, l)
+	}
+	rows.Close()
+
+	for _, l := range todo {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE categories SET id_categorie_legacy = $1
+			WHERE id_categorie = (
+				SELECT id_categorie FROM categories
+				WHERE LOWER(nom) = LOWER($2) AND id_categorie_legacy IS NULL
+				ORDER BY id_categorie LIMIT 1)`, l.id, l.nom)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			rep.CategoriesMapped++
+			continue
+		}
+		slug, err := uniqueSlug(ctx, tx, `SELECT 1 FROM categories WHERE slug = $1`, l.nom)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO categories (nom, slug, description, actif, id_categorie_legacy)
+			VALUES ($1, $2, $3, $4, $5)`, uniqueName(ctx, tx, l.nom), slug, l.descr, l.actif, l.id); err != nil {
+			return err
+		}
+		rep.CategoriesCreated++
+	}
+	return nil
+}
+
+func migrateProducts(ctx context.Context, tx *sql.Tx, rep *Report) error {
+	// Le niveau "service" disparaît : un produit rejoint la catégorie de son service.
+	rows, err := tx.QueryContext(ctx, `
+		SELECT p.id_produit, p.nom, COALESCE(p.description, ''), COALESCE(p.sur_devis, FALSE),
+		       COALESCE(p.actif, TRUE), w.id_categorie,
+		       (SELECT t.prix FROM tarification t WHERE t.id_produit = p.id_produit AND t.actif = TRUE
+		        ORDER BY t.prix LIMIT 1)
+		FROM produit p
+		LEFT JOIN service s ON s.id_service = p.id_service
+		LEFT JOIN categories w ON w.id_categorie_legacy = s.id_categorie
+		WHERE NOT EXISTS (SELECT 1 FROM produits x WHERE x.id_produit_legacy = p.id_produit)
+		ORDER BY p.id_produit`)
+	if err != nil {
+		return err
+	}
+	type legacy struct {
+		id         int
+		nom, descr string
+		surDevis   bool
+		actif      bool
+		categorie  sql.NullInt64
+		prix       sql.NullFloat64
+	}
+	var todo []legacy
+	for rows.Next() {
+		var l legacy
+		if err := rows.Scan(&l.id, &l.nom, &l.descr, &l.surDevis, &l.actif, &l.categorie, &l.prix); err != nil {
+			rows.Close()
+			return err
+		}
+		todo = append(todo, l)
+	}
+	rows.Close()
+
+	for _, l := range todo {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE produits SET id_produit_legacy = $1
+			WHERE id_produit = (
+				SELECT id_produit FROM produits
+				WHERE LOWER(nom) = LOWER($2) AND id_produit_legacy IS NULL
+				ORDER BY id_produit LIMIT 1)`, l.id, l.nom)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			rep.ProductsMapped++
+			continue
+		}
+		slug, err := uniqueSlug(ctx, tx, `SELECT 1 FROM produits WHERE slug = $1`, l.nom)
+		if err != nil {
+			return err
+		}
+		typeAchat := "panier"
+		if l.surDevis {
+			typeAchat = "devis"
+		}
+		var prix interface{}
+		if l.prix.Valid {
+			prix = l.prix.Float64
+		}
+		var categorie interface{}
+		if l.categorie.Valid {
+			categorie = l.categorie.Int64
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO produits (nom, slug, description_courte, prix, id_categorie, type_achat, actif, id_produit_legacy)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			l.nom, slug, l.descr, prix, categorie, typeAchat, l.actif, l.id); err != nil {
+			return err
+		}
+		rep.ProductsCreated++
+	}
+	return nil
+}
+
+// repoint réécrit table.column (id legacy → id canonique) et remplace la clé étrangère
+// vers produit par une clé vers produits. Retourne -1 si la référence est déjà migrée.
+func repoint(ctx context.Context, tx *sql.Tx, table, column string, rep *Report) (int, error) {
+	if !tableExists(ctx, tx, table) {
+		return -1, nil
+	}
+	var constraint string
+	err := tx.QueryRowContext(ctx, `
+		SELECT con.conname
+		FROM pg_constraint con
+		JOIN pg_attribute att ON att.attrelid = con.conrelid AND att.attnum = ANY(con.conkey)
+		WHERE con.contype = 'f' AND con.conrelid = $1::regclass
+		  AND con.confrelid = 'produit'::regclass AND att.attname = $2`, table, column).Scan(&constraint)
+	if err == sql.ErrNoRows {
+		return -1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var orphans []string
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`
+		SELECT DISTINCT t.%[2]s FROM %[1]s t
+		WHERE t.%[2]s IS NOT NULL
+		  AND NOT EXISTS (SELECT 1 FROM produits p WHERE p.id_produit_legacy = t.%[2]s)`, table, column))
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		orphans = append(orphans, fmt.Sprintf("%s.%s=%d", table, column, id))
+	}
+	rows.Close()
+	if len(orphans) > 0 {
+		rep.Unmapped = append(rep.Unmapped, orphans...)
+		return 0, fmt.Errorf("%d référence(s) sans produit canonique", len(orphans))
+	}
+
+	// Toute valeur non nulle a un produit canonique : la colonne garde sa contrainte NOT NULL.
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s DROP CONSTRAINT %s`, table, quoteIdent(constraint))); err != nil {
+		return 0, err
+	}
+	res, err := tx.ExecContext(ctx, fmt.Sprintf(`
+		UPDATE %[1]s t SET %[2]s = p.id_produit
+		FROM produits p WHERE p.id_produit_legacy = t.%[2]s`, table, column))
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(
+		`ALTER TABLE %[1]s ADD CONSTRAINT %[1]s_%[2]s_produits_fkey FOREIGN KEY (%[2]s) REFERENCES produits(id_produit)`,
+		table, column)); err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+func tableExists(ctx context.Context, tx *sql.Tx, table string) bool {
+	var ok bool
+	tx.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, table).Scan(&ok)
+	return ok
+}
+
+func uniqueSlug(ctx context.Context, tx *sql.Tx, existsQuery, name string) (string, error) {
+	base := Slugify(name)
+	if base == "" {
+		base = "produit"
+	}
+	slug := base
+	for i := 2; ; i++ {
+		var one int
+		err := tx.QueryRowContext(ctx, existsQuery, slug).Scan(&one)
+		if err == sql.ErrNoRows {
+			return slug, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		slug = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// uniqueName suffixe le nom d'une catégorie créée si une catégorie homonyme déjà
+// rapprochée existe (categories.nom est unique).
+func uniqueName(ctx context.Context, tx *sql.Tx, name string) string {
+	candidate := name
+	for i := 2; ; i++ {
+		var one int
+		if tx.QueryRowContext(ctx, `SELECT 1 FROM categories WHERE nom = $1`, candidate).Scan(&one) == sql.ErrNoRows {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s (%d)", name, i)
+	}
+}
+
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+var accents = strings.NewReplacer(
+	"à", "a", "â", "a", "ä", "a", "á", "a", "ç", "c",
+	"é", "e", "è", "e", "ê", "e", "ë", "e", "î", "i", "ï", "i", "í", "i",
+	"ô", "o", "ö", "o", "ó", "o", "ù", "u", "û", "u", "ü", "u", "ú", "u",
+	"ÿ", "y", "ñ", "n", "œ", "oe", "æ", "ae",
+)
+
+// Slugify produit un slug ASCII en minuscules : "Sécurité Réseau" → "securite-reseau".
+func Slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range accents.Replace(strings.ToLower(s)) {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(r)
+			dash = false
+		case !dash && b.Len() > 0:
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
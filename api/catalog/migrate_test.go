@@ -0,0 +1,197 @@
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	cases := map[string]string{
+		"Pack EDR 50 postes":      "pack-edr-50-postes",
+		"Sécurité Réseau":         "securite-reseau",
+		"  SOC -- 24/7 (Managé) ": "soc-24-7-manage",
+		"Cœur & Données":          "coeur-donnees",
+		"!!!":                     "",
+	}
+	for in, want := range cases {
+		if got := Slugify(in); got != want {
+			t.Errorf("Slugify(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// ===== Pilote database/sql factice : réponses par motif de requête, journal des requêtes =====
+
+type fakeRule struct {
+	match    string
+	rows     [][]driver.Value
+	affected int64
+}
+
+type fakeDB struct {
+	mu    sync.Mutex
+	rules []fakeRule
+	log   []string
+}
+
+func (f *fakeDB) run(query string) fakeRule {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.log = append(f.log, query)
+	for _, r := range f.rules {
+		if strings.Contains(query, r.match) {
+			return r
+		}
+	}
+	return fakeRule{}
+}
+
+func (f *fakeDB) executed(substr string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, q := range f.log {
+		if strings.Contains(q, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	fakeMu  sync.Mutex
+	fakeDBs = map[string]*fakeDB{}
+)
+
+func init() { sql.Register("catalogfake", fakeDriver{}) }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeMu.Lock()
+	defer fakeMu.Unlock()
+	return fakeConn{fakeDBs[name]}, nil
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.db, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                 { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(s.db.run(s.query).affected), nil
+}
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &fakeRows{rows: s.db.run(s.query).rows}, nil
+}
+
+type fakeRows struct{ rows [][]driver.Value }
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return []string{"c"}
+	}
+	return make([]string, len(r.rows[0]))
+}
+func (r *fakeRows) Close() error { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func openFake(t *testing.T, rules ...fakeRule) (*fakeDB, *sql.Tx) {
+	t.Helper()
+	f := &fakeDB{rules: rules}
+	fakeMu.Lock()
+	fakeDBs[t.Name()] = f
+	fakeMu.Unlock()
+	db, err := sql.Open("catalogfake", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	return f, tx
+}
+
+// legacyRef : table existante dont la colonne référence encore la table legacy produit.
+var legacyRef = []fakeRule{
+	{match: "to_regclass", rows: [][]driver.Value{{true}}},
+	{match: "pg_constraint", rows: [][]driver.Value{{"devis_id_produit_fkey"}}},
+}
+
+func TestRepoint_ReportsOrphansWithoutAltering(t *testing.T) {
+	f, tx := openFake(t, append(legacyRef,
+		fakeRule{match: "SELECT DISTINCT", rows: [][]driver.Value{{int64(7)}, {int64(12)}}})...)
+	rep := Report{Remapped: map[string]int{}}
+	n, err := repoint(context.Background(), tx, "devis", "id_produit", &rep)
+	if err == nil || n != 0 {
+		t.Fatalf("orphan references must abort the repoint, got n=%d err=%v", n, err)
+	}
+	if want := []string{"devis.id_produit=7", "devis.id_produit=12"}; !reflect.DeepEqual(rep.Unmapped, want) {
+		t.Errorf("Unmapped = %v, want %v", rep.Unmapped, want)
+	}
+	if f.executed("ALTER TABLE") || f.executed("UPDATE") {
+		t.Errorf("nothing may be altered when references are orphaned: %q", f.log)
+	}
+}
+
+func TestRepoint_RewritesAndKeepsNotNull(t *testing.T) {
+	f, tx := openFake(t, append(legacyRef, fakeRule{match: "UPDATE devis", affected: 3})...)
+	rep := Report{Remapped: map[string]int{}}
+	n, err := repoint(context.Background(), tx, "devis", "id_produit", &rep)
+	if err != nil || n != 3 {
+		t.Fatalf("repoint = %d, %v; want 3 rows", n, err)
+	}
+	for _, want := range []string{
+		`ALTER TABLE devis DROP CONSTRAINT "devis_id_produit_fkey"`,
+		"FOREIGN KEY (id_produit) REFERENCES produits(id_produit)",
+	} {
+		if !f.executed(want) {
+			t.Errorf("missing statement %q in %q", want, f.log)
+		}
+	}
+	if f.executed("DROP NOT NULL") {
+		t.Error("the NOT NULL constraint must be kept")
+	}
+	if len(rep.Unmapped) != 0 {
+		t.Errorf("unexpected orphans %v", rep.Unmapped)
+	}
+}
+
+func TestRepoint_AlreadyMigrated(t *testing.T) {
+	f, tx := openFake(t, fakeRule{match: "to_regclass", rows: [][]driver.Value{{true}}})
+	n, err := repoint(context.Background(), tx, "tarification", "id_produit", &Report{})
+	if err != nil || n != -1 {
+		t.Fatalf("repoint = %d, %v; want -1 when no key points to produit", n, err)
+	}
+	if f.executed("ALTER TABLE") {
+		t.Error("an already migrated reference must not be altered")
+	}
+}
@@ -0,0 +1,103 @@
+package catalog
+
+import (
+	"html"
+	"sort"
+	"strings"
+)
+
+// ============================================================
+// Autocomplétion — index de préfixes en mémoire.
+// Chaque nom (produit ou catégorie) est indexé à partir du début
+// de chacun de ses mots : "pare feu" et "feu" retrouvent tous deux
+// "Pare-feu managé". Recherche par dichotomie sur les clés triées.
+// ============================================================
+
+// Suggestion est une complétion proposée par GET /api/public/search/suggest.
+type Suggestion struct {
+	Type          string   `json:"type"` // product | category
+	ID            int      `json:"id"`
+	Nom           string   `json:"nom"`
+	Slug          string   `json:"slug"`
+	CategorieNom  string   `json:"categorie_nom,omitempty"`
+	CategorieSlug string   `json:"categorie_slug,omitempty"`
+	Prix          *float64 `json:"prix,omitempty"`
+	Ordre         int      `json:"-"` // ordre d'affichage : départage les complétions équivalentes
+}
+
+type SuggestIndex struct {
+	keys  []suggestKey
+	items []Suggestion
+}
+
+type suggestKey struct {
+	text  string
+	item  int
+	inner bool // clé issue d'un mot autre que le premier
+}
+
+// NewSuggestIndex construit l'index à partir des produits et catégories actifs.
+func NewSuggestIndex(items []Suggestion) *SuggestIndex {
+	ix := &SuggestIndex{items: items}
+	for i, it := range items {
+		words := strings.Fields(Normalize(it.Nom))
+		for w := range words {
+			ix.keys = append(ix.keys, suggestKey{text: strings.Join(words[w:], " "), item: i, inner: w > 0})
+		}
+	}
+	sort.Slice(ix.keys, func(a, b int) bool { return ix.keys[a].text < ix.keys[b].text })
+	return ix
+}
+
+// Len retourne le nombre d'entrées indexées.
+func (ix *SuggestIndex) Len() int { return len(ix.items) }
+
+// Lookup retourne au plus limit complétions pour la saisie prefix : d'abord les noms qui
+// commencent par la saisie, puis ceux dont un mot y correspond ; catégories avant produits.
+func (ix *SuggestIndex) Lookup(prefix string, limit int) []Suggestion {
+	out := []Suggestion{}
+	p := Normalize(prefix)
+	if p == "" || limit <= 0 {
+		return out
+	}
+	best := map[int]bool{} // item → correspondance en milieu de nom uniquement
+	for i := sort.Search(len(ix.keys), func(i int) bool { return ix.keys[i].text >= p }); i < len(ix.keys); i++ {
+		k := ix.keys[i]
+		if !strings.HasPrefix(k.text, p) {
+			break
+		}
+		if inner, seen := best[k.item]; !seen || (inner && !k.inner) {
+			best[k.item] = k.inner
+		}
+	}
+	matches := make([]int, 0, len(best))
+	for item := range best {
+		matches = append(matches, item)
+	}
+	sort.Slice(matches, func(a, b int) bool {
+		x, y := ix.items[matches[a]], ix.items[matches[b]]
+		if best[matches[a]] != best[matches[b]] {
+			return !best[matches[a]]
+		}
+		if x.Type != y.Type {
+			return x.Type == "category"
+		}
+		if x.Ordre != y.Ordre {
+			return x.Ordre < y.Ordre
+		}
+		return x.Nom < y.Nom
+	})
+	for _, item := range matches {
+		if len(out) == limit {
+			break
+		}
+		out = append(out, ix.items[item])
+	}
+	return out
+}
+
+// Normalize ramène une saisie à ses mots en minuscules sans accents :
+// "Pare-feu  Managé" → "pare feu manage". Les noms stockés échappés (&amp;) sont décodés.
+func Normalize(s string) string {
+	return strings.ReplaceAll(Slugify(html.UnescapeString(s)), "-", " ")
+}
@@ -0,0 +1,44 @@
+package catalog
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	cases := map[string]string{
+		"Pare-feu  Managé":   "pare feu manage",
+		"Cœur &amp; Données": "coeur donnees",
+		"  ":                 "",
+	}
+	for in, want := range cases {
+		if got := Normalize(in); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSuggestIndexLookup(t *testing.T) {
+	ix := NewSuggestIndex([]Suggestion{
+		{Type: "product", ID: 1, Nom: "Pare-feu managé", Ordre: 2},
+		{Type: "product", ID: 2, Nom: "Audit pare-feu", Ordre: 1},
+		{Type: "category", ID: 3, Nom: "Pare-feu & Réseau", Ordre: 5},
+		{Type: "product", ID: 4, Nom: "EDR Premium", Ordre: 0},
+	})
+	got := ix.Lookup("PARE f", 10)
+	want := []int{3, 1, 2} // début de nom (catégorie d'abord), puis mot intérieur
+	if len(got) != len(want) {
+		t.Fatalf("Lookup = %+v", got)
+	}
+	for i, id := range want {
+		if got[i].ID != id {
+			t.Errorf("Lookup[%d] = %d, want %d", i, got[i].ID, id)
+		}
+	}
+	if got := ix.Lookup("feu", 2); len(got) != 2 || got[0].ID != 3 || got[1].ID != 2 {
+		t.Errorf("Lookup(feu, 2) = %+v", got)
+	}
+	if got := ix.Lookup("reseau", 10); len(got) != 1 || got[0].ID != 3 {
+		t.Errorf("Lookup(reseau) = %+v", got)
+	}
+	if got := ix.Lookup("  ", 10); len(got) != 0 {
+		t.Errorf("Lookup(blank) = %+v", got)
+	}
+}
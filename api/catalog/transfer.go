@@ -0,0 +1,401 @@
+package catalog
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ============================================================
+// Import / export du catalogue — format d'échange (CSV ou JSON)
+// des catégories, produits et tarifs, identifiés par leur slug,
+// et validation des lignes indépendante de la base.
+// ============================================================
+
+const (
+	RecordCategorie = "categorie"
+	RecordProduit   = "produit"
+	RecordTarif     = "tarif"
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// CategoryRecord : catégorie identifiée par son slug.
+type CategoryRecord struct {
+	Line           int    `json:"-"`
+	Slug           string `json:"slug"`
+	Nom            string `json:"nom"`
+	Description    string `json:"description,omitempty"`
+	Image          string `json:"image,omitempty"`
+	Icone          string `json:"icone,omitempty"`
+	Couleur        string `json:"couleur,omitempty"`
+	OrdreAffichage int    `json:"ordre_affichage"`
+	Actif          *bool  `json:"actif,omitempty"` // absent : inchangé (actif à la création)
+
+	issues []string
+}
+
+// ProductRecord : produit identifié par son slug, rattaché à une catégorie par slug.
+type ProductRecord struct {
+	Line              int      `json:"-"`
+	Slug              string   `json:"slug"`
+	Categorie         string   `json:"categorie"`
+	Nom               string   `json:"nom"`
+	DescriptionCourte string   `json:"description_courte,omitempty"`
+	DescriptionLongue string   `json:"description_longue,omitempty"`
+	DescriptionHTML   string   `json:"description_html,omitempty"`
+	Images            string   `json:"images,omitempty"` // tableau JSON d'URL
+	Prix              *float64 `json:"prix,omitempty"`
+	Devise            string   `json:"devise,omitempty"`
+	Duree             string   `json:"duree,omitempty"`
+	Tag               string   `json:"tag,omitempty"`
+	Statut            string   `json:"statut,omitempty"`
+	TypeAchat         string   `json:"type_achat,omitempty"`
+	OrdreAffichage    int      `json:"ordre_affichage"`
+	Actif             *bool    `json:"actif,omitempty"`
+
+	issues []string
+}
+
+// PriceRecord : tarif catalogue d'un produit (hors variantes), identifié par le slug
+// du produit et la périodicité.
+type PriceRecord struct {
+	Line        int      `json:"-"`
+	Produit     string   `json:"produit"`
+	Periodicite string   `json:"periodicite"`
+	Prix        float64  `json:"prix"`
+	Unite       string   `json:"unite,omitempty"`
+	PrixUsage   *float64 `json:"prix_usage,omitempty"`
+	Agregation  string   `json:"agregation,omitempty"`
+	Actif       *bool    `json:"actif,omitempty"`
+
+	issues []string
+}
+
+// Bundle : contenu d'un fichier d'import ou d'export.
+type Bundle struct {
+	Categories []CategoryRecord `json:"categories"`
+	Produits   []ProductRecord  `json:"produits"`
+	Tarifs     []PriceRecord    `json:"tarifs"`
+}
+
+// CSVColumns : en-tête du format CSV. La colonne type indique la nature de la ligne
+// (categorie, produit ou tarif) ; pour un tarif, slug est celui du produit.
+var CSVColumns = []string{
+	"type", "slug", "categorie", "nom", "description", "description_longue", "description_html",
+	"image", "images", "icone", "couleur", "prix", "devise", "duree", "tag", "statut", "type_achat",
+	"ordre_affichage", "actif", "periodicite", "unite", "prix_usage", "agregation",
+}
+
+// ParseJSON lit un fichier d'import JSON ; les lignes sont numérotées par section.
+func ParseJSON(r io.Reader) (Bundle, error) {
+	var b Bundle
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&b); err != nil {
+		return b, fmt.Errorf("JSON invalide : %w", err)
+	}
+	for i := range b.Categories {
+		b.Categories[i].Line = i + 1
+	}
+	for i := range b.Produits {
+		b.Produits[i].Line = i + 1
+	}
+	for i := range b.Tarifs {
+		b.Tarifs[i].Line = i + 1
+	}
+	return b, nil
+}
+
+// ParseCSV lit un fichier d'import CSV (séparateur virgule ou point-virgule, en-tête
+// obligatoire). Les valeurs illisibles sont signalées sur leur ligne, numérotée comme
+// dans un tableur (l'en-tête est la ligne 1).
+func ParseCSV(r io.Reader) (Bundle, error) {
+	var b Bundle
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return b, err
+	}
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	cr := csv.NewReader(strings.NewReader(text))
+	if first, _, _ := strings.Cut(text, "\n"); strings.Count(first, ";") > strings.Count(first, ",") {
+		cr.Comma = ';'
+	}
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return b, fmt.Errorf("CSV invalide : en-tête illisible")
+	}
+	col := map[string]int{}
+	for i, h := range header {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	if _, ok := col["type"]; !ok {
+		return b, fmt.Errorf("CSV invalide : colonne type manquante")
+	}
+	if _, ok := col["slug"]; !ok {
+		return b, fmt.Errorf("CSV invalide : colonne slug manquante")
+	}
+
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return b, fmt.Errorf("CSV invalide : %v", err)
+		}
+		line, _ := cr.FieldPos(0)
+		get := func(name string) string {
+			if i, ok := col[name]; ok && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		var issues []string
+		num := func(name string) *float64 {
+			s := strings.Replace(get(name), ",", ".", 1)
+			if s == "" {
+				return nil
+			}
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				issues = append(issues, fmt.Sprintf("%s : nombre invalide %q", name, get(name)))
+				return nil
+			}
+			return &v
+		}
+		integer := func(name string) int {
+			if get(name) == "" {
+				return 0
+			}
+			v, err := strconv.Atoi(get(name))
+			if err != nil {
+				issues = append(issues, fmt.Sprintf("%s : entier invalide %q", name, get(name)))
+			}
+			return v
+		}
+		boolean := func(name string) *bool {
+			v, ok := parseBool(get(name))
+			if !ok {
+				issues = append(issues, fmt.Sprintf("%s : booléen invalide %q", name, get(name)))
+			}
+			return v
+		}
+
+		switch kind := strings.ToLower(get("type")); kind {
+		case RecordCategorie:
+			c := CategoryRecord{
+				Line: line, Slug: get("slug"), Nom: get("nom"), Description: get("description"),
+				Image: get("image"), Icone: get("icone"), Couleur: get("couleur"),
+				OrdreAffichage: integer("ordre_affichage"), Actif: boolean("actif"),
+			}
+			c.issues = issues
+			b.Categories = append(b.Categories, c)
+		case RecordProduit:
+			p := ProductRecord{
+				Line: line, Slug: get("slug"), Categorie: get("categorie"), Nom: get("nom"),
+				DescriptionCourte: get("description"), DescriptionLongue: get("description_longue"),
+				DescriptionHTML: get("description_html"), Images: get("images"), Prix: num("prix"),
+				Devise: get("devise"), Duree: get("duree"), Tag: get("tag"), Statut: get("statut"),
+				TypeAchat: get("type_achat"), OrdreAffichage: integer("ordre_affichage"),
+				Actif: boolean("actif"),
+			}
+			p.issues = issues
+			b.Produits = append(b.Produits, p)
+		case RecordTarif:
+			p := PriceRecord{
+				Line: line, Produit: get("slug"), Periodicite: get("periodicite"), Unite: get("unite"),
+				PrixUsage: num("prix_usage"), Agregation: get("agregation"), Actif: boolean("actif"),
+			}
+			if prix := num("prix"); prix != nil {
+				p.Prix = *prix
+			} else if get("prix") == "" {
+				issues = append(issues, "prix requis")
+			}
+			p.issues = issues
+			b.Tarifs = append(b.Tarifs, p)
+		default:
+			if strings.Join(rec, "") == "" {
+				continue // ligne vide
+			}
+			return b, fmt.Errorf("CSV invalide (ligne %d) : type %q inconnu (categorie, produit ou tarif)", line, kind)
+		}
+	}
+	return b, nil
+}
+
+func parseBool(s string) (*bool, bool) {
+	var v bool
+	switch strings.ToLower(s) {
+	case "":
+		return nil, true
+	case "true", "1", "oui", "yes", "vrai":
+		v = true
+	case "false", "0", "non", "no", "faux":
+		v = false
+	default:
+		return nil, false
+	}
+	return &v, true
+}
+
+// WriteCSV écrit le catalogue au format CSV d'import.
+func WriteCSV(w io.Writer, b Bundle) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(CSVColumns); err != nil {
+		return err
+	}
+	row := func(values map[string]string) error {
+		rec := make([]string, len(CSVColumns))
+		for i, c := range CSVColumns {
+			rec[i] = values[c]
+		}
+		return cw.Write(rec)
+	}
+	for _, c := range b.Categories {
+		if err := row(map[string]string{
+			"type": RecordCategorie, "slug": c.Slug, "nom": c.Nom, "description": c.Description,
+			"image": c.Image, "icone": c.Icone, "couleur": c.Couleur,
+			"ordre_affichage": strconv.Itoa(c.OrdreAffichage), "actif": formatBool(c.Actif),
+		}); err != nil {
+			return err
+		}
+	}
+	for _, p := range b.Produits {
+		if err := row(map[string]string{
+			"type": RecordProduit, "slug": p.Slug, "categorie": p.Categorie, "nom": p.Nom,
+			"description": p.DescriptionCourte, "description_longue": p.DescriptionLongue,
+			"description_html": p.DescriptionHTML, "images": p.Images, "prix": formatFloat(p.Prix),
+			"devise": p.Devise, "duree": p.Duree, "tag": p.Tag, "statut": p.Statut, "type_achat": p.TypeAchat,
+			"ordre_affichage": strconv.Itoa(p.OrdreAffichage), "actif": formatBool(p.Actif),
+		}); err != nil {
+			return err
+		}
+	}
+	for _, t := range b.Tarifs {
+		if err := row(map[string]string{
+			"type": RecordTarif, "slug": t.Produit, "prix": formatFloat(&t.Prix), "periodicite": t.Periodicite,
+			"unite": t.Unite, "prix_usage": formatFloat(t.PrixUsage), "agregation": t.Agregation,
+			"actif": formatBool(t.Actif),
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatFloat(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
+
+func formatBool(v *bool) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatBool(*v)
+}
+
+// Validate contrôle chaque ligne (champs requis, valeurs connues, doublons dans le
+// fichier) et retourne le nombre de lignes en erreur. Les motifs sont conservés sur
+// les lignes pour le rapport d'import.
+func (b *Bundle) Validate() int {
+	invalid := 0
+	seen := map[string]bool{}
+	for i := range b.Categories {
+		c := &b.Categories[i]
+		c.Slug, c.Nom = strings.TrimSpace(c.Slug), strings.TrimSpace(c.Nom)
+		c.issues = append(c.issues, checkSlug(c.Slug)...)
+		if c.Nom == "" {
+			c.issues = append(c.issues, "nom requis")
+		}
+		if seen[c.Slug] {
+			c.issues = append(c.issues, "slug en double dans le fichier")
+		}
+		seen[c.Slug] = true
+		if len(c.issues) > 0 {
+			invalid++
+		}
+	}
+
+	seen = map[string]bool{}
+	for i := range b.Produits {
+		p := &b.Produits[i]
+		p.Slug, p.Nom, p.Categorie = strings.TrimSpace(p.Slug), strings.TrimSpace(p.Nom), strings.TrimSpace(p.Categorie)
+		p.issues = append(p.issues, checkSlug(p.Slug)...)
+		if p.Nom == "" {
+			p.issues = append(p.issues, "nom requis")
+		}
+		if p.Categorie == "" {
+			p.issues = append(p.issues, "categorie requise")
+		}
+		if p.TypeAchat != "" && p.TypeAchat != "panier" && p.TypeAchat != "devis" {
+			p.issues = append(p.issues, "type_achat doit valoir panier ou devis")
+		}
+		if p.Prix != nil && *p.Prix < 0 {
+			p.issues = append(p.issues, "prix négatif")
+		}
+		if p.Images != "" {
+			var urls []string
+			if json.Unmarshal([]byte(p.Images), &urls) != nil {
+				p.issues = append(p.issues, "images doit être un tableau JSON d'URL")
+			}
+		}
+		if seen[p.Slug] {
+			p.issues = append(p.issues, "slug en double dans le fichier")
+		}
+		seen[p.Slug] = true
+		if len(p.issues) > 0 {
+			invalid++
+		}
+	}
+
+	seen = map[string]bool{}
+	for i := range b.Tarifs {
+		t := &b.Tarifs[i]
+		t.Produit, t.Periodicite = strings.TrimSpace(t.Produit), strings.TrimSpace(t.Periodicite)
+		if t.Produit == "" {
+			t.issues = append(t.issues, "produit requis")
+		}
+		if t.Periodicite == "" {
+			t.issues = append(t.issues, "periodicite requise")
+		}
+		if t.Prix < 0 || (t.PrixUsage != nil && *t.PrixUsage < 0) {
+			t.issues = append(t.issues, "prix négatif")
+		}
+		// Mêmes valeurs que billing.AgregationSomme / AgregationMax.
+		if t.Agregation != "" && t.Agregation != "sum" && t.Agregation != "max" {
+			t.issues = append(t.issues, "agregation doit valoir sum ou max")
+		}
+		if t.PrixUsage != nil && strings.TrimSpace(t.Unite) == "" {
+			t.issues = append(t.issues, "prix_usage requiert une unite")
+		}
+		key := t.Produit + "\x00" + strings.ToLower(t.Periodicite)
+		if seen[key] {
+			t.issues = append(t.issues, "tarif en double dans le fichier (produit, periodicite)")
+		}
+		seen[key] = true
+		if len(t.issues) > 0 {
+			invalid++
+		}
+	}
+	return invalid
+}
+
+func checkSlug(slug string) []string {
+	if slug == "" {
+		return []string{"slug requis"}
+	}
+	if !slugPattern.MatchString(slug) {
+		return []string{fmt.Sprintf("slug %q invalide (minuscules, chiffres et tirets)", slug)}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package catalog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const sampleCSV = "\ufefftype;slug;categorie;nom;prix;actif;periodicite;unite\n" +
+	"categorie;edr;;EDR;;oui;;\n" +
+	"produit;edr-pro;edr;EDR Pro;19,90;;;\n" +
+	"tarif;edr-pro;;;199;;annuel;poste\n" +
+	"tarif;edr-pro;;;abc;;mensuel;poste\n"
+
+func TestParseCSV(t *testing.T) {
+	b, err := ParseCSV(strings.NewReader(sampleCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Categories) != 1 || len(b.Produits) != 1 || len(b.Tarifs) != 2 {
+		t.Fatalf("unexpected bundle: %+v", b)
+	}
+	if c := b.Categories[0]; c.Slug != "edr" || c.Actif == nil || !*c.Actif || c.Line != 2 {
+		t.Errorf("unexpected category: %+v", c)
+	}
+	if p := b.Produits[0]; p.Prix == nil || *p.Prix != 19.90 || p.Actif != nil || p.Categorie != "edr" {
+		t.Errorf("unexpected product: %+v", p)
+	}
+	if b.Tarifs[0].Prix != 199 || b.Tarifs[0].Unite != "poste" {
+		t.Errorf("unexpected price: %+v", b.Tarifs[0])
+	}
+	if invalid := b.Validate(); invalid != 1 || len(b.Tarifs[1].issues) == 0 || b.Tarifs[1].Line != 5 {
+		t.Errorf("expected only line 5 to be invalid, got %d: %+v", invalid, b.Tarifs[1])
+	}
+}
+
+func TestParseCSVRejectsUnknownType(t *testing.T) {
+	if _, err := ParseCSV(strings.NewReader("type,slug\npack,promo\n")); err == nil {
+		t.Error("unknown row type should fail")
+	}
+	if _, err := ParseCSV(strings.NewReader("slug,nom\nedr,EDR\n")); err == nil {
+		t.Error("missing type column should fail")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	neg := -1.0
+	b := Bundle{
+		Categories: []CategoryRecord{{Slug: "soc", Nom: "SOC"}, {Slug: "soc", Nom: "SOC bis"}},
+		Produits: []ProductRecord{
+			{Slug: "Bad Slug", Nom: "X", Categorie: "soc"},
+			{Slug: "soc-pme", Nom: "SOC PME", Categorie: "soc", TypeAchat: "abonnement", Images: "not json"},
+			{Slug: "soc-eti", Nom: "SOC ETI", Categorie: "soc", Images: `["/img/soc.png"]`},
+		},
+		Tarifs: []PriceRecord{
+			{Produit: "soc-eti", Periodicite: "mensuel", Prix: 10},
+			{Produit: "soc-eti", Periodicite: "Mensuel", Prix: 12},
+			{Produit: "soc-eti", Periodicite: "annuel", Prix: 100, PrixUsage: &neg, Agregation: "avg"},
+		},
+	}
+	if invalid := b.Validate(); invalid != 5 {
+		t.Fatalf("expected 5 invalid rows, got %d", invalid)
+	}
+	if len(b.Categories[0].issues) != 0 || len(b.Produits[2].issues) != 0 || len(b.Tarifs[0].issues) != 0 {
+		t.Error("valid rows should have no issues")
+	}
+	if got := len(b.Produits[1].issues); got != 2 {
+		t.Errorf("expected type_achat and images issues, got %v", b.Produits[1].issues)
+	}
+	if got := len(b.Tarifs[2].issues); got != 3 {
+		t.Errorf("expected negative price, aggregation and unit issues, got %v", b.Tarifs[2].issues)
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	prix, actif := 499.0, false
+	in := Bundle{
+		Categories: []CategoryRecord{{Slug: "soc", Nom: "SOC", Description: "Supervision, alerting", Actif: &actif}},
+		Produits:   []ProductRecord{{Slug: "soc-essentials", Categorie: "soc", Nom: "SOC Essentials", Prix: &prix, Images: `["a.png"]`}},
+		Tarifs:     []PriceRecord{{Produit: "soc-essentials", Periodicite: "mensuel", Prix: 499, Agregation: "sum"}},
+	}
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	out, err := ParseCSV(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Validate() != 0 {
+		t.Fatalf("exported catalog should re-import cleanly: %+v", out)
+	}
+	if out.Categories[0].Description != "Supervision, alerting" || *out.Categories[0].Actif {
+		t.Errorf("category mismatch: %+v", out.Categories[0])
+	}
+	if *out.Produits[0].Prix != 499 || out.Produits[0].Images != `["a.png"]` || out.Tarifs[0].Periodicite != "mensuel" {
+		t.Errorf("round trip mismatch: %+v %+v", out.Produits[0], out.Tarifs[0])
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	b, err := ParseJSON(strings.NewReader(`{"produits":[{"slug":"edr-pro","categorie":"edr","nom":"EDR Pro"}]}`))
+	if err != nil || len(b.Produits) != 1 || b.Produits[0].Line != 1 {
+		t.Fatalf("ParseJSON = %+v, %v", b, err)
+	}
+	if _, err := ParseJSON(strings.NewReader(`{"produits":[{"slug":"x","price":1}]}`)); err == nil {
+		t.Error("unknown fields should be rejected")
+	}
+}
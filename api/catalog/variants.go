@@ -0,0 +1,99 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ============================================================
+// Variantes produit — règles indépendantes de la base :
+// format des SKU et codes, disponibilité, et validation d'une
+// combinaison (une valeur pour chaque option du produit).
+// ============================================================
+
+const (
+	DisponibiliteDisponible   = "disponible"
+	DisponibiliteSurDevis     = "sur_devis"
+	DisponibiliteIndisponible = "indisponible"
+)
+
+var (
+	skuPattern  = regexp.MustCompile(`^[A-Z0-9][A-Z0-9_-]{2,39}$`)
+	codePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+)
+
+// OptionDef décrit une option d'un produit et les codes de ses valeurs.
+type OptionDef struct {
+	Code   string
+	Values []string
+}
+
+// NormalizeSKU met un SKU saisi en majuscules sans espaces superflus.
+func NormalizeSKU(s string) string {
+	return strings.ToUpper(strings.TrimSpace(s))
+}
+
+// ValidSKU : 3 à 40 caractères A-Z, 0-9, '-' ou '_' (après NormalizeSKU).
+func ValidSKU(s string) bool {
+	return skuPattern.MatchString(s)
+}
+
+// ValidCode : code d'option ou de valeur (minuscules, chiffres, '-' ou '_', 50 caractères max).
+func ValidCode(s string) bool {
+	return codePattern.MatchString(s)
+}
+
+// ValidDisponibilite indique si la valeur fait partie des disponibilités connues.
+func ValidDisponibilite(s string) bool {
+	switch s {
+	case DisponibiliteDisponible, DisponibiliteSurDevis, DisponibiliteIndisponible:
+		return true
+	}
+	return false
+}
+
+// CheckCombination vérifie qu'une variante choisit exactement une valeur existante
+// pour chacune des options du produit.
+func CheckCombination(options []OptionDef, chosen map[string]string) error {
+	if len(options) == 0 {
+		return errors.New("le produit n'a aucune option")
+	}
+	known := make(map[string]bool, len(options))
+	for _, o := range options {
+		known[o.Code] = true
+		v, ok := chosen[o.Code]
+		if !ok {
+			return fmt.Errorf("valeur manquante pour l'option %q", o.Code)
+		}
+		found := false
+		for _, allowed := range o.Values {
+			if allowed == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("valeur %q inconnue pour l'option %q", v, o.Code)
+		}
+	}
+	for code := range chosen {
+		if !known[code] {
+			return fmt.Errorf("option %q inconnue", code)
+		}
+	}
+	return nil
+}
+
+// CombinationKey retourne la clé canonique d'une combinaison ("endpoints=100;support=24-7"),
+// indépendante de l'ordre de saisie ; elle garantit l'unicité des variantes actives.
+func CombinationKey(chosen map[string]string) string {
+	parts := make([]string, 0, len(chosen))
+	for code, v := range chosen {
+		parts = append(parts, code+"="+v)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ";")
+}
@@ -0,0 +1,47 @@
+package catalog
+
+import "testing"
+
+func TestValidSKU(t *testing.T) {
+	for sku, want := range map[string]bool{
+		NormalizeSKU(" soc-100-90j "): true,
+		"SOC_250":                     true,
+		"AB":                          false,
+		"-SOC":                        false,
+		"SOC 100":                     false,
+		"soc-100":                     false,
+	} {
+		if got := ValidSKU(sku); got != want {
+			t.Errorf("ValidSKU(%q) = %v, want %v", sku, got, want)
+		}
+	}
+}
+
+func TestCheckCombination(t *testing.T) {
+	options := []OptionDef{
+		{Code: "endpoints", Values: []string{"50", "100"}},
+		{Code: "support", Values: []string{"ouvre", "24-7"}},
+	}
+	if err := CheckCombination(options, map[string]string{"endpoints": "100", "support": "24-7"}); err != nil {
+		t.Errorf("valid combination: %v", err)
+	}
+	for _, chosen := range []map[string]string{
+		{"endpoints": "100"},
+		{"endpoints": "500", "support": "24-7"},
+		{"endpoints": "100", "support": "24-7", "retention": "90j"},
+	} {
+		if err := CheckCombination(options, chosen); err == nil {
+			t.Errorf("CheckCombination(%v) should fail", chosen)
+		}
+	}
+	if err := CheckCombination(nil, map[string]string{}); err == nil {
+		t.Error("product without options should fail")
+	}
+}
+
+func TestCombinationKey(t *testing.T) {
+	got := CombinationKey(map[string]string{"support": "24-7", "endpoints": "100"})
+	if got != "endpoints=100;support=24-7" {
+		t.Errorf("CombinationKey = %q", got)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"api/catalog"
+	"api/config"
+)
+
+// runCommand exécute une sous-commande d'administration (`./api <commande>`).
+// Retourne false si args ne désigne aucune commande (démarrage normal du serveur).
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "migrate-catalog":
+		dryRun := len(args) > 1 && (args[1] == "--dry-run" || args[1] == "-n")
+		config.Init()
+		rep, err := catalog.MigrateLegacy(context.Background(), config.DB, dryRun)
+		out, _ := json.MarshalIndent(rep, "", "  ")
+		fmt.Println(string(out))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "migrate-catalog: %v\n", err)
+			os.Exit(1)
+		}
+		return true
+	}
+	return false
+}
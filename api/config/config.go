@@ -12,21 +12,19 @@ import (
 
 var DB *sql.DB
 
-func Init() {
-	host := getEnv("DB_HOST", "localhost")
-	port := getEnv("DB_PORT", "5432")
-	user := getEnv("DB_USER", "postgres")
-	password := getEnv("DB_PASSWORD", "password")
-	dbname := getEnv("DB_NAME", "mydb")
-	sslmode := getEnv("DB_SSLMODE", "disable")
-
-	connStr := fmt.Sprintf(
+// ConnString retourne la chaîne de connexion PostgreSQL (variables DB_*). Elle sert aussi
+// aux connexions dédiées hors pool (LISTEN).
+func ConnString() string {
+	host, port, user, password, dbname := DBEnv()
+	return fmt.Sprintf(
 		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		host, port, user, password, dbname, sslmode,
+		host, port, user, password, dbname, getEnv("DB_SSLMODE", "disable"),
 	)
+}
 
+func Init() {
 	var err error
-	DB, err = sql.Open("postgres", connStr)
+	DB, err = sql.Open("postgres", ConnString())
 	if err != nil {
 		log.Fatalf("[config] sql.Open: %v", err)
 	}
@@ -58,3 +58,17 @@ func TestDBEnv_Defaults(t *testing.T) {
 		t.Errorf("expected dbname 'mydb', got '%s'", dbname)
 	}
 }
+
+func TestConnString(t *testing.T) {
+	t.Setenv("DB_HOST", "db")
+	t.Setenv("DB_PORT", "5433")
+	t.Setenv("DB_USER", "cyna")
+	t.Setenv("DB_PASSWORD", "secret")
+	t.Setenv("DB_NAME", "cyna")
+	t.Setenv("DB_SSLMODE", "")
+
+	want := "host=db port=5433 user=cyna password=secret dbname=cyna sslmode=disable"
+	if got := ConnString(); got != want {
+		t.Errorf("ConnString() = %q, want %q", got, want)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"html"
 	"log"
 	"net/http"
 	"strconv"
@@ -102,6 +104,7 @@ func CreateAPIToken(w http.ResponseWriter, r *http.Request) {
 		jsonErr(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	notifySecurity(r, body.IDUtilisateur, "Nouvelle clé API", fmt.Sprintf("La clé API « %s » a été créée pour votre compte", html.UnescapeString(body.Nom)))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{
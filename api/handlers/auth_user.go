@@ -249,6 +249,7 @@ func Verify2FA(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error saving 2FA secret", http.StatusInternalServerError)
 		return
 	}
+	notifySecurity(r, userID, "Double authentification activée", "La double authentification a été activée sur votre compte")
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "2FA enabled successfully"})
 }
@@ -278,6 +279,7 @@ func Remove2FA(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error removing 2FA", http.StatusInternalServerError)
 		return
 	}
+	notifySecurity(r, targetUserID, "Double authentification désactivée", "La double authentification a été désactivée sur votre compte")
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "2FA disabled successfully"})
 }
@@ -345,6 +347,7 @@ func RegisterWebAuthn(w http.ResponseWriter, r *http.Request) {
 		jsonErr(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	notifySecurity(r, userID, "Clé de sécurité ajoutée", "Une clé de sécurité (WebAuthn) a été enregistrée sur votre compte")
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -361,6 +364,7 @@ func RemoveWebAuthn(w http.ResponseWriter, r *http.Request) {
 		jsonErr(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	notifySecurity(r, userID, "Clé de sécurité supprimée", "La clé de sécurité (WebAuthn) de votre compte a été supprimée")
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -733,6 +737,7 @@ func ResetUser2FA(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
+	notifySecurity(r, targetUserID, "Double authentification réinitialisée", "Un administrateur a réinitialisé la double authentification de votre compte")
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "2FA reset successfully"})
 }
@@ -831,6 +836,7 @@ func UpdateUserProfile(w http.ResponseWriter, r *http.Request) {
 		}
 		// Password changed successfully: this account is no longer considered in first-login state.
 		_, _ = config.DB.Exec("UPDATE utilisateur SET derniere_connexion = NOW() WHERE id_utilisateur = $1", userID)
+		notifySecurity(r, userID, "Mot de passe modifié", "Le mot de passe de votre compte a été modifié")
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"message": "Password updated successfully"})
 		return
@@ -1001,6 +1007,7 @@ func ResetPassword(w http.ResponseWriter, r *http.Request) {
 		jsonErr(w, "Failed to update password", http.StatusInternalServerError)
 		return
 	}
+	notifySecurity(r, userID, "Mot de passe réinitialisé", "Le mot de passe de votre compte a été réinitialisé et vos sessions ont été fermées")
 
 	// Marquer le token comme utilisé
 	config.DB.Exec(`
@@ -3,6 +3,7 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
@@ -10,8 +11,11 @@ import (
 
 	"github.com/gorilla/mux"
 
+	"api/billing"
 	"api/config"
 	"api/models"
+	"api/repositories"
+	"api/services"
 )
 
 // ===== ABONNEMENTS =====
@@ -39,7 +43,7 @@ func GetAbonnements(w http.ResponseWriter, r *http.Request) {
 		       COALESCE(e.nom, ''), COALESCE(p.nom, ''), t.prix, t.periodicite
 		FROM abonnement a
 		LEFT JOIN entreprise e ON e.id_entreprise = a.id_entreprise
-		LEFT JOIN produit p ON p.id_produit = a.id_produit
+		LEFT JOIN produits p ON p.id_produit = a.id_produit
 		LEFT JOIN tarification t ON t.id_tarification = a.id_tarification
 		ORDER BY a.date_debut DESC
 	`)
@@ -85,7 +89,7 @@ func GetMesAbonnements(w http.ResponseWriter, r *http.Request) {
 		       COALESCE(e.nom, ''), COALESCE(p.nom, ''), t.prix, t.periodicite
 		FROM abonnement a
 		LEFT JOIN entreprise e ON e.id_entreprise = a.id_entreprise
-		LEFT JOIN produit p ON p.id_produit = a.id_produit
+		LEFT JOIN produits p ON p.id_produit = a.id_produit
 		LEFT JOIN tarification t ON t.id_tarification = a.id_tarification
 		WHERE a.id_entreprise = $1
 		ORDER BY a.date_debut DESC
@@ -208,51 +212,78 @@ func CancelAbonnement(w http.ResponseWriter, r *http.Request) {
 }
 
 
-// CreateAbonnementFromPurchase creates an abonnement from product slug + userId (called after Stripe payment)
+// CreateAbonnementFromPurchase creates an abonnement from product slug + userId (called after Stripe payment).
+// For a bundle (bundle_slug), one abonnement is created per component.
 func CreateAbonnementFromPurchase(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		ProductSlug string `json:"product_slug"`
+		BundleSlug  string `json:"bundle_slug"`
+		VariantSKU  string `json:"variant_sku"`
+		Duration    string `json:"duration"`
 		UserID      int    `json:"user_id"`
 		Quantity    int    `json:"quantity"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ProductSlug == "" || req.UserID == 0 {
-		jsonErr(w, "product_slug and user_id required", http.StatusBadRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.ProductSlug == "" && req.BundleSlug == "") || req.UserID == 0 {
+		jsonErr(w, "product_slug (or bundle_slug) and user_id required", http.StatusBadRequest)
 		return
 	}
 	if req.Quantity < 1 {
 		req.Quantity = 1
 	}
 
-	// Look up product by slug (try both tables)
-	var productID int
-	err := config.DB.QueryRow("SELECT id_produit FROM produit WHERE slug = $1 UNION SELECT id_produit FROM produits WHERE slug = $1 LIMIT 1", req.ProductSlug).Scan(&productID)
-	if err != nil {
-		jsonErr(w, "Produit introuvable", http.StatusNotFound)
+	if req.BundleSlug != "" {
+		companyID := purchaseCompany(req.UserID)
+		ids, err := subscribePack(req.BundleSlug, companyID, req.Quantity)
+		if err != nil {
+			writeAppError(w, err, "subscribe pack")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ids": ids, "company_id": companyID, "message": "Abonnements crees"})
 		return
 	}
 
-	// Find active tarification
-	var tarifID int
-	err = config.DB.QueryRow("SELECT id_tarification FROM tarification WHERE id_produit = $1 AND actif = TRUE LIMIT 1", productID).Scan(&tarifID)
-	if err != nil {
-		jsonErr(w, "Aucune tarification active", http.StatusNotFound)
+	// Variante choisie (produits à options) : sa tarification pour la période achetée
+	items := []models.OrderItem{{ProductSlug: req.ProductSlug, VariantSKU: req.VariantSKU, Duration: req.Duration}}
+	if err := resolveOrderItems(config.DB, items); err != nil {
+		writeAppError(w, err, "resolve purchase variant")
 		return
 	}
 
-	// Get or create company
-	var companyID int
-	config.DB.QueryRow("SELECT COALESCE(id_entreprise,0) FROM utilisateur WHERE id_utilisateur=$1", req.UserID).Scan(&companyID)
-	if companyID == 0 {
-		var name string
-		config.DB.QueryRow("SELECT COALESCE(lastname, email, 'Client') FROM utilisateur WHERE id_utilisateur=$1", req.UserID).Scan(&name)
-		config.DB.QueryRow("INSERT INTO entreprise (nom) VALUES ($1) RETURNING id_entreprise", name+" (Auto)").Scan(&companyID)
-		config.DB.Exec("UPDATE utilisateur SET id_entreprise=$1 WHERE id_utilisateur=$2", companyID, req.UserID)
+	// Produit du catalogue unifié et son plan actif
+	var productID, tarifID int
+	var periodicite string
+	var err error
+	if items[0].TarificationID > 0 {
+		err = config.DB.QueryRow(`SELECT id_produit, id_tarification, COALESCE(periodicite, 'mensuel')
+			FROM tarification WHERE id_tarification = $1`, items[0].TarificationID).Scan(&productID, &tarifID, &periodicite)
+	} else {
+		err = config.DB.QueryRow(`
+			SELECT p.id_produit, t.id_tarification, COALESCE(t.periodicite, 'mensuel')
+			FROM produits p
+			JOIN tarification t ON t.id_produit = p.id_produit AND t.actif = TRUE AND t.id_variante IS NULL
+			WHERE p.slug = $1
+			ORDER BY t.id_tarification LIMIT 1`, req.ProductSlug).Scan(&productID, &tarifID, &periodicite)
+	}
+	if err != nil {
+		var exists bool
+		config.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM produits WHERE slug = $1)", req.ProductSlug).Scan(&exists)
+		if exists {
+			jsonErr(w, "Aucune tarification active", http.StatusNotFound)
+		} else {
+			jsonErr(w, "Produit introuvable", http.StatusNotFound)
+		}
+		return
 	}
 
-	// Create abonnement (30 days from now)
+	companyID := purchaseCompany(req.UserID)
+
+	// Create abonnement (une période du plan)
 	var subID int
-	err = config.DB.QueryRow("INSERT INTO abonnement (date_debut,date_fin,quantite,statut,renouvellement_auto,id_entreprise,id_produit,id_tarification) VALUES (CURRENT_DATE,CURRENT_DATE+30,$1,'actif',TRUE,$2,$3,$4) RETURNING id_abonnement",
-		req.Quantity, companyID, productID, tarifID).Scan(&subID)
+	today := time.Now()
+	err = config.DB.QueryRow("INSERT INTO abonnement (date_debut,date_fin,quantite,statut,renouvellement_auto,id_entreprise,id_produit,id_tarification) VALUES ($1,$2,$3,'actif',TRUE,$4,$5,$6) RETURNING id_abonnement",
+		today, billing.AddPeriod(today, periodicite), req.Quantity, companyID, productID, tarifID).Scan(&subID)
 	if err != nil {
 		log.Printf("CreateAbonnementFromPurchase error: %v", err)
 		jsonErr(w, "Erreur creation abonnement", http.StatusInternalServerError)
@@ -263,57 +294,67 @@ func CreateAbonnementFromPurchase(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]interface{}{"id": subID, "company_id": companyID, "message": "Abonnement cree"})
 }
 
+// purchaseCompany returns the buyer's company, creating it on first purchase.
+func purchaseCompany(userID int) int {
+	var companyID int
+	config.DB.QueryRow("SELECT COALESCE(id_entreprise,0) FROM utilisateur WHERE id_utilisateur=$1", userID).Scan(&companyID)
+	if companyID == 0 {
+		var name string
+		config.DB.QueryRow("SELECT COALESCE(lastname, email, 'Client') FROM utilisateur WHERE id_utilisateur=$1", userID).Scan(&name)
+		config.DB.QueryRow("INSERT INTO entreprise (nom) VALUES ($1) RETURNING id_entreprise", name+" (Auto)").Scan(&companyID)
+		config.DB.Exec("UPDATE utilisateur SET id_entreprise=$1 WHERE id_utilisateur=$2", companyID, userID)
+	}
+	return companyID
+}
+
 // ===== STATS =====
 
+// GetTopProductsLast3Months returns the public best-sellers ranking (paid orders over the
+// configured window, 90 days by default) without sales figures.
 func GetTopProductsLast3Months(w http.ResponseWriter, r *http.Request) {
-	rows, err := config.DB.Query(`
-		SELECT p.id_produit, p.nom, p.slug,
-		       COALESCE(p.description_courte,''), COALESCE(p.description_longue,''),
-		       COALESCE(p.description_html,''), COALESCE(p.images::text,'[]'),
-		       COALESCE(p.prix,0), COALESCE(p.devise,'EUR'), COALESCE(p.duree,'mois'),
-		       COALESCE(p.tag,''), COALESCE(p.statut,'Disponible'), COALESCE(p.type_achat,'panier'),
-		       COALESCE(p.ordre_affichage,0), p.id_categorie,
-		       COALESCE(c.nom,''), COALESCE(c.slug,'')
-		FROM produits p
-		LEFT JOIN categories c ON c.id_categorie = p.id_categorie
-		WHERE p.actif = TRUE
-		ORDER BY p.ordre_affichage DESC, p.id_produit ASC
-		LIMIT 8`)
+	items, err := repositories.NewSalesRepo(config.DB).PublicTopProducts(services.TopProductsWindow(), 8)
 	if err != nil {
 		log.Printf("top products query error: %v", err)
 		jsonErr(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
 
-	items := []models.ProduitWeb{}
-	for rows.Next() {
-		var p models.ProduitWeb
-		var descHTML sql.NullString
-		var catID sql.NullInt64
-		var catNom, catSlug string
-		var prix float64
-		if err := rows.Scan(&p.ID, &p.Nom, &p.Slug, &p.DescriptionCourte, &p.DescriptionLongue,
-			&descHTML, &p.Images, &prix, &p.Devise, &p.Duree, &p.Tag, &p.Statut,
-			&p.TypeAchat, &p.OrdreAffichage, &catID, &catNom, &catSlug); err != nil {
-			log.Printf("scan top products error: %v", err)
-			continue
-		}
-		p.Prix = &prix
-		if descHTML.Valid {
-			p.DescriptionHTML = descHTML.String
-		}
-		p.Actif = true
-		if catID.Valid {
-			p.IDCategorie = int(catID.Int64)
+// GetTopProductsStats returns the full sales figures (orders, quantity, revenue) per product
+// for one of the precomputed windows (?days=, default: public window).
+func GetTopProductsStats(w http.ResponseWriter, r *http.Request) {
+	days := services.TopProductsWindow()
+	if v := r.URL.Query().Get("days"); v != "" {
+		d, err := strconv.Atoi(v)
+		if err != nil || !services.IsTopProductsWindow(d) {
+			jsonErr(w, fmt.Sprintf("days must be one of %v", services.TopProductsWindows()), http.StatusBadRequest)
+			return
 		}
-		_ = catNom
-		_ = catSlug
-		items = append(items, p)
+		days = d
+	}
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > 100 {
+		limit = 10
+	}
+	items, computed, err := repositories.NewSalesRepo(config.DB).TopProducts(days, limit)
+	if err != nil {
+		log.Printf("top products stats error: %v", err)
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	resp := map[string]interface{}{
+		"days":         days,
+		"windows":      services.TopProductsWindows(),
+		"top_products": items,
+	}
+	if !computed.IsZero() {
+		resp["computed_at"] = computed
+		resp["from"] = computed.AddDate(0, 0, -days)
 	}
-
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(items)
+	json.NewEncoder(w).Encode(resp)
 }
 
 // ===== COMMANDES =====
@@ -425,12 +466,20 @@ func CreateCommande(w http.ResponseWriter, r *http.Request) {
 		pc := c.PromoCode
 		promoCode = &pc
 	}
-	if err := config.DB.QueryRow("INSERT INTO commande (montant_total, statut, id_utilisateur, promo_code) VALUES ($1,$2,$3,$4) RETURNING id_commande",
-		c.MontantTotal, c.Statut, c.IDUtilisateur, promoCode).Scan(&c.ID); err != nil {
+	// Lignes : chaque article d'un produit à options référence sa variante (SKU, tarification).
+	if c.Items == nil {
+		c.Items = []models.OrderItem{}
+	}
+	if err := resolveOrderItems(config.DB, c.Items); err != nil {
+		writeAppError(w, err, "resolve order items")
+		return
+	}
+	itemsJSON, _ := json.Marshal(c.Items)
+	if err := config.DB.QueryRow("INSERT INTO commande (montant_total, statut, id_utilisateur, promo_code, items) VALUES ($1,$2,$3,$4,$5) RETURNING id_commande",
+		c.MontantTotal, c.Statut, c.IDUtilisateur, promoCode, string(itemsJSON)).Scan(&c.ID); err != nil {
 		jsonErr(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	c.Items = []models.OrderItem{}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(c)
@@ -447,10 +496,20 @@ func UpdateCommande(w http.ResponseWriter, r *http.Request) {
 		jsonErr(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	if _, err := config.DB.Exec("UPDATE commande SET montant_total=$1, statut=$2 WHERE id_commande=$3", c.MontantTotal, c.Statut, id); err != nil {
+	// o : la ligne avant modification, pour ne signaler au client qu'un vrai changement de statut.
+	var owner sql.NullInt64
+	var previous string
+	err = config.DB.QueryRow(`
+		UPDATE commande c SET montant_total=$1, statut=$2
+		FROM commande o WHERE o.id_commande = c.id_commande AND c.id_commande=$3
+		RETURNING c.id_utilisateur, COALESCE(o.statut, '')`, c.MontantTotal, c.Statut, id).Scan(&owner, &previous)
+	if err != nil && err != sql.ErrNoRows {
 		jsonErr(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	if owner.Valid && previous != c.Statut {
+		billing.PublishOrderStatus(int(owner.Int64), id, c.Statut)
+	}
 	c.ID = id
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(c)
@@ -523,10 +582,29 @@ func GetFacture(w http.ResponseWriter, r *http.Request) {
 		jsonErr(w, "Invoice not found", http.StatusNotFound)
 		return
 	}
+	f.Lignes = getFactureLignes(f.ID)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(f)
 }
 
+func getFactureLignes(factureID int) []models.FactureLigne {
+	rows, err := config.DB.Query(`
+		SELECT id_ligne, type_ligne, libelle, quantite, prix_unitaire, montant, id_abonnement
+		FROM facture_ligne WHERE id_facture = $1 ORDER BY id_ligne`, factureID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var lignes []models.FactureLigne
+	for rows.Next() {
+		var l models.FactureLigne
+		if rows.Scan(&l.ID, &l.Type, &l.Libelle, &l.Quantite, &l.PrixUnitaire, &l.Montant, &l.IDAbonnement) == nil {
+			lignes = append(lignes, l)
+		}
+	}
+	return lignes
+}
+
 func CreateFacture(w http.ResponseWriter, r *http.Request) {
 	var f models.Facture
 	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
@@ -535,6 +613,10 @@ func CreateFacture(w http.ResponseWriter, r *http.Request) {
 	}
 	config.DB.QueryRow("INSERT INTO facture (date_facture, montant, lien_pdf, id_commande) VALUES ($1,$2,$3,$4) RETURNING id_facture",
 		f.DateFacture, f.Montant, f.LienPDF, f.IDCommande).Scan(&f.ID)
+	var ownerID int
+	if f.ID > 0 && config.DB.QueryRow("SELECT id_utilisateur FROM commande WHERE id_commande = $1", f.IDCommande).Scan(&ownerID) == nil {
+		billing.NotifyInvoice(ownerID, f.ID, f.Montant)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(f)
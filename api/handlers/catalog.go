@@ -3,17 +3,23 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/lib/pq"
 
+	"api/billing"
 	"api/cache"
+	"api/catalog"
 	"api/config"
 	mw "api/middleware"
 	"api/models"
+	"api/repositories"
+	"api/services"
 )
 
 // parsePagination returns (page, limit, offset) when "page" param is present; page=0 means no pagination.
@@ -82,17 +88,22 @@ func GetCategories(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(categories)
 }
 
+// GetActiveCategories : catégories actives dans la langue négociée (repli sur le français).
 func GetActiveCategories(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	if cached := cache.CatalogCache.Get(cache.KeyActiveCategories); cached != nil {
+	locale := requestLocale(w, r)
+	cacheKey := cache.KeyActiveCategoriesLocale(locale)
+	if cached := cache.CatalogCache.Get(cacheKey); cached != nil {
 		w.Write(cached)
 		return
 	}
 	rows, err := config.DB.Query(`
-		SELECT id_categorie, nom, slug,
-		       COALESCE(description,''), COALESCE(image,''), COALESCE(icone,''), COALESCE(couleur,''),
-		       COALESCE(ordre_affichage,0)
-		FROM categories WHERE actif = TRUE ORDER BY ordre_affichage ASC`)
+		SELECT c.id_categorie, COALESCE(t.nom, c.nom), c.slug,
+		       COALESCE(t.description, c.description, ''), COALESCE(c.image,''), COALESCE(c.icone,''), COALESCE(c.couleur,''),
+		       COALESCE(c.ordre_affichage,0)
+		FROM categories c
+		LEFT JOIN categorie_traduction t ON t.id_categorie = c.id_categorie AND t.langue = $1
+		WHERE c.actif = TRUE ORDER BY c.ordre_affichage ASC`, locale)
 	if err != nil {
 		jsonErr(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -108,7 +119,7 @@ func GetActiveCategories(w http.ResponseWriter, r *http.Request) {
 		c.Actif = true
 		categories = append(categories, c)
 	}
-	cache.SetJSON(cache.CatalogCache, cache.KeyActiveCategories, categories)
+	cache.SetJSON(cache.CatalogCache, cacheKey, categories)
 	json.NewEncoder(w).Encode(categories)
 }
 
@@ -127,12 +138,14 @@ func CreateCategorie(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	userID, _ := getUserID(r)
-	if err := config.DB.QueryRow(`
-		INSERT INTO categories (nom, slug, description, image, icone, couleur, ordre_affichage, actif, id_utilisateur_creation)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		RETURNING id_categorie, date_creation, date_modification`,
-		c.Nom, c.Slug, c.Description, c.Image, c.Icone, c.Couleur, c.OrdreAffichage, c.Actif, userID).Scan(
-		&c.ID, &c.DateCreation, &c.DateModification); err != nil {
+	if err := withActor(r, func(tx *sql.Tx) error {
+		return tx.QueryRow(`
+			INSERT INTO categories (nom, slug, description, image, icone, couleur, ordre_affichage, actif, id_utilisateur_creation)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			RETURNING id_categorie, date_creation, date_modification`,
+			c.Nom, c.Slug, c.Description, c.Image, c.Icone, c.Couleur, c.OrdreAffichage, c.Actif, userID).Scan(
+			&c.ID, &c.DateCreation, &c.DateModification)
+	}); err != nil {
 		log.Printf("Error creating categorie: %v", err)
 		jsonErr(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -158,10 +171,7 @@ func UpdateCategorie(w http.ResponseWriter, r *http.Request) {
 	c.Nom = mw.SanitizeString(c.Nom)
 	c.Description = mw.SanitizeString(c.Description)
 	c.Image = strings.TrimSpace(c.Image)
-	if _, err := config.DB.Exec(`
-		UPDATE categories SET nom=$1, slug=$2, description=$3, image=$4, icone=$5, couleur=$6,
-		    ordre_affichage=$7, actif=$8, date_modification=CURRENT_TIMESTAMP WHERE id_categorie=$9`,
-		c.Nom, c.Slug, c.Description, c.Image, c.Icone, c.Couleur, c.OrdreAffichage, c.Actif, id); err != nil {
+	if err := withActor(r, func(tx *sql.Tx) error { return updateCategorieRow(tx, id, c) }); err != nil {
 		log.Printf("Error updating categorie %d: %v", id, err)
 		jsonErr(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -172,6 +182,15 @@ func UpdateCategorie(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(c)
 }
 
+// updateCategorieRow écrit une catégorie complète (édition directe ou publication d'un brouillon).
+func updateCategorieRow(db dbExecer, id int, c models.CategorieWeb) error {
+	_, err := db.Exec(`
+		UPDATE categories SET nom=$1, slug=$2, description=$3, image=$4, icone=$5, couleur=$6,
+		    ordre_affichage=$7, actif=$8, date_modification=CURRENT_TIMESTAMP WHERE id_categorie=$9`,
+		c.Nom, c.Slug, c.Description, c.Image, c.Icone, c.Couleur, c.OrdreAffichage, c.Actif, id)
+	return err
+}
+
 func DeleteCategorie(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(mux.Vars(r)["id"])
 	if err != nil {
@@ -187,7 +206,10 @@ func DeleteCategorie(w http.ResponseWriter, r *http.Request) {
 		jsonErr(w, "Cannot delete category with associated products", http.StatusConflict)
 		return
 	}
-	if _, err := config.DB.Exec("DELETE FROM categories WHERE id_categorie = $1", id); err != nil {
+	if err := withActor(r, func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM categories WHERE id_categorie = $1", id)
+		return err
+	}); err != nil {
 		jsonErr(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -257,9 +279,10 @@ func GetProduits(w http.ResponseWriter, r *http.Request) {
 func GetActiveProduitsByCategory(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	slug := mux.Vars(r)["slug"]
+	locale := requestLocale(w, r)
 	page, limit, offset := parsePaginationDefault(r)
 	useCache := page == 1 && limit == 20
-	cacheKey := cache.KeyProduitsByCategory(slug)
+	cacheKey := cache.KeyProduitsByCategory(locale, slug)
 	if useCache {
 		if cached := cache.CatalogCache.Get(cacheKey); cached != nil {
 			w.Write(cached)
@@ -267,15 +290,16 @@ func GetActiveProduitsByCategory(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	rows, err := config.DB.Query(`
-		SELECT p.id_produit, p.nom, p.slug,
-		       COALESCE(p.description_courte,''), COALESCE(p.description_longue,''),
-		       COALESCE(p.description_html,''), COALESCE(p.images::text,'[]'),
+		SELECT p.id_produit, COALESCE(t.nom, p.nom), p.slug,
+		       COALESCE(t.description_courte, p.description_courte, ''), COALESCE(t.description_longue, p.description_longue, ''),
+		       COALESCE(t.description_html, p.description_html, ''), COALESCE(p.images::text,'[]'),
 		       p.prix, COALESCE(p.devise,'EUR'), COALESCE(p.duree,''),
 		       COALESCE(p.tag,''), COALESCE(p.statut,'actif'), COALESCE(p.type_achat,''),
 		       COALESCE(p.ordre_affichage,0)
 		FROM produits p JOIN categories c ON p.id_categorie = c.id_categorie
+		LEFT JOIN produit_traduction t ON t.id_produit = p.id_produit AND t.langue = $4
 		WHERE c.slug = $1 AND p.actif = TRUE AND c.actif = TRUE
-		ORDER BY p.ordre_affichage ASC LIMIT $2 OFFSET $3`, slug, limit, offset)
+		ORDER BY p.ordre_affichage ASC LIMIT $2 OFFSET $3`, slug, limit, offset, locale)
 	if err != nil {
 		jsonErr(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -302,7 +326,17 @@ func GetActiveProduitsByCategory(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(produits)
 }
 
+// GetProduit : fiche produit de référence (français), pour l'édition.
 func GetProduit(w http.ResponseWriter, r *http.Request) {
+	getProduit(w, r, catalog.DefaultLocale)
+}
+
+// GetPublicProduit : fiche produit de la vitrine, dans la langue négociée.
+func GetPublicProduit(w http.ResponseWriter, r *http.Request) {
+	getProduit(w, r, requestLocale(w, r))
+}
+
+func getProduit(w http.ResponseWriter, r *http.Request, locale string) {
 	w.Header().Set("Content-Type", "application/json")
 	id, err := strconv.Atoi(mux.Vars(r)["id"])
 	if err != nil {
@@ -312,20 +346,21 @@ func GetProduit(w http.ResponseWriter, r *http.Request) {
 	var p models.ProduitWeb
 	var descHTML, catNom sql.NullString
 	err = config.DB.QueryRow(`
-		SELECT p.id_produit, p.nom, p.slug,
-		       COALESCE(p.description_courte,''), COALESCE(p.description_longue,''),
-		       p.description_html, COALESCE(p.images::text,'[]'),
+		SELECT p.id_produit, COALESCE(t.nom, p.nom), p.slug,
+		       COALESCE(t.description_courte, p.description_courte, ''), COALESCE(t.description_longue, p.description_longue, ''),
+		       COALESCE(t.description_html, p.description_html), COALESCE(p.images::text,'[]'),
 		       p.prix, COALESCE(p.devise,'EUR'), COALESCE(p.duree,''), p.id_categorie,
 		       COALESCE(p.tag,''), COALESCE(p.statut,'actif'), COALESCE(p.type_achat,''),
 		       COALESCE(p.ordre_affichage,0), COALESCE(p.actif,false),
 		       COALESCE(p.date_creation,NOW()), COALESCE(p.date_modification,NOW()),
-		       c.nom as categorie_nom
+		       c.nom as categorie_nom, p.media_ids
 		FROM produits p LEFT JOIN categories c ON p.id_categorie = c.id_categorie
-		WHERE p.id_produit = $1`, id).Scan(
+		LEFT JOIN produit_traduction t ON t.id_produit = p.id_produit AND t.langue = $2
+		WHERE p.id_produit = $1`, id, locale).Scan(
 		&p.ID, &p.Nom, &p.Slug, &p.DescriptionCourte, &p.DescriptionLongue,
 		&descHTML, &p.Images, &p.Prix, &p.Devise, &p.Duree, &p.IDCategorie,
 		&p.Tag, &p.Statut, &p.TypeAchat, &p.OrdreAffichage, &p.Actif,
-		&p.DateCreation, &p.DateModification, &catNom)
+		&p.DateCreation, &p.DateModification, &catNom, pq.Array(&p.MediaIDs))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			jsonErr(w, "Product not found", http.StatusNotFound)
@@ -337,9 +372,36 @@ func GetProduit(w http.ResponseWriter, r *http.Request) {
 	if descHTML.Valid {
 		p.DescriptionHTML = descHTML.String
 	}
+	p.Plans = getProduitPlans(id)
+	if p.Options, p.Variantes, err = loadVariantMatrix(config.DB, id, false); err != nil {
+		log.Printf("load variants error: %v", err)
+	}
+	p.AchetesEnsemble = catalogService().FrequentlyBoughtWith(p.ID, p.Slug)
 	json.NewEncoder(w).Encode(p)
 }
 
+// getProduitPlans retourne les tarifications actives d'un produit (les tarifications
+// privées issues d'un devis sont inactives et donc exclues ; les prix des variantes
+// sont portés par la matrice d'options).
+func getProduitPlans(productID int) []models.Tarification {
+	rows, err := config.DB.Query(`
+		SELECT id_tarification, COALESCE(prix,0), COALESCE(unite,''), COALESCE(periodicite,''), actif, id_produit,
+		       prix_usage, COALESCE(agregation,'sum')
+		FROM tarification WHERE id_produit = $1 AND actif = TRUE AND id_variante IS NULL ORDER BY prix ASC`, productID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var plans []models.Tarification
+	for rows.Next() {
+		var t models.Tarification
+		if err := rows.Scan(&t.ID, &t.Prix, &t.Unite, &t.Periodicite, &t.Actif, &t.IDProduit, &t.PrixUsage, &t.Agregation); err == nil {
+			plans = append(plans, t)
+		}
+	}
+	return plans
+}
+
 func CreateProduit(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var p models.ProduitWeb
@@ -349,26 +411,31 @@ func CreateProduit(w http.ResponseWriter, r *http.Request) {
 	}
 	p.Nom = mw.SanitizeString(p.Nom)
 	p.DescriptionCourte = mw.SanitizeString(p.DescriptionCourte)
+	p.DescriptionHTML = mw.SanitizeHTML(p.DescriptionHTML)
 	if p.Nom == "" || p.Slug == "" {
 		jsonErr(w, "Name and slug are required", http.StatusBadRequest)
 		return
 	}
 	userID, _ := getUserID(r)
-	images := p.Images
-	if images == "" {
-		images = "[]"
-	}
-	if err := config.DB.QueryRow(`
-		INSERT INTO produits (nom, slug, description_courte, description_longue, description_html,
-		    images, prix, devise, duree, id_categorie, tag, statut, type_achat,
-		    ordre_affichage, actif, id_utilisateur_creation)
-		VALUES ($1,$2,$3,$4,$5,$6::jsonb,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16)
-		RETURNING id_produit, date_creation, date_modification`,
-		p.Nom, p.Slug, p.DescriptionCourte, p.DescriptionLongue, p.DescriptionHTML,
-		images, p.Prix, p.Devise, p.Duree, p.IDCategorie, p.Tag, p.Statut,
-		p.TypeAchat, p.OrdreAffichage, p.Actif, userID).Scan(&p.ID, &p.DateCreation, &p.DateModification); err != nil {
-		log.Printf("Error creating produit: %v", err)
-		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+	if err := withActor(r, func(tx *sql.Tx) error {
+		if err := resolveProduitMedia(tx, &p); err != nil {
+			return err
+		}
+		images := p.Images
+		if images == "" {
+			images = "[]"
+		}
+		return tx.QueryRow(`
+			INSERT INTO produits (nom, slug, description_courte, description_longue, description_html,
+			    images, prix, devise, duree, id_categorie, tag, statut, type_achat,
+			    ordre_affichage, actif, id_utilisateur_creation, media_ids)
+			VALUES ($1,$2,$3,$4,$5,$6::jsonb,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17)
+			RETURNING id_produit, date_creation, date_modification`,
+			p.Nom, p.Slug, p.DescriptionCourte, p.DescriptionLongue, p.DescriptionHTML,
+			images, p.Prix, p.Devise, p.Duree, p.IDCategorie, p.Tag, p.Statut,
+			p.TypeAchat, p.OrdreAffichage, p.Actif, userID, pq.Array(p.MediaIDs)).Scan(&p.ID, &p.DateCreation, &p.DateModification)
+	}); err != nil {
+		writeAppError(w, err, "create produit")
 		return
 	}
 	cache.InvalidateProduits()
@@ -390,26 +457,36 @@ func UpdateProduit(w http.ResponseWriter, r *http.Request) {
 	}
 	p.Nom = mw.SanitizeString(p.Nom)
 	p.DescriptionCourte = mw.SanitizeString(p.DescriptionCourte)
+	p.DescriptionHTML = mw.SanitizeHTML(p.DescriptionHTML)
+	if err := withActor(r, func(tx *sql.Tx) error { return updateProduitRow(tx, id, &p) }); err != nil {
+		writeAppError(w, err, fmt.Sprintf("update produit %d", id))
+		return
+	}
+	cache.InvalidateProduits()
+	p.ID = id
+	json.NewEncoder(w).Encode(p)
+}
+
+// updateProduitRow écrit un produit complet (édition directe ou publication d'un brouillon) ;
+// images est recalculé à partir des médias s'ils sont fournis.
+func updateProduitRow(tx *sql.Tx, id int, p *models.ProduitWeb) error {
+	if err := resolveProduitMedia(tx, p); err != nil {
+		return err
+	}
 	images := p.Images
 	if images == "" {
 		images = "[]"
 	}
-	if _, err := config.DB.Exec(`
+	_, err := tx.Exec(`
 		UPDATE produits SET nom=$1, slug=$2, description_courte=$3, description_longue=$4,
 		    description_html=$5, images=$6::jsonb, prix=$7, devise=$8, duree=$9,
 		    id_categorie=$10, tag=$11, statut=$12, type_achat=$13,
-		    ordre_affichage=$14, actif=$15, date_modification=CURRENT_TIMESTAMP
-		WHERE id_produit=$16`,
+		    ordre_affichage=$14, actif=$15, media_ids=$16, date_modification=CURRENT_TIMESTAMP
+		WHERE id_produit=$17`,
 		p.Nom, p.Slug, p.DescriptionCourte, p.DescriptionLongue, p.DescriptionHTML,
 		images, p.Prix, p.Devise, p.Duree, p.IDCategorie, p.Tag, p.Statut,
-		p.TypeAchat, p.OrdreAffichage, p.Actif, id); err != nil {
-		log.Printf("Error updating produit %d: %v", id, err)
-		jsonErr(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-	cache.InvalidateProduits()
-	p.ID = id
-	json.NewEncoder(w).Encode(p)
+		p.TypeAchat, p.OrdreAffichage, p.Actif, pq.Array(p.MediaIDs), id)
+	return err
 }
 
 func DeleteProduit(w http.ResponseWriter, r *http.Request) {
@@ -418,7 +495,10 @@ func DeleteProduit(w http.ResponseWriter, r *http.Request) {
 		jsonErr(w, "Invalid ID", http.StatusBadRequest)
 		return
 	}
-	if _, err := config.DB.Exec("DELETE FROM produits WHERE id_produit = $1", id); err != nil {
+	if err := withActor(r, func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM produits WHERE id_produit = $1", id)
+		return err
+	}); err != nil {
 		jsonErr(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -426,97 +506,184 @@ func DeleteProduit(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// catalogService fournit la recherche partagée entre vitrine et administration.
+func catalogService() *services.CatalogService {
+	return services.NewCatalogService(repositories.NewCatalogRepo(config.DB))
+}
+
+// SearchProduits : recherche publique (produits actifs). Le mode (browse | fulltext | fuzzy),
+// le tri, le total et le curseur de la page suivante sont renvoyés dans les en-têtes X-Search-*,
+// X-Total-Count et X-Next-Cursor ; facets=true renvoie la page complète avec les facettes.
 func SearchProduits(w http.ResponseWriter, r *http.Request) {
+	opts, ok := searchOptions(w, r)
+	if !ok {
+		return
+	}
+	opts.Locale = requestLocale(w, r)
+	page, ok := runSearch(w, opts)
+	if !ok {
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
-	q := strings.TrimSpace(r.URL.Query().Get("q"))
-	category := strings.TrimSpace(r.URL.Query().Get("category"))
-	if len(q) > 100 {
-		jsonErr(w, "Search query too long", http.StatusBadRequest)
+	w.Header().Set("X-Search-Mode", page.Mode)
+	w.Header().Set("X-Search-Sort", page.Sort)
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	if page.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+	}
+	// Sans facettes, la réponse reste un tableau (compatibilité vitrine et application mobile).
+	if !opts.Facets {
+		json.NewEncoder(w).Encode(page.Results)
 		return
 	}
-	page, limit, offset := parsePaginationDefault(r)
-
-	type SearchResult struct {
-		ID                int     `json:"id_produit"`
-		Nom               string  `json:"nom"`
-		Slug              string  `json:"slug"`
-		DescriptionCourte string  `json:"description_courte"`
-		DescriptionLongue string  `json:"description_longue"`
-		Prix              float64 `json:"prix"`
-		Devise            string  `json:"devise"`
-		Duree             string  `json:"duree"`
-		Tag               string  `json:"tag"`
-		Statut            string  `json:"statut"`
-		TypeAchat         string  `json:"type_achat"`
-		OrdreAffichage    int     `json:"ordre_affichage"`
-		CategorieNom      string  `json:"categorie_nom"`
-		CategorieSlug     string  `json:"categorie_slug"`
-		NomCategorie      string  `json:"nom_categorie"`
-		Images            string  `json:"images"`
-	}
-
-	baseSelect := `
-		SELECT p.id_produit, p.nom, p.slug,
-		       COALESCE(p.description_courte,''), COALESCE(p.description_longue,''),
-		       COALESCE(p.prix,0), COALESCE(p.devise,'EUR'), COALESCE(p.duree,''),
-		       COALESCE(p.tag,''), COALESCE(p.statut,'actif'), COALESCE(p.type_achat,''),
-		       COALESCE(p.ordre_affichage,0),
-		       COALESCE(c.nom,''), COALESCE(c.slug,''),
-		       COALESCE(p.images::text,'[]')
-		FROM produits p JOIN categories c ON p.id_categorie = c.id_categorie
-		WHERE p.actif=TRUE AND c.actif=TRUE`
+	json.NewEncoder(w).Encode(page)
+}
 
-	var rows *sql.Rows
-	var err error
+// AdminSearchProduits : même recherche, produits inactifs inclus, réponse paginée complète.
+func AdminSearchProduits(w http.ResponseWriter, r *http.Request) {
+	opts, ok := searchOptions(w, r)
+	if !ok {
+		return
+	}
+	opts.IncludeInactive = true
+	page, ok := runSearch(w, opts)
+	if !ok {
+		return
+	}
+	pageNum, _, _ := parsePaginationDefault(r)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"mode":        page.Mode,
+		"sort":        page.Sort,
+		"total":       page.Total,
+		"page":        pageNum,
+		"limit":       opts.Limit,
+		"next_cursor": page.NextCursor,
+		"results":     page.Results,
+		"facets":      page.Facets,
+	})
+}
 
-	if q == "" {
-		// Browse mode: all active products, optional category filter
-		if category != "" {
-			rows, err = config.DB.Query(baseSelect+" AND c.slug=$1 ORDER BY p.ordre_affichage ASC LIMIT $2 OFFSET $3", category, limit, offset)
-		} else {
-			rows, err = config.DB.Query(baseSelect+" ORDER BY p.ordre_affichage ASC LIMIT $1 OFFSET $2", limit, offset)
+// searchOptions lit les paramètres communs : q, category, page/limit, cursor, sort, facets,
+// min_price/max_price et les filtres multi-valeurs tag, duree, type_achat, statut
+// (paramètre répété ou valeurs séparées par des virgules).
+func searchOptions(w http.ResponseWriter, r *http.Request) (repositories.SearchOptions, bool) {
+	q := r.URL.Query()
+	_, limit, offset := parsePaginationDefault(r)
+	opts := repositories.SearchOptions{
+		Query:      q.Get("q"),
+		Category:   strings.TrimSpace(q.Get("category")),
+		Limit:      limit,
+		Offset:     offset,
+		Tags:       queryList(q["tag"]),
+		Durees:     queryList(q["duree"]),
+		TypesAchat: queryList(q["type_achat"]),
+		Statuts:    queryList(q["statut"]),
+		Sort:       strings.TrimSpace(q.Get("sort")),
+		Cursor:     strings.TrimSpace(q.Get("cursor")),
+	}
+	opts.Facets, _ = strconv.ParseBool(q.Get("facets"))
+	for _, p := range []struct {
+		name string
+		dst  **float64
+	}{{"min_price", &opts.PrixMin}, {"max_price", &opts.PrixMax}} {
+		raw := strings.TrimSpace(q.Get(p.name))
+		if raw == "" {
+			continue
 		}
-	} else {
-		// Search mode: filter by text
-		useCache := page == 1 && limit == 20
-		cacheKey := cache.KeySearchResults(q)
-		if useCache {
-			if cached := cache.SearchCache.Get(cacheKey); cached != nil {
-				w.Write(cached)
-				return
-			}
+		v, err := strconv.ParseFloat(strings.Replace(raw, ",", ".", 1), 64)
+		if err != nil || v < 0 {
+			jsonErr(w, "Invalid "+p.name, http.StatusBadRequest)
+			return opts, false
 		}
-		pattern := "%" + q + "%"
-		if category != "" {
-			rows, err = config.DB.Query(baseSelect+
-				` AND c.slug=$1 AND (p.nom ILIKE $2 OR p.description_courte ILIKE $2 OR p.tag ILIKE $2 OR c.nom ILIKE $2)
-				ORDER BY p.ordre_affichage ASC LIMIT $3 OFFSET $4`, category, pattern, limit, offset)
-		} else {
-			rows, err = config.DB.Query(baseSelect+
-				` AND (p.nom ILIKE $1 OR p.description_courte ILIKE $1 OR p.tag ILIKE $1 OR c.nom ILIKE $1)
-				ORDER BY p.ordre_affichage ASC LIMIT $2 OFFSET $3`, pattern, limit, offset)
+		*p.dst = &v
+	}
+	if opts.PrixMin != nil && opts.PrixMax != nil && *opts.PrixMin > *opts.PrixMax {
+		jsonErr(w, "min_price must be lower than max_price", http.StatusBadRequest)
+		return opts, false
+	}
+	return opts, true
+}
+
+// queryList accepte ?tag=a&tag=b comme ?tag=a,b.
+func queryList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
 		}
-		_ = useCache
+	}
+	return out
+}
+
+func runSearch(w http.ResponseWriter, opts repositories.SearchOptions) (repositories.SearchPage, bool) {
+	page, err := catalogService().Search(opts)
+	switch err {
+	case nil:
+		return page, true
+	case services.ErrSearchQueryTooLong:
+		jsonErr(w, "Search query too long", http.StatusBadRequest)
+	case repositories.ErrInvalidSort:
+		jsonErr(w, "Invalid sort (relevance, featured, price_asc, price_desc, newest, popular)", http.StatusBadRequest)
+	case repositories.ErrInvalidCursor:
+		jsonErr(w, "Invalid cursor", http.StatusBadRequest)
+	default:
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+	}
+	return page, false
+}
+
+// SearchSuggest : autocomplétion de la barre de recherche (noms de produits et catégories
+// dans la langue négociée), servie depuis l'index en mémoire. Les saisies partielles ne
+// sont pas journalisées.
+func SearchSuggest(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	items, err := catalogService().Suggest(requestLocale(w, r), r.URL.Query().Get("q"), limit)
+	if err == services.ErrSearchQueryTooLong {
+		jsonErr(w, "Search query too long", http.StatusBadRequest)
+		return
 	}
 	if err != nil {
 		jsonErr(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	json.NewEncoder(w).Encode(items)
+}
 
-	results := []SearchResult{}
-	for rows.Next() {
-		var p SearchResult
-		if err := rows.Scan(&p.ID, &p.Nom, &p.Slug, &p.DescriptionCourte, &p.DescriptionLongue,
-			&p.Prix, &p.Devise, &p.Duree, &p.Tag,
-			&p.Statut, &p.TypeAchat, &p.OrdreAffichage, &p.CategorieNom, &p.CategorieSlug,
-			&p.Images); err != nil {
-			continue
-		}
-		p.NomCategorie = p.CategorieNom
-		results = append(results, p)
+// GetSearchTopQueries : requêtes les plus fréquentes (?days=30&limit=20).
+func GetSearchTopQueries(w http.ResponseWriter, r *http.Request) {
+	searchReport(w, r, (*repositories.SearchLogRepo).TopQueries)
+}
+
+// GetSearchZeroResults : requêtes sans résultat, pour repérer les services demandés absents du catalogue.
+func GetSearchZeroResults(w http.ResponseWriter, r *http.Request) {
+	searchReport(w, r, (*repositories.SearchLogRepo).ZeroResultQueries)
+}
+
+func searchReport(w http.ResponseWriter, r *http.Request, report func(*repositories.SearchLogRepo, int, int) ([]repositories.QueryStat, error)) {
+	days, err := strconv.Atoi(r.URL.Query().Get("days"))
+	if err != nil || days <= 0 || days > 365 {
+		days = 30
+	}
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	stats, err := report(repositories.NewSearchLogRepo(config.DB), days, limit)
+	if err != nil {
+		log.Printf("search report error: %v", err)
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
-	json.NewEncoder(w).Encode(results)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"days":    days,
+		"queries": stats,
+	})
 }
 
 // ===== TARIFICATION =====
@@ -528,7 +695,7 @@ func GetTarifications(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	rows, err := config.DB.Query(
-		`SELECT id_tarification, COALESCE(prix,0), COALESCE(unite,''), COALESCE(periodicite,''), COALESCE(actif,false), id_produit FROM tarification`)
+		`SELECT id_tarification, COALESCE(prix,0), COALESCE(unite,''), COALESCE(periodicite,''), COALESCE(actif,false), id_produit, prix_usage, COALESCE(agregation,'sum'), id_variante FROM tarification`)
 	if err != nil {
 		jsonErr(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -537,7 +704,7 @@ func GetTarifications(w http.ResponseWriter, r *http.Request) {
 	tarifications := []models.Tarification{}
 	for rows.Next() {
 		var t models.Tarification
-		if err := rows.Scan(&t.ID, &t.Prix, &t.Unite, &t.Periodicite, &t.Actif, &t.IDProduit); err != nil {
+		if err := rows.Scan(&t.ID, &t.Prix, &t.Unite, &t.Periodicite, &t.Actif, &t.IDProduit, &t.PrixUsage, &t.Agregation, &t.IDVariante); err != nil {
 			jsonErr(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
@@ -555,8 +722,8 @@ func GetTarification(w http.ResponseWriter, r *http.Request) {
 	}
 	var t models.Tarification
 	if err := config.DB.QueryRow(
-		`SELECT id_tarification, COALESCE(prix,0), COALESCE(unite,''), COALESCE(periodicite,''), COALESCE(actif,false), id_produit FROM tarification WHERE id_tarification = $1`, id).Scan(
-		&t.ID, &t.Prix, &t.Unite, &t.Periodicite, &t.Actif, &t.IDProduit); err != nil {
+		`SELECT id_tarification, COALESCE(prix,0), COALESCE(unite,''), COALESCE(periodicite,''), COALESCE(actif,false), id_produit, prix_usage, COALESCE(agregation,'sum'), id_variante FROM tarification WHERE id_tarification = $1`, id).Scan(
+		&t.ID, &t.Prix, &t.Unite, &t.Periodicite, &t.Actif, &t.IDProduit, &t.PrixUsage, &t.Agregation, &t.IDVariante); err != nil {
 		jsonErr(w, "Pricing not found", http.StatusNotFound)
 		return
 	}
@@ -574,8 +741,16 @@ func CreateTarification(w http.ResponseWriter, r *http.Request) {
 		jsonErr(w, "Price cannot be negative", http.StatusBadRequest)
 		return
 	}
-	if err := config.DB.QueryRow("INSERT INTO tarification (prix, unite, periodicite, actif, id_produit) VALUES ($1,$2,$3,$4,$5) RETURNING id_tarification",
-		t.Prix, t.Unite, t.Periodicite, t.Actif, t.IDProduit).Scan(&t.ID); err != nil {
+	if !validUsagePricing(w, &t) {
+		return
+	}
+	if !validTarificationVariant(w, &t) {
+		return
+	}
+	if err := withActor(r, func(tx *sql.Tx) error {
+		return tx.QueryRow("INSERT INTO tarification (prix, unite, periodicite, actif, id_produit, prix_usage, agregation, id_variante) VALUES ($1,$2,$3,$4,$5,$6,$7,$8) RETURNING id_tarification",
+			t.Prix, t.Unite, t.Periodicite, t.Actif, t.IDProduit, t.PrixUsage, t.Agregation, t.IDVariante).Scan(&t.ID)
+	}); err != nil {
 		jsonErr(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -600,8 +775,17 @@ func UpdateTarification(w http.ResponseWriter, r *http.Request) {
 		jsonErr(w, "Price cannot be negative", http.StatusBadRequest)
 		return
 	}
-	if _, err := config.DB.Exec("UPDATE tarification SET prix=$1, unite=$2, periodicite=$3, actif=$4, id_produit=$5 WHERE id_tarification=$6",
-		t.Prix, t.Unite, t.Periodicite, t.Actif, t.IDProduit, id); err != nil {
+	if !validUsagePricing(w, &t) {
+		return
+	}
+	if !validTarificationVariant(w, &t) {
+		return
+	}
+	if err := withActor(r, func(tx *sql.Tx) error {
+		_, err := tx.Exec("UPDATE tarification SET prix=$1, unite=$2, periodicite=$3, actif=$4, id_produit=$5, prix_usage=$6, agregation=$7, id_variante=$8 WHERE id_tarification=$9",
+			t.Prix, t.Unite, t.Periodicite, t.Actif, t.IDProduit, t.PrixUsage, t.Agregation, t.IDVariante, id)
+		return err
+	}); err != nil {
 		jsonErr(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -611,13 +795,46 @@ func UpdateTarification(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(t)
 }
 
+// validUsagePricing contrôle les champs de facturation à l'usage d'une tarification.
+func validUsagePricing(w http.ResponseWriter, t *models.Tarification) bool {
+	if t.Agregation == "" {
+		t.Agregation = billing.AgregationSomme
+	}
+	if t.Agregation != billing.AgregationSomme && t.Agregation != billing.AgregationMax {
+		jsonErr(w, "usageAggregation must be sum or max", http.StatusBadRequest)
+		return false
+	}
+	if t.PrixUsage != nil && (*t.PrixUsage < 0 || strings.TrimSpace(t.Unite) == "") {
+		jsonErr(w, "usagePrice requires a unit and cannot be negative", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// validTarificationVariant vérifie que la variante tarifée appartient au produit.
+func validTarificationVariant(w http.ResponseWriter, t *models.Tarification) bool {
+	if t.IDVariante == nil {
+		return true
+	}
+	var ok bool
+	config.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM produit_variante WHERE id_variante = $1 AND id_produit = $2)",
+		*t.IDVariante, t.IDProduit).Scan(&ok)
+	if !ok {
+		jsonErr(w, "variantId does not belong to productId", http.StatusBadRequest)
+	}
+	return ok
+}
+
 func DeleteTarification(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(mux.Vars(r)["id"])
 	if err != nil {
 		jsonErr(w, "Invalid ID", http.StatusBadRequest)
 		return
 	}
-	if _, err := config.DB.Exec("DELETE FROM tarification WHERE id_tarification = $1", id); err != nil {
+	if err := withActor(r, func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM tarification WHERE id_tarification = $1", id)
+		return err
+	}); err != nil {
 		jsonErr(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
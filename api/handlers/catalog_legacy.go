@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"api/config"
+	"api/models"
+)
+
+// ===== CATALOGUE LEGACY (compatibilité, période de dépréciation) =====
+// Les identifiants legacy (table produit) restent résolubles via la correspondance
+// produits.id_produit_legacy renseignée par `./api migrate-catalog`.
+
+const legacyProduitSelect = `
+	SELECT p.id_produit_legacy, p.id_produit, p.nom, COALESCE(p.description_courte, ''),
+	       COALESCE(p.type_achat, '') = 'devis', COALESCE(p.actif, FALSE)
+	FROM produits p
+	WHERE p.id_produit_legacy IS NOT NULL`
+
+type legacyProduit struct {
+	models.Produit
+	CanonicalID int `json:"canonicalId"`
+}
+
+func GetLegacyProduits(w http.ResponseWriter, r *http.Request) {
+	rows, err := config.DB.Query(legacyProduitSelect + " ORDER BY p.id_produit_legacy")
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	items := []legacyProduit{}
+	for rows.Next() {
+		var p legacyProduit
+		if err := rows.Scan(&p.ID, &p.CanonicalID, &p.Nom, &p.Description, &p.SurDevis, &p.Actif); err == nil {
+			items = append(items, p)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+// GetLegacyProduit résout un identifiant legacy vers le produit canonique.
+func GetLegacyProduit(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		jsonErr(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	var p legacyProduit
+	if err := config.DB.QueryRow(legacyProduitSelect+" AND p.id_produit_legacy = $1", id).Scan(
+		&p.ID, &p.CanonicalID, &p.Nom, &p.Description, &p.SurDevis, &p.Actif); err != nil {
+		jsonErr(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Link", "</api/produits/"+strconv.Itoa(p.CanonicalID)+`>; rel="successor-version"`)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
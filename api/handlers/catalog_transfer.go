@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"api/cache"
+	"api/catalog"
+	"api/config"
+	mw "api/middleware"
+)
+
+// ===== CATALOGUE — IMPORT / EXPORT =====
+
+// MaxImportSize : taille maximale d'un fichier d'import (10 Mo, comme l'import du back-office web).
+const MaxImportSize = 10 << 20
+
+// errImportRollback annule la transaction d'import (simulation ou lignes en erreur).
+var errImportRollback = errors.New("import rolled back")
+
+// ExportCatalog exporte catégories, produits et tarifs (?format=json par défaut, ou csv).
+func ExportCatalog(w http.ResponseWriter, r *http.Request) {
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		jsonErr(w, "format must be csv or json", http.StatusBadRequest)
+		return
+	}
+	b, err := catalog.Export(r.Context(), config.DB)
+	if err != nil {
+		log.Printf("catalog export error: %v", err)
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	filename := "catalogue-" + time.Now().Format("20060102") + "." + format
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		if err := catalog.WriteCSV(w, b); err != nil {
+			log.Printf("catalog export error: %v", err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(b)
+}
+
+// ImportCatalog crée ou met à jour le catalogue depuis un fichier CSV ou JSON (corps
+// brut, ou champ "file" d'un formulaire multipart). Tout est écrit dans une seule
+// transaction, enregistrée seulement si aucune ligne n'est en erreur ; ?dryRun=true
+// produit le même rapport sans rien enregistrer.
+func ImportCatalog(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxImportSize)
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			jsonErr(w, "file is required", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		body = file
+		if format == "" {
+			format = strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+		}
+		if r.FormValue("dryRun") == "true" {
+			dryRun = true
+		}
+	}
+	if format == "" {
+		format = "json"
+		if strings.Contains(r.Header.Get("Content-Type"), "csv") {
+			format = "csv"
+		}
+	}
+
+	var b catalog.Bundle
+	var err error
+	switch format {
+	case "csv":
+		b, err = catalog.ParseCSV(body)
+	case "json":
+		b, err = catalog.ParseJSON(body)
+	default:
+		jsonErr(w, "format must be csv or json", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			jsonErr(w, "File too large (10 MB max)", http.StatusRequestEntityTooLarge)
+			return
+		}
+		jsonErr(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for i := range b.Produits {
+		b.Produits[i].DescriptionHTML = mw.SanitizeHTML(b.Produits[i].DescriptionHTML)
+	}
+
+	var rep catalog.ImportReport
+	err = withActor(r, func(tx *sql.Tx) error {
+		var err error
+		if rep, err = catalog.Import(r.Context(), tx, b); err != nil {
+			return err
+		}
+		if dryRun || rep.Failed() {
+			return errImportRollback
+		}
+		return nil
+	})
+	if err != nil && err != errImportRollback {
+		log.Printf("catalog import error: %v", err)
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	rep.DryRun = dryRun
+	rep.Committed = err == nil
+	status := http.StatusOK
+	if rep.Committed {
+		cache.InvalidateCategories()
+		cache.InvalidateAdminCategories()
+		cache.InvalidateProduits()
+		cache.InvalidateTarifications()
+	} else if !dryRun {
+		status = http.StatusUnprocessableEntity
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(rep)
+}
@@ -0,0 +1,841 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"api/billing"
+	"api/config"
+	"api/mailer"
+	mw "api/middleware"
+	"api/models"
+)
+
+// ===== DEVIS (produits sur devis) =====
+
+const maxDevisBesoin = 5000
+
+// errDevisQuantite : ligne à quantité non entière, non convertible en commande.
+var errDevisQuantite = errors.New("devis: quantité non entière")
+
+// dbQuerier est satisfait par *sql.DB et *sql.Tx.
+type dbQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// dbExecer est satisfait par *sql.DB et *sql.Tx.
+type dbExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+const devisSelect = `
+	SELECT d.id_devis, COALESCE(d.numero, ''), d.statut, COALESCE(d.besoin, ''), d.id_utilisateur,
+	       d.id_entreprise, d.id_produit, COALESCE(d.periodicite, 'mensuel'),
+	       COALESCE(d.remise_pct, 0), d.date_validite, COALESCE(d.notes, ''), d.id_commercial,
+	       d.date_creation, d.date_envoi, d.date_reponse, COALESCE(d.motif_refus, ''),
+	       d.id_commande, d.id_abonnement,
+	       COALESCE(u.email, ''), TRIM(COALESCE(u.prenom, '') || ' ' || COALESCE(u.nom, '')),
+	       COALESCE(e.nom, ''), COALESCE(p.nom, '')
+	FROM devis d
+	JOIN utilisateur u ON u.id_utilisateur = d.id_utilisateur
+	LEFT JOIN entreprise e ON e.id_entreprise = d.id_entreprise
+	LEFT JOIN produits p ON p.id_produit = d.id_produit`
+
+func scanDevis(row interface{ Scan(...interface{}) error }) (models.Devis, error) {
+	var d models.Devis
+	err := row.Scan(&d.ID, &d.Numero, &d.Statut, &d.Besoin, &d.IDUtilisateur,
+		&d.IDEntreprise, &d.IDProduit, &d.Periodicite,
+		&d.RemisePct, &d.DateValidite, &d.Notes, &d.IDCommercial,
+		&d.DateCreation, &d.DateEnvoi, &d.DateReponse, &d.MotifRefus,
+		&d.IDCommande, &d.IDAbonnement,
+		&d.ClientEmail, &d.ClientNom, &d.NomEntreprise, &d.NomProduit)
+	d.Lignes = []models.DevisLigne{}
+	return d, err
+}
+
+// loadDevis charge un devis et ses lignes ; forUpdate verrouille la ligne devis (transaction).
+func loadDevis(q dbQuerier, id int, forUpdate bool) (models.Devis, error) {
+	query := devisSelect + " WHERE d.id_devis = $1"
+	if forUpdate {
+		query += " FOR UPDATE OF d"
+	}
+	d, err := scanDevis(q.QueryRow(query, id))
+	if err != nil {
+		return d, err
+	}
+	rows, err := q.Query(`
+		SELECT id_ligne, libelle, quantite, prix_unitaire, recurrent
+		FROM devis_ligne WHERE id_devis = $1 ORDER BY ordre, id_ligne`, id)
+	if err != nil {
+		return d, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var l models.DevisLigne
+		if err := rows.Scan(&l.ID, &l.Libelle, &l.Quantite, &l.PrixUnitaire, &l.Recurrent); err == nil {
+			d.Lignes = append(d.Lignes, l)
+		}
+	}
+	return d, rows.Err()
+}
+
+func devisTotals(d models.Devis) billing.QuoteTotals {
+	lines := make([]billing.QuoteLine, len(d.Lignes))
+	for i, l := range d.Lignes {
+		lines[i] = billing.QuoteLine{Quantite: l.Quantite, PrixUnitaire: l.PrixUnitaire, Recurrent: l.Recurrent}
+	}
+	return billing.ComputeQuote(lines, d.RemisePct)
+}
+
+type devisResponse struct {
+	models.Devis
+	Totals billing.QuoteTotals `json:"totals"`
+}
+
+func writeDevis(w http.ResponseWriter, code int, d models.Devis) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(devisResponse{Devis: d, Totals: devisTotals(d)})
+}
+
+// clientView masque le chiffrage tant que le devis n'a pas été envoyé.
+func clientView(d models.Devis) models.Devis {
+	if d.Statut == billing.DevisDemande || d.Statut == billing.DevisBrouillon {
+		d.Statut = billing.DevisDemande
+		d.Lignes = []models.DevisLigne{}
+		d.RemisePct = 0
+		d.DateValidite = nil
+		d.Notes = ""
+	}
+	return d
+}
+
+// ownsDevis vérifie que le devis appartient à l'utilisateur ou à son entreprise.
+func ownsDevis(d models.Devis, userID int) bool {
+	if d.IDUtilisateur == userID {
+		return true
+	}
+	if d.IDEntreprise == nil {
+		return false
+	}
+	var companyID int
+	config.DB.QueryRow("SELECT COALESCE(id_entreprise, 0) FROM utilisateur WHERE id_utilisateur = $1", userID).Scan(&companyID)
+	return companyID != 0 && companyID == *d.IDEntreprise
+}
+
+func devisIDParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		jsonErr(w, "Invalid ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// ----- Client -----
+
+// RequestDevis enregistre une demande de devis avec la description du besoin.
+func RequestDevis(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserID(r)
+	if !ok {
+		jsonErr(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		ProductSlug string `json:"productSlug"`
+		Besoin      string `json:"needs"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Besoin = strings.TrimSpace(req.Besoin)
+	if req.Besoin == "" || len(req.Besoin) > maxDevisBesoin {
+		jsonErr(w, "needs is required (max 5000 characters)", http.StatusBadRequest)
+		return
+	}
+
+	var productID *int
+	if req.ProductSlug != "" {
+		var id int
+		if err := config.DB.QueryRow("SELECT id_produit FROM produits WHERE slug = $1 AND actif = TRUE", req.ProductSlug).Scan(&id); err != nil {
+			jsonErr(w, "Produit introuvable", http.StatusNotFound)
+			return
+		}
+		productID = &id
+	}
+	var companyID *int
+	config.DB.QueryRow("SELECT id_entreprise FROM utilisateur WHERE id_utilisateur = $1", userID).Scan(&companyID)
+
+	var id int
+	if err := config.DB.QueryRow(`
+		INSERT INTO devis (statut, besoin, id_utilisateur, id_entreprise, id_produit)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id_devis`,
+		billing.DevisDemande, req.Besoin, userID, companyID, productID).Scan(&id); err != nil {
+		log.Printf("RequestDevis error: %v", err)
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	config.DB.Exec("UPDATE devis SET numero = $1 WHERE id_devis = $2", devisNumero(id, time.Now()), id)
+
+	d, err := loadDevis(config.DB, id, false)
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if sales := os.Getenv("SALES_EMAIL"); sales != "" {
+		go sendDevisRequestNotification(sales, d)
+	}
+	writeDevis(w, http.StatusCreated, clientView(d))
+}
+
+func devisNumero(id int, t time.Time) string {
+	return fmt.Sprintf("DEV-%d-%05d", t.Year(), id)
+}
+
+// GetMesDevis liste les devis de l'utilisateur et de son entreprise.
+func GetMesDevis(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserID(r)
+	if !ok {
+		jsonErr(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	rows, err := config.DB.Query(devisSelect+`
+		WHERE d.id_utilisateur = $1
+		   OR d.id_entreprise = (SELECT id_entreprise FROM utilisateur WHERE id_utilisateur = $1)
+		ORDER BY d.date_creation DESC`, userID)
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	items := []models.Devis{}
+	for rows.Next() {
+		d, err := scanDevis(rows)
+		if err != nil {
+			continue
+		}
+		items = append(items, clientView(d))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+func loadOwnDevis(w http.ResponseWriter, r *http.Request) (models.Devis, bool) {
+	userID, ok := getUserID(r)
+	if !ok {
+		jsonErr(w, "Unauthorized", http.StatusUnauthorized)
+		return models.Devis{}, false
+	}
+	id, ok := devisIDParam(w, r)
+	if !ok {
+		return models.Devis{}, false
+	}
+	d, err := loadDevis(config.DB, id, false)
+	if err != nil || !ownsDevis(d, userID) {
+		jsonErr(w, "Devis introuvable", http.StatusNotFound)
+		return d, false
+	}
+	return d, true
+}
+
+func GetMonDevis(w http.ResponseWriter, r *http.Request) {
+	d, ok := loadOwnDevis(w, r)
+	if !ok {
+		return
+	}
+	writeDevis(w, http.StatusOK, clientView(d))
+}
+
+func GetMonDevisPDF(w http.ResponseWriter, r *http.Request) {
+	d, ok := loadOwnDevis(w, r)
+	if !ok {
+		return
+	}
+	if d.Statut == billing.DevisDemande || d.Statut == billing.DevisBrouillon {
+		jsonErr(w, "Devis en cours de préparation", http.StatusConflict)
+		return
+	}
+	writeDevisPDF(w, d)
+}
+
+// AcceptDevis accepte un devis envoyé et le convertit, dans une seule transaction,
+// en commande (+ facture) et, s'il comporte des lignes récurrentes, en abonnement
+// sur une tarification dédiée au prix négocié.
+func AcceptDevis(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserID(r)
+	if !ok {
+		jsonErr(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id, ok := devisIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	d, err := loadDevis(tx, id, true)
+	if err != nil || !ownsDevis(d, userID) {
+		jsonErr(w, "Devis introuvable", http.StatusNotFound)
+		return
+	}
+	if d.Statut != billing.DevisEnvoye {
+		jsonErr(w, "Ce devis ne peut plus être accepté (statut "+d.Statut+")", http.StatusConflict)
+		return
+	}
+	today := time.Now().Truncate(24 * time.Hour)
+	if d.DateValidite == nil || d.DateValidite.Before(today) {
+		tx.Exec("UPDATE devis SET statut = $1, date_modification = NOW() WHERE id_devis = $2", billing.DevisExpire, id)
+		tx.Commit()
+		jsonErr(w, "Devis expiré", http.StatusGone)
+		return
+	}
+
+	res, err := convertDevis(tx, d, userID)
+	if errors.Is(err, errDevisQuantite) {
+		jsonErr(w, "Ce devis comporte une quantité non entière et doit être corrigé par votre conseiller", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("AcceptDevis %d error: %v", id, err)
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	go sendDevisAcceptedEmails(d, res)
+	billing.NotifyInvoice(userID, res.FactureID, res.Totals.Total)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":        "Devis accepté",
+		"orderId":        res.CommandeID,
+		"invoiceId":      res.FactureID,
+		"subscriptionId": res.AbonnementID,
+	})
+}
+
+type devisConversion struct {
+	CommandeID   int
+	FactureID    int
+	AbonnementID *int
+	Totals       billing.QuoteTotals
+}
+
+func convertDevis(tx *sql.Tx, d models.Devis, userID int) (devisConversion, error) {
+	var res devisConversion
+	res.Totals = devisTotals(d)
+
+	// Entreprise : celle du devis, sinon celle du client (créée si besoin, comme un achat en ligne).
+	var companyID int
+	if d.IDEntreprise != nil {
+		companyID = *d.IDEntreprise
+	} else {
+		tx.QueryRow("SELECT COALESCE(id_entreprise, 0) FROM utilisateur WHERE id_utilisateur = $1", d.IDUtilisateur).Scan(&companyID)
+	}
+	if companyID == 0 {
+		name := d.ClientNom
+		if name == "" {
+			name = d.ClientEmail
+		}
+		if err := tx.QueryRow("INSERT INTO entreprise (nom) VALUES ($1) RETURNING id_entreprise", name+" (Auto)").Scan(&companyID); err != nil {
+			return res, err
+		}
+		if _, err := tx.Exec("UPDATE utilisateur SET id_entreprise = $1 WHERE id_utilisateur = $2", companyID, d.IDUtilisateur); err != nil {
+			return res, err
+		}
+	}
+
+	items := make([]models.OrderItem, len(d.Lignes))
+	invoiceLines := make([]billing.InvoiceLine, 0, len(d.Lignes)+1)
+	for i, l := range d.Lignes {
+		if l.Quantite != math.Trunc(l.Quantite) {
+			return res, fmt.Errorf("%w (ligne %d : %v)", errDevisQuantite, i, l.Quantite)
+		}
+		items[i] = models.OrderItem{ProductName: l.Libelle, Price: l.PrixUnitaire, Quantity: int(l.Quantite)}
+		lineType := billing.LigneFrais
+		if l.Recurrent {
+			items[i].Duration = d.Periodicite
+			lineType = billing.LigneAbonnement
+		}
+		invoiceLines = append(invoiceLines, billing.InvoiceLine{
+			Type: lineType, Libelle: l.Libelle, Quantite: l.Quantite, PrixUnitaire: l.PrixUnitaire,
+			Montant: billing.QuoteLine{Quantite: l.Quantite, PrixUnitaire: l.PrixUnitaire}.Total(),
+		})
+	}
+	if res.Totals.Remise > 0 {
+		invoiceLines = append(invoiceLines, billing.InvoiceLine{
+			Type: billing.LigneRemise, Libelle: fmt.Sprintf("Remise %s %% (devis %s)", formatPercent(d.RemisePct), d.Numero),
+			Quantite: 1, Montant: -res.Totals.Remise,
+		})
+	}
+	itemsJSON, _ := json.Marshal(items)
+
+	if err := tx.QueryRow(
+		"INSERT INTO commande (montant_total, statut, items, id_utilisateur) VALUES ($1, 'attente', $2, $3) RETURNING id_commande",
+		res.Totals.Total, string(itemsJSON), userID).Scan(&res.CommandeID); err != nil {
+		return res, err
+	}
+	if err := tx.QueryRow(
+		"INSERT INTO facture (date_facture, montant, id_commande) VALUES (CURRENT_DATE, $1, $2) RETURNING id_facture",
+		res.Totals.Total, res.CommandeID).Scan(&res.FactureID); err != nil {
+		return res, err
+	}
+
+	if res.Totals.Recurrent > 0 {
+		if d.IDProduit == nil {
+			return res, fmt.Errorf("devis %d: produit requis pour les lignes récurrentes", d.ID)
+		}
+		for i := range invoiceLines {
+			if invoiceLines[i].Type == billing.LigneAbonnement {
+				invoiceLines[i].AbonnementID = -1 // renseigné après création
+			}
+		}
+		var tarifID, subID int
+		if err := tx.QueryRow(`
+			INSERT INTO tarification (prix, unite, periodicite, actif, id_produit)
+			VALUES ($1, $2, $3, FALSE, $4) RETURNING id_tarification`,
+			res.Totals.Recurrent, "devis "+d.Numero, d.Periodicite, *d.IDProduit).Scan(&tarifID); err != nil {
+			return res, err
+		}
+		today := time.Now()
+		if err := tx.QueryRow(`
+			INSERT INTO abonnement (date_debut, date_fin, quantite, statut, renouvellement_auto, id_entreprise, id_produit, id_tarification)
+			VALUES ($1, $2, 1, $3, TRUE, $4, $5, $6) RETURNING id_abonnement`,
+			today, billing.AddPeriod(today, d.Periodicite), billing.StatutActif, companyID, *d.IDProduit, tarifID).Scan(&subID); err != nil {
+			return res, err
+		}
+		res.AbonnementID = &subID
+		for i := range invoiceLines {
+			if invoiceLines[i].AbonnementID == -1 {
+				invoiceLines[i].AbonnementID = subID
+			}
+		}
+	}
+	if err := billing.AddInvoiceLines(context.Background(), tx, res.FactureID, invoiceLines); err != nil {
+		return res, err
+	}
+
+	_, err := tx.Exec(`
+		UPDATE devis SET statut = $1, date_reponse = NOW(), date_modification = NOW(),
+		       id_entreprise = $2, id_commande = $3, id_abonnement = $4
+		WHERE id_devis = $5`,
+		billing.DevisAccepte, companyID, res.CommandeID, res.AbonnementID, d.ID)
+	return res, err
+}
+
+// RefuseDevis enregistre le refus d'un devis envoyé par le client.
+func RefuseDevis(w http.ResponseWriter, r *http.Request) {
+	d, ok := loadOwnDevis(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	if !billing.CanTransitionDevis(d.Statut, billing.DevisRefuse) {
+		jsonErr(w, "Ce devis ne peut pas être refusé (statut "+d.Statut+")", http.StatusConflict)
+		return
+	}
+	res, err := config.DB.Exec(`
+		UPDATE devis SET statut = $1, motif_refus = $2, date_reponse = NOW(), date_modification = NOW()
+		WHERE id_devis = $3 AND statut = $4`,
+		billing.DevisRefuse, mw.SanitizeString(req.Reason), d.ID, billing.DevisEnvoye)
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		jsonErr(w, "Ce devis ne peut pas être refusé", http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Devis refusé"})
+}
+
+// ----- Commercial (admin) -----
+
+func GetAdminDevis(w http.ResponseWriter, r *http.Request) {
+	query := devisSelect
+	args := []interface{}{}
+	if statut := r.URL.Query().Get("statut"); statut != "" {
+		query += " WHERE d.statut = $1"
+		args = append(args, statut)
+	}
+	rows, err := config.DB.Query(query+" ORDER BY d.date_creation DESC", args...)
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	items := []models.Devis{}
+	for rows.Next() {
+		if d, err := scanDevis(rows); err == nil {
+			items = append(items, d)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+func GetAdminDevisByID(w http.ResponseWriter, r *http.Request) {
+	id, ok := devisIDParam(w, r)
+	if !ok {
+		return
+	}
+	d, err := loadDevis(config.DB, id, false)
+	if err != nil {
+		jsonErr(w, "Devis introuvable", http.StatusNotFound)
+		return
+	}
+	writeDevis(w, http.StatusOK, d)
+}
+
+func GetAdminDevisPDF(w http.ResponseWriter, r *http.Request) {
+	id, ok := devisIDParam(w, r)
+	if !ok {
+		return
+	}
+	d, err := loadDevis(config.DB, id, false)
+	if err != nil {
+		jsonErr(w, "Devis introuvable", http.StatusNotFound)
+		return
+	}
+	writeDevisPDF(w, d)
+}
+
+type devisDraftReq struct {
+	UserID       int                 `json:"userId"` // création uniquement
+	Besoin       string              `json:"needs"`
+	ProductID    *int                `json:"productId"`
+	Periodicite  string              `json:"periodicity"`
+	RemisePct    float64             `json:"discountPercent"`
+	DateValidite string              `json:"validUntil"` // YYYY-MM-DD
+	Notes        string              `json:"notes"`
+	Lignes       []models.DevisLigne `json:"lines"`
+}
+
+func (req *devisDraftReq) validate() (*time.Time, string) {
+	if req.RemisePct < 0 || req.RemisePct > 100 {
+		return nil, "discountPercent must be between 0 and 100"
+	}
+	if req.Periodicite == "" {
+		req.Periodicite = "mensuel"
+	}
+	for i, l := range req.Lignes {
+		if strings.TrimSpace(l.Libelle) == "" || l.Quantite <= 0 || l.PrixUnitaire < 0 {
+			return nil, fmt.Sprintf("line %d: label, positive quantity and unit price are required", i)
+		}
+		if l.Quantite != math.Trunc(l.Quantite) {
+			return nil, fmt.Sprintf("line %d: quantity must be a whole number", i)
+		}
+		req.Lignes[i].Libelle = strings.TrimSpace(l.Libelle)
+	}
+	if req.DateValidite == "" {
+		return nil, ""
+	}
+	t, err := time.Parse("2006-01-02", req.DateValidite)
+	if err != nil {
+		return nil, "validUntil must be YYYY-MM-DD"
+	}
+	return &t, ""
+}
+
+func saveDevisLignes(tx *sql.Tx, id int, lignes []models.DevisLigne) error {
+	if _, err := tx.Exec("DELETE FROM devis_ligne WHERE id_devis = $1", id); err != nil {
+		return err
+	}
+	for i, l := range lignes {
+		if _, err := tx.Exec(`
+			INSERT INTO devis_ligne (id_devis, libelle, quantite, prix_unitaire, recurrent, ordre)
+			VALUES ($1, $2, $3, $4, $5, $6)`, id, l.Libelle, l.Quantite, l.PrixUnitaire, l.Recurrent, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateDevis permet au commercial de rédiger directement un devis pour un client.
+func CreateDevis(w http.ResponseWriter, r *http.Request) {
+	salesID, _ := getUserID(r)
+	var req devisDraftReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == 0 {
+		jsonErr(w, "userId is required", http.StatusBadRequest)
+		return
+	}
+	validite, msg := req.validate()
+	if msg != "" {
+		jsonErr(w, msg, http.StatusBadRequest)
+		return
+	}
+	var companyID *int
+	if err := config.DB.QueryRow("SELECT id_entreprise FROM utilisateur WHERE id_utilisateur = $1", req.UserID).Scan(&companyID); err != nil {
+		jsonErr(w, "Utilisateur introuvable", http.StatusNotFound)
+		return
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO devis (statut, besoin, id_utilisateur, id_entreprise, id_produit, periodicite,
+		                   remise_pct, date_validite, notes, id_commercial)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id_devis`,
+		billing.DevisBrouillon, strings.TrimSpace(req.Besoin), req.UserID, companyID, req.ProductID, req.Periodicite,
+		req.RemisePct, validite, req.Notes, salesID).Scan(&id)
+	if err == nil {
+		_, err = tx.Exec("UPDATE devis SET numero = $1 WHERE id_devis = $2", devisNumero(id, time.Now()), id)
+	}
+	if err == nil {
+		err = saveDevisLignes(tx, id, req.Lignes)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("CreateDevis error: %v", err)
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	d, _ := loadDevis(config.DB, id, false)
+	writeDevis(w, http.StatusCreated, d)
+}
+
+// UpdateDevis chiffre ou modifie un devis (lignes, remise, validité). Un devis déjà
+// envoyé repasse en brouillon et doit être renvoyé.
+func UpdateDevis(w http.ResponseWriter, r *http.Request) {
+	salesID, _ := getUserID(r)
+	id, ok := devisIDParam(w, r)
+	if !ok {
+		return
+	}
+	var req devisDraftReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	validite, msg := req.validate()
+	if msg != "" {
+		jsonErr(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	d, err := loadDevis(tx, id, true)
+	if err != nil {
+		jsonErr(w, "Devis introuvable", http.StatusNotFound)
+		return
+	}
+	if !billing.CanTransitionDevis(d.Statut, billing.DevisBrouillon) {
+		jsonErr(w, "Devis non modifiable (statut "+d.Statut+")", http.StatusConflict)
+		return
+	}
+	besoin := d.Besoin
+	if strings.TrimSpace(req.Besoin) != "" {
+		besoin = strings.TrimSpace(req.Besoin)
+	}
+	_, err = tx.Exec(`
+		UPDATE devis SET statut = $1, besoin = $2, id_produit = $3, periodicite = $4, remise_pct = $5,
+		       date_validite = $6, notes = $7, id_commercial = $8, date_modification = NOW()
+		WHERE id_devis = $9`,
+		billing.DevisBrouillon, besoin, req.ProductID, req.Periodicite, req.RemisePct, validite, req.Notes, salesID, id)
+	if err == nil {
+		err = saveDevisLignes(tx, id, req.Lignes)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("UpdateDevis %d error: %v", id, err)
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	d, _ = loadDevis(config.DB, id, false)
+	writeDevis(w, http.StatusOK, d)
+}
+
+// SendDevis génère le PDF, l'envoie par email au client et passe le devis en "envoye".
+func SendDevis(w http.ResponseWriter, r *http.Request) {
+	id, ok := devisIDParam(w, r)
+	if !ok {
+		return
+	}
+	d, err := loadDevis(config.DB, id, false)
+	if err != nil {
+		jsonErr(w, "Devis introuvable", http.StatusNotFound)
+		return
+	}
+	if d.Statut != billing.DevisBrouillon {
+		jsonErr(w, "Seul un devis en brouillon peut être envoyé (statut "+d.Statut+")", http.StatusConflict)
+		return
+	}
+	if msg := devisReadyToSend(d, time.Now()); msg != "" {
+		jsonErr(w, msg, http.StatusUnprocessableEntity)
+		return
+	}
+
+	res, err := config.DB.Exec(`
+		UPDATE devis SET statut = $1, date_envoi = NOW(), date_modification = NOW()
+		WHERE id_devis = $2 AND statut = $3`, billing.DevisEnvoye, id, billing.DevisBrouillon)
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		jsonErr(w, "Devis modifié entre-temps", http.StatusConflict)
+		return
+	}
+	d.Statut = billing.DevisEnvoye
+	now := time.Now()
+	d.DateEnvoi = &now
+
+	if err := sendDevisEmail(d); err != nil {
+		log.Printf("[EMAIL] Erreur envoi devis %s à %s: %v", d.Numero, d.ClientEmail, err)
+	}
+	writeDevis(w, http.StatusOK, d)
+}
+
+func devisReadyToSend(d models.Devis, now time.Time) string {
+	if len(d.Lignes) == 0 {
+		return "Le devis doit comporter au moins une ligne"
+	}
+	if d.DateValidite == nil || d.DateValidite.Before(now.Truncate(24*time.Hour)) {
+		return "Date de validité manquante ou dépassée"
+	}
+	if d.IDProduit == nil && devisTotals(d).Recurrent > 0 {
+		return "Un produit est requis pour les lignes récurrentes (abonnement)"
+	}
+	return ""
+}
+
+// CancelDevis annule un devis non encore accepté.
+func CancelDevis(w http.ResponseWriter, r *http.Request) {
+	id, ok := devisIDParam(w, r)
+	if !ok {
+		return
+	}
+	res, err := config.DB.Exec(`
+		UPDATE devis SET statut = $1, date_modification = NOW()
+		WHERE id_devis = $2 AND statut IN ($3, $4, $5)`,
+		billing.DevisAnnule, id, billing.DevisDemande, billing.DevisBrouillon, billing.DevisEnvoye)
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		jsonErr(w, "Devis introuvable ou déjà clôturé", http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ----- Emails -----
+
+func devisLink(d models.Devis) string {
+	frontendURL := os.Getenv("FRONTEND_URL")
+	if frontendURL == "" {
+		frontendURL = "http://localhost:3000"
+	}
+	return frontendURL + "/devis.html?id=" + strconv.Itoa(d.ID)
+}
+
+func sendDevisEmail(d models.Devis) error {
+	t := devisTotals(d)
+	link := devisLink(d)
+	body := fmt.Sprintf(`
+      <p style="color:#555;line-height:1.6;">Bonjour %s,</p>
+      <p style="color:#555;line-height:1.6;">Veuillez trouver ci-joint notre proposition <strong>%s</strong>
+        d'un montant de <strong>%s</strong>, valable jusqu'au <strong>%s</strong>.</p>
+      <div style="text-align:center;margin:32px 0;">
+        <a href="%s" style="background:#3b12a3;color:#fff;padding:14px 32px;border-radius:8px;text-decoration:none;font-weight:700;font-size:15px;display:inline-block;">
+          Consulter et accepter le devis
+        </a>
+      </div>`,
+		html.EscapeString(d.ClientNom), d.Numero, formatEuros(t.Total), d.DateValidite.Format("02/01/2006"), link)
+	return mailer.SendWithAttachments(d.ClientEmail, "Votre devis CYNA "+d.Numero,
+		mailer.Layout("Votre devis", body),
+		mailer.Attachment{Filename: d.Numero + ".pdf", ContentType: "application/pdf", Data: renderDevisPDF(d)})
+}
+
+func sendDevisRequestNotification(to string, d models.Devis) {
+	body := fmt.Sprintf(`
+      <p style="color:#555;line-height:1.6;">Nouvelle demande <strong>%s</strong> de %s (%s)%s :</p>
+      <blockquote style="color:#555;border-left:3px solid #3b12a3;margin:16px 0;padding-left:12px;">%s</blockquote>`,
+		d.Numero, html.EscapeString(d.ClientNom), html.EscapeString(d.ClientEmail),
+		map[bool]string{true: " pour <strong>" + html.EscapeString(d.NomProduit) + "</strong>", false: ""}[d.NomProduit != ""],
+		strings.ReplaceAll(html.EscapeString(d.Besoin), "\n", "<br>"))
+	if err := mailer.Send(to, "Demande de devis "+d.Numero, mailer.Layout("Demande de devis", body)); err != nil {
+		log.Printf("[EMAIL] Erreur notification devis %s: %v", d.Numero, err)
+	}
+}
+
+func sendDevisAcceptedEmails(d models.Devis, res devisConversion) {
+	body := fmt.Sprintf(`
+      <p style="color:#555;line-height:1.6;">Le devis <strong>%s</strong> a été accepté.</p>
+      <p style="color:#555;line-height:1.6;">Commande n°%d — montant : <strong>%s</strong>.</p>`,
+		d.Numero, res.CommandeID, formatEuros(res.Totals.Total))
+	if err := mailer.Send(d.ClientEmail, "Confirmation de votre commande CYNA", mailer.Layout("Merci pour votre confiance", body)); err != nil {
+		log.Printf("[EMAIL] Erreur confirmation devis %s: %v", d.Numero, err)
+	}
+	if sales := os.Getenv("SALES_EMAIL"); sales != "" {
+		mailer.Send(sales, "Devis accepté "+d.Numero, mailer.Layout("Devis accepté", body))
+	}
+}
+
+// formatEuros formate un montant à la française : 1 234,56 €.
+func formatEuros(v float64) string {
+	neg := v < 0
+	if neg {
+		v = -v
+	}
+	s := strconv.FormatFloat(v, 'f', 2, 64)
+	intPart, dec := s[:len(s)-3], s[len(s)-2:]
+	var b strings.Builder
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteRune(' ')
+		}
+		b.WriteRune(c)
+	}
+	out := b.String() + "," + dec + " €"
+	if neg {
+		out = "-" + out
+	}
+	return out
+}
+
+func formatPercent(v float64) string {
+	return strings.Replace(strconv.FormatFloat(v, 'f', -1, 64), ".", ",", 1)
+}
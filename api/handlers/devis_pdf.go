@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"api/models"
+	"api/pdf"
+)
+
+// ===== DEVIS — rendu PDF =====
+
+const (
+	pdfMargin = 50.0
+	pdfBottom = pdf.PageHeight - 70
+)
+
+var periodeLabels = map[string]string{
+	"mensuel":     "mois",
+	"trimestriel": "trimestre",
+	"annuel":      "an",
+}
+
+func writeDevisPDF(w http.ResponseWriter, d models.Devis) {
+	data := renderDevisPDF(d)
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `inline; filename="`+d.Numero+`.pdf"`)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+// renderDevisPDF produit le devis au format PDF (en-tête CYNA, client, lignes, totaux).
+func renderDevisPDF(d models.Devis) []byte {
+	doc := pdf.New("Devis " + d.Numero)
+	page := doc.AddPage()
+	right := pdf.PageWidth - pdfMargin
+
+	// En-tête
+	page.FillRect(0, 0, pdf.PageWidth, 90, 0.231, 0.071, 0.639)
+	page.Text(pdfMargin, 45, 24, true, 1, 1, 1, "CYNA")
+	page.Text(pdfMargin, 65, 10, false, 1, 1, 1, "Cybersécurité managée pour les PME")
+	page.TextRight(right, 45, 16, true, 1, 1, 1, "DEVIS")
+	page.TextRight(right, 65, 10, false, 1, 1, 1, d.Numero)
+
+	y := 125.0
+	page.Text(pdfMargin, y, 10, false, 0.33, 0.33, 0.33, "Date : "+devisDate(d).Format("02/01/2006"))
+	if d.DateValidite != nil {
+		page.Text(pdfMargin, y+15, 10, false, 0.33, 0.33, 0.33, "Valable jusqu'au : "+d.DateValidite.Format("02/01/2006"))
+	}
+
+	// Client
+	page.Text(330, y, 10, true, 0.1, 0.1, 0.1, "Client")
+	cy := y + 15
+	for _, s := range []string{d.NomEntreprise, d.ClientNom, d.ClientEmail} {
+		if s != "" {
+			page.Text(330, cy, 10, false, 0.33, 0.33, 0.33, s)
+			cy += 14
+		}
+	}
+
+	y = 200
+	if name := d.NomProduit; name != "" {
+		page.Text(pdfMargin, y, 12, true, 0.1, 0.1, 0.1, name)
+		y += 20
+	}
+	if d.Besoin != "" {
+		page.Text(pdfMargin, y, 10, true, 0.1, 0.1, 0.1, "Votre besoin")
+		y += 14
+		for _, l := range pdf.Wrap(d.Besoin, 9, right-pdfMargin) {
+			if y > 330 {
+				page.Text(pdfMargin, y, 9, false, 0.33, 0.33, 0.33, "[...]")
+				y += 12
+				break
+			}
+			page.Text(pdfMargin, y, 9, false, 0.33, 0.33, 0.33, l)
+			y += 12
+		}
+		y += 10
+	}
+
+	// Lignes
+	cols := []float64{pdfMargin + 6, 330, 400, 470, right - 6}
+	header := func(p *pdf.Page, y float64) float64 {
+		p.FillRect(pdfMargin, y, right-pdfMargin, 22, 0.95, 0.94, 0.99)
+		p.Text(cols[0], y+15, 9, true, 0.1, 0.1, 0.1, "Désignation")
+		p.TextRight(cols[1]+30, y+15, 9, true, 0.1, 0.1, 0.1, "Qté")
+		p.TextRight(cols[2]+50, y+15, 9, true, 0.1, 0.1, 0.1, "PU HT")
+		p.Text(cols[3], y+15, 9, true, 0.1, 0.1, 0.1, "Type")
+		p.TextRight(cols[4], y+15, 9, true, 0.1, 0.1, 0.1, "Montant HT")
+		return y + 22
+	}
+	y = header(page, y)
+	for _, l := range d.Lignes {
+		labels := pdf.Wrap(l.Libelle, 9, cols[1]-cols[0]-20)
+		if y+float64(len(labels))*12+8 > pdfBottom {
+			devisFooter(page)
+			page = doc.AddPage()
+			y = header(page, pdfMargin)
+		}
+		y += 16
+		for i, s := range labels {
+			page.Text(cols[0], y+float64(i)*12, 9, false, 0.2, 0.2, 0.2, s)
+		}
+		page.TextRight(cols[1]+30, y, 9, false, 0.2, 0.2, 0.2, formatPercent(l.Quantite))
+		page.TextRight(cols[2]+50, y, 9, false, 0.2, 0.2, 0.2, formatEuros(l.PrixUnitaire))
+		kind := "Unique"
+		if l.Recurrent {
+			kind = "/" + periodeLabel(d.Periodicite)
+		}
+		page.Text(cols[3], y, 9, false, 0.2, 0.2, 0.2, kind)
+		page.TextRight(cols[4], y, 9, false, 0.2, 0.2, 0.2, formatEuros(l.Quantite*l.PrixUnitaire))
+		y += float64(len(labels)-1)*12 + 8
+		page.Line(pdfMargin, y, right, y, 0.5)
+	}
+
+	// Totaux
+	t := devisTotals(d)
+	if y+110 > pdfBottom {
+		devisFooter(page)
+		page = doc.AddPage()
+		y = pdfMargin
+	}
+	y += 24
+	total := func(label, value string, bold bool) {
+		page.Text(330, y, 10, bold, 0.1, 0.1, 0.1, label)
+		page.TextRight(right, y, 10, bold, 0.1, 0.1, 0.1, value)
+		y += 16
+	}
+	total("Sous-total HT", formatEuros(t.SousTotal), false)
+	if t.Remise > 0 {
+		total("Remise "+formatPercent(d.RemisePct)+" %", "-"+formatEuros(t.Remise), false)
+	}
+	total("Total HT", formatEuros(t.Total), true)
+	if t.Recurrent > 0 {
+		y += 4
+		page.Text(330, y, 9, false, 0.33, 0.33, 0.33,
+			"dont abonnement : "+formatEuros(t.Recurrent)+" / "+periodeLabel(d.Periodicite))
+		y += 14
+	}
+
+	if d.Notes != "" {
+		y += 16
+		for _, l := range pdf.Wrap(d.Notes, 9, right-pdfMargin) {
+			if y > pdfBottom {
+				break
+			}
+			page.Text(pdfMargin, y, 9, false, 0.33, 0.33, 0.33, l)
+			y += 12
+		}
+	}
+	devisFooter(page)
+	return doc.Bytes()
+}
+
+func devisFooter(p *pdf.Page) {
+	p.Line(pdfMargin, pdf.PageHeight-50, pdf.PageWidth-pdfMargin, pdf.PageHeight-50, 0.5)
+	p.Text(pdfMargin, pdf.PageHeight-35, 8, false, 0.6, 0.6, 0.6, "© 2025 CYNA — Tous droits réservés")
+	p.TextRight(pdf.PageWidth-pdfMargin, pdf.PageHeight-35, 8, false, 0.6, 0.6, 0.6,
+		"Devis accepté en ligne depuis votre espace client")
+}
+
+func devisDate(d models.Devis) time.Time {
+	if d.DateEnvoi != nil {
+		return *d.DateEnvoi
+	}
+	return d.DateCreation
+}
+
+func periodeLabel(p string) string {
+	if l, ok := periodeLabels[p]; ok {
+		return l
+	}
+	return p
+}
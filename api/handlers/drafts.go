@@ -0,0 +1,607 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"api/cache"
+	"api/catalog"
+	"api/config"
+	apierrors "api/errors"
+	mw "api/middleware"
+	"api/models"
+)
+
+// ===== CATALOGUE — BROUILLONS ET PUBLICATION PLANIFIÉE =====
+//
+// Une modification de produit ou de catégorie est préparée en brouillon, prévisualisée
+// par un jeton signé, puis publiée à la main ou à date_publication par le job de
+// publication. Les brouillons planifiés au même instant sont appliqués ensemble, dans une
+// transaction : un lancement (catégorie + produits) passe en ligne d'un seul coup.
+
+const previewTokenTTL = 72 * time.Hour
+
+var (
+	previewSecretOnce sync.Once
+	previewSecretKey  []byte
+)
+
+// previewSecret retourne la clé HMAC des jetons de prévisualisation (PREVIEW_TOKEN_SECRET).
+// Sans configuration, une clé aléatoire est générée : les jetons ne survivent pas à un
+// redémarrage et ne sont valables que sur la réplica qui les a émis.
+func previewSecret() []byte {
+	previewSecretOnce.Do(func() {
+		if s := os.Getenv("PREVIEW_TOKEN_SECRET"); s != "" {
+			previewSecretKey = []byte(s)
+			return
+		}
+		log.Println("[WARN] PREVIEW_TOKEN_SECRET not set — using an ephemeral preview key")
+		previewSecretKey = make([]byte, 32)
+		rand.Read(previewSecretKey)
+	})
+	return previewSecretKey
+}
+
+const draftColumns = `id_brouillon, type_contenu, id_contenu, version, action, donnees, statut,
+	date_publication, COALESCE(erreur,''), id_auteur, date_creation, date_modification, date_application`
+
+func scanDraft(row interface{ Scan(...interface{}) error }) (models.CatalogDraft, error) {
+	var d models.CatalogDraft
+	var donnees []byte
+	err := row.Scan(&d.ID, &d.TypeContenu, &d.IDContenu, &d.Version, &d.Action, &donnees, &d.Statut,
+		&d.DatePublication, &d.Erreur, &d.IDAuteur, &d.DateCreation, &d.DateModif, &d.DateApplication)
+	if len(donnees) > 0 {
+		d.Donnees = donnees
+	}
+	return d, err
+}
+
+func loadDraft(q dbQuerier, id int, forUpdate bool) (models.CatalogDraft, error) {
+	query := "SELECT " + draftColumns + " FROM catalogue_brouillon WHERE id_brouillon = $1"
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+	d, err := scanDraft(q.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return d, apierrors.NewNotFound("Draft not found")
+	}
+	return d, err
+}
+
+type draftReq struct {
+	Type      string          `json:"type"`
+	ContentID int             `json:"contentId"`
+	Action    string          `json:"action"`
+	Content   json.RawMessage `json:"content"`
+	PublishAt *time.Time      `json:"publishAt"`
+}
+
+// normalizeContent valide le contenu d'un brouillon "update" (mêmes règles que l'édition
+// directe) et le retourne nettoyé, l'identifiant forcé sur le contenu visé.
+func (req *draftReq) normalizeContent() ([]byte, error) {
+	if req.Action != catalog.DraftUpdate {
+		return nil, nil
+	}
+	if len(req.Content) == 0 {
+		return nil, apierrors.NewValidation("content is required for an update draft")
+	}
+	var out interface{}
+	switch req.Type {
+	case catalog.DraftProduit:
+		var p models.ProduitWeb
+		if err := json.Unmarshal(req.Content, &p); err != nil {
+			return nil, apierrors.NewValidation("Invalid product content")
+		}
+		p.ID = req.ContentID
+		p.Nom = mw.SanitizeString(p.Nom)
+		p.DescriptionCourte = mw.SanitizeString(p.DescriptionCourte)
+		p.DescriptionHTML = mw.SanitizeHTML(p.DescriptionHTML)
+		if p.Nom == "" || p.Slug == "" {
+			return nil, apierrors.NewValidation("Name and slug are required")
+		}
+		// images dérivé des médias dès l'enregistrement : la prévisualisation l'affiche.
+		if err := resolveProduitMedia(config.DB, &p); err != nil {
+			return nil, err
+		}
+		out = p
+	case catalog.DraftCategorie:
+		var c models.CategorieWeb
+		if err := json.Unmarshal(req.Content, &c); err != nil {
+			return nil, apierrors.NewValidation("Invalid category content")
+		}
+		c.ID = req.ContentID
+		c.Nom = mw.SanitizeString(c.Nom)
+		c.Description = mw.SanitizeString(c.Description)
+		c.Image = strings.TrimSpace(c.Image)
+		if c.Nom == "" || c.Slug == "" {
+			return nil, apierrors.NewValidation("Name and slug are required")
+		}
+		out = c
+	}
+	return json.Marshal(out)
+}
+
+func draftStatus(publishAt *time.Time) string {
+	if publishAt != nil {
+		return catalog.DraftPlanifie
+	}
+	return catalog.DraftBrouillon
+}
+
+// contentModified retourne la date de dernière modification du contenu visé.
+func contentModified(q dbQuerier, kind string, id int, forUpdate bool) (time.Time, error) {
+	query := "SELECT COALESCE(date_modification, date_creation, 'epoch'::timestamp) FROM produits WHERE id_produit = $1"
+	if kind == catalog.DraftCategorie {
+		query = "SELECT COALESCE(date_modification, date_creation, 'epoch'::timestamp) FROM categories WHERE id_categorie = $1"
+	}
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+	var t time.Time
+	err := q.QueryRow(query, id).Scan(&t)
+	if err == sql.ErrNoRows {
+		return t, apierrors.NewNotFound("Content not found")
+	}
+	return t, err
+}
+
+// GetCatalogDrafts liste les brouillons (?status=, ?type=, ?contentId=), les plus récents d'abord.
+func GetCatalogDrafts(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	contentID, _ := strconv.Atoi(q.Get("contentId"))
+	_, limit, offset := parsePaginationDefault(r)
+	rows, err := config.DB.Query(`SELECT `+draftColumns+` FROM catalogue_brouillon
+		WHERE ($1 = '' OR statut = $1) AND ($2 = '' OR type_contenu = $2) AND ($3 = 0 OR id_contenu = $3)
+		ORDER BY date_modification DESC, id_brouillon DESC
+		LIMIT $4 OFFSET $5`, q.Get("status"), q.Get("type"), contentID, limit, offset)
+	if err != nil {
+		writeAppError(w, err, "list drafts")
+		return
+	}
+	defer rows.Close()
+	drafts := []models.CatalogDraft{}
+	for rows.Next() {
+		d, err := scanDraft(rows)
+		if err != nil {
+			writeAppError(w, err, "scan draft")
+			return
+		}
+		drafts = append(drafts, d)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(drafts)
+}
+
+// GetCatalogDraft retourne un brouillon.
+func GetCatalogDraft(w http.ResponseWriter, r *http.Request) {
+	id, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	d, err := loadDraft(config.DB, id, false)
+	if err != nil {
+		writeAppError(w, err, "get draft")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d)
+}
+
+// CreateCatalogDraft prépare une modification : nouvelle version du contenu visé.
+func CreateCatalogDraft(w http.ResponseWriter, r *http.Request) {
+	var req draftReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Action == "" {
+		req.Action = catalog.DraftUpdate
+	}
+	if !catalog.ValidDraftTarget(req.Type, req.Action) || req.ContentID <= 0 {
+		jsonErr(w, "type (produit | categorie), contentId and action (update | publish | unpublish) required", http.StatusBadRequest)
+		return
+	}
+	if req.PublishAt != nil && req.PublishAt.Before(time.Now()) {
+		jsonErr(w, "publishAt must be in the future", http.StatusBadRequest)
+		return
+	}
+	content, err := req.normalizeContent()
+	if err != nil {
+		writeAppError(w, err, "create draft")
+		return
+	}
+	base, err := contentModified(config.DB, req.Type, req.ContentID, false)
+	if err != nil {
+		writeAppError(w, err, "create draft")
+		return
+	}
+	userID, _ := getUserID(r)
+	var id int
+	err = config.DB.QueryRow(`
+		INSERT INTO catalogue_brouillon (type_contenu, id_contenu, version, action, donnees, statut,
+		    date_publication, base_modification, id_auteur)
+		SELECT $1::varchar, $2::int, COALESCE(MAX(version), 0) + 1, $3, $4::jsonb, $5, $6, $7, $8
+		FROM catalogue_brouillon WHERE type_contenu = $1 AND id_contenu = $2
+		RETURNING id_brouillon`,
+		req.Type, req.ContentID, req.Action, nullJSON(content), draftStatus(req.PublishAt),
+		req.PublishAt, base, userID).Scan(&id)
+	if err != nil {
+		writeAppError(w, err, "create draft")
+		return
+	}
+	respondDraft(w, id, http.StatusCreated)
+}
+
+func nullJSON(b []byte) interface{} {
+	if b == nil {
+		return nil
+	}
+	return string(b)
+}
+
+func respondDraft(w http.ResponseWriter, id, status int) {
+	d, err := loadDraft(config.DB, id, false)
+	if err != nil {
+		writeAppError(w, err, "load draft")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(d)
+}
+
+// UpdateCatalogDraft remplace le contenu, l'action ou la date de publication d'un brouillon
+// non publié. L'enregistrer le rebase sur l'état courant du contenu.
+func UpdateCatalogDraft(w http.ResponseWriter, r *http.Request) {
+	id, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	var req draftReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.PublishAt != nil && req.PublishAt.Before(time.Now()) {
+		jsonErr(w, "publishAt must be in the future", http.StatusBadRequest)
+		return
+	}
+	tx, err := config.DB.Begin()
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	err = func() error {
+		d, err := loadDraft(tx, id, true)
+		if err != nil {
+			return err
+		}
+		if !catalog.DraftEditable(d.Statut) {
+			return apierrors.NewConflict("Draft is " + d.Statut + " and can no longer be edited")
+		}
+		req.Type, req.ContentID = d.TypeContenu, d.IDContenu
+		if req.Action == "" {
+			req.Action = d.Action
+		}
+		if !catalog.ValidDraftTarget(req.Type, req.Action) {
+			return apierrors.NewValidation("action must be update, publish or unpublish")
+		}
+		if len(req.Content) == 0 && req.Action == d.Action {
+			req.Content = d.Donnees
+		}
+		content, err := req.normalizeContent()
+		if err != nil {
+			return err
+		}
+		base, err := contentModified(tx, d.TypeContenu, d.IDContenu, false)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`
+			UPDATE catalogue_brouillon SET action = $1, donnees = $2::jsonb, statut = $3, date_publication = $4,
+			       base_modification = $5, erreur = NULL, date_modification = NOW()
+			WHERE id_brouillon = $6`,
+			req.Action, nullJSON(content), draftStatus(req.PublishAt), req.PublishAt, base, id); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}()
+	if err != nil {
+		writeAppError(w, err, "update draft")
+		return
+	}
+	respondDraft(w, id, http.StatusOK)
+}
+
+// DeleteCatalogDraft abandonne un brouillon non publié (conservé avec le statut annule).
+func DeleteCatalogDraft(w http.ResponseWriter, r *http.Request) {
+	id, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	res, err := config.DB.Exec(`UPDATE catalogue_brouillon SET statut = $1, date_modification = NOW()
+		WHERE id_brouillon = $2 AND statut IN ($3, $4)`, catalog.DraftAnnule, id, catalog.DraftBrouillon, catalog.DraftPlanifie)
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		jsonErr(w, "Draft not found or already published", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PublishCatalogDraft applique immédiatement un brouillon.
+func PublishCatalogDraft(w http.ResponseWriter, r *http.Request) {
+	id, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	tx, err := config.DB.Begin()
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	var d models.CatalogDraft
+	err = func() error {
+		if d, err = loadDraft(tx, id, true); err != nil {
+			return err
+		}
+		if !catalog.DraftEditable(d.Statut) {
+			return apierrors.NewConflict("Draft is " + d.Statut)
+		}
+		userID, _ := getUserID(r)
+		if err := setActor(tx, userID); err != nil {
+			return err
+		}
+		if err := applyDraft(tx, d); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}()
+	if err != nil {
+		var ae apierrors.AppErrorer
+		if errors.As(err, &ae) && ae.AppErr().Code == http.StatusConflict && d.ID != 0 {
+			config.DB.Exec("UPDATE catalogue_brouillon SET erreur = $1 WHERE id_brouillon = $2", ae.AppErr().Message, d.ID)
+		}
+		writeAppError(w, err, "publish draft")
+		return
+	}
+	invalidateDraftCaches(map[string]bool{d.TypeContenu: true})
+	respondDraft(w, id, http.StatusOK)
+}
+
+// applyDraft écrit le brouillon sur le contenu et le marque publié. Un brouillon "update"
+// est refusé si le contenu a été modifié depuis sa création (ou son dernier enregistrement).
+func applyDraft(tx *sql.Tx, d models.CatalogDraft) error {
+	modified, err := contentModified(tx, d.TypeContenu, d.IDContenu, true)
+	if err != nil {
+		return err
+	}
+	switch d.Action {
+	case catalog.DraftUpdate:
+		var base time.Time
+		if err := tx.QueryRow("SELECT base_modification FROM catalogue_brouillon WHERE id_brouillon = $1", d.ID).Scan(&base); err != nil {
+			return err
+		}
+		if modified.After(base) {
+			return apierrors.NewConflict(fmt.Sprintf("%s %d was modified after draft v%d was saved", d.TypeContenu, d.IDContenu, d.Version))
+		}
+		if d.TypeContenu == catalog.DraftProduit {
+			var p models.ProduitWeb
+			if err := json.Unmarshal(d.Donnees, &p); err != nil {
+				return err
+			}
+			// Un média supprimé depuis l'enregistrement du brouillon est une erreur métier (apierrors).
+			err = updateProduitRow(tx, d.IDContenu, &p)
+		} else {
+			var c models.CategorieWeb
+			if err := json.Unmarshal(d.Donnees, &c); err != nil {
+				return err
+			}
+			err = updateCategorieRow(tx, d.IDContenu, c)
+		}
+	default:
+		query := "UPDATE produits SET actif = $1, date_modification = CURRENT_TIMESTAMP WHERE id_produit = $2"
+		if d.TypeContenu == catalog.DraftCategorie {
+			query = "UPDATE categories SET actif = $1, date_modification = CURRENT_TIMESTAMP WHERE id_categorie = $2"
+		}
+		_, err = tx.Exec(query, d.Action == catalog.DraftPublish, d.IDContenu)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE catalogue_brouillon SET statut = $1, erreur = NULL, date_application = NOW(), date_modification = NOW()
+		WHERE id_brouillon = $2`, catalog.DraftPublie, d.ID)
+	return err
+}
+
+func invalidateDraftCaches(kinds map[string]bool) {
+	if kinds[catalog.DraftProduit] {
+		cache.InvalidateProduits()
+	}
+	if kinds[catalog.DraftCategorie] {
+		cache.InvalidateCategories()
+		cache.InvalidateAdminCategories()
+	}
+}
+
+// CreateCatalogDraftPreview émet un jeton de prévisualisation signé (72 h).
+func CreateCatalogDraftPreview(w http.ResponseWriter, r *http.Request) {
+	id, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	d, err := loadDraft(config.DB, id, false)
+	if err != nil {
+		writeAppError(w, err, "preview draft")
+		return
+	}
+	exp := time.Now().Add(previewTokenTTL)
+	token := catalog.SignPreview(previewSecret(), d.ID, exp)
+	resp := map[string]interface{}{"token": token, "expiresAt": exp}
+	// Seule la fiche produit sait afficher un brouillon ; les autres se lisent via l'API.
+	if d.TypeContenu == catalog.DraftProduit && d.Action == catalog.DraftUpdate {
+		frontendURL := os.Getenv("FRONTEND_URL")
+		if frontendURL == "" {
+			frontendURL = "http://localhost:3000"
+		}
+		resp["url"] = frontendURL + "/produit.html?preview=" + token
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GetCatalogPreview (public) retourne le brouillon désigné par un jeton de prévisualisation.
+func GetCatalogPreview(w http.ResponseWriter, r *http.Request) {
+	id, err := catalog.VerifyPreview(previewSecret(), r.URL.Query().Get("token"), time.Now())
+	if err != nil {
+		jsonErr(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	d, err := loadDraft(config.DB, id, false)
+	if err != nil {
+		writeAppError(w, err, "preview draft")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"type":      d.TypeContenu,
+		"contentId": d.IDContenu,
+		"version":   d.Version,
+		"action":    d.Action,
+		"status":    d.Statut,
+		"publishAt": d.DatePublication,
+		"content":   d.Donnees,
+	})
+}
+
+// ----- Job de publication -----
+
+// InitCatalogPublisher démarre le job qui publie les brouillons planifiés arrivés à échéance
+// (toutes les CATALOG_PUBLISH_INTERVAL_SECONDS, 60 par défaut).
+func InitCatalogPublisher() {
+	seconds := 60
+	if s, err := strconv.Atoi(os.Getenv("CATALOG_PUBLISH_INTERVAL_SECONDS")); err == nil && s > 0 {
+		seconds = s
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(seconds) * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := publishDueDrafts(); err != nil {
+				log.Printf("[WARN] catalog publisher: %v", err)
+			}
+		}
+	}()
+	log.Printf("[INFO] Catalog publisher ready (interval: %ds)", seconds)
+}
+
+// publishDueDrafts publie, instant par instant, les brouillons planifiés échus.
+func publishDueDrafts() error {
+	if config.DB == nil {
+		return nil
+	}
+	rows, err := config.DB.Query(`SELECT DISTINCT date_publication FROM catalogue_brouillon
+		WHERE statut = $1 AND date_publication <= NOW() ORDER BY 1`, catalog.DraftPlanifie)
+	if err != nil {
+		return err
+	}
+	var due []time.Time
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			rows.Close()
+			return err
+		}
+		due = append(due, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, at := range due {
+		publishDraftGroup(at)
+	}
+	return nil
+}
+
+// publishDraftGroup applique ensemble les brouillons planifiés à l'instant at. En cas
+// d'échec, aucun n'est appliqué et tous passent en echec avec le motif.
+func publishDraftGroup(at time.Time) {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		log.Printf("[WARN] catalog publisher: %v", err)
+		return
+	}
+	defer tx.Rollback()
+	rows, err := tx.Query("SELECT "+draftColumns+` FROM catalogue_brouillon
+		WHERE statut = $1 AND date_publication = $2 ORDER BY id_brouillon FOR UPDATE SKIP LOCKED`, catalog.DraftPlanifie, at)
+	if err != nil {
+		log.Printf("[WARN] catalog publisher: %v", err)
+		return
+	}
+	var drafts []models.CatalogDraft
+	for rows.Next() {
+		d, err := scanDraft(rows)
+		if err != nil {
+			rows.Close()
+			log.Printf("[WARN] catalog publisher: %v", err)
+			return
+		}
+		drafts = append(drafts, d)
+	}
+	rows.Close()
+	if len(drafts) == 0 {
+		return
+	}
+
+	kinds := map[string]bool{}
+	for _, d := range drafts {
+		// Les versions publiées par le job sont attribuées à l'auteur du brouillon.
+		author := 0
+		if d.IDAuteur != nil {
+			author = *d.IDAuteur
+		}
+		err := setActor(tx, author)
+		if err == nil {
+			err = applyDraft(tx, d)
+		}
+		if err != nil {
+			tx.Rollback()
+			msg := err.Error()
+			if _, ok := err.(apierrors.AppErrorer); !ok {
+				log.Printf("[WARN] catalog publisher: draft %d: %v", d.ID, err)
+				msg = "internal error"
+			}
+			for _, g := range drafts {
+				reason := fmt.Sprintf("draft %d: %s", d.ID, msg)
+				config.DB.Exec(`UPDATE catalogue_brouillon SET statut = $1, erreur = $2, date_modification = NOW()
+					WHERE id_brouillon = $3 AND statut = $4`, catalog.DraftEchec, reason, g.ID, catalog.DraftPlanifie)
+			}
+			return
+		}
+		kinds[d.TypeContenu] = true
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("[WARN] catalog publisher: commit: %v", err)
+		return
+	}
+	invalidateDraftCaches(kinds)
+	log.Printf("[INFO] catalog publisher: %d draft(s) published (scheduled %s)", len(drafts), at.Format(time.RFC3339))
+}
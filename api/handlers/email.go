@@ -3,34 +3,14 @@ package handlers
 import (
 	"fmt"
 	"log"
-	"net/smtp"
 	"os"
+
+	"api/mailer"
 )
 
-// sendEmail envoie un email HTML via Gmail SMTP (port 587 / STARTTLS).
-// Si SMTP_FROM ou SMTP_PASSWORD est absent, log un avertissement et retourne nil.
+// sendEmail envoie un email HTML (voir mailer.Send).
 func sendEmail(to, subject, html string) error {
-	from := os.Getenv("SMTP_FROM")
-	password := os.Getenv("SMTP_PASSWORD")
-
-	if from == "" || password == "" {
-		log.Printf("[EMAIL-DEV] SMTP_FROM/SMTP_PASSWORD absents — email non envoyé à %s | sujet: %s", to, subject)
-		return nil
-	}
-
-	host := "smtp.gmail.com"
-	msg := "From: CYNA <" + from + ">\r\n" +
-		"To: " + to + "\r\n" +
-		"Subject: " + subject + "\r\n" +
-		"MIME-Version: 1.0\r\n" +
-		"Content-Type: text/html; charset=UTF-8\r\n" +
-		"\r\n" + html
-
-	auth := smtp.PlainAuth("", from, password, host)
-	if err := smtp.SendMail(host+":587", auth, from, []string{to}, []byte(msg)); err != nil {
-		return fmt.Errorf("smtp: %w", err)
-	}
-	return nil
+	return mailer.Send(to, subject, html)
 }
 
 // sendEmailWelcome envoie un email de bienvenue après inscription mobile (email déjà vérifié).
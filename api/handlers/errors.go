@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	apierrors "api/errors"
+)
+
+// writeAppError renvoie le message et le code HTTP d'une erreur métier (apierrors) ;
+// toute autre erreur est journalisée avec son contexte et renvoyée en 500.
+func writeAppError(w http.ResponseWriter, err error, context string) {
+	var ae apierrors.AppErrorer
+	if errors.As(err, &ae) {
+		e := ae.AppErr()
+		jsonErr(w, e.Message, e.Code)
+		return
+	}
+	log.Printf("%s error: %v", context, err)
+	jsonErr(w, "Internal server error", http.StatusInternalServerError)
+}
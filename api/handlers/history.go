@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+
+	"api/cache"
+	"api/catalog"
+	"api/config"
+	"api/models"
+)
+
+// ===== CATALOGUE — HISTORIQUE ET RESTAURATION =====
+//
+// Les versions sont écrites par les triggers de catalogue_version ; l'API ne fait que
+// positionner l'auteur (withActor) et lire / restaurer les instantanés.
+
+// historyEntity décrit la table d'un type de contenu historisé et les colonnes
+// réécrites par une restauration (identifiants et métadonnées de création exclus).
+type historyEntity struct {
+	table      string
+	pk         string
+	columns    string
+	invalidate func()
+}
+
+var historyEntities = map[string]historyEntity{
+	catalog.HistoryProduit: {"produits", "id_produit",
+		"nom, slug, description_courte, description_longue, description_html, images, media_ids, prix, devise, duree, id_categorie, tag, statut, type_achat, ordre_affichage, actif",
+		cache.InvalidateProduits},
+	catalog.HistoryCategorie: {"categories", "id_categorie",
+		"nom, slug, description, image, icone, couleur, ordre_affichage, actif",
+		func() { cache.InvalidateCategories(); cache.InvalidateAdminCategories() }},
+	catalog.HistoryTarification: {"tarification", "id_tarification",
+		"prix, unite, periodicite, actif, id_produit, prix_usage, agregation, id_variante",
+		cache.InvalidateTarifications},
+	catalog.HistoryCarouselImage: {"carousel_images", "id_image",
+		"titre, description, url_image, id_media, alt_text, ordre_affichage, actif",
+		func() {}},
+}
+
+// withActor exécute fn dans une transaction attribuée à l'utilisateur de la requête :
+// les versions enregistrées par les triggers portent son identifiant.
+func withActor(r *http.Request, fn func(tx *sql.Tx) error) error {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	userID, _ := getUserID(r)
+	if err := setActor(tx, userID); err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setActor positionne l'auteur des versions écrites par la transaction (0 : aucun).
+func setActor(tx *sql.Tx, userID int) error {
+	actor := ""
+	if userID > 0 {
+		actor = strconv.Itoa(userID)
+	}
+	_, err := tx.Exec("SELECT set_config('cyna.id_utilisateur', $1, true)", actor)
+	return err
+}
+
+const versionColumns = `v.id_version, v.type_contenu, v.id_contenu, v.version, v.action, v.version_restauree,
+	v.id_auteur, COALESCE(NULLIF(TRIM(CONCAT(u.prenom, ' ', u.nom)), ''), u.email, ''), v.date_creation`
+
+func scanVersion(row interface{ Scan(...interface{}) error }, extra ...interface{}) (models.CatalogVersion, error) {
+	var v models.CatalogVersion
+	dest := append([]interface{}{&v.ID, &v.TypeContenu, &v.IDContenu, &v.Version, &v.Action, &v.VersionRestauree,
+		&v.IDAuteur, &v.Auteur, &v.DateCreation}, extra...)
+	return v, row.Scan(dest...)
+}
+
+// versionChanges calcule le diff d'une version par rapport à la précédente ; une
+// suppression est présentée comme le passage de tous les champs à null.
+func versionChanges(v models.CatalogVersion, previous []byte) ([]catalog.FieldChange, error) {
+	if v.Action == catalog.VersionDelete {
+		return catalog.DiffSnapshots(v.Donnees, nil)
+	}
+	return catalog.DiffSnapshots(previous, v.Donnees)
+}
+
+// GetCatalogHistory liste les dernières versions du catalogue, tous contenus confondus
+// (?type=, ?author=, pagination), sans les instantanés.
+func GetCatalogHistory(w http.ResponseWriter, r *http.Request) {
+	kind := r.URL.Query().Get("type")
+	if kind != "" && !catalog.ValidHistoryType(kind) {
+		jsonErr(w, "type must be produit, categorie, tarification or carousel_image", http.StatusBadRequest)
+		return
+	}
+	author, _ := strconv.Atoi(r.URL.Query().Get("author"))
+	_, limit, offset := parsePaginationDefault(r)
+	rows, err := config.DB.Query(`SELECT `+versionColumns+`
+		FROM catalogue_version v LEFT JOIN utilisateur u ON u.id_utilisateur = v.id_auteur
+		WHERE ($1 = '' OR v.type_contenu = $1) AND ($2 = 0 OR v.id_auteur = $2)
+		ORDER BY v.date_creation DESC, v.id_version DESC
+		LIMIT $3 OFFSET $4`, kind, author, limit, offset)
+	if err != nil {
+		log.Printf("catalog history error: %v", err)
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	versions := []models.CatalogVersion{}
+	for rows.Next() {
+		v, err := scanVersion(rows)
+		if err != nil {
+			jsonErr(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		versions = append(versions, v)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+// historyTarget lit {type} et {id} dans l'URL.
+func historyTarget(w http.ResponseWriter, r *http.Request) (string, int, bool) {
+	kind := mux.Vars(r)["type"]
+	if !catalog.ValidHistoryType(kind) {
+		jsonErr(w, "type must be produit, categorie, tarification or carousel_image", http.StatusBadRequest)
+		return "", 0, false
+	}
+	id, ok := intParam(w, r, "id")
+	return kind, id, ok
+}
+
+// GetCatalogContentHistory liste les versions d'un contenu, les plus récentes d'abord,
+// chacune avec les champs modifiés par rapport à la version précédente.
+func GetCatalogContentHistory(w http.ResponseWriter, r *http.Request) {
+	kind, id, ok := historyTarget(w, r)
+	if !ok {
+		return
+	}
+	_, limit, offset := parsePaginationDefault(r)
+	rows, err := config.DB.Query(`SELECT `+versionColumns+`, v.donnees,
+		       LAG(v.donnees) OVER (ORDER BY v.version)
+		FROM catalogue_version v LEFT JOIN utilisateur u ON u.id_utilisateur = v.id_auteur
+		WHERE v.type_contenu = $1 AND v.id_contenu = $2
+		ORDER BY v.version DESC
+		LIMIT $3 OFFSET $4`, kind, id, limit, offset)
+	if err != nil {
+		log.Printf("catalog history error: %v", err)
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	type versionDiff struct {
+		models.CatalogVersion
+		Changes []catalog.FieldChange `json:"changes"`
+	}
+	versions := []versionDiff{}
+	for rows.Next() {
+		var data, previous []byte
+		v, err := scanVersion(rows, &data, &previous)
+		if err != nil {
+			jsonErr(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		v.Donnees = data
+		changes, err := versionChanges(v, previous)
+		if err != nil {
+			jsonErr(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		v.Donnees = nil
+		versions = append(versions, versionDiff{v, changes})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+func loadVersion(q dbQuerier, kind string, id, version int) (models.CatalogVersion, error) {
+	var data []byte
+	v, err := scanVersion(q.QueryRow(`SELECT `+versionColumns+`, v.donnees
+		FROM catalogue_version v LEFT JOIN utilisateur u ON u.id_utilisateur = v.id_auteur
+		WHERE v.type_contenu = $1 AND v.id_contenu = $2 AND v.version = $3`, kind, id, version), &data)
+	v.Donnees = data
+	return v, err
+}
+
+// GetCatalogVersion retourne l'instantané d'une version et son diff avec la version
+// précédente, ou avec ?against=N.
+func GetCatalogVersion(w http.ResponseWriter, r *http.Request) {
+	kind, id, ok := historyTarget(w, r)
+	if !ok {
+		return
+	}
+	version, ok := intParam(w, r, "version")
+	if !ok {
+		return
+	}
+	v, err := loadVersion(config.DB, kind, id, version)
+	if err == sql.ErrNoRows {
+		jsonErr(w, "Version not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	against := version - 1
+	if s := r.URL.Query().Get("against"); s != "" {
+		if against, err = strconv.Atoi(s); err != nil || against <= 0 {
+			jsonErr(w, "against must be a version number", http.StatusBadRequest)
+			return
+		}
+	}
+	var changes []catalog.FieldChange
+	if against == version-1 {
+		var previous []byte
+		config.DB.QueryRow(`SELECT donnees FROM catalogue_version
+			WHERE type_contenu = $1 AND id_contenu = $2 AND version = $3`, kind, id, against).Scan(&previous)
+		changes, err = versionChanges(v, previous)
+	} else {
+		var other models.CatalogVersion
+		if other, err = loadVersion(config.DB, kind, id, against); err == sql.ErrNoRows {
+			jsonErr(w, "Version to compare against not found", http.StatusNotFound)
+			return
+		} else if err == nil {
+			changes, err = catalog.DiffSnapshots(other.Donnees, v.Donnees)
+		}
+	}
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"version": v,
+		"against": against,
+		"changes": changes,
+	})
+}
+
+// RestoreCatalogVersion réécrit le contenu avec l'instantané d'une version. Un contenu
+// supprimé est recréé avec son identifiant d'origine. La restauration crée elle-même une
+// nouvelle version (action restore).
+func RestoreCatalogVersion(w http.ResponseWriter, r *http.Request) {
+	kind, id, ok := historyTarget(w, r)
+	if !ok {
+		return
+	}
+	version, ok := intParam(w, r, "version")
+	if !ok {
+		return
+	}
+	entity := historyEntities[kind]
+	var restored models.CatalogVersion
+	err := withActor(r, func(tx *sql.Tx) error {
+		v, err := loadVersion(tx, kind, id, version)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("SELECT set_config('cyna.version_restauree', $1, true)", strconv.Itoa(version)); err != nil {
+			return err
+		}
+		var current int
+		err = tx.QueryRow("SELECT "+entity.pk+" FROM "+entity.table+" WHERE "+entity.pk+" = $1 FOR UPDATE", id).Scan(&current)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil {
+			_, err = tx.Exec(`UPDATE `+entity.table+` SET (`+entity.columns+`) =
+				(SELECT `+entity.columns+` FROM jsonb_populate_record(NULL::`+entity.table+`, $1::jsonb)),
+				date_modification = NOW()
+				WHERE `+entity.pk+` = $2`, string(v.Donnees), id)
+		} else {
+			_, err = tx.Exec(`INSERT INTO `+entity.table+`
+				SELECT * FROM jsonb_populate_record(NULL::`+entity.table+`, $1::jsonb)`, string(v.Donnees))
+		}
+		if err != nil {
+			return err
+		}
+		restored, err = scanVersion(tx.QueryRow(`SELECT `+versionColumns+`
+			FROM catalogue_version v LEFT JOIN utilisateur u ON u.id_utilisateur = v.id_auteur
+			WHERE v.type_contenu = $1 AND v.id_contenu = $2
+			ORDER BY v.version DESC LIMIT 1`, kind, id))
+		return err
+	})
+	if err == sql.ErrNoRows {
+		jsonErr(w, "Version not found", http.StatusNotFound)
+		return
+	}
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Class() == "23" {
+		jsonErr(w, "Cannot restore this version: "+pqErr.Message, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("restore %s %d v%d error: %v", kind, id, version, err)
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	entity.invalidate()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(restored)
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+
+	"api/cache"
+	"api/catalog"
+	"api/config"
+	mw "api/middleware"
+)
+
+// ===== CATALOGUE — TRADUCTIONS =====
+
+// requestLocale négocie la langue d'une réponse publique (?lang=, puis Accept-Language,
+// repli sur le français) et l'annonce dans Content-Language.
+func requestLocale(w http.ResponseWriter, r *http.Request) string {
+	locale := catalog.NegotiateLocale(r.URL.Query().Get("lang"), r.Header.Get("Accept-Language"))
+	w.Header().Set("Content-Language", locale)
+	w.Header().Add("Vary", "Accept-Language")
+	return locale
+}
+
+// translationEntity : table de traduction d'un type de contenu.
+type translationEntity struct {
+	table, base, pk string
+	invalidate      func()
+}
+
+var translationEntities = map[string]translationEntity{
+	catalog.HistoryProduit:       {"produit_traduction", "produits", "id_produit", cache.InvalidateProduits},
+	catalog.HistoryCategorie:     {"categorie_traduction", "categories", "id_categorie", func() { cache.InvalidateCategories(); cache.InvalidateProduits() }},
+	catalog.HistoryCarouselImage: {"carousel_image_traduction", "carousel_images", "id_image", func() {}},
+}
+
+// translationRich : champs longs (texte conservé tel quel) ou HTML (liste blanche),
+// traités comme dans l'édition directe.
+var translationRich = map[string]func(string) string{
+	"description_longue": func(s string) string { return s },
+	"description_html":   mw.SanitizeHTML,
+}
+
+// translationTarget lit {type} et {id} dans l'URL.
+func translationTarget(w http.ResponseWriter, r *http.Request) (string, translationEntity, int, bool) {
+	kind := mux.Vars(r)["type"]
+	entity, ok := translationEntities[kind]
+	if !ok {
+		jsonErr(w, "type must be produit, categorie or carousel_image", http.StatusBadRequest)
+		return "", entity, 0, false
+	}
+	id, ok := intParam(w, r, "id")
+	return kind, entity, id, ok
+}
+
+// GetCatalogTranslations renvoie le contenu français (référence) et ses traductions :
+// {"fr": {...}, "en": {...}, "de": {...}} ; une langue non traduite est absente.
+func GetCatalogTranslations(w http.ResponseWriter, r *http.Request) {
+	kind, entity, id, ok := translationTarget(w, r)
+	if !ok {
+		return
+	}
+	fields := catalog.TranslatableFields[kind]
+	scan := func(row interface{ Scan(...interface{}) error }, extra ...interface{}) (map[string]*string, error) {
+		values := make([]sql.NullString, len(fields))
+		dest := append([]interface{}{}, extra...)
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := row.Scan(dest...); err != nil {
+			return nil, err
+		}
+		out := map[string]*string{}
+		for i, f := range fields {
+			if values[i].Valid {
+				v := values[i].String
+				out[f] = &v
+			} else {
+				out[f] = nil
+			}
+		}
+		return out, nil
+	}
+	cols := strings.Join(fields, ", ")
+	result := map[string]map[string]*string{}
+	base, err := scan(config.DB.QueryRow("SELECT "+cols+" FROM "+entity.base+" WHERE "+entity.pk+" = $1", id))
+	if err == sql.ErrNoRows {
+		jsonErr(w, "Content not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("get translations error: %v", err)
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	result[catalog.DefaultLocale] = base
+	rows, err := config.DB.Query("SELECT langue, "+cols+" FROM "+entity.table+" WHERE "+entity.pk+" = $1 ORDER BY langue", id)
+	if err != nil {
+		log.Printf("get translations error: %v", err)
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var locale string
+		t, err := scan(rows, &locale)
+		if err != nil {
+			jsonErr(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		result[locale] = t
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// PutCatalogTranslation remplace la traduction d'un contenu dans une langue. Un champ
+// absent, null ou vide n'est pas traduit (repli sur le français).
+func PutCatalogTranslation(w http.ResponseWriter, r *http.Request) {
+	kind, entity, id, ok := translationTarget(w, r)
+	if !ok {
+		return
+	}
+	locale := mux.Vars(r)["lang"]
+	if !catalog.ValidTranslationLocale(locale) {
+		jsonErr(w, "lang must be en or de (French is edited on the content itself)", http.StatusBadRequest)
+		return
+	}
+	var body map[string]*string
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		jsonErr(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	fields := catalog.TranslatableFields[kind]
+	known := map[string]bool{}
+	for _, f := range fields {
+		known[f] = true
+	}
+	for f := range body {
+		if !known[f] {
+			jsonErr(w, "Unknown field "+f+" (expected "+strings.Join(fields, ", ")+")", http.StatusBadRequest)
+			return
+		}
+	}
+	args := []interface{}{id, locale}
+	placeholders, updates := []string{"$1", "$2"}, []string{}
+	for _, f := range fields {
+		var v interface{}
+		if p := body[f]; p != nil {
+			s := strings.TrimSpace(*p)
+			if clean, ok := translationRich[f]; ok {
+				s = clean(s)
+			} else {
+				s = mw.SanitizeString(s)
+			}
+			if s != "" {
+				v = s
+			}
+		}
+		args = append(args, v)
+		placeholders = append(placeholders, "$"+strconv.Itoa(len(args)))
+		updates = append(updates, f+" = EXCLUDED."+f)
+	}
+	_, err := config.DB.Exec(`INSERT INTO `+entity.table+` (`+entity.pk+`, langue, `+strings.Join(fields, ", ")+`)
+		VALUES (`+strings.Join(placeholders, ", ")+`)
+		ON CONFLICT (`+entity.pk+`, langue) DO UPDATE SET `+strings.Join(updates, ", ")+`, date_modification = NOW()`, args...)
+	if pqErr, ok := err.(*pq.Error); ok {
+		switch {
+		case pqErr.Code == "23503":
+			jsonErr(w, "Content not found", http.StatusNotFound)
+			return
+		case pqErr.Code.Class() == "22":
+			jsonErr(w, "Translation value too long", http.StatusBadRequest)
+			return
+		}
+	}
+	if err != nil {
+		log.Printf("put translation error: %v", err)
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	entity.invalidate()
+	GetCatalogTranslations(w, r)
+}
+
+// DeleteCatalogTranslation supprime la traduction d'un contenu dans une langue.
+func DeleteCatalogTranslation(w http.ResponseWriter, r *http.Request) {
+	_, entity, id, ok := translationTarget(w, r)
+	if !ok {
+		return
+	}
+	locale := mux.Vars(r)["lang"]
+	if !catalog.ValidTranslationLocale(locale) {
+		jsonErr(w, "lang must be en or de", http.StatusBadRequest)
+		return
+	}
+	res, err := config.DB.Exec("DELETE FROM "+entity.table+" WHERE "+entity.pk+" = $1 AND langue = $2", id, locale)
+	if err != nil {
+		log.Printf("delete translation error: %v", err)
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		jsonErr(w, "Translation not found", http.StatusNotFound)
+		return
+	}
+	entity.invalidate()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
@@ -18,7 +20,7 @@ func GetCarouselImages(w http.ResponseWriter, r *http.Request) {
 	rows, err := config.DB.Query(
 		`SELECT id_image, titre, COALESCE(description,''), url_image, COALESCE(alt_text,''),
 		        COALESCE(ordre_affichage,0), COALESCE(actif,false),
-		        COALESCE(date_creation,NOW()), COALESCE(date_modification,NOW()), id_utilisateur_creation
+		        COALESCE(date_creation,NOW()), COALESCE(date_modification,NOW()), id_utilisateur_creation, id_media
 		 FROM carousel_images ORDER BY ordre_affichage ASC`)
 	if err != nil {
 		log.Printf("Error fetching carousel images: %v", err)
@@ -30,7 +32,7 @@ func GetCarouselImages(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var img models.CarouselImage
 		if err := rows.Scan(&img.ID, &img.Titre, &img.Description, &img.URLImage, &img.AltText,
-			&img.OrdreAffichage, &img.Actif, &img.DateCreation, &img.DateModification, &img.IDUtilisateurCreation); err != nil {
+			&img.OrdreAffichage, &img.Actif, &img.DateCreation, &img.DateModification, &img.IDUtilisateurCreation, &img.IDMedia); err != nil {
 			jsonErr(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
@@ -40,11 +42,15 @@ func GetCarouselImages(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(images)
 }
 
+// GetActiveCarouselImages : images actives, textes dans la langue négociée.
 func GetActiveCarouselImages(w http.ResponseWriter, r *http.Request) {
+	locale := requestLocale(w, r)
 	rows, err := config.DB.Query(
-		`SELECT id_image, titre, COALESCE(description,''), url_image, COALESCE(alt_text,''),
-		        COALESCE(ordre_affichage,0), COALESCE(date_creation,NOW())
-		 FROM carousel_images WHERE actif = TRUE ORDER BY ordre_affichage ASC`)
+		`SELECT i.id_image, COALESCE(t.titre, i.titre), COALESCE(t.description, i.description, ''), i.url_image,
+		        COALESCE(t.alt_text, i.alt_text, ''), COALESCE(i.ordre_affichage,0), COALESCE(i.date_creation,NOW())
+		 FROM carousel_images i
+		 LEFT JOIN carousel_image_traduction t ON t.id_image = i.id_image AND t.langue = $1
+		 WHERE i.actif = TRUE ORDER BY i.ordre_affichage ASC`, locale)
 	if err != nil {
 		jsonErr(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -75,10 +81,10 @@ func GetCarouselImage(w http.ResponseWriter, r *http.Request) {
 	if err := config.DB.QueryRow(
 		`SELECT id_image, titre, COALESCE(description,''), url_image, COALESCE(alt_text,''),
 		        COALESCE(ordre_affichage,0), COALESCE(actif,false),
-		        COALESCE(date_creation,NOW()), COALESCE(date_modification,NOW()), id_utilisateur_creation
+		        COALESCE(date_creation,NOW()), COALESCE(date_modification,NOW()), id_utilisateur_creation, id_media
 		 FROM carousel_images WHERE id_image = $1`, id).Scan(
 		&img.ID, &img.Titre, &img.Description, &img.URLImage, &img.AltText,
-		&img.OrdreAffichage, &img.Actif, &img.DateCreation, &img.DateModification, &img.IDUtilisateurCreation); err != nil {
+		&img.OrdreAffichage, &img.Actif, &img.DateCreation, &img.DateModification, &img.IDUtilisateurCreation, &img.IDMedia); err != nil {
 		jsonErr(w, "Image not found", http.StatusNotFound)
 		return
 	}
@@ -100,8 +106,8 @@ func CreateCarouselImage(w http.ResponseWriter, r *http.Request) {
 	img.Titre = mw.SanitizeString(img.Titre)
 	img.Description = mw.SanitizeString(img.Description)
 	img.AltText = mw.SanitizeString(img.AltText)
-	if img.Titre == "" || img.URLImage == "" {
-		jsonErr(w, "Title and URL are required", http.StatusBadRequest)
+	if img.Titre == "" || (img.URLImage == "" && img.IDMedia == nil) {
+		jsonErr(w, "Title and media (or URL) are required", http.StatusBadRequest)
 		return
 	}
 	if img.AltText == "" { img.AltText = img.Titre }
@@ -110,11 +116,15 @@ func CreateCarouselImage(w http.ResponseWriter, r *http.Request) {
 		config.DB.QueryRow("SELECT COALESCE(MAX(ordre_affichage), 0) FROM carousel_images").Scan(&maxOrder)
 		img.OrdreAffichage = maxOrder + 1
 	}
-	if err := config.DB.QueryRow("INSERT INTO carousel_images (titre, description, url_image, alt_text, ordre_affichage, actif, id_utilisateur_creation) VALUES ($1,$2,$3,$4,$5,$6,$7) RETURNING id_image, date_creation, date_modification",
-		img.Titre, img.Description, img.URLImage, img.AltText, img.OrdreAffichage, img.Actif, userID).Scan(
-		&img.ID, &img.DateCreation, &img.DateModification); err != nil {
-		log.Printf("Error creating carousel image: %v", err)
-		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+	if err := withActor(r, func(tx *sql.Tx) error {
+		if err := resolveCarouselMedia(tx, &img); err != nil {
+			return err
+		}
+		return tx.QueryRow("INSERT INTO carousel_images (titre, description, url_image, alt_text, ordre_affichage, actif, id_utilisateur_creation, id_media) VALUES ($1,$2,$3,$4,$5,$6,$7,$8) RETURNING id_image, date_creation, date_modification",
+			img.Titre, img.Description, img.URLImage, img.AltText, img.OrdreAffichage, img.Actif, userID, img.IDMedia).Scan(
+			&img.ID, &img.DateCreation, &img.DateModification)
+	}); err != nil {
+		writeAppError(w, err, "create carousel image")
 		return
 	}
 	img.IDUtilisateurCreation = &userID
@@ -133,10 +143,10 @@ func UpdateCarouselImage(w http.ResponseWriter, r *http.Request) {
 	if err := config.DB.QueryRow(
 		`SELECT id_image, titre, COALESCE(description,''), url_image, COALESCE(alt_text,''),
 		        COALESCE(ordre_affichage,0), COALESCE(actif,false),
-		        COALESCE(date_creation,NOW()), COALESCE(date_modification,NOW()), id_utilisateur_creation
+		        COALESCE(date_creation,NOW()), COALESCE(date_modification,NOW()), id_utilisateur_creation, id_media
 		 FROM carousel_images WHERE id_image = $1`, id).Scan(
 		&cur.ID, &cur.Titre, &cur.Description, &cur.URLImage, &cur.AltText,
-		&cur.OrdreAffichage, &cur.Actif, &cur.DateCreation, &cur.DateModification, &cur.IDUtilisateurCreation); err != nil {
+		&cur.OrdreAffichage, &cur.Actif, &cur.DateCreation, &cur.DateModification, &cur.IDUtilisateurCreation, &cur.IDMedia); err != nil {
 		jsonErr(w, "Image not found", http.StatusNotFound)
 		return
 	}
@@ -144,16 +154,22 @@ func UpdateCarouselImage(w http.ResponseWriter, r *http.Request) {
 	json.NewDecoder(r.Body).Decode(&updates)
 	if updates.Titre != "" { cur.Titre = mw.SanitizeString(updates.Titre) }
 	if updates.Description != "" { cur.Description = mw.SanitizeString(updates.Description) }
-	if updates.URLImage != "" { cur.URLImage = updates.URLImage }
+	if updates.URLImage != "" { cur.URLImage = updates.URLImage; cur.IDMedia = nil }
+	if updates.IDMedia != nil { cur.IDMedia = updates.IDMedia }
 	if updates.AltText != "" { cur.AltText = mw.SanitizeString(updates.AltText) }
 	if updates.OrdreAffichage != 0 { cur.OrdreAffichage = updates.OrdreAffichage }
 	cur.Actif = updates.Actif
 
 	now := time.Now()
-	if _, err := config.DB.Exec("UPDATE carousel_images SET titre=$1, description=$2, url_image=$3, alt_text=$4, ordre_affichage=$5, actif=$6, date_modification=$7 WHERE id_image=$8",
-		cur.Titre, cur.Description, cur.URLImage, cur.AltText, cur.OrdreAffichage, cur.Actif, now, id); err != nil {
-		log.Printf("Error updating carousel image %d: %v", id, err)
-		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+	if err := withActor(r, func(tx *sql.Tx) error {
+		if err := resolveCarouselMedia(tx, &cur); err != nil {
+			return err
+		}
+		_, err := tx.Exec("UPDATE carousel_images SET titre=$1, description=$2, url_image=$3, alt_text=$4, ordre_affichage=$5, actif=$6, date_modification=$7, id_media=$8 WHERE id_image=$9",
+			cur.Titre, cur.Description, cur.URLImage, cur.AltText, cur.OrdreAffichage, cur.Actif, now, cur.IDMedia, id)
+		return err
+	}); err != nil {
+		writeAppError(w, err, fmt.Sprintf("update carousel image %d", id))
 		return
 	}
 	cur.DateModification = now
@@ -167,10 +183,26 @@ func DeleteCarouselImage(w http.ResponseWriter, r *http.Request) {
 		jsonErr(w, "Invalid ID", http.StatusBadRequest)
 		return
 	}
-	config.DB.Exec("DELETE FROM carousel_images WHERE id_image = $1", id)
+	withActor(r, func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM carousel_images WHERE id_image = $1", id)
+		return err
+	})
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// resolveCarouselMedia dérive url_image du média référencé.
+func resolveCarouselMedia(q dbQuerier, img *models.CarouselImage) error {
+	if img.IDMedia == nil {
+		return nil
+	}
+	urls, err := mediaURLs(q, []int64{int64(*img.IDMedia)})
+	if err != nil {
+		return err
+	}
+	img.URLImage = urls[0]
+	return nil
+}
+
 func ReorderCarouselImages(w http.ResponseWriter, r *http.Request) {
 	var orderData struct {
 		ImageOrders []struct {
@@ -192,6 +224,11 @@ func ReorderCarouselImages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer tx.Rollback()
+	userID, _ := getUserID(r)
+	if err := setActor(tx, userID); err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 	for _, item := range orderData.ImageOrders {
 		if _, err := tx.Exec("UPDATE carousel_images SET ordre_affichage=$1, date_modification=NOW() WHERE id_image=$2", item.Order, item.ID); err != nil {
 			jsonErr(w, "Internal server error", http.StatusInternalServerError)
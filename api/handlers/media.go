@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"api/config"
+	apierrors "api/errors"
+	"api/media"
+	mw "api/middleware"
+	"api/models"
+)
+
+// ===== MÉDIAS — téléversement et traitement des images =====
+
+var (
+	mediaStore media.Storage
+	mediaWebP  media.Encoder
+)
+
+// InitMedia prépare le stockage des médias (MEDIA_STORAGE) et l'encodeur WebP.
+func InitMedia() {
+	store, err := media.NewStorageFromEnv()
+	if err != nil {
+		log.Printf("[WARN] Media storage disabled: %v", err)
+	}
+	mediaStore = store
+	if c := media.LookupCwebp(); c != nil {
+		mediaWebP = c
+	} else {
+		log.Println("[WARN] cwebp not found — WebP variants disabled")
+	}
+	log.Printf("[INFO] Media storage ready (max upload: %d MB)", MediaMaxUploadSize()>>20)
+}
+
+// MediaMaxUploadSize : taille maximale d'un fichier téléversé (MEDIA_MAX_UPLOAD_MB,
+// 10 Mo par défaut), indépendante de la limite globale des corps de requête.
+func MediaMaxUploadSize() int64 {
+	if mb, err := strconv.Atoi(os.Getenv("MEDIA_MAX_UPLOAD_MB")); err == nil && mb > 0 {
+		return int64(mb) << 20
+	}
+	return 10 << 20
+}
+
+// MediaMaxRequestSize : limite du corps d'un téléversement, enveloppe multipart comprise.
+func MediaMaxRequestSize() int64 { return MediaMaxUploadSize() + 64<<10 }
+
+const mediaColumns = `id_media, empreinte, COALESCE(nom_original,''), type_mime, taille, largeur, hauteur,
+	COALESCE(alt_text,''), variantes, id_utilisateur_creation, date_creation`
+
+func scanMedia(row interface{ Scan(...interface{}) error }) (models.Media, error) {
+	var m models.Media
+	var variantes []byte
+	err := row.Scan(&m.ID, &m.Empreinte, &m.NomOriginal, &m.TypeMime, &m.Taille, &m.Largeur, &m.Hauteur,
+		&m.AltText, &variantes, &m.IDAuteur, &m.DateCreation)
+	if err != nil {
+		return m, err
+	}
+	m.Variantes = variantes
+	var vs []media.Variant
+	if json.Unmarshal(variantes, &vs) == nil {
+		m.URL = media.DisplayURL(vs)
+	}
+	return m, nil
+}
+
+// UploadMedia téléverse une image (champ multipart "file", "alt" optionnel). Le type est
+// détecté sur le contenu ; l'image est ré-encodée sans métadonnées et déclinée en
+// tailles réduites et WebP. Un fichier déjà connu (même empreinte) renvoie le média existant.
+func UploadMedia(w http.ResponseWriter, r *http.Request) {
+	if mediaStore == nil {
+		jsonErr(w, "Media storage is not configured", http.StatusServiceUnavailable)
+		return
+	}
+	maxSize := MediaMaxUploadSize()
+	r.Body = http.MaxBytesReader(w, r.Body, MediaMaxRequestSize())
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			jsonErr(w, fmt.Sprintf("File too large (%d MB max)", maxSize>>20), http.StatusRequestEntityTooLarge)
+			return
+		}
+		jsonErr(w, "file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		jsonErr(w, "Invalid upload", http.StatusBadRequest)
+		return
+	}
+	if int64(len(data)) > maxSize {
+		jsonErr(w, fmt.Sprintf("File too large (%d MB max)", maxSize>>20), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if m, err := scanMedia(config.DB.QueryRow("SELECT "+mediaColumns+" FROM media WHERE empreinte = $1", hash)); err == nil {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(m)
+		return
+	} else if err != sql.ErrNoRows {
+		writeAppError(w, err, "upload media")
+		return
+	}
+
+	img, err := media.Process(data, mediaWebP)
+	switch err {
+	case nil:
+	case media.ErrUnsupportedType:
+		jsonErr(w, "Unsupported file type (JPEG, PNG or GIF expected)", http.StatusUnsupportedMediaType)
+		return
+	case media.ErrTooManyPixels:
+		jsonErr(w, fmt.Sprintf("Image dimensions too large (%d megapixels max)", media.MaxPixels/1_000_000), http.StatusBadRequest)
+		return
+	default:
+		writeAppError(w, err, "process media")
+		return
+	}
+	if err := img.Store(r.Context(), mediaStore); err != nil {
+		writeAppError(w, err, "store media")
+		return
+	}
+	variantes, _ := json.Marshal(img.Variants)
+	userID, _ := getUserID(r)
+	alt := mw.SanitizeString(r.FormValue("alt"))
+	name := mw.SanitizeString(header.Filename)
+	if len(name) > 255 {
+		name = name[:255]
+	}
+	// Deux envois simultanés du même fichier : le second récupère la ligne du premier
+	// (mêmes clés de stockage, rien à supprimer).
+	m, err := scanMedia(config.DB.QueryRow(`
+		INSERT INTO media (empreinte, nom_original, type_mime, taille, largeur, hauteur, alt_text, variantes, id_utilisateur_creation)
+		VALUES ($1, NULLIF($2,''), $3, $4, $5, $6, NULLIF($7,''), $8::jsonb, NULLIF($9, 0))
+		ON CONFLICT (empreinte) DO UPDATE SET empreinte = EXCLUDED.empreinte
+		RETURNING `+mediaColumns,
+		hash, name, img.MIME, len(data), img.Width, img.Height, alt, string(variantes), userID))
+	if err != nil {
+		media.Remove(r.Context(), mediaStore, img.Variants)
+		writeAppError(w, err, "save media")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(m)
+}
+
+// GetMediaList liste les médias, les plus récents d'abord.
+func GetMediaList(w http.ResponseWriter, r *http.Request) {
+	_, limit, offset := parsePaginationDefault(r)
+	rows, err := config.DB.Query("SELECT "+mediaColumns+" FROM media ORDER BY date_creation DESC, id_media DESC LIMIT $1 OFFSET $2", limit, offset)
+	if err != nil {
+		writeAppError(w, err, "list media")
+		return
+	}
+	defer rows.Close()
+	list := []models.Media{}
+	for rows.Next() {
+		m, err := scanMedia(rows)
+		if err != nil {
+			writeAppError(w, err, "list media")
+			return
+		}
+		list = append(list, m)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+func GetMedia(w http.ResponseWriter, r *http.Request) {
+	id, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	m, err := scanMedia(config.DB.QueryRow("SELECT "+mediaColumns+" FROM media WHERE id_media = $1", id))
+	if err == sql.ErrNoRows {
+		jsonErr(w, "Media not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeAppError(w, err, "get media")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
+
+// DeleteMedia supprime un média non référencé par un produit ou une image du carrousel,
+// puis ses fichiers.
+func DeleteMedia(w http.ResponseWriter, r *http.Request) {
+	id, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	var variantes []byte
+	err := withActor(r, func(tx *sql.Tx) error {
+		var used bool
+		if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM produits WHERE $1 = ANY(media_ids))
+			OR EXISTS(SELECT 1 FROM carousel_images WHERE id_media = $1)`, id).Scan(&used); err != nil {
+			return err
+		}
+		if used {
+			return apierrors.NewConflict("Media is used by a product or a carousel image")
+		}
+		err := tx.QueryRow("DELETE FROM media WHERE id_media = $1 RETURNING variantes", id).Scan(&variantes)
+		if err == sql.ErrNoRows {
+			return apierrors.NewNotFound("Media not found")
+		}
+		return err
+	})
+	if err != nil {
+		writeAppError(w, err, "delete media")
+		return
+	}
+	var vs []media.Variant
+	if json.Unmarshal(variantes, &vs) == nil && mediaStore != nil {
+		if err := media.Remove(r.Context(), mediaStore, vs); err != nil {
+			log.Printf("[WARN] media %d: files not removed: %v", id, err)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ServeMedia sert les fichiers du stockage local (GET /media/…). Les clés dérivent du
+// contenu : les réponses sont cachables indéfiniment.
+func ServeMedia() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		local, ok := mediaStore.(*media.LocalStorage)
+		key := strings.TrimPrefix(r.URL.Path, "/media/")
+		if !ok || key == "" || strings.HasSuffix(key, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		http.StripPrefix("/media", http.FileServer(http.Dir(local.Dir))).ServeHTTP(w, r)
+	})
+}
+
+// mediaURLs renvoie, dans l'ordre, l'URL à référencer pour chaque média ; un identifiant
+// inconnu est refusé.
+func mediaURLs(q dbQuerier, ids []int64) ([]string, error) {
+	rows, err := q.Query("SELECT id_media, variantes FROM media WHERE id_media = ANY($1)", pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byID := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var variantes []byte
+		if err := rows.Scan(&id, &variantes); err != nil {
+			return nil, err
+		}
+		var vs []media.Variant
+		if err := json.Unmarshal(variantes, &vs); err != nil {
+			return nil, err
+		}
+		byID[id] = media.DisplayURL(vs)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	urls := make([]string, len(ids))
+	for i, id := range ids {
+		url, ok := byID[id]
+		if !ok {
+			return nil, apierrors.NewValidation(fmt.Sprintf("Unknown media id %d", id))
+		}
+		urls[i] = url
+	}
+	return urls, nil
+}
+
+// resolveProduitMedia dérive images des médias du produit lorsqu'ils sont fournis ;
+// sans médias, images (URLs externes) est conservé tel quel.
+func resolveProduitMedia(q dbQuerier, p *models.ProduitWeb) error {
+	if p.MediaIDs == nil {
+		p.MediaIDs = []int64{}
+	}
+	if len(p.MediaIDs) == 0 {
+		return nil
+	}
+	urls, err := mediaURLs(q, p.MediaIDs)
+	if err != nil {
+		return err
+	}
+	images, _ := json.Marshal(urls)
+	p.Images = string(images)
+	return nil
+}
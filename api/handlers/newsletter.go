@@ -198,7 +198,8 @@ func CreateNewsletterCampaign(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data.Title = mw.SanitizeString(data.Title)
-	// NOTA: content is HTML from Quill editor — ne pas sanitizer (conserver les balises)
+	// Contenu HTML de l'éditeur Quill : balises conservées, nettoyé par liste blanche
+	data.Content = mw.SanitizeHTML(data.Content)
 
 	var campaignID int
 	err := config.DB.QueryRow(`
@@ -242,6 +243,8 @@ func SendNewsletterCampaign(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	// Campagnes enregistrées avant le nettoyage à l'écriture
+	content = mw.SanitizeHTML(content)
 
 	// Get subscribers
 	subRows, err := config.DB.Query(`
@@ -0,0 +1,439 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"api/config"
+	mw "api/middleware"
+	"api/models"
+	"api/notify"
+)
+
+// ===== NOTIFICATIONS =====
+
+// Les notifications sont créées par notify.Send (factures, abonnements, tickets,
+// sécurité) ; l'utilisateur ne voit et ne modifie que les siennes.
+
+const notificationSelect = `
+	SELECT id_notification, COALESCE(type, 'info'), COALESCE(titre, ''), COALESCE(message, ''),
+	       COALESCE(lien, ''), donnees, COALESCE(lu, FALSE), date_lecture, date_creation, id_utilisateur
+	FROM notification`
+
+func scanNotification(row interface{ Scan(...interface{}) error }) (models.Notification, error) {
+	var n models.Notification
+	var data []byte
+	err := row.Scan(&n.ID, &n.Type, &n.Titre, &n.Message, &n.Lien, &data, &n.Lu, &n.DateLecture,
+		&n.DateCreation, &n.IDUtilisateur)
+	if n.Titre == "" {
+		n.Titre = notify.DefaultTitle(n.Type)
+	}
+	if len(data) > 0 {
+		n.Donnees = json.RawMessage(data)
+	}
+	return n, err
+}
+
+// notificationParam lit l'id de la route ; une notification d'un autre utilisateur est
+// signalée comme introuvable par les requêtes (filtre id_utilisateur).
+func notificationParam(w http.ResponseWriter, r *http.Request) (id, userID int, ok bool) {
+	if userID, ok = getUserID(r); !ok {
+		jsonErr(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id, ok = intParam(w, r, "id")
+	return
+}
+
+// GetNotifications liste les notifications de l'utilisateur, les plus récentes d'abord :
+// ?unread=true, ?type=, pagination page/limit. Le total et le nombre de non lues sont
+// renvoyés dans X-Total-Count et X-Unread-Count.
+func GetNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserID(r)
+	if !ok {
+		jsonErr(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	q := r.URL.Query()
+	typ := q.Get("type")
+	if typ != "" && !notify.ValidType(typ) {
+		jsonErr(w, "Invalid notification type", http.StatusBadRequest)
+		return
+	}
+	unreadOnly := q.Get("unread") == "true"
+	_, limit, offset := parsePaginationDefault(r)
+
+	const filter = " WHERE id_utilisateur = $1 AND ($2 = '' OR type = $2) AND (NOT $3 OR NOT lu)"
+	var total, unread int
+	if err := config.DB.QueryRow(`
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE NOT lu) FROM notification`+filter,
+		userID, typ, unreadOnly).Scan(&total, &unread); err != nil {
+		log.Printf("list notifications error: %v", err)
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	rows, err := config.DB.Query(notificationSelect+filter+`
+		ORDER BY date_creation DESC, id_notification DESC LIMIT $4 OFFSET $5`,
+		userID, typ, unreadOnly, limit, offset)
+	if err != nil {
+		log.Printf("list notifications error: %v", err)
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	items := []models.Notification{}
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			jsonErr(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		items = append(items, n)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	w.Header().Set("X-Unread-Count", strconv.Itoa(unread))
+	json.NewEncoder(w).Encode(items)
+}
+
+// GetUnreadNotificationCount : nombre de notifications non lues, au total et par type.
+func GetUnreadNotificationCount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserID(r)
+	if !ok {
+		jsonErr(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	rows, err := config.DB.Query(`
+		SELECT COALESCE(type, 'info'), COUNT(*) FROM notification
+		WHERE id_utilisateur = $1 AND NOT lu GROUP BY 1`, userID)
+	if err != nil {
+		log.Printf("unread notifications error: %v", err)
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	total := 0
+	byType := map[string]int{}
+	for rows.Next() {
+		var typ string
+		var n int
+		if err := rows.Scan(&typ, &n); err != nil {
+			jsonErr(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		byType[typ] = n
+		total += n
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"unread": total, "byType": byType})
+}
+
+func GetNotification(w http.ResponseWriter, r *http.Request) {
+	id, userID, ok := notificationParam(w, r)
+	if !ok {
+		return
+	}
+	n, err := scanNotification(config.DB.QueryRow(notificationSelect+
+		" WHERE id_notification = $1 AND id_utilisateur = $2", id, userID))
+	if err == sql.ErrNoRows {
+		jsonErr(w, "Notification not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(n)
+}
+
+// CreateNotification (admin) notifie un utilisateur via notify.Send : ses préférences
+// s'appliquent comme pour les notifications du système.
+func CreateNotification(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID  int    `json:"userId"`
+		Type    string `json:"type"`
+		Title   string `json:"title"`
+		Message string `json:"message"`
+		Link    string `json:"link"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Type == "" {
+		req.Type = notify.TypeInfo
+	}
+	req.Message = mw.SanitizeString(req.Message)
+	if req.UserID <= 0 || req.Message == "" {
+		jsonErr(w, "userId and message are required", http.StatusBadRequest)
+		return
+	}
+	if !notify.ValidType(req.Type) {
+		jsonErr(w, "Invalid notification type", http.StatusBadRequest)
+		return
+	}
+	var exists bool
+	config.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM utilisateur WHERE id_utilisateur = $1)", req.UserID).Scan(&exists)
+	if !exists {
+		jsonErr(w, "User not found", http.StatusNotFound)
+		return
+	}
+	err := notify.Send(req.UserID, req.Type, notify.Payload{
+		Title: mw.SanitizeString(req.Title), Message: req.Message, Link: req.Link,
+	})
+	if err != nil {
+		log.Printf("create notification error: %v", err)
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Notification sent"})
+}
+
+// UpdateNotification marque une notification lue ou non lue : {read}.
+func UpdateNotification(w http.ResponseWriter, r *http.Request) {
+	id, userID, ok := notificationParam(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Read *bool `json:"read"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Read == nil {
+		jsonErr(w, "read is required", http.StatusBadRequest)
+		return
+	}
+	setNotificationRead(w, id, userID, *req.Read)
+}
+
+// MarkNotificationRead marque une notification comme lue.
+func MarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	id, userID, ok := notificationParam(w, r)
+	if !ok {
+		return
+	}
+	setNotificationRead(w, id, userID, true)
+}
+
+func setNotificationRead(w http.ResponseWriter, id, userID int, read bool) {
+	n, err := scanNotification(config.DB.QueryRow(`
+		UPDATE notification SET lu = $1,
+		       date_lecture = CASE WHEN NOT $1 THEN NULL WHEN lu THEN date_lecture ELSE NOW() END
+		WHERE id_notification = $2 AND id_utilisateur = $3
+		RETURNING id_notification, COALESCE(type, 'info'), COALESCE(titre, ''), COALESCE(message, ''),
+		          COALESCE(lien, ''), donnees, lu, date_lecture, date_creation, id_utilisateur`,
+		read, id, userID))
+	if err == sql.ErrNoRows {
+		jsonErr(w, "Notification not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("update notification error: %v", err)
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(n)
+}
+
+// MarkAllNotificationsRead marque toutes les notifications de l'utilisateur comme lues
+// (?type= pour un seul type).
+func MarkAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserID(r)
+	if !ok {
+		jsonErr(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	typ := r.URL.Query().Get("type")
+	if typ != "" && !notify.ValidType(typ) {
+		jsonErr(w, "Invalid notification type", http.StatusBadRequest)
+		return
+	}
+	res, err := config.DB.Exec(`
+		UPDATE notification SET lu = TRUE, date_lecture = NOW()
+		WHERE id_utilisateur = $1 AND NOT lu AND ($2 = '' OR type = $2)`, userID, typ)
+	if err != nil {
+		log.Printf("mark notifications read error: %v", err)
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	n, _ := res.RowsAffected()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"updated": n})
+}
+
+func DeleteNotification(w http.ResponseWriter, r *http.Request) {
+	id, userID, ok := notificationParam(w, r)
+	if !ok {
+		return
+	}
+	res, err := config.DB.Exec("DELETE FROM notification WHERE id_notification = $1 AND id_utilisateur = $2", id, userID)
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		jsonErr(w, "Notification not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// notifySecurity signale un événement de sécurité du compte, avec l'adresse IP d'origine.
+// La notification in-app ne peut pas être désactivée.
+func notifySecurity(r *http.Request, userID int, title, message string) {
+	ip := mw.GetClientIP(r)
+	notify.SendAsync(userID, notify.TypeSecurite, notify.Payload{
+		Title: title,
+		Message: fmt.Sprintf("%s (adresse IP : %s). Si vous n'êtes pas à l'origine de cette action, "+
+			"changez votre mot de passe et contactez le support.", message, ip),
+		Link: "/parametres.html",
+		Data: map[string]interface{}{"ip": ip},
+	})
+}
+
+// ===== PRÉFÉRENCES =====
+
+// GetNotificationPreferences : canaux (inApp, email) de chaque type de notification.
+func GetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserID(r)
+	if !ok {
+		jsonErr(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	prefs, err := notify.Preferences(userID)
+	if err != nil {
+		log.Printf("notification preferences error: %v", err)
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+// UpdateNotificationPreferences enregistre les choix envoyés ([{type, inApp, email}]) et
+// renvoie toutes les préférences. La notification in-app de sécurité ne peut pas être
+// désactivée.
+func UpdateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserID(r)
+	if !ok {
+		jsonErr(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req []notify.Preference
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req) == 0 {
+		jsonErr(w, "Expected a list of {type, inApp, email}", http.StatusBadRequest)
+		return
+	}
+	for _, p := range req {
+		if !notify.ValidType(p.Type) {
+			jsonErr(w, "Invalid notification type: "+p.Type, http.StatusBadRequest)
+			return
+		}
+		if notify.Resolve(p.Type, nil).Locked && !p.InApp {
+			jsonErr(w, "Security notifications cannot be disabled in-app", http.StatusBadRequest)
+			return
+		}
+	}
+	for _, p := range req {
+		if err := notify.SetPreference(userID, p); err != nil {
+			log.Printf("notification preferences error: %v", err)
+			jsonErr(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	GetNotificationPreferences(w, r)
+}
+
+// ===== APPAREILS MOBILES (PUSH) =====
+
+// GetPushDevices liste les appareils enregistrés pour les pushs de l'utilisateur.
+func GetPushDevices(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserID(r)
+	if !ok {
+		jsonErr(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	devices, err := notify.Devices(userID)
+	if err != nil {
+		log.Printf("push devices error: %v", err)
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(devices)
+}
+
+// RegisterPushDevice enregistre le jeton push de l'appareil ({token, platform, name}) ;
+// l'application l'appelle à chaque connexion. 201 pour un nouvel appareil, 200 sinon.
+func RegisterPushDevice(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserID(r)
+	if !ok {
+		jsonErr(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var body struct {
+		Token    string `json:"token"`
+		Platform string `json:"platform"`
+		Name     string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		jsonErr(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	name := mw.SanitizeString(strings.TrimSpace(body.Name))
+	if len([]rune(name)) > 100 {
+		jsonErr(w, "name must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+	sessionID, _ := r.Context().Value(models.SessionIDKey).(int)
+	d, created, err := notify.RegisterDevice(userID, sessionID, notify.Device{
+		Token:    strings.TrimSpace(body.Token),
+		Platform: strings.ToLower(strings.TrimSpace(body.Platform)),
+		Name:     name,
+	})
+	switch {
+	case errors.Is(err, notify.ErrInvalidPlatform):
+		jsonErr(w, "platform must be ios or android", http.StatusBadRequest)
+		return
+	case errors.Is(err, notify.ErrInvalidToken):
+		jsonErr(w, "Invalid push token", http.StatusBadRequest)
+		return
+	case errors.Is(err, notify.ErrDeviceClaimed):
+		jsonErr(w, "Push token is registered to another account", http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("register push device error: %v", err)
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(d)
+}
+
+// DeletePushDevice retire un appareil (déconnexion de l'application).
+func DeletePushDevice(w http.ResponseWriter, r *http.Request) {
+	id, userID, ok := notificationParam(w, r)
+	if !ok {
+		return
+	}
+	found, err := notify.RemoveDevice(userID, id)
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		jsonErr(w, "Device not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,476 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"api/billing"
+	"api/cache"
+	"api/catalog"
+	"api/config"
+	apierrors "api/errors"
+	mw "api/middleware"
+	"api/models"
+)
+
+// ===== PACKS (offres groupées) =====
+//
+// Un pack regroupe des produits existants pour une périodicité, à prix fixe ou avec une
+// remise en pourcentage. Son prix est recalculé à chaque lecture à partir des tarifications
+// catalogue ; l'achat crée un abonnement par composant au prix réparti.
+
+type packComponent struct {
+	models.PackElement
+	actif bool
+}
+
+// loadPacks charge les packs filtrés par where (alias p) avec leurs composants et leur prix.
+// Un pack dont un composant n'est plus vendu ou n'a pas de prix pour sa périodicité est
+// retourné avec ErreurPrix renseignée.
+func loadPacks(q dbQuerier, where string, args ...interface{}) ([]models.Pack, error) {
+	rows, err := q.Query(`
+		SELECT p.id_pack, p.nom, p.slug, COALESCE(p.description,''), p.prix, p.remise_pct,
+		       p.periodicite, COALESCE(p.actif,false), COALESCE(p.ordre_affichage,0)
+		FROM pack p WHERE `+where+`
+		ORDER BY p.ordre_affichage, p.id_pack`, args...)
+	if err != nil {
+		return nil, err
+	}
+	packs := []models.Pack{}
+	index := map[int]int{}
+	for rows.Next() {
+		var p models.Pack
+		var prix, remise sql.NullFloat64
+		if err := rows.Scan(&p.ID, &p.Nom, &p.Slug, &p.Description, &prix, &remise,
+			&p.Periodicite, &p.Actif, &p.Ordre); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if prix.Valid {
+			p.Prix = &prix.Float64
+		}
+		if remise.Valid {
+			p.RemisePct = &remise.Float64
+		}
+		p.Elements = []models.PackElement{}
+		index[p.ID] = len(packs)
+		packs = append(packs, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(packs) == 0 {
+		return packs, err
+	}
+
+	rows, err = q.Query(`
+		SELECT e.id_pack, e.id_produit, pr.nom, pr.slug, e.id_variante, COALESCE(v.sku,''), e.quantite,
+		       COALESCE(pr.actif,false) AND (v.id_variante IS NULL OR (v.actif = TRUE AND v.disponibilite = 'disponible'))
+		FROM pack_element e
+		JOIN produits pr ON pr.id_produit = e.id_produit
+		LEFT JOIN produit_variante v ON v.id_variante = e.id_variante
+		WHERE e.id_pack IN (SELECT p.id_pack FROM pack p WHERE `+where+`)
+		ORDER BY e.ordre, e.id_element`, args...)
+	if err != nil {
+		return nil, err
+	}
+	components := map[int][]packComponent{}
+	for rows.Next() {
+		var packID int
+		var c packComponent
+		if err := rows.Scan(&packID, &c.IDProduit, &c.Nom, &c.Slug, &c.IDVariante, &c.SKU, &c.Quantite, &c.actif); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		components[packID] = append(components[packID], c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for id, i := range index {
+		if err := pricePack(q, &packs[i], components[id]); err != nil {
+			return nil, err
+		}
+	}
+	return packs, nil
+}
+
+// pricePack renseigne les prix catalogue des composants et répartit le prix du pack.
+func pricePack(q dbQuerier, p *models.Pack, components []packComponent) error {
+	lines := make([]billing.BundleLine, 0, len(components))
+	for _, c := range components {
+		el := c.PackElement
+		if !c.actif && p.ErreurPrix == "" {
+			p.ErreurPrix = el.Nom + " is no longer sold"
+		}
+		tarifID, prix, err := componentTarification(q, el.IDProduit, el.IDVariante, p.Periodicite)
+		if err != nil {
+			return err
+		}
+		if tarifID == 0 && p.ErreurPrix == "" {
+			p.ErreurPrix = el.Nom + " has no " + p.Periodicite + " price"
+		}
+		el.IDTarification, el.PrixCatalogue = tarifID, prix
+		p.Elements = append(p.Elements, el)
+		lines = append(lines, billing.BundleLine{PrixUnitaire: prix, Quantite: el.Quantite})
+	}
+	if p.ErreurPrix != "" {
+		return nil
+	}
+	totals, err := billing.ComputeBundle(lines, p.Prix, p.RemisePct)
+	if err != nil {
+		p.ErreurPrix = err.Error()
+		return nil
+	}
+	p.SousTotal, p.Remise, p.Total = totals.SousTotal, totals.Remise, totals.Total
+	for i := range p.Elements {
+		p.Elements[i].PrixPack = totals.Unitaires[i]
+	}
+	return nil
+}
+
+// componentTarification retourne la tarification active d'un produit (hors variantes) ou
+// d'une variante pour la périodicité demandée ; 0 si elle n'existe pas.
+func componentTarification(q dbQuerier, productID int, variantID *int, periode string) (int, float64, error) {
+	rows, err := q.Query(`
+		SELECT id_tarification, COALESCE(prix,0), COALESCE(periodicite,'') FROM tarification
+		WHERE id_produit = $1 AND actif = TRUE AND id_variante IS NOT DISTINCT FROM $2
+		ORDER BY prix ASC, id_tarification ASC`, productID, variantID)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var prix float64
+		var periodicite string
+		if err := rows.Scan(&id, &prix, &periodicite); err != nil {
+			return 0, 0, err
+		}
+		if billing.SamePeriod(periodicite, periode) {
+			return id, prix, nil
+		}
+	}
+	return 0, 0, rows.Err()
+}
+
+// GetPublicPacks liste les packs actifs vendables.
+func GetPublicPacks(w http.ResponseWriter, r *http.Request) {
+	packs, err := loadPacks(config.DB, "p.actif = TRUE")
+	if err != nil {
+		writeAppError(w, err, "list packs")
+		return
+	}
+	out := []models.Pack{}
+	for _, p := range packs {
+		if p.ErreurPrix == "" {
+			out = append(out, p)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// GetPublicPack retourne un pack actif par son slug.
+func GetPublicPack(w http.ResponseWriter, r *http.Request) {
+	packs, err := loadPacks(config.DB, "p.actif = TRUE AND p.slug = $1", mux.Vars(r)["slug"])
+	if err != nil {
+		writeAppError(w, err, "get pack")
+		return
+	}
+	if len(packs) == 0 || packs[0].ErreurPrix != "" {
+		jsonErr(w, "Pack not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(packs[0])
+}
+
+// GetAdminPacks liste tous les packs, inactifs et non vendables compris (pricingError).
+func GetAdminPacks(w http.ResponseWriter, r *http.Request) {
+	packs, err := loadPacks(config.DB, "TRUE")
+	if err != nil {
+		writeAppError(w, err, "list packs")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(packs)
+}
+
+type packReq struct {
+	Nom         string   `json:"name"`
+	Slug        string   `json:"slug"`
+	Description string   `json:"description"`
+	Prix        *float64 `json:"price"`
+	RemisePct   *float64 `json:"discountPct"`
+	Periodicite string   `json:"periodicity"`
+	Ordre       int      `json:"order"`
+	Actif       *bool    `json:"active"`
+	Elements    []struct {
+		IDProduit  int    `json:"productId"`
+		VariantSKU string `json:"variantSku"`
+		Quantite   int    `json:"quantity"`
+	} `json:"items"`
+}
+
+func (req *packReq) validate() error {
+	req.Nom = mw.SanitizeString(strings.TrimSpace(req.Nom))
+	req.Description = mw.SanitizeString(strings.TrimSpace(req.Description))
+	if req.Nom == "" {
+		return apierrors.NewValidation("name is required")
+	}
+	if req.Slug = catalog.Slugify(req.Slug); req.Slug == "" {
+		req.Slug = catalog.Slugify(req.Nom)
+	}
+	req.Periodicite = strings.ToLower(strings.TrimSpace(req.Periodicite))
+	if req.Periodicite == "" {
+		req.Periodicite = "mensuel"
+	}
+	if (req.Prix == nil) == (req.RemisePct == nil) {
+		return apierrors.NewValidation(billing.ErrBundlePricing.Error())
+	}
+	if len(req.Elements) < 2 {
+		return apierrors.NewValidation("A pack needs at least two products")
+	}
+	seen := map[int]bool{}
+	for i := range req.Elements {
+		el := &req.Elements[i]
+		if el.IDProduit <= 0 {
+			return apierrors.NewValidation("productId is required")
+		}
+		if seen[el.IDProduit] {
+			return apierrors.NewValidation("Each product can appear only once in a pack")
+		}
+		seen[el.IDProduit] = true
+		if el.Quantite < 1 {
+			el.Quantite = 1
+		}
+		el.VariantSKU = catalog.NormalizeSKU(el.VariantSKU)
+	}
+	return nil
+}
+
+// savePackElements remplace les composants d'un pack puis vérifie qu'il est vendable.
+func savePackElements(tx *sql.Tx, packID int, req packReq) error {
+	if _, err := tx.Exec("DELETE FROM pack_element WHERE id_pack = $1", packID); err != nil {
+		return err
+	}
+	for i, el := range req.Elements {
+		var variantID *int
+		if el.VariantSKU != "" {
+			var id int
+			err := tx.QueryRow("SELECT id_variante FROM produit_variante WHERE sku = $1 AND id_produit = $2 AND actif = TRUE",
+				el.VariantSKU, el.IDProduit).Scan(&id)
+			if err == sql.ErrNoRows {
+				return apierrors.NewValidation("Unknown variant " + el.VariantSKU + " for this product")
+			}
+			if err != nil {
+				return err
+			}
+			variantID = &id
+		} else {
+			var hasVariants bool
+			if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM produit_variante WHERE id_produit = $1 AND actif = TRUE)",
+				el.IDProduit).Scan(&hasVariants); err != nil {
+				return err
+			}
+			if hasVariants {
+				return apierrors.NewValidation("variantSku required for products with variants")
+			}
+		}
+		_, err := tx.Exec(`INSERT INTO pack_element (id_pack, id_produit, id_variante, quantite, ordre)
+			SELECT $1::int, id_produit, $3::int, $4::int, $5::int FROM produits WHERE id_produit = $2`,
+			packID, el.IDProduit, variantID, el.Quantite, i)
+		if err != nil {
+			return err
+		}
+	}
+	var n int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM pack_element WHERE id_pack = $1", packID).Scan(&n); err != nil {
+		return err
+	}
+	if n != len(req.Elements) {
+		return apierrors.NewValidation("Unknown product in pack")
+	}
+	packs, err := loadPacks(tx, "p.id_pack = $1", packID)
+	if err != nil {
+		return err
+	}
+	if len(packs) == 1 && packs[0].ErreurPrix != "" {
+		return apierrors.NewValidation(packs[0].ErreurPrix)
+	}
+	return nil
+}
+
+func respondPack(w http.ResponseWriter, packID, status int) {
+	packs, err := loadPacks(config.DB, "p.id_pack = $1", packID)
+	if err != nil || len(packs) == 0 {
+		writeAppError(w, err, "load pack")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(packs[0])
+}
+
+// CreatePack crée un pack ; refusé si un composant n'a pas de prix pour la périodicité.
+func CreatePack(w http.ResponseWriter, r *http.Request) {
+	var req packReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeAppError(w, err, "create pack")
+		return
+	}
+	tx, err := config.DB.Begin()
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	var packID int
+	err = func() error {
+		err := tx.QueryRow(`
+			INSERT INTO pack (nom, slug, description, prix, remise_pct, periodicite, actif, ordre_affichage)
+			VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+			ON CONFLICT (slug) DO NOTHING RETURNING id_pack`,
+			req.Nom, req.Slug, req.Description, req.Prix, req.RemisePct, req.Periodicite,
+			req.Actif == nil || *req.Actif, req.Ordre).Scan(&packID)
+		if err == sql.ErrNoRows {
+			return apierrors.NewConflict("Slug already exists")
+		}
+		if err != nil {
+			return err
+		}
+		if err := savePackElements(tx, packID, req); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}()
+	if err != nil {
+		writeAppError(w, err, "create pack")
+		return
+	}
+	respondPack(w, packID, http.StatusCreated)
+}
+
+// UpdatePack remplace la définition d'un pack. Les abonnements déjà souscrits gardent
+// leurs tarifications : seul le prix des nouveaux achats change.
+func UpdatePack(w http.ResponseWriter, r *http.Request) {
+	packID, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	var req packReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeAppError(w, err, "update pack")
+		return
+	}
+	tx, err := config.DB.Begin()
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	err = func() error {
+		var taken bool
+		tx.QueryRow("SELECT EXISTS(SELECT 1 FROM pack WHERE slug = $1 AND id_pack <> $2)", req.Slug, packID).Scan(&taken)
+		if taken {
+			return apierrors.NewConflict("Slug already exists")
+		}
+		res, err := tx.Exec(`
+			UPDATE pack SET nom = $1, slug = $2, description = $3, prix = $4, remise_pct = $5, periodicite = $6,
+			       actif = COALESCE($7, actif), ordre_affichage = $8, date_modification = CURRENT_TIMESTAMP
+			WHERE id_pack = $9`,
+			req.Nom, req.Slug, req.Description, req.Prix, req.RemisePct, req.Periodicite, req.Actif, req.Ordre, packID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return apierrors.NewNotFound("Pack not found")
+		}
+		if err := savePackElements(tx, packID, req); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}()
+	if err != nil {
+		writeAppError(w, err, "update pack")
+		return
+	}
+	respondPack(w, packID, http.StatusOK)
+}
+
+// DeletePack retire un pack de la vente (désactivation) : les abonnements y restent rattachés.
+func DeletePack(w http.ResponseWriter, r *http.Request) {
+	packID, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	res, err := config.DB.Exec("UPDATE pack SET actif = FALSE, date_modification = CURRENT_TIMESTAMP WHERE id_pack = $1", packID)
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		jsonErr(w, "Pack not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// subscribePack crée, dans une transaction, un abonnement par composant du pack, chacun sur
+// une tarification privée (inactive) à son prix réparti.
+func subscribePack(slug string, companyID, quantity int) ([]int, error) {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	packs, err := loadPacks(tx, "p.actif = TRUE AND p.slug = $1", slug)
+	if err != nil {
+		return nil, err
+	}
+	if len(packs) == 0 {
+		return nil, apierrors.NewNotFound("Pack introuvable")
+	}
+	p := packs[0]
+	if p.ErreurPrix != "" {
+		return nil, apierrors.NewConflict("Pack indisponible : " + p.ErreurPrix)
+	}
+	today := time.Now()
+	ids := make([]int, 0, len(p.Elements))
+	for _, el := range p.Elements {
+		var tarifID, subID int
+		if err := tx.QueryRow(`
+			INSERT INTO tarification (prix, unite, periodicite, actif, id_produit, id_variante)
+			VALUES ($1, $2, $3, FALSE, $4, $5) RETURNING id_tarification`,
+			el.PrixPack, "pack "+p.Slug, p.Periodicite, el.IDProduit, el.IDVariante).Scan(&tarifID); err != nil {
+			return nil, err
+		}
+		if err := tx.QueryRow(`
+			INSERT INTO abonnement (date_debut, date_fin, quantite, statut, renouvellement_auto, id_entreprise, id_produit, id_tarification, id_pack)
+			VALUES ($1, $2, $3, $4, TRUE, $5, $6, $7, $8) RETURNING id_abonnement`,
+			today, billing.AddPeriod(today, p.Periodicite), el.Quantite*quantity, billing.StatutActif,
+			companyID, el.IDProduit, tarifID, p.ID).Scan(&subID); err != nil {
+			return nil, err
+		}
+		ids = append(ids, subID)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	cache.InvalidateTarifications()
+	return ids, nil
+}
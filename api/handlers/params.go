@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// intParam lit l'identifiant positif de la variable de route name ; sinon répond 400.
+func intParam(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)[name])
+	if err != nil || id <= 0 {
+		jsonErr(w, "Invalid ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
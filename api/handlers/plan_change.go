@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"api/billing"
+	"api/config"
+	apierrors "api/errors"
+	"api/models"
+	"api/payments"
+)
+
+// ===== CHANGEMENT DE FORMULE (mes abonnements) =====
+
+type planChangeReq struct {
+	Quantity  int    `json:"quantity"`
+	PricingID int    `json:"pricingId"`
+	TokenID   string `json:"tokenId"` // carte à utiliser si l'entreprise n'a pas de moyen enregistré
+}
+
+type planView struct {
+	PricingID   int     `json:"pricingId"`
+	Quantity    int     `json:"quantity"`
+	UnitPrice   float64 `json:"unitPrice"`
+	Periodicity string  `json:"periodicity"`
+	PeriodTotal float64 `json:"periodTotal"`
+}
+
+type planChangeLine struct {
+	Type     string  `json:"type"`
+	Label    string  `json:"label"`
+	Quantity float64 `json:"quantity"`
+	Amount   float64 `json:"amount"`
+}
+
+type planChangePreview struct {
+	SubscriptionID int               `json:"subscriptionId"`
+	Type           string            `json:"type"` // upgrade | downgrade
+	CurrentPlan    planView          `json:"currentPlan"`
+	NewPlan        planView          `json:"newPlan"`
+	Proration      billing.Proration `json:"proration"`
+	Lines          []planChangeLine  `json:"lines"`
+	invoiceLines   []billing.InvoiceLine
+	customerID     string
+	produit        string
+}
+
+// preparePlanChange charge l'abonnement du client et calcule le prorata.
+// Dans une transaction, la ligne abonnement est verrouillée (FOR UPDATE).
+func preparePlanChange(ctx context.Context, tx *sql.Tx, subID, userID int, req planChangeReq, now time.Time) (*planChangePreview, error) {
+	queryRow := config.DB.QueryRowContext
+	lock := ""
+	if tx != nil {
+		queryRow = tx.QueryRowContext
+		lock = "FOR UPDATE OF a"
+	}
+
+	var companyID int
+	queryRow(ctx, "SELECT COALESCE(id_entreprise, 0) FROM utilisateur WHERE id_utilisateur = $1", userID).Scan(&companyID)
+	if companyID == 0 {
+		return nil, apierrors.NewForbidden("No company associated")
+	}
+
+	var statut, produit, customerID string
+	var dateFin sql.NullTime
+	var productID int
+	from := billing.Plan{}
+	err := queryRow(ctx, `
+		SELECT COALESCE(a.statut, ''), a.date_fin, COALESCE(a.quantite, 1), a.id_tarification, a.id_produit,
+		       COALESCE(t.prix, 0), COALESCE(t.periodicite, 'mensuel'), COALESCE(p.nom, ''),
+		       COALESCE(e.stripe_customer_id, '')
+		FROM abonnement a
+		JOIN tarification t ON t.id_tarification = a.id_tarification
+		JOIN entreprise e ON e.id_entreprise = a.id_entreprise
+		LEFT JOIN produits p ON p.id_produit = a.id_produit
+		WHERE a.id_abonnement = $1 AND a.id_entreprise = $2 `+lock, subID, companyID).Scan(
+		&statut, &dateFin, &from.Quantite, &from.TarificationID, &productID,
+		&from.Prix, &from.Periodicite, &produit, &customerID)
+	if err == sql.ErrNoRows {
+		return nil, apierrors.NewNotFound("Abonnement introuvable ou non autorisé")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if statut != billing.StatutActif || !dateFin.Valid {
+		return nil, apierrors.NewConflict("Seul un abonnement actif peut changer de formule")
+	}
+
+	to := billing.Plan{TarificationID: req.PricingID, Quantite: req.Quantity}
+	if to.TarificationID == 0 {
+		to.TarificationID = from.TarificationID
+	}
+	if to.Quantite == 0 {
+		to.Quantite = from.Quantite
+	}
+	if to.Quantite < 1 {
+		return nil, apierrors.NewValidation("quantity must be at least 1")
+	}
+	if to.TarificationID == from.TarificationID && to.Quantite == from.Quantite {
+		return nil, apierrors.NewValidation("Aucun changement demandé")
+	}
+	err = queryRow(ctx, `
+		SELECT COALESCE(prix, 0), COALESCE(periodicite, 'mensuel') FROM tarification
+		WHERE id_tarification = $1 AND id_produit = $2 AND actif = TRUE`,
+		to.TarificationID, productID).Scan(&to.Prix, &to.Periodicite)
+	if err == sql.ErrNoRows {
+		return nil, apierrors.NewValidation("Tarification inconnue pour ce produit")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	end := dateFin.Time
+	pr := billing.Prorate(from, to, billing.PeriodStart(end, from.Periodicite), end, now)
+
+	p := &planChangePreview{
+		SubscriptionID: subID,
+		Type:           "downgrade",
+		CurrentPlan:    newPlanView(from),
+		NewPlan:        newPlanView(to),
+		Proration:      pr,
+		Lines:          []planChangeLine{},
+		customerID:     customerID,
+		produit:        produit,
+	}
+	if pr.Upgrade {
+		p.Type = "upgrade"
+		until := end.Format("02/01/2006")
+		p.invoiceLines = []billing.InvoiceLine{
+			{
+				Type:         billing.LigneProrataCredit,
+				Libelle:      fmt.Sprintf("Crédit %s (x%d) — %d jours restants jusqu'au %s", produit, from.Quantite, pr.RemainingDays, until),
+				Quantite:     float64(from.Quantite),
+				PrixUnitaire: from.Prix,
+				Montant:      -pr.Credit,
+				AbonnementID: subID,
+			},
+			{
+				Type:         billing.LigneProrataDebit,
+				Libelle:      fmt.Sprintf("%s (x%d) — %d jours restants jusqu'au %s", produit, to.Quantite, pr.RemainingDays, until),
+				Quantite:     float64(to.Quantite),
+				PrixUnitaire: to.Prix,
+				Montant:      pr.Charge,
+				AbonnementID: subID,
+			},
+		}
+		for _, l := range p.invoiceLines {
+			p.Lines = append(p.Lines, planChangeLine{Type: l.Type, Label: l.Libelle, Quantity: l.Quantite, Amount: l.Montant})
+		}
+	}
+	return p, nil
+}
+
+func newPlanView(p billing.Plan) planView {
+	return planView{
+		PricingID:   p.TarificationID,
+		Quantity:    p.Quantite,
+		UnitPrice:   p.Prix,
+		Periodicity: p.Periodicite,
+		PeriodTotal: p.Total(),
+	}
+}
+
+func decodePlanChange(w http.ResponseWriter, r *http.Request) (subID, userID int, req planChangeReq, ok bool) {
+	subID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		jsonErr(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	userID, ok = getUserID(r)
+	if !ok {
+		jsonErr(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, "Invalid request body", http.StatusBadRequest)
+		return subID, userID, req, false
+	}
+	return subID, userID, req, true
+}
+
+// PreviewPlanChange calcule le montant d'un changement de formule sans l'appliquer.
+func PreviewPlanChange(w http.ResponseWriter, r *http.Request) {
+	subID, userID, req, ok := decodePlanChange(w, r)
+	if !ok {
+		return
+	}
+	p, err := preparePlanChange(r.Context(), nil, subID, userID, req, time.Now())
+	if err != nil {
+		writeAppError(w, err, "plan change")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// planChangeClaimTimeout : au-delà, une hausse réservée dont le débit n'a pas été
+// enregistré (arrêt pendant l'appel au fournisseur) ne bloque plus un nouveau changement.
+const planChangeClaimTimeout = 15 * time.Minute
+
+// ChangePlan applique un changement de formule. Hausse : le prorata est facturé
+// et débité immédiatement. Baisse : la nouvelle formule s'applique au prochain renouvellement.
+// Comme pour les renouvellements, la hausse est réservée (commande et facture en attente),
+// débitée hors transaction puis enregistrée dans une seconde transaction.
+func ChangePlan(w http.ResponseWriter, r *http.Request) {
+	subID, userID, req, ok := decodePlanChange(w, r)
+	if !ok {
+		return
+	}
+	p, commandeID, factureID, err := claimPlanChange(r.Context(), subID, userID, req)
+	if err != nil {
+		writeAppError(w, err, "plan change")
+		return
+	}
+	if !p.Proration.Upgrade {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":       "Changement programmé au prochain renouvellement",
+			"effectiveDate": p.Proration.EffectiveDate,
+			"change":        p,
+		})
+		return
+	}
+
+	charge := payments.ChargeRequest{
+		AmountCents:    payments.ToCents(p.Proration.AmountDue),
+		Currency:       "eur",
+		Customer:       p.customerID,
+		Description:    fmt.Sprintf("Changement de formule abonnement CYNA #%d", subID),
+		IdempotencyKey: fmt.Sprintf("cyna-formule-commande-%d", commandeID),
+	}
+	if req.TokenID != "" {
+		charge.Customer, charge.Source = "", req.TokenID
+	}
+	// Un rejeu client avec le même Idempotency-Key ne doit pas débiter deux fois chez Stripe.
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		charge.IdempotencyKey = fmt.Sprintf("cyna-formule-%d-%d-%s", userID, subID, key)
+	}
+	chargeID, err := payments.Default().Charge(charge)
+	if err != nil {
+		// La réservation est libérée : le client peut réessayer.
+		if _, ferr := config.DB.Exec("UPDATE commande SET statut = 'echec' WHERE id_commande = $1", commandeID); ferr != nil {
+			log.Printf("[WARN] ChangePlan: commande %d: %v", commandeID, ferr)
+		}
+		billing.PublishOrderStatus(userID, commandeID, "echec")
+		writeChargeError(w, err)
+		return
+	}
+
+	// Le client est débité : l'enregistrement ne dépend plus de la requête (déconnexion).
+	if err := recordPlanChange(context.Background(), p, commandeID, chargeID); err != nil {
+		log.Printf("[ERROR] ChangePlan: charge %s réussie (commande %d) mais abonnement %d non mis à jour: %v",
+			chargeID, commandeID, subID, err)
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	billing.NotifyInvoice(userID, factureID, p.Proration.AmountDue)
+	billing.PublishOrderStatus(userID, commandeID, "paye")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":   "Formule mise à jour",
+		"orderId":   commandeID,
+		"invoiceId": factureID,
+		"chargeId":  chargeID,
+		"change":    p,
+	})
+}
+
+// claimPlanChange verrouille l'abonnement et calcule le changement. Une baisse est
+// programmée et validée directement ; une hausse crée la commande et la facture en
+// attente puis valide : aucun verrou n'est tenu pendant le débit.
+func claimPlanChange(ctx context.Context, subID, userID int, req planChangeReq) (p *planChangePreview, commandeID, factureID int, err error) {
+	tx, err := config.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer tx.Rollback()
+
+	p, err = preparePlanChange(ctx, tx, subID, userID, req, time.Now())
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	if !p.Proration.Upgrade {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE abonnement SET quantite_prochaine = $1, id_tarification_prochaine = $2 WHERE id_abonnement = $3",
+			p.NewPlan.Quantity, p.NewPlan.PricingID, subID); err != nil {
+			return nil, 0, 0, err
+		}
+		if err := billing.RefreshPendingRenewal(ctx, tx, subID); err != nil {
+			return nil, 0, 0, err
+		}
+		return p, 0, 0, tx.Commit()
+	}
+
+	if p.customerID == "" && req.TokenID == "" {
+		return nil, 0, 0, apierrors.New(http.StatusPaymentRequired, "Aucun moyen de paiement enregistré — tokenId requis")
+	}
+	var pending bool
+	if err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM facture_ligne l
+			JOIN facture f ON f.id_facture = l.id_facture
+			JOIN commande c ON c.id_commande = f.id_commande
+			WHERE l.id_abonnement = $1 AND l.type_ligne = $2
+			  AND c.statut = 'attente' AND c.date_commande > $3)`,
+		subID, billing.LigneProrataDebit, time.Now().Add(-planChangeClaimTimeout)).Scan(&pending); err != nil {
+		return nil, 0, 0, err
+	}
+	if pending {
+		return nil, 0, 0, apierrors.NewConflict("Un changement de formule est déjà en cours de paiement")
+	}
+
+	items, _ := json.Marshal([]models.OrderItem{{
+		ProductName: p.produit, Price: p.NewPlan.UnitPrice, Quantity: p.NewPlan.Quantity, Duration: p.NewPlan.Periodicity,
+	}})
+	if err := tx.QueryRowContext(ctx,
+		"INSERT INTO commande (montant_total, statut, items, id_utilisateur) VALUES ($1, 'attente', $2, $3) RETURNING id_commande",
+		p.Proration.AmountDue, string(items), userID).Scan(&commandeID); err != nil {
+		return nil, 0, 0, err
+	}
+	if err := tx.QueryRowContext(ctx,
+		"INSERT INTO facture (date_facture, montant, id_commande) VALUES (CURRENT_DATE, $1, $2) RETURNING id_facture",
+		p.Proration.AmountDue, commandeID).Scan(&factureID); err != nil {
+		return nil, 0, 0, err
+	}
+	if err := billing.AddInvoiceLines(ctx, tx, factureID, p.invoiceLines); err != nil {
+		return nil, 0, 0, err
+	}
+	return p, commandeID, factureID, tx.Commit()
+}
+
+// recordPlanChange enregistre le paiement et applique la nouvelle formule.
+func recordPlanChange(ctx context.Context, p *planChangePreview, commandeID int, chargeID string) error {
+	tx, err := config.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO paiement (moyen, statut, date_paiement, reference_externe, id_commande) VALUES ('CB', 'success', NOW(), $1, $2)",
+		chargeID, commandeID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE commande SET statut = 'paye' WHERE id_commande = $1", commandeID); err != nil {
+		return err
+	}
+	// Une hausse remplace toute baisse programmée.
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE abonnement SET quantite = $1, id_tarification = $2,
+		       quantite_prochaine = NULL, id_tarification_prochaine = NULL
+		WHERE id_abonnement = $3`, p.NewPlan.Quantity, p.NewPlan.PricingID, p.SubscriptionID); err != nil {
+		return err
+	}
+	if err := billing.RefreshPendingRenewal(ctx, tx, p.SubscriptionID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
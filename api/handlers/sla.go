@@ -0,0 +1,451 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+
+	"api/config"
+	"api/mailer"
+	mw "api/middleware"
+	"api/notify"
+	"api/support"
+)
+
+// ===== SUPPORT — SLA ET ESCALADE =====
+
+// SLAPolicy : politique SLA d'un niveau d'abonnement (tag produit) ou par défaut.
+type SLAPolicy struct {
+	Niveau             string    `json:"tier"`
+	PremiereReponseMin int       `json:"firstResponseMinutes"`
+	ResolutionMin      int       `json:"resolutionMinutes"`
+	Actif              bool      `json:"active"`
+	DateModification   time.Time `json:"updatedAt"`
+}
+
+// ticketPolicy choisit la politique d'un nouveau ticket : la plus exigeante parmi les
+// niveaux des abonnements actifs de l'entreprise du client, sinon la politique par défaut.
+func ticketPolicy(q dbQuerier, owner *int) (support.Policy, error) {
+	var policies []support.Policy
+	rows, err := q.Query("SELECT niveau, premiere_reponse_min, resolution_min FROM sla_politique WHERE actif")
+	if err != nil {
+		return support.Policy{}, err
+	}
+	for rows.Next() {
+		var p support.Policy
+		var first, resolution int
+		if err := rows.Scan(&p.Niveau, &first, &resolution); err != nil {
+			rows.Close()
+			return support.Policy{}, err
+		}
+		p.FirstResponse, p.Resolution = time.Duration(first)*time.Minute, time.Duration(resolution)*time.Minute
+		policies = append(policies, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return support.Policy{}, err
+	}
+
+	var niveaux []string
+	if owner != nil {
+		rows, err := q.Query(`
+			SELECT DISTINCT p.tag
+			FROM utilisateur u
+			JOIN abonnement a ON a.id_entreprise = u.id_entreprise AND a.statut = 'actif'
+			JOIN produits p ON p.id_produit = a.id_produit
+			WHERE u.id_utilisateur = $1 AND p.tag IS NOT NULL`, *owner)
+		if err != nil {
+			return support.Policy{}, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var tag string
+			if err := rows.Scan(&tag); err != nil {
+				return support.Policy{}, err
+			}
+			niveaux = append(niveaux, tag)
+		}
+		if err := rows.Err(); err != nil {
+			return support.Policy{}, err
+		}
+	}
+	p, _ := support.SelectPolicy(policies, niveaux)
+	return p, nil
+}
+
+// InitSLAMonitor lance la surveillance des échéances SLA (SLA_CHECK_INTERVAL_SECONDS,
+// 60 s par défaut).
+func InitSLAMonitor() {
+	seconds := 60
+	if s, err := strconv.Atoi(os.Getenv("SLA_CHECK_INTERVAL_SECONDS")); err == nil && s > 0 {
+		seconds = s
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(seconds) * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := checkSLA(); err != nil {
+				log.Printf("[WARN] SLA monitor: %v", err)
+			}
+		}
+	}()
+	log.Printf("[INFO] SLA monitor ready (interval: %ds)", seconds)
+}
+
+// checkSLA signale les tickets en attente du support dont une échéance approche ou est
+// dépassée. Les tickets en pause (en attente du client, fermés) ne sont pas surveillés.
+func checkSLA() error {
+	if config.DB == nil {
+		return nil
+	}
+	rows, err := config.DB.Query(ticketSelect+`
+		WHERE t.statut = ANY($1) AND t.sla_niveau IS NOT NULL
+		  AND (t.sla_alerte_reponse < $2 OR t.sla_alerte_resolution < $2)`,
+		pq.Array([]string{support.StatutOuvert, support.StatutEnCours}), support.LevelBreached)
+	if err != nil {
+		return err
+	}
+	var tickets []Ticket
+	for rows.Next() {
+		t, err := scanTicket(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		tickets = append(tickets, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, t := range tickets {
+		elapsed := t.SLA.clock.Elapsed(t.now)
+		if t.SLA.DatePremiereReponse == nil {
+			target := time.Duration(t.SLA.PremiereReponseMin) * time.Minute
+			if level := support.Level(elapsed, target); level > t.SLA.AlerteReponse {
+				if err := escalateSLA(t, "reponse", level); err != nil {
+					return err
+				}
+			}
+		}
+		target := time.Duration(t.SLA.ResolutionMin) * time.Minute
+		if level := support.Level(elapsed, target); level > t.SLA.AlerteResolution {
+			if err := escalateSLA(t, "resolution", level); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type slaRecipient struct {
+	id    int
+	email string
+}
+
+// escalateSLA enregistre le niveau d'alerte d'un objectif ("reponse" ou "resolution")
+// et prévient le personnel : l'agent affecté (tout le support si personne) à
+// l'approche de l'échéance, les administrateurs en plus au dépassement, qui relève
+// aussi la priorité du ticket.
+func escalateSLA(t Ticket, objectif string, level int) error {
+	label, target := "première réponse", t.SLA.PremiereReponseMin
+	if objectif == "resolution" {
+		label, target = "résolution", t.SLA.ResolutionMin
+	}
+	priorite := t.Priorite
+	if level == support.LevelBreached {
+		priorite = support.Escalate(t.Priorite)
+	}
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`UPDATE ticket_support SET sla_alerte_`+objectif+` = $1, priorite = $2
+		WHERE id_ticket = $3 AND sla_alerte_`+objectif+` < $1`, level, priorite, t.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil // déjà signalé (autre instance)
+	}
+
+	msg := fmt.Sprintf("Ticket #%d « %s » : échéance de %s proche (objectif %d min, niveau %s)",
+		t.ID, t.Sujet, label, target, t.SLA.Niveau)
+	roles := []string{}
+	if t.IDAssigne == nil {
+		roles = append(roles, mw.StaffRoles...)
+	}
+	if level == support.LevelBreached {
+		msg = fmt.Sprintf("Ticket #%d « %s » : SLA de %s dépassé (objectif %d min, niveau %s)",
+			t.ID, t.Sujet, label, target, t.SLA.Niveau)
+		if priorite != t.Priorite {
+			msg += fmt.Sprintf(" — priorité %s → %s", t.Priorite, priorite)
+		}
+		roles = append(roles, "admin")
+		if _, err := tx.Exec(`INSERT INTO ticket_message (id_ticket, staff, interne, message)
+			VALUES ($1, TRUE, TRUE, $2)`, t.ID, msg); err != nil {
+			return err
+		}
+	}
+	assignee := 0
+	if t.IDAssigne != nil {
+		assignee = *t.IDAssigne
+	}
+	rows, err := tx.Query(`
+		SELECT DISTINCT u.id_utilisateur, COALESCE(u.email, '')
+		FROM utilisateur u
+		LEFT JOIN user_roles ur ON ur.id_utilisateur = u.id_utilisateur
+		LEFT JOIN roles r ON r.id_role = ur.id_role
+		WHERE COALESCE(u.statut, 'actif') = 'actif' AND (u.id_utilisateur = $1 OR LOWER(r.nom) = ANY($2))`,
+		assignee, pq.Array(roles))
+	if err != nil {
+		return err
+	}
+	var recipients []slaRecipient
+	for rows.Next() {
+		var rc slaRecipient
+		if err := rows.Scan(&rc.id, &rc.email); err != nil {
+			rows.Close()
+			return err
+		}
+		recipients = append(recipients, rc)
+	}
+	rows.Close()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	ids := []int{}
+	emails := []string{}
+	for _, rc := range recipients {
+		ids = append(ids, rc.id)
+		if rc.email != "" {
+			emails = append(emails, rc.email)
+		}
+	}
+	// L'alerte est toujours envoyée par email (sendSLAEmails), quelles que soient les préférences.
+	if err := notify.SendMany(ids, notify.TypeSupport, notify.Payload{
+		Title: "Alerte SLA", Message: html.UnescapeString(msg), NoEmail: true,
+		Data: map[string]interface{}{"ticketId": t.ID, "level": level},
+	}); err != nil {
+		log.Printf("[WARN] SLA notification ticket %d: %v", t.ID, err)
+	}
+	if to := os.Getenv("SUPPORT_ESCALATION_EMAIL"); to != "" && level == support.LevelBreached {
+		emails = append(emails, to)
+	}
+	go sendSLAEmails(emails, t.ID, msg)
+	log.Printf("[SLA] %s", msg)
+	return nil
+}
+
+func sendSLAEmails(emails []string, ticketID int, msg string) {
+	body := fmt.Sprintf(`
+      <p style="color:#555;line-height:1.6;">%s.</p>
+      <p style="color:#555;line-height:1.6;">Le ticket est à traiter en priorité depuis la file d'attente du support.</p>`,
+		html.EscapeString(msg))
+	for _, to := range emails {
+		if err := mailer.Send(to, fmt.Sprintf("SLA — ticket #%d", ticketID), mailer.Layout("Alerte SLA", body)); err != nil {
+			log.Printf("[EMAIL] Erreur alerte SLA ticket %d à %s: %v", ticketID, to, err)
+		}
+	}
+}
+
+// GetSLAPolicies liste les politiques SLA.
+func GetSLAPolicies(w http.ResponseWriter, r *http.Request) {
+	rows, err := config.DB.Query(`SELECT niveau, premiere_reponse_min, resolution_min, actif, date_modification
+		FROM sla_politique ORDER BY premiere_reponse_min, niveau`)
+	if err != nil {
+		writeAppError(w, err, "list sla policies")
+		return
+	}
+	defer rows.Close()
+	policies := []SLAPolicy{}
+	for rows.Next() {
+		var p SLAPolicy
+		if err := rows.Scan(&p.Niveau, &p.PremiereReponseMin, &p.ResolutionMin, &p.Actif, &p.DateModification); err != nil {
+			writeAppError(w, err, "list sla policies")
+			return
+		}
+		policies = append(policies, p)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policies)
+}
+
+// PutSLAPolicy crée ou modifie la politique d'un niveau. Les tickets déjà ouverts gardent
+// les objectifs de leur ouverture.
+func PutSLAPolicy(w http.ResponseWriter, r *http.Request) {
+	niveau := mux.Vars(r)["tier"]
+	if niveau == "" || len(niveau) > 50 {
+		jsonErr(w, "Invalid tier", http.StatusBadRequest)
+		return
+	}
+	var body struct {
+		PremiereReponseMin int   `json:"firstResponseMinutes"`
+		ResolutionMin      int   `json:"resolutionMinutes"`
+		Actif              *bool `json:"active"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		jsonErr(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if body.PremiereReponseMin <= 0 || body.ResolutionMin < body.PremiereReponseMin {
+		jsonErr(w, "firstResponseMinutes must be positive and resolutionMinutes at least as long", http.StatusBadRequest)
+		return
+	}
+	actif := body.Actif == nil || *body.Actif
+	var p SLAPolicy
+	err := config.DB.QueryRow(`
+		INSERT INTO sla_politique (niveau, premiere_reponse_min, resolution_min, actif)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (niveau) DO UPDATE SET premiere_reponse_min = EXCLUDED.premiere_reponse_min,
+		       resolution_min = EXCLUDED.resolution_min, actif = EXCLUDED.actif, date_modification = NOW()
+		RETURNING niveau, premiere_reponse_min, resolution_min, actif, date_modification`,
+		niveau, body.PremiereReponseMin, body.ResolutionMin, actif).Scan(
+		&p.Niveau, &p.PremiereReponseMin, &p.ResolutionMin, &p.Actif, &p.DateModification)
+	if err != nil {
+		writeAppError(w, err, "put sla policy")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// slaStats : objectifs tenus et dépassés ; un ticket sans réponse dont l'échéance est
+// passée compte comme dépassé, un ticket encore dans les temps n'est pas évalué.
+type slaStats struct {
+	Tickets        int      `json:"tickets"`
+	ReponseOK      int      `json:"firstResponseMet"`
+	ReponseKO      int      `json:"firstResponseBreached"`
+	ReponseTaux    *float64 `json:"firstResponseCompliance"` // %, null sans ticket évalué
+	ResolutionOK   int      `json:"resolutionMet"`
+	ResolutionKO   int      `json:"resolutionBreached"`
+	ResolutionTaux *float64 `json:"resolutionCompliance"`
+}
+
+func (s *slaStats) rates() {
+	rate := func(met, breached int) *float64 {
+		if v := support.Compliance(met, breached); v >= 0 {
+			return &v
+		}
+		return nil
+	}
+	s.ReponseTaux, s.ResolutionTaux = rate(s.ReponseOK, s.ReponseKO), rate(s.ResolutionOK, s.ResolutionKO)
+}
+
+type slaReportRow struct {
+	Mois         string `json:"month"`
+	IDEntreprise *int   `json:"companyId"`
+	Client       string `json:"customer"`
+	Niveaux      string `json:"tiers"`
+	slaStats
+	ReponseMoyMin    *float64 `json:"avgFirstResponseMinutes"`
+	ResolutionMoyMin *float64 `json:"avgResolutionMinutes"`
+}
+
+// GetSLAReport : respect des SLA par mois d'ouverture et par client (entreprise, sinon
+// email du demandeur). Paramètres from / to (YYYY-MM, 12 derniers mois par défaut) et
+// companyId.
+func GetSLAReport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	now := time.Now()
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	from, to := thisMonth.AddDate(0, -11, 0), thisMonth
+	for param, dst := range map[string]*time.Time{"from": &from, "to": &to} {
+		if v := q.Get(param); v != "" {
+			m, err := time.Parse("2006-01", v)
+			if err != nil {
+				jsonErr(w, param+" must be YYYY-MM", http.StatusBadRequest)
+				return
+			}
+			*dst = m
+		}
+	}
+	if to.Before(from) {
+		jsonErr(w, "to must not be before from", http.StatusBadRequest)
+		return
+	}
+	args := []interface{}{from.Format("2006-01-02"), to.AddDate(0, 1, 0).Format("2006-01-02")}
+	cond := ""
+	if v := q.Get("companyId"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			jsonErr(w, "Invalid companyId", http.StatusBadRequest)
+			return
+		}
+		args = append(args, id)
+		cond = " AND u.id_entreprise = $3"
+	}
+	rows, err := config.DB.Query(`
+		SELECT to_char(date_trunc('month', t.date_creation), 'YYYY-MM'), e.id_entreprise,
+		       COALESCE(e.nom, u.email, t.email_expediteur, ''), string_agg(DISTINCT t.sla_niveau, ','),
+		       COUNT(*),
+		       COUNT(*) FILTER (WHERE t.sla_reponse_secondes <= t.sla_premiere_reponse_min * 60),
+		       COUNT(*) FILTER (WHERE t.sla_reponse_secondes > t.sla_premiere_reponse_min * 60
+		                           OR t.sla_reponse_secondes IS NULL AND t.sla_alerte_reponse = 2),
+		       COUNT(*) FILTER (WHERE t.statut = 'ferme' AND t.sla_resolution_secondes <= t.sla_resolution_min * 60),
+		       COUNT(*) FILTER (WHERE t.statut = 'ferme' AND t.sla_resolution_secondes > t.sla_resolution_min * 60
+		                           OR t.statut <> 'ferme' AND t.sla_alerte_resolution = 2),
+		       AVG(t.sla_reponse_secondes) / 60, AVG(t.sla_resolution_secondes) FILTER (WHERE t.statut = 'ferme') / 60
+		FROM ticket_support t
+		LEFT JOIN utilisateur u ON u.id_utilisateur = t.id_utilisateur
+		LEFT JOIN entreprise e ON e.id_entreprise = u.id_entreprise
+		WHERE t.sla_niveau IS NOT NULL AND t.date_creation >= $1::date AND t.date_creation < $2::date`+cond+`
+		GROUP BY 1, 2, 3
+		ORDER BY 1 DESC, 3`, args...)
+	if err != nil {
+		writeAppError(w, err, "sla report")
+		return
+	}
+	defer rows.Close()
+	report := []slaReportRow{}
+	months := map[string]*slaStats{}
+	order := []string{}
+	for rows.Next() {
+		var row slaReportRow
+		if err := rows.Scan(&row.Mois, &row.IDEntreprise, &row.Client, &row.Niveaux, &row.Tickets,
+			&row.ReponseOK, &row.ReponseKO, &row.ResolutionOK, &row.ResolutionKO,
+			&row.ReponseMoyMin, &row.ResolutionMoyMin); err != nil {
+			writeAppError(w, err, "sla report")
+			return
+		}
+		row.rates()
+		report = append(report, row)
+		m, ok := months[row.Mois]
+		if !ok {
+			m = &slaStats{}
+			months[row.Mois] = m
+			order = append(order, row.Mois)
+		}
+		m.Tickets += row.Tickets
+		m.ReponseOK += row.ReponseOK
+		m.ReponseKO += row.ReponseKO
+		m.ResolutionOK += row.ResolutionOK
+		m.ResolutionKO += row.ResolutionKO
+	}
+	type monthStats struct {
+		Mois string `json:"month"`
+		slaStats
+	}
+	summary := []monthStats{}
+	for _, mois := range order {
+		months[mois].rates()
+		summary = append(summary, monthStats{mois, *months[mois]})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":      from.Format("2006-01"),
+		"to":        to.Format("2006-01"),
+		"months":    summary,
+		"customers": report,
+	})
+}
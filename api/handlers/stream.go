@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	mw "api/middleware"
+	"api/realtime"
+)
+
+// ===== FLUX TEMPS RÉEL (SSE) =====
+
+// streamWriteTimeout : délai accordé à chaque écriture sur le flux ; remplace le
+// WriteTimeout global du serveur, qui couperait les connexions longues.
+const streamWriteTimeout = 10 * time.Second
+
+// streamRetry : délai de reconnexion conseillé au navigateur (ms).
+const streamRetry = 5000
+
+// Stream godoc
+// GET /api/stream — flux Server-Sent Events de l'utilisateur connecté : notifications,
+// réponses et changements de tickets, statut des commandes. Last-Event-ID (en-tête ou
+// ?lastEventId=) reprend les événements manqués depuis la dernière connexion.
+func Stream(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserID(r)
+	if !ok {
+		jsonErr(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var lastID int64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		lastID, _ = strconv.ParseInt(v, 10, 64)
+	} else if v := r.URL.Query().Get("lastEventId"); v != "" {
+		lastID, _ = strconv.ParseInt(v, 10, 64)
+	}
+	if lastID < 0 {
+		lastID = 0
+	}
+
+	// S'abonner avant la reprise : un événement publié entre les deux n'est pas perdu.
+	sub, err := realtime.Subscribe(userID)
+	switch {
+	case errors.Is(err, realtime.ErrTooManyStreams):
+		jsonErr(w, "Too many open streams", http.StatusTooManyRequests)
+		return
+	case err != nil:
+		jsonErr(w, "Stream unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	defer realtime.Unsubscribe(sub)
+
+	var replay []realtime.Event
+	var resync int64
+	if lastID > 0 {
+		if replay, resync, err = realtime.Replay(userID, lastID); err != nil {
+			log.Printf("[WARN] stream: replay for user %d: %v", userID, err)
+			jsonErr(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	// Le ReadTimeout du serveur annulerait le contexte de la requête au bout de 10 s.
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		jsonErr(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	write := func(b []byte) bool {
+		rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if _, err := w.Write(b); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if !write([]byte("retry: " + strconv.Itoa(streamRetry) + "\n\n")) {
+		return
+	}
+
+	if resync > 0 {
+		// Trop d'événements manqués : le client recharge son état par l'API.
+		if !write(realtime.Event{ID: resync, Type: "resync"}.Format()) {
+			return
+		}
+	}
+	sent := make(map[int64]bool, len(replay))
+	for _, e := range replay {
+		if !write(e.Format()) {
+			return
+		}
+		sent[e.ID] = true
+	}
+
+	heartbeat := time.NewTicker(realtime.Heartbeat())
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sub.Done():
+			return
+		case e := <-sub.Events():
+			if sent[e.ID] {
+				continue
+			}
+			if !write(e.Format()) {
+				return
+			}
+		case <-heartbeat.C:
+			// Session expirée ou révoquée (réinitialisation du mot de passe, compte
+			// désactivé) depuis l'ouverture : le flux est fermé, la reconnexion reçoit 401.
+			if valid, err := mw.SessionValid(r, userID); err != nil {
+				log.Printf("[WARN] stream: session check for user %d: %v", userID, err)
+			} else if !valid {
+				return
+			}
+			if !write([]byte(": ping\n\n")) {
+				return
+			}
+		}
+	}
+}
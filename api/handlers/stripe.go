@@ -2,22 +2,26 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
-	"io"
+	"errors"
+	"log"
 	"net/http"
-	"net/url"
-	"os"
-	"strings"
+
+	"api/billing"
+	"api/config"
+	"api/payments"
 )
 
 type stripeChargeReq struct {
 	TokenID  string `json:"tokenId"`
 	Amount   int64  `json:"amount"`
 	Currency string `json:"currency"`
+	// SavePaymentMethod enregistre la carte comme client Stripe de l'entreprise
+	// pour permettre les renouvellements automatiques d'abonnement.
+	SavePaymentMethod bool `json:"savePaymentMethod"`
 }
 
 func CreateStripeCharge(w http.ResponseWriter, r *http.Request) {
-	_, ok := getUserID(r)
+	userID, ok := getUserID(r)
 	if !ok {
 		jsonErr(w, "Unauthorized", http.StatusUnauthorized)
 		return
@@ -32,56 +36,59 @@ func CreateStripeCharge(w http.ResponseWriter, r *http.Request) {
 		req.Currency = "eur"
 	}
 
-	secretKey := os.Getenv("STRIPE_SECRET_KEY")
-	if secretKey == "" || strings.HasPrefix(secretKey, "sk_test_...") {
-		jsonErr(w, "Stripe not configured — set STRIPE_SECRET_KEY", http.StatusServiceUnavailable)
-		return
+	provider := payments.Default()
+	charge := payments.ChargeRequest{
+		AmountCents: req.Amount,
+		Currency:    req.Currency,
+		Source:      req.TokenID,
+		Description: "Commande CYNA",
 	}
 
-	params := url.Values{}
-	params.Set("amount", fmt.Sprintf("%d", req.Amount))
-	params.Set("currency", req.Currency)
-	params.Set("source", req.TokenID)
-	params.Set("description", "Commande CYNA")
-
-	stripeReq, err := http.NewRequest("POST", "https://api.stripe.com/v1/charges", strings.NewReader(params.Encode()))
-	if err != nil {
-		jsonErr(w, "Internal error", http.StatusInternalServerError)
-		return
+	if req.SavePaymentMethod {
+		var email string
+		var companyID int
+		config.DB.QueryRow("SELECT email, COALESCE(id_entreprise, 0) FROM utilisateur WHERE id_utilisateur = $1", userID).Scan(&email, &companyID)
+		customerID, err := provider.CreateCustomer(email, req.TokenID)
+		if err != nil {
+			writeChargeError(w, err)
+			return
+		}
+		// Un token carte ne peut servir qu'une fois : on débite le client créé.
+		charge.Source = ""
+		charge.Customer = customerID
+		if companyID != 0 {
+			if _, err := config.DB.Exec("UPDATE entreprise SET stripe_customer_id = $1 WHERE id_entreprise = $2", customerID, companyID); err != nil {
+				log.Printf("CreateStripeCharge: save customer for company %d: %v", companyID, err)
+			} else if n, err := billing.RetrySuspended(r.Context(), companyID); err != nil {
+				log.Printf("CreateStripeCharge: retry suspended renewals for company %d: %v", companyID, err)
+			} else if n > 0 {
+				log.Printf("[INFO] CreateStripeCharge: %d suspended renewal(s) rescheduled for company %d", n, companyID)
+			}
+		}
 	}
-	stripeReq.Header.Set("Authorization", "Bearer "+secretKey)
-	stripeReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	resp, err := (&http.Client{}).Do(stripeReq)
+	chargeID, err := provider.Charge(charge)
 	if err != nil {
-		jsonErr(w, "Payment service unavailable", http.StatusServiceUnavailable)
-		return
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	var stripeResp struct {
-		ID    string `json:"id"`
-		Error *struct {
-			Message string `json:"message"`
-		} `json:"error"`
-	}
-	json.Unmarshal(body, &stripeResp)
-
-	if resp.StatusCode != http.StatusOK {
-		msg := "Payment failed"
-		if stripeResp.Error != nil {
-			msg = stripeResp.Error.Message
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusPaymentRequired)
-		json.NewEncoder(w).Encode(map[string]string{"error": msg})
+		writeChargeError(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success":  true,
-		"chargeId": stripeResp.ID,
+		"chargeId": chargeID,
 	})
 }
+
+func writeChargeError(w http.ResponseWriter, err error) {
+	var declined *payments.DeclinedError
+	switch {
+	case errors.Is(err, payments.ErrNotConfigured):
+		jsonErr(w, "Stripe not configured — set STRIPE_SECRET_KEY", http.StatusServiceUnavailable)
+	case errors.As(err, &declined):
+		jsonErr(w, declined.Message, http.StatusPaymentRequired)
+	default:
+		log.Printf("Stripe error: %v", err)
+		jsonErr(w, "Payment service unavailable", http.StatusServiceUnavailable)
+	}
+}
@@ -1,35 +1,222 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"fmt"
+	"html"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/gorilla/mux"
+	"github.com/lib/pq"
 
 	"api/config"
+	apierrors "api/errors"
+	mw "api/middleware"
+	"api/models"
+	"api/notify"
+	"api/realtime"
+	"api/support"
 )
 
+// ===== SUPPORT — TICKETS =====
+
+const maxTicketMessage = 10000
+
 type Ticket struct {
-	ID              int        `json:"id"`
-	Sujet           string     `json:"subject"`
-	Message         string     `json:"message"`
-	Statut          string     `json:"status"`
-	DateCreation    time.Time  `json:"createdAt"`
-	IDUtilisateur   *int       `json:"userId"`
-	EmailExpediteur string     `json:"email,omitempty"`
+	ID               int                `json:"id"`
+	Sujet            string             `json:"subject"`
+	Message          string             `json:"message"`
+	Statut           string             `json:"status"`
+	Priorite         string             `json:"priority"`
+	Categorie        string             `json:"category"`
+	DateCreation     time.Time          `json:"createdAt"`
+	DateModification time.Time          `json:"updatedAt"`
+	DateFermeture    *time.Time         `json:"closedAt,omitempty"`
+	IDUtilisateur    *int               `json:"userId"`
+	EmailExpediteur  string             `json:"email,omitempty"`
+	IDAssigne        *int               `json:"assigneeId"`
+	NomAssigne       string             `json:"assigneeName,omitempty"`
+	SLA              *TicketSLA         `json:"sla,omitempty"`
+	Attachments      []TicketAttachment `json:"attachments,omitempty"` // pièces jointes du message initial
+	Messages         []TicketMessage    `json:"messages,omitempty"`
+	now              time.Time          // horloge de la base au moment de la lecture
+}
+
+// TicketSLA : objectifs figés à l'ouverture du ticket et leur suivi (temps en pause déduit).
+type TicketSLA struct {
+	Niveau              string     `json:"tier"`
+	PremiereReponseMin  int        `json:"firstResponseMinutes"`
+	ResolutionMin       int        `json:"resolutionMinutes"`
+	EcheanceReponse     *time.Time `json:"firstResponseDue,omitempty"`
+	EcheanceResolution  *time.Time `json:"resolutionDue,omitempty"`
+	DatePremiereReponse *time.Time `json:"firstResponseAt,omitempty"`
+	ReponseSecondes     *int       `json:"firstResponseSeconds,omitempty"`
+	ResolutionSecondes  *int       `json:"resolutionSeconds,omitempty"`
+	EnPause             bool       `json:"paused"`
+	AlerteReponse       int        `json:"firstResponseAlert"` // 0 | 1 proche | 2 dépassé
+	AlerteResolution    int        `json:"resolutionAlert"`
+	clock               support.Clock
+}
+
+// TicketMessage : échange d'un ticket après le message initial (Ticket.Message).
+type TicketMessage struct {
+	ID           int                `json:"id"`
+	IDAuteur     *int               `json:"authorId"`
+	NomAuteur    string             `json:"authorName,omitempty"`
+	Staff        bool               `json:"staff"`
+	Interne      bool               `json:"internal"`
+	Canal        string             `json:"channel"` // web | email
+	Message      string             `json:"message"`
+	DateCreation time.Time          `json:"createdAt"`
+	Attachments  []TicketAttachment `json:"attachments,omitempty"`
+}
+
+const ticketSelect = `
+	SELECT t.id_ticket, COALESCE(t.sujet,''), COALESCE(t.message,''), COALESCE(t.statut,'ouvert'),
+	       t.priorite, t.categorie, t.date_creation, COALESCE(t.date_modification, t.date_creation),
+	       t.date_fermeture, t.id_utilisateur, COALESCE(t.email_expediteur, u.email, ''),
+	       t.id_assigne, TRIM(COALESCE(a.prenom,'') || ' ' || COALESCE(a.nom,'')),
+	       t.sla_niveau, COALESCE(t.sla_premiere_reponse_min, 0), COALESCE(t.sla_resolution_min, 0),
+	       t.sla_pause_secondes, t.sla_pause_depuis, t.date_premiere_reponse, t.sla_reponse_secondes,
+	       t.sla_resolution_secondes, t.sla_alerte_reponse, t.sla_alerte_resolution, LOCALTIMESTAMP
+	FROM ticket_support t
+	LEFT JOIN utilisateur u ON u.id_utilisateur = t.id_utilisateur
+	LEFT JOIN utilisateur a ON a.id_utilisateur = t.id_assigne`
+
+func scanTicket(row interface{ Scan(...interface{}) error }) (Ticket, error) {
+	var t Ticket
+	var sla TicketSLA
+	var niveau sql.NullString
+	var pause int
+	err := row.Scan(&t.ID, &t.Sujet, &t.Message, &t.Statut, &t.Priorite, &t.Categorie,
+		&t.DateCreation, &t.DateModification, &t.DateFermeture, &t.IDUtilisateur, &t.EmailExpediteur,
+		&t.IDAssigne, &t.NomAssigne,
+		&niveau, &sla.PremiereReponseMin, &sla.ResolutionMin, &pause, &sla.clock.PausedSince,
+		&sla.DatePremiereReponse, &sla.ReponseSecondes, &sla.ResolutionSecondes,
+		&sla.AlerteReponse, &sla.AlerteResolution, &t.now)
+	if err != nil || !niveau.Valid {
+		return t, err
+	}
+	sla.Niveau = niveau.String
+	sla.clock.Start = t.DateCreation
+	sla.clock.Paused = time.Duration(pause) * time.Second
+	sla.EnPause = sla.clock.PausedSince != nil
+	if due, ok := sla.clock.Due(time.Duration(sla.PremiereReponseMin) * time.Minute); ok && sla.DatePremiereReponse == nil {
+		sla.EcheanceReponse = &due
+	}
+	if due, ok := sla.clock.Due(time.Duration(sla.ResolutionMin) * time.Minute); ok {
+		sla.EcheanceResolution = &due
+	}
+	t.SLA = &sla
+	return t, nil
+}
+
+// loadTicketMessages charge les échanges ; les notes internes ne sont renvoyées qu'au personnel.
+func loadTicketMessages(q dbQuerier, id int, staff bool) ([]TicketMessage, error) {
+	rows, err := q.Query(`
+		SELECT m.id_message, m.id_auteur, TRIM(COALESCE(u.prenom,'') || ' ' || COALESCE(u.nom,'')),
+		       m.staff, m.interne, m.canal, m.message, m.date_creation
+		FROM ticket_message m
+		LEFT JOIN utilisateur u ON u.id_utilisateur = m.id_auteur
+		WHERE m.id_ticket = $1 AND ($2 OR NOT m.interne)
+		ORDER BY m.date_creation, m.id_message`, id, staff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	messages := []TicketMessage{}
+	for rows.Next() {
+		var m TicketMessage
+		if err := rows.Scan(&m.ID, &m.IDAuteur, &m.NomAuteur, &m.Staff, &m.Interne, &m.Canal, &m.Message, &m.DateCreation); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// isStaffRequest : requête d'un membre du personnel (admin ou support).
+func isStaffRequest(r *http.Request) bool {
+	role, _ := r.Context().Value(models.UserRoleKey).(string)
+	return mw.IsStaffRole(role)
+}
+
+// lockTicket verrouille un ticket visible par l'utilisateur : le sien, ou tous pour le
+// personnel. Un ticket d'un autre client est signalé comme introuvable.
+func lockTicket(tx *sql.Tx, id, userID int, staff bool) (Ticket, error) {
+	t, err := scanTicket(tx.QueryRow(ticketSelect+" WHERE t.id_ticket = $1 FOR UPDATE OF t", id))
+	if err == sql.ErrNoRows || err == nil && !staff && (t.IDUtilisateur == nil || *t.IDUtilisateur != userID) {
+		return t, apierrors.NewNotFound("Ticket not found")
+	}
+	return t, err
 }
 
+// setTicketStatus enregistre le statut d'un ticket verrouillé : date de fermeture,
+// pause ou reprise du chronomètre SLA, temps de résolution mesuré à la fermeture.
+func setTicketStatus(tx *sql.Tx, t Ticket, statut string) error {
+	var pause int
+	var pauseSince *time.Time
+	var resolution *int
+	if t.SLA != nil {
+		c := t.SLA.clock.Transition(t.Statut, statut, t.now)
+		pause, pauseSince = int(c.Paused/time.Second), c.PausedSince
+		switch {
+		case statut == support.StatutFerme && t.Statut != statut:
+			s := int(c.Elapsed(t.now) / time.Second)
+			resolution = &s
+		case statut == support.StatutFerme:
+			resolution = t.SLA.ResolutionSecondes
+		}
+	}
+	_, err := tx.Exec(`
+		UPDATE ticket_support SET statut = $1::varchar, date_modification = NOW(),
+		       date_fermeture = CASE WHEN $1::varchar = 'ferme' THEN COALESCE(date_fermeture, NOW()) END,
+		       sla_pause_secondes = $3, sla_pause_depuis = $4, sla_resolution_secondes = $5
+		WHERE id_ticket = $2`, statut, t.ID, pause, pauseSince, resolution)
+	return err
+}
+
+// recordFirstResponse mesure le délai de première réponse du support (pauses déduites).
+func recordFirstResponse(tx *sql.Tx, t Ticket) error {
+	var elapsed *int
+	if t.SLA != nil {
+		if t.SLA.DatePremiereReponse != nil {
+			return nil
+		}
+		s := int(t.SLA.clock.Elapsed(t.now) / time.Second)
+		elapsed = &s
+	}
+	_, err := tx.Exec(`
+		UPDATE ticket_support SET date_premiere_reponse = $2, sla_reponse_secondes = $3
+		WHERE id_ticket = $1 AND date_premiere_reponse IS NULL`, t.ID, t.now, elapsed)
+	return err
+}
+
+func writeTicket(w http.ResponseWriter, code int, id int, staff bool) {
+	t, err := scanTicket(config.DB.QueryRow(ticketSelect+" WHERE t.id_ticket = $1", id))
+	if err == nil {
+		err = loadTicketThread(config.DB, &t, staff)
+	}
+	if err != nil {
+		writeAppError(w, err, "load ticket")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(t)
+}
+
+// GetTicketSupports liste les tickets de l'utilisateur connecté.
 func GetTicketSupports(w http.ResponseWriter, r *http.Request) {
 	userID, ok := getUserID(r)
 	if !ok {
 		jsonErr(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	rows, err := config.DB.Query(
-		`SELECT id_ticket, COALESCE(sujet,''), COALESCE(message,''), COALESCE(statut,'ouvert'), date_creation, id_utilisateur, COALESCE(email_expediteur,'')
-		 FROM ticket_support WHERE id_utilisateur = $1 ORDER BY date_creation DESC`, userID)
+	rows, err := config.DB.Query(ticketSelect+" WHERE t.id_utilisateur = $1 ORDER BY t.date_creation DESC", userID)
 	if err != nil {
 		jsonErr(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -37,77 +224,536 @@ func GetTicketSupports(w http.ResponseWriter, r *http.Request) {
 	defer rows.Close()
 	tickets := []Ticket{}
 	for rows.Next() {
-		var t Ticket
-		rows.Scan(&t.ID, &t.Sujet, &t.Message, &t.Statut, &t.DateCreation, &t.IDUtilisateur, &t.EmailExpediteur)
-		tickets = append(tickets, t)
+		if t, err := scanTicket(rows); err == nil {
+			tickets = append(tickets, t)
+		}
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(tickets)
 }
 
+// GetTicketSupport renvoie un ticket et ses échanges (notes internes pour le personnel).
 func GetTicketSupport(w http.ResponseWriter, r *http.Request) {
-	id, _ := strconv.Atoi(mux.Vars(r)["id"])
-	var t Ticket
-	err := config.DB.QueryRow(
-		`SELECT id_ticket, COALESCE(sujet,''), COALESCE(message,''), COALESCE(statut,'ouvert'), date_creation, id_utilisateur, COALESCE(email_expediteur,'')
-		 FROM ticket_support WHERE id_ticket = $1`, id).Scan(
-		&t.ID, &t.Sujet, &t.Message, &t.Statut, &t.DateCreation, &t.IDUtilisateur, &t.EmailExpediteur)
-	if err != nil {
+	id, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	userID, _ := getUserID(r)
+	staff := isStaffRequest(r)
+	t, err := scanTicket(config.DB.QueryRow(ticketSelect+" WHERE t.id_ticket = $1", id))
+	if err == sql.ErrNoRows || err == nil && !staff && (t.IDUtilisateur == nil || *t.IDUtilisateur != userID) {
 		jsonErr(w, "Ticket not found", http.StatusNotFound)
 		return
+	} else if err != nil {
+		writeAppError(w, err, "get ticket")
+		return
+	}
+	if err := loadTicketThread(config.DB, &t, staff); err != nil {
+		writeAppError(w, err, "get ticket")
+		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(t)
 }
 
+// CreateTicketSupport ouvre un ticket (client connecté, ou invité via le formulaire de
+// contact avec son email). En multipart/form-data, les champs "files" sont joints au
+// message initial.
 func CreateTicketSupport(w http.ResponseWriter, r *http.Request) {
 	userID, isAuth := getUserID(r)
 
 	var body struct {
-		Subject string `json:"subject"`
-		Message string `json:"message"`
-		Email   string `json:"email"`
+		Subject  string `json:"subject"`
+		Message  string `json:"message"`
+		Email    string `json:"email"`
+		Category string `json:"category"`
+	}
+	var files []pendingAttachment
+	if isMultipartRequest(r) {
+		defer removeMultipartFiles(r)
+		var err error
+		if files, err = readTicketForm(r); err != nil {
+			writeAppError(w, err, "create ticket")
+			return
+		}
+		body.Subject, body.Message = r.FormValue("subject"), r.FormValue("message")
+		body.Email, body.Category = r.FormValue("email"), r.FormValue("category")
+	} else if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		jsonErr(w, "Subject and message are required", http.StatusBadRequest)
+		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Subject == "" || body.Message == "" {
+	body.Subject = mw.SanitizeString(body.Subject)
+	body.Message = mw.SanitizeString(body.Message)
+	if body.Subject == "" || body.Message == "" {
 		jsonErr(w, "Subject and message are required", http.StatusBadRequest)
 		return
 	}
+	if len(body.Subject) > 150 || len(body.Message) > maxTicketMessage {
+		jsonErr(w, fmt.Sprintf("Subject (150) or message (%d) too long", maxTicketMessage), http.StatusBadRequest)
+		return
+	}
+	if body.Category == "" {
+		body.Category = support.CategorieDefaut
+	}
+	if !support.ValidCategorie(body.Category) {
+		jsonErr(w, "category must be one of "+strings.Join(support.Categories, ", "), http.StatusBadRequest)
+		return
+	}
 
-	var t Ticket
+	var owner *int
+	var email *string
 	if isAuth {
-		t.IDUtilisateur = &userID
-		config.DB.QueryRow(
-			`INSERT INTO ticket_support (sujet, message, id_utilisateur) VALUES ($1,$2,$3) RETURNING id_ticket, date_creation`,
-			body.Subject, body.Message, userID).Scan(&t.ID, &t.DateCreation)
+		owner = &userID
 	} else {
+		body.Email = strings.TrimSpace(body.Email)
 		if body.Email == "" {
 			jsonErr(w, "Email is required for guest submissions", http.StatusBadRequest)
 			return
 		}
-		t.EmailExpediteur = body.Email
-		config.DB.QueryRow(
-			`INSERT INTO ticket_support (sujet, message, email_expediteur) VALUES ($1,$2,$3) RETURNING id_ticket, date_creation`,
-			body.Subject, body.Message, body.Email).Scan(&t.ID, &t.DateCreation)
+		if !mw.IsValidEmail(body.Email) {
+			jsonErr(w, "Invalid email", http.StatusBadRequest)
+			return
+		}
+		email = &body.Email
+	}
+	policy, err := ticketPolicy(config.DB, owner)
+	if err != nil {
+		writeAppError(w, err, "create ticket")
+		return
+	}
+	tx, err := config.DB.Begin()
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	var id int
+	var keys []string
+	err = tx.QueryRow(`
+		INSERT INTO ticket_support (sujet, message, statut, priorite, categorie, id_utilisateur, email_expediteur,
+		                            sla_niveau, sla_premiere_reponse_min, sla_resolution_min)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), NULLIF($9, 0), NULLIF($10, 0)) RETURNING id_ticket`,
+		body.Subject, body.Message, support.StatutOuvert, support.PrioriteDefaut, body.Category, owner, email,
+		policy.Niveau, int(policy.FirstResponse/time.Minute), int(policy.Resolution/time.Minute)).Scan(&id)
+	if err == nil && len(files) > 0 {
+		_, keys, err = storeTicketAttachments(r.Context(), tx, id, nil, owner, files)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		discardBlobs(keys)
+		writeAppError(w, err, "create ticket")
+		return
+	}
+	go notifyTicketContact(id, "Nous avons bien reçu votre demande et vous répondrons au plus vite :", body.Message)
+	writeTicket(w, http.StatusCreated, id, false)
+}
+
+// UpdateTicketSupport fait avancer le workflow d'un ticket. Le client peut seulement
+// fermer ou rouvrir son ticket ; le personnel change aussi priorité, catégorie et
+// affectation (assigneeId null pour désaffecter).
+func UpdateTicketSupport(w http.ResponseWriter, r *http.Request) {
+	id, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	userID, _ := getUserID(r)
+	staff := isStaffRequest(r)
+	var body struct {
+		Status     *string         `json:"status"`
+		Priority   *string         `json:"priority"`
+		Category   *string         `json:"category"`
+		AssigneeID json.RawMessage `json:"assigneeId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		jsonErr(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !staff && (body.Priority != nil || body.Category != nil || body.AssigneeID != nil) {
+		jsonErr(w, "Only staff can change priority, category or assignee", http.StatusForbidden)
+		return
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	var previous *int // assigné avant la modification, prévenu s'il est remplacé
+	err = func() error {
+		t, err := lockTicket(tx, id, userID, staff)
+		if err != nil {
+			return err
+		}
+		previous = t.IDAssigne
+		if body.Status != nil && *body.Status != t.Statut {
+			to := *body.Status
+			switch {
+			case !support.ValidStatut(to):
+				return apierrors.NewValidation("status must be one of " + strings.Join(support.Statuts, ", "))
+			case !staff && !support.CustomerCanSet(to):
+				return apierrors.NewForbidden("Customers can only close or reopen a ticket")
+			case !support.CanTransition(t.Statut, to):
+				return apierrors.NewConflict(fmt.Sprintf("Cannot move ticket from %s to %s", t.Statut, to))
+			}
+			if err := setTicketStatus(tx, t, to); err != nil {
+				return err
+			}
+		}
+		if body.Priority != nil && !support.ValidPriorite(*body.Priority) {
+			return apierrors.NewValidation("priority must be one of " + strings.Join(support.Priorites, ", "))
+		}
+		if body.Category != nil && !support.ValidCategorie(*body.Category) {
+			return apierrors.NewValidation("category must be one of " + strings.Join(support.Categories, ", "))
+		}
+		assignee := t.IDAssigne
+		if body.AssigneeID != nil {
+			assignee = nil
+			if string(body.AssigneeID) != "null" {
+				var a int
+				if json.Unmarshal(body.AssigneeID, &a) != nil {
+					return apierrors.NewValidation("assigneeId must be a user id or null")
+				}
+				if !isStaffUser(tx, a) {
+					return apierrors.NewValidation("Assignee must be a staff user (admin or support)")
+				}
+				assignee = &a
+			}
+		}
+		priorite, categorie := t.Priorite, t.Categorie
+		if body.Priority != nil {
+			priorite = *body.Priority
+		}
+		if body.Category != nil {
+			categorie = *body.Category
+		}
+		_, err = tx.Exec(`
+			UPDATE ticket_support SET priorite = $1, categorie = $2, id_assigne = $3, date_modification = NOW()
+			WHERE id_ticket = $4`, priorite, categorie, assignee, id)
+		return err
+	}()
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		writeAppError(w, err, "update ticket")
+		return
+	}
+	if t, err := scanTicket(config.DB.QueryRow(ticketSelect+" WHERE t.id_ticket = $1", id)); err == nil {
+		publishTicketEvent(realtime.EventTicketUpdate, newTicketUpdateEvent(t), userID, t.IDUtilisateur, t.IDAssigne, previous)
+	}
+	writeTicket(w, http.StatusOK, id, staff)
+}
+
+// isStaffUser vérifie qu'un utilisateur a un rôle du personnel.
+func isStaffUser(q dbQuerier, userID int) bool {
+	var ok bool
+	err := q.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM user_roles ur
+			JOIN roles r ON r.id_role = ur.id_role
+			WHERE ur.id_utilisateur = $1 AND LOWER(r.nom) = ANY($2)
+		)`, userID, pq.Array(mw.StaffRoles)).Scan(&ok)
+	return err == nil && ok
+}
+
+// AddTicketMessage ajoute un échange à un ticket. Le personnel peut écrire une note
+// interne et fixer le statut avec sa réponse ; sinon le statut suit support.AfterReply.
+// En multipart/form-data (champs message, internal, status et fichiers "files"), le
+// message peut se limiter aux pièces jointes.
+func AddTicketMessage(w http.ResponseWriter, r *http.Request) {
+	id, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	userID, _ := getUserID(r)
+	staff := isStaffRequest(r)
+	var body struct {
+		Message  string  `json:"message"`
+		Internal bool    `json:"internal"`
+		Status   *string `json:"status"`
+	}
+	var files []pendingAttachment
+	if isMultipartRequest(r) {
+		defer removeMultipartFiles(r)
+		var err error
+		if files, err = readTicketForm(r); err != nil {
+			writeAppError(w, err, "add ticket message")
+			return
+		}
+		body.Message = r.FormValue("message")
+		body.Internal, _ = strconv.ParseBool(r.FormValue("internal"))
+		if s := r.FormValue("status"); s != "" {
+			body.Status = &s
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		jsonErr(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	body.Message = mw.SanitizeString(body.Message)
+	if body.Message == "" && len(files) == 0 || len(body.Message) > maxTicketMessage {
+		jsonErr(w, fmt.Sprintf("message is required (%d characters max)", maxTicketMessage), http.StatusBadRequest)
+		return
+	}
+	if !staff && (body.Internal || body.Status != nil) {
+		jsonErr(w, "Only staff can write internal notes or set the status", http.StatusForbidden)
+		return
 	}
-	t.Sujet = body.Subject
-	t.Message = body.Message
-	t.Statut = "ouvert"
 
+	tx, err := config.DB.Begin()
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	var t Ticket
+	var m TicketMessage
+	var keys []string
+	var next string
+	err = func() error {
+		var err error
+		if t, err = lockTicket(tx, id, userID, staff); err != nil {
+			return err
+		}
+		next = t.Statut
+		if !body.Internal {
+			next = support.AfterReply(t.Statut, staff)
+		}
+		if body.Status != nil && *body.Status != t.Statut {
+			if !support.ValidStatut(*body.Status) {
+				return apierrors.NewValidation("status must be one of " + strings.Join(support.Statuts, ", "))
+			}
+			if !support.CanTransition(t.Statut, *body.Status) {
+				return apierrors.NewConflict(fmt.Sprintf("Cannot move ticket from %s to %s", t.Statut, *body.Status))
+			}
+			next = *body.Status
+		}
+		err = tx.QueryRow(`
+			INSERT INTO ticket_message (id_ticket, id_auteur, staff, interne, message)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id_message, id_auteur, staff, interne, canal, message, date_creation`,
+			id, userID, staff, body.Internal, body.Message).Scan(
+			&m.ID, &m.IDAuteur, &m.Staff, &m.Interne, &m.Canal, &m.Message, &m.DateCreation)
+		if err != nil {
+			return err
+		}
+		if len(files) > 0 {
+			if m.Attachments, keys, err = storeTicketAttachments(r.Context(), tx, id, &m.ID, &userID, files); err != nil {
+				return err
+			}
+		}
+		if staff && !body.Internal {
+			if err := recordFirstResponse(tx, t); err != nil {
+				return err
+			}
+		}
+		return setTicketStatus(tx, t, next)
+	}()
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		discardBlobs(keys)
+		writeAppError(w, err, "add ticket message")
+		return
+	}
+	if staff && !body.Internal {
+		go notifyTicketContact(id, "Le support a répondu à votre demande :", m.Message)
+	}
+	if !body.Internal {
+		notifyTicketReply(t, staff, userID)
+	}
+	owner := t.IDUtilisateur
+	if body.Internal {
+		owner = nil
+	}
+	publishTicketEvent(realtime.EventTicketMessage, ticketMessageEvent{id, next, m}, userID, owner, t.IDAssigne)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(t)
+	json.NewEncoder(w).Encode(m)
+}
+
+// notifyTicketReply signale une réponse publique : au client pour une réponse du support
+// (l'email de suivi est envoyé par notifyTicketContact), à l'agent affecté pour une
+// réponse du client.
+func notifyTicketReply(t Ticket, staff bool, authorID int) {
+	recipient := t.IDAssigne
+	title, message := "Réponse du client", fmt.Sprintf("Le client a répondu sur le ticket #%d « %s ».",
+		t.ID, html.UnescapeString(t.Sujet))
+	if staff {
+		recipient = t.IDUtilisateur
+		title, message = "Réponse du support", fmt.Sprintf("Le support a répondu à votre ticket #%d « %s ».",
+			t.ID, html.UnescapeString(t.Sujet))
+	}
+	if recipient == nil || *recipient == authorID {
+		return
+	}
+	notify.SendAsync(*recipient, notify.TypeSupport, notify.Payload{
+		Title: title, Message: message, NoEmail: staff,
+		Data: map[string]interface{}{"ticketId": t.ID},
+	})
 }
 
-func UpdateTicketSupport(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
-func DeleteTicketSupport(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+// ticketMessageEvent : nouvel échange sur un ticket, poussé sur les flux temps réel.
+type ticketMessageEvent struct {
+	TicketID int           `json:"ticketId"`
+	Status   string        `json:"status"`
+	Message  TicketMessage `json:"message"`
+}
 
-// Notification Handlers (stubs)
+// ticketUpdateEvent : changement de statut, de priorité ou d'assignation d'un ticket.
+type ticketUpdateEvent struct {
+	TicketID   int       `json:"ticketId"`
+	Status     string    `json:"status"`
+	Priority   string    `json:"priority"`
+	Category   string    `json:"category"`
+	AssigneeID *int      `json:"assigneeId"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
 
-func GetNotifications(w http.ResponseWriter, r *http.Request) {
+func newTicketUpdateEvent(t Ticket) ticketUpdateEvent {
+	return ticketUpdateEvent{t.ID, t.Statut, t.Priorite, t.Categorie, t.IDAssigne, t.DateModification}
+}
+
+// publishTicketEvent pousse un événement de ticket aux destinataires (client, agents),
+// une seule fois chacun et jamais à son auteur.
+func publishTicketEvent(typ string, data interface{}, authorID int, recipients ...*int) {
+	seen := map[int]bool{authorID: true}
+	for _, id := range recipients {
+		if id != nil && !seen[*id] {
+			seen[*id] = true
+			realtime.Publish(*id, typ, data)
+		}
+	}
+}
+
+// DeleteTicketSupport supprime un ticket et ses échanges (administrateurs uniquement ;
+// un client ferme son ticket).
+func DeleteTicketSupport(w http.ResponseWriter, r *http.Request) {
+	id, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	if role, _ := r.Context().Value(models.UserRoleKey).(string); role != "admin" {
+		jsonErr(w, "Forbidden: Admin access required", http.StatusForbidden)
+		return
+	}
+	// Les fichiers des pièces jointes sont supprimés une fois le ticket effacé.
+	var keys []string
+	err := config.DB.QueryRow(`
+		WITH pj AS (SELECT cle_stockage FROM ticket_piece_jointe WHERE id_ticket = $1),
+		     del AS (DELETE FROM ticket_support WHERE id_ticket = $1 RETURNING id_ticket)
+		SELECT COALESCE((SELECT array_agg(cle_stockage) FROM pj), '{}') FROM del`, id).Scan(pq.Array(&keys))
+	if err == sql.ErrNoRows {
+		jsonErr(w, "Ticket not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeAppError(w, err, "delete ticket")
+		return
+	}
+	if len(keys) > 0 && attachmentStore != nil {
+		go discardBlobs(keys)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetAdminTickets : file d'attente du support, par priorité puis ancienneté. Filtres :
+// status (liste séparée par des virgules), assignee (me, none ou id), priority,
+// category, older_than / newer_than (90m, 48h, 7d).
+func GetAdminTickets(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	userID, _ := getUserID(r)
+	where, args := []string{}, []interface{}{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	if v := q.Get("status"); v != "" {
+		statuts := strings.Split(v, ",")
+		for _, s := range statuts {
+			if !support.ValidStatut(s) {
+				jsonErr(w, "status must be one of "+strings.Join(support.Statuts, ", "), http.StatusBadRequest)
+				return
+			}
+		}
+		where = append(where, "t.statut = ANY("+arg(pq.Array(statuts))+")")
+	}
+	switch v := q.Get("assignee"); v {
+	case "":
+	case "me":
+		where = append(where, "t.id_assigne = "+arg(userID))
+	case "none":
+		where = append(where, "t.id_assigne IS NULL")
+	default:
+		a, err := strconv.Atoi(v)
+		if err != nil {
+			jsonErr(w, "assignee must be me, none or a user id", http.StatusBadRequest)
+			return
+		}
+		where = append(where, "t.id_assigne = "+arg(a))
+	}
+	if v := q.Get("priority"); v != "" {
+		if !support.ValidPriorite(v) {
+			jsonErr(w, "priority must be one of "+strings.Join(support.Priorites, ", "), http.StatusBadRequest)
+			return
+		}
+		where = append(where, "t.priorite = "+arg(v))
+	}
+	if v := q.Get("category"); v != "" {
+		if !support.ValidCategorie(v) {
+			jsonErr(w, "category must be one of "+strings.Join(support.Categories, ", "), http.StatusBadRequest)
+			return
+		}
+		where = append(where, "t.categorie = "+arg(v))
+	}
+	for param, op := range map[string]string{"older_than": "<=", "newer_than": ">="} {
+		if v := q.Get(param); v != "" {
+			age, err := support.ParseAge(v)
+			if err != nil {
+				jsonErr(w, param+": "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			where = append(where, "t.date_creation "+op+" LOCALTIMESTAMP - make_interval(secs => "+arg(age.Seconds())+")")
+		}
+	}
+	if v := q.Get("sla"); v != "" {
+		// sla=warning : échéance proche ou dépassée ; sla=breached : dépassée
+		level, ok := map[string]int{"warning": support.LevelWarning, "breached": support.LevelBreached}[v]
+		if !ok {
+			jsonErr(w, "sla must be warning or breached", http.StatusBadRequest)
+			return
+		}
+		where = append(where, "GREATEST(t.sla_alerte_reponse, t.sla_alerte_resolution) >= "+arg(level))
+	}
+	cond := ""
+	if len(where) > 0 {
+		cond = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := config.DB.QueryRow("SELECT COUNT(*) FROM ticket_support t"+cond, args...).Scan(&total); err != nil {
+		writeAppError(w, err, "list tickets")
+		return
+	}
+	page, limit, offset := parsePaginationDefault(r)
+	order := " ORDER BY array_position(" + arg(pq.Array(support.Priorites)) + "::varchar[], t.priorite::varchar), t.date_creation"
+	rows, err := config.DB.Query(ticketSelect+cond+order+" LIMIT "+arg(limit)+" OFFSET "+arg(offset), args...)
+	if err != nil {
+		writeAppError(w, err, "list tickets")
+		return
+	}
+	defer rows.Close()
+	tickets := []Ticket{}
+	for rows.Next() {
+		t, err := scanTicket(rows)
+		if err != nil {
+			writeAppError(w, err, "list tickets")
+			return
+		}
+		tickets = append(tickets, t)
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode([]interface{}{})
+	json.NewEncoder(w).Encode(map[string]interface{}{"tickets": tickets, "total": total, "page": page, "limit": limit})
 }
-func GetNotification(w http.ResponseWriter, r *http.Request)   { w.WriteHeader(http.StatusNotFound) }
-func CreateNotification(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
-func UpdateNotification(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
-func DeleteNotification(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"api/config"
+	apierrors "api/errors"
+	"api/media"
+	"api/support"
+)
+
+// ===== SUPPORT — PIÈCES JOINTES =====
+
+var attachmentStore media.Blobs
+
+// TicketAttachment : pièce jointe du message initial d'un ticket ou d'un échange.
+type TicketAttachment struct {
+	ID           int       `json:"id"`
+	Nom          string    `json:"name"`
+	TypeMime     string    `json:"contentType"`
+	Taille       int       `json:"size"`
+	URL          string    `json:"url"`
+	DateCreation time.Time `json:"createdAt"`
+}
+
+// pendingAttachment : fichier reçu et contrôlé, pas encore stocké.
+type pendingAttachment struct {
+	nom      string
+	typeMime string
+	data     []byte
+}
+
+// InitSupportAttachments prépare le stockage privé des pièces jointes (ATTACHMENT_STORAGE,
+// voir media.NewBlobsFromEnv).
+func InitSupportAttachments() {
+	store, err := media.NewBlobsFromEnv("ATTACHMENT", "/data/attachments")
+	if err != nil {
+		log.Printf("[WARN] Ticket attachments disabled: %v", err)
+		return
+	}
+	attachmentStore = store
+	log.Printf("[INFO] Ticket attachments ready (max %d files of %d MB)", support.MaxAttachments, AttachmentMaxSize()>>20)
+}
+
+// AttachmentMaxSize : taille maximale d'une pièce jointe (SUPPORT_ATTACHMENT_MAX_MB,
+// 10 Mo par défaut).
+func AttachmentMaxSize() int64 {
+	if mb, err := strconv.Atoi(os.Getenv("SUPPORT_ATTACHMENT_MAX_MB")); err == nil && mb > 0 {
+		return int64(mb) << 20
+	}
+	return 10 << 20
+}
+
+// AttachmentMaxRequestSize : limite du corps d'une requête avec pièces jointes.
+func AttachmentMaxRequestSize() int64 {
+	return support.MaxAttachments*AttachmentMaxSize() + 256<<10
+}
+
+func isMultipartRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data")
+}
+
+// removeMultipartFiles supprime les fichiers temporaires d'un formulaire multipart.
+func removeMultipartFiles(r *http.Request) {
+	if r.MultipartForm != nil {
+		r.MultipartForm.RemoveAll()
+	}
+}
+
+// readTicketForm lit un formulaire multipart (champs texte et fichiers "files") et
+// contrôle nombre, taille et type des pièces jointes.
+func readTicketForm(r *http.Request) ([]pendingAttachment, error) {
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, apierrors.New(http.StatusRequestEntityTooLarge, fmt.Sprintf("Request too large (%d files of %d MB max)",
+				support.MaxAttachments, AttachmentMaxSize()>>20))
+		}
+		return nil, apierrors.NewValidation("Invalid multipart form")
+	}
+	headers := r.MultipartForm.File["files"]
+	if len(headers) > support.MaxAttachments {
+		return nil, apierrors.NewValidation(fmt.Sprintf("Too many attachments (%d max)", support.MaxAttachments))
+	}
+	if len(headers) > 0 && attachmentStore == nil {
+		return nil, apierrors.New(http.StatusServiceUnavailable, "Attachment storage is not configured")
+	}
+	files := make([]pendingAttachment, 0, len(headers))
+	for _, fh := range headers {
+		if fh.Size > AttachmentMaxSize() {
+			return nil, apierrors.New(http.StatusRequestEntityTooLarge, fmt.Sprintf("%s: file too large (%d MB max)", support.SafeFilename(fh.Filename),
+				AttachmentMaxSize()>>20))
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(io.LimitReader(f, AttachmentMaxSize()+1))
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		att, err := checkTicketAttachment(fh.Filename, data)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, att)
+	}
+	return files, nil
+}
+
+// checkTicketAttachment applique les règles de support.CheckAttachment et la limite de taille.
+func checkTicketAttachment(filename string, data []byte) (pendingAttachment, error) {
+	name := support.SafeFilename(filename)
+	if int64(len(data)) > AttachmentMaxSize() {
+		return pendingAttachment{}, apierrors.New(http.StatusRequestEntityTooLarge, fmt.Sprintf("%s: file too large (%d MB max)", name,
+			AttachmentMaxSize()>>20))
+	}
+	typeMime, err := support.CheckAttachment(name, data)
+	switch err {
+	case nil:
+	case support.ErrAttachmentEmpty:
+		return pendingAttachment{}, apierrors.NewValidation(name + ": empty file")
+	default:
+		return pendingAttachment{}, apierrors.New(http.StatusUnsupportedMediaType, fmt.Sprintf("%s: unsupported file type (allowed: %s)", name,
+			strings.Join(support.AttachmentExtensions(), ", ")))
+	}
+	return pendingAttachment{nom: name, typeMime: typeMime, data: data}, nil
+}
+
+// storeTicketAttachments range les fichiers et les rattache au ticket (messageID nil pour
+// le message initial). Les clés écrites sont retournées, même en cas d'erreur, pour que
+// l'appelant les supprime si la transaction n'aboutit pas.
+func storeTicketAttachments(ctx context.Context, tx *sql.Tx, ticketID int, messageID, authorID *int,
+	files []pendingAttachment) ([]TicketAttachment, []string, error) {
+	var keys []string
+	atts := []TicketAttachment{}
+	for _, f := range files {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return atts, keys, err
+		}
+		key := fmt.Sprintf("tickets/%d/%s", ticketID, hex.EncodeToString(b))
+		if err := attachmentStore.Put(ctx, key, f.typeMime, f.data); err != nil {
+			return atts, keys, err
+		}
+		keys = append(keys, key)
+		sum := sha256.Sum256(f.data)
+		a := TicketAttachment{Nom: f.nom, TypeMime: f.typeMime, Taille: len(f.data)}
+		err := tx.QueryRow(`
+			INSERT INTO ticket_piece_jointe (id_ticket, id_message, nom_fichier, type_mime, taille, empreinte, cle_stockage, id_auteur)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id_piece_jointe, date_creation`,
+			ticketID, messageID, f.nom, f.typeMime, len(f.data), hex.EncodeToString(sum[:]), key, authorID).Scan(
+			&a.ID, &a.DateCreation)
+		if err != nil {
+			return atts, keys, err
+		}
+		a.URL = attachmentURL(ticketID, a.ID)
+		atts = append(atts, a)
+	}
+	return atts, keys, nil
+}
+
+// discardBlobs supprime les fichiers d'une opération annulée ou d'un ticket supprimé.
+func discardBlobs(keys []string) {
+	for _, key := range keys {
+		if err := attachmentStore.Delete(context.Background(), key); err != nil {
+			log.Printf("[WARN] attachment %s not deleted: %v", key, err)
+		}
+	}
+}
+
+func attachmentURL(ticketID, id int) string {
+	return fmt.Sprintf("/api/tickets/%d/attachments/%d", ticketID, id)
+}
+
+// loadTicketThread charge les échanges d'un ticket et les pièces jointes visibles :
+// celles des notes internes ne sont renvoyées qu'au personnel.
+func loadTicketThread(q dbQuerier, t *Ticket, staff bool) error {
+	var err error
+	if t.Messages, err = loadTicketMessages(q, t.ID, staff); err != nil {
+		return err
+	}
+	rows, err := q.Query(`
+		SELECT p.id_piece_jointe, p.id_message, p.nom_fichier, p.type_mime, p.taille, p.date_creation
+		FROM ticket_piece_jointe p
+		LEFT JOIN ticket_message m ON m.id_message = p.id_message
+		WHERE p.id_ticket = $1 AND ($2 OR NOT COALESCE(m.interne, FALSE))
+		ORDER BY p.id_piece_jointe`, t.ID, staff)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	byMessage := map[int]int{}
+	for i, m := range t.Messages {
+		byMessage[m.ID] = i
+	}
+	for rows.Next() {
+		var a TicketAttachment
+		var messageID *int
+		if err := rows.Scan(&a.ID, &messageID, &a.Nom, &a.TypeMime, &a.Taille, &a.DateCreation); err != nil {
+			return err
+		}
+		a.URL = attachmentURL(t.ID, a.ID)
+		if messageID == nil {
+			t.Attachments = append(t.Attachments, a)
+		} else if i, ok := byMessage[*messageID]; ok {
+			t.Messages[i].Attachments = append(t.Messages[i].Attachments, a)
+		}
+	}
+	return rows.Err()
+}
+
+// GetTicketAttachment télécharge une pièce jointe : propriétaire du ticket ou personnel,
+// personnel seulement pour une note interne. Le fichier est toujours servi en
+// téléchargement, sans interprétation par le navigateur.
+func GetTicketAttachment(w http.ResponseWriter, r *http.Request) {
+	ticketID, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	id, ok := intParam(w, r, "attachmentId")
+	if !ok {
+		return
+	}
+	if attachmentStore == nil {
+		jsonErr(w, "Attachment storage is not configured", http.StatusServiceUnavailable)
+		return
+	}
+	userID, _ := getUserID(r)
+	staff := isStaffRequest(r)
+	var nom, typeMime, key string
+	var owner *int
+	var interne bool
+	err := config.DB.QueryRow(`
+		SELECT p.nom_fichier, p.type_mime, p.cle_stockage, t.id_utilisateur, COALESCE(m.interne, FALSE)
+		FROM ticket_piece_jointe p
+		JOIN ticket_support t ON t.id_ticket = p.id_ticket
+		LEFT JOIN ticket_message m ON m.id_message = p.id_message
+		WHERE p.id_piece_jointe = $1 AND p.id_ticket = $2`, id, ticketID).Scan(&nom, &typeMime, &key, &owner, &interne)
+	if err == sql.ErrNoRows || err == nil && !staff && (owner == nil || *owner != userID || interne) {
+		jsonErr(w, "Attachment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeAppError(w, err, "get ticket attachment")
+		return
+	}
+	data, err := attachmentStore.Get(r.Context(), key)
+	if err == media.ErrNotFound {
+		jsonErr(w, "Attachment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		writeAppError(w, err, "get ticket attachment")
+		return
+	}
+	w.Header().Set("Content-Type", typeMime)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": nom}))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Write(data)
+}
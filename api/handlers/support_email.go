@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"api/config"
+	apierrors "api/errors"
+	"api/mailer"
+	mw "api/middleware"
+	"api/realtime"
+	"api/support"
+)
+
+// ===== SUPPORT — TICKETS PAR EMAIL =====
+
+// InboundEmailMaxSize : taille maximale d'un email reçu du relais (pièces jointes comprises).
+const InboundEmailMaxSize = 25 << 20
+
+var (
+	replySecretOnce sync.Once
+	replySecretKey  []byte
+)
+
+// supportReplySecret retourne la clé HMAC des adresses de réponse (SUPPORT_REPLY_SECRET).
+// Sans configuration, une clé aléatoire est générée : les réponses aux emails envoyés
+// avant un redémarrage sont alors rejetées.
+func supportReplySecret() []byte {
+	replySecretOnce.Do(func() {
+		if s := os.Getenv("SUPPORT_REPLY_SECRET"); s != "" {
+			replySecretKey = []byte(s)
+			return
+		}
+		log.Println("[WARN] SUPPORT_REPLY_SECRET not set — using an ephemeral reply key")
+		replySecretKey = make([]byte, 32)
+		rand.Read(replySecretKey)
+	})
+	return replySecretKey
+}
+
+// notifyTicketContact envoie au demandeur (client ou invité) un email de suivi du ticket.
+// Avec SUPPORT_REPLY_ADDRESS, l'email porte l'adresse de réponse signée du ticket et le
+// client peut répondre directement.
+func notifyTicketContact(id int, intro, message string) {
+	if config.DB == nil {
+		return
+	}
+	t, err := scanTicket(config.DB.QueryRow(ticketSelect+" WHERE t.id_ticket = $1", id))
+	if err != nil {
+		log.Printf("[EMAIL] ticket %d: %v", id, err)
+		return
+	}
+	if t.EmailExpediteur == "" {
+		return
+	}
+	replyTo := support.ReplyAddress(supportReplySecret(), t.ID, os.Getenv("SUPPORT_REPLY_ADDRESS"))
+	marker := `<p style="color:#999;font-size:12px;margin:0 0 16px;">Suivez votre demande depuis votre espace client.</p>`
+	if replyTo != "" {
+		marker = fmt.Sprintf(`<p style="color:#999;font-size:12px;margin:0 0 16px;">## %s ##</p>`, support.ReplyMarker)
+	}
+	// Sujet et message sont stockés échappés (mw.SanitizeString).
+	body := fmt.Sprintf(`
+      %s
+      <p style="color:#555;line-height:1.6;">%s</p>
+      <div style="border-left:3px solid #3b12a3;padding:8px 16px;color:#333;line-height:1.6;">%s</div>
+      <p style="color:#999;font-size:12px;">Ticket #%d — statut : %s</p>`,
+		marker, html.EscapeString(intro), strings.ReplaceAll(message, "\n", "<br>"), t.ID, html.EscapeString(t.Statut))
+	subject := fmt.Sprintf("[Ticket #%d] %s", t.ID, html.UnescapeString(t.Sujet))
+	if err := mailer.SendReplyTo(t.EmailExpediteur, replyTo, subject, mailer.Layout("Votre demande au support", body)); err != nil {
+		log.Printf("[EMAIL] Erreur suivi ticket %d à %s: %v", t.ID, t.EmailExpediteur, err)
+	}
+}
+
+// InboundTicketEmail reçoit du relais de messagerie (MIME brut) la réponse d'un client à
+// un email de ticket. Le relais s'authentifie avec l'en-tête X-Inbound-Secret
+// (SUPPORT_INBOUND_SECRET) ; le ticket est désigné par l'adresse de réponse signée et
+// l'expéditeur doit être le demandeur. Les pièces jointes acceptées (voir
+// checkTicketAttachment) sont conservées, les autres ignorées. Les réponses automatiques
+// sont ignorées et un Message-ID déjà reçu n'est pas enregistré deux fois.
+func InboundTicketEmail(w http.ResponseWriter, r *http.Request) {
+	secret := os.Getenv("SUPPORT_INBOUND_SECRET")
+	if secret == "" {
+		jsonErr(w, "Inbound email is not configured", http.StatusServiceUnavailable)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Inbound-Secret")), []byte(secret)) != 1 {
+		jsonErr(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, InboundEmailMaxSize)
+	msg, err := support.ParseInbound(r.Body)
+	if err != nil {
+		jsonErr(w, "Invalid MIME message: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if msg.Auto {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"status": "ignored"})
+		return
+	}
+	id, err := msg.ReplyTicket(supportReplySecret())
+	switch err {
+	case nil:
+	case support.ErrNoReplyAddress:
+		jsonErr(w, "No ticket reply address among recipients", http.StatusUnprocessableEntity)
+		return
+	default:
+		log.Printf("[SECURITY] Rejected ticket reply from %s: %v", msg.From, err)
+		jsonErr(w, "Invalid reply token", http.StatusForbidden)
+		return
+	}
+	text := mw.SanitizeString(msg.Reply())
+	if len(text) > maxTicketMessage {
+		text = strings.ToValidUTF8(text[:maxTicketMessage], "")
+	}
+	var files []pendingAttachment
+	skipped := 0
+	for _, a := range msg.Attachments {
+		f, err := checkTicketAttachment(a.Filename, a.Data)
+		if err != nil || attachmentStore == nil || len(files) == support.MaxAttachments {
+			skipped++
+			continue
+		}
+		files = append(files, f)
+	}
+	if text == "" && len(files) == 0 {
+		jsonErr(w, "Empty reply", http.StatusUnprocessableEntity)
+		return
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	var t Ticket
+	var messageID int
+	var keys []string
+	m := TicketMessage{Canal: "email", Message: text}
+	var status string
+	err = func() error {
+		var err error
+		t, err = scanTicket(tx.QueryRow(ticketSelect+" WHERE t.id_ticket = $1 FOR UPDATE OF t", id))
+		if err == sql.ErrNoRows {
+			return apierrors.NewNotFound("Ticket not found")
+		} else if err != nil {
+			return err
+		}
+		if !strings.EqualFold(t.EmailExpediteur, msg.From) {
+			log.Printf("[SECURITY] Ticket %d reply from %s does not match the ticket contact", id, msg.From)
+			return apierrors.NewForbidden("Sender does not match the ticket contact")
+		}
+		err = tx.QueryRow(`
+			INSERT INTO ticket_message (id_ticket, id_auteur, staff, interne, message, canal, message_id_email)
+			VALUES ($1, $2, FALSE, FALSE, $3, 'email', NULLIF($4, ''))
+			ON CONFLICT (message_id_email) DO NOTHING
+			RETURNING id_message, date_creation`, id, t.IDUtilisateur, text, msg.MessageID).Scan(&messageID, &m.DateCreation)
+		if err == sql.ErrNoRows {
+			return nil // déjà reçu (relais qui renvoie le message)
+		} else if err != nil {
+			return err
+		}
+		if len(files) > 0 {
+			if m.Attachments, keys, err = storeTicketAttachments(r.Context(), tx, id, &messageID, t.IDUtilisateur, files); err != nil {
+				return err
+			}
+		}
+		status = support.AfterReply(t.Statut, false)
+		return setTicketStatus(tx, t, status)
+	}()
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		discardBlobs(keys)
+		writeAppError(w, err, "inbound ticket email")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if messageID == 0 {
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "duplicate", "ticketId": id})
+		return
+	}
+	authorID := 0
+	if t.IDUtilisateur != nil {
+		authorID = *t.IDUtilisateur
+	}
+	notifyTicketReply(t, false, authorID)
+	m.ID, m.IDAuteur = messageID, t.IDUtilisateur
+	publishTicketEvent(realtime.EventTicketMessage, ticketMessageEvent{id, status, m}, authorID, t.IDUtilisateur, t.IDAssigne)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "created", "ticketId": id, "messageId": messageID,
+		"attachments": len(files), "skippedAttachments": skipped,
+	})
+}
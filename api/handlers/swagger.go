@@ -18,13 +18,13 @@ func tagForPath(path string) string {
 	case "login":                    return "Auth"
 	case "users", "user":            return "Users"
 	case "categories", "web-categories": return "Categories"
-	case "produits", "web-products": return "Products"
+	case "produits", "web-products", "legacy": return "Products"
 	case "carousel-images":          return "Carousel"
 	case "tarifications":            return "Tarification"
 	case "entreprises":              return "Entreprises"
-	case "abonnements", "commandes", "factures", "paiements": return "Billing"
+	case "abonnements", "mes-abonnements", "usage", "devis", "mes-devis", "commandes", "factures", "paiements": return "Billing"
 	case "tickets":                  return "Support"
-	case "notifications":            return "Notifications"
+	case "notifications", "stream":  return "Notifications"
 	case "api-tokens":               return "API Tokens"
 	case "public":                   return "Public"
 	case "webauthn":                 return "2FA / WebAuthn"
@@ -41,6 +41,8 @@ func isPublicRoute(path, method string) bool {
 		"GET /api/public/categories":      true,
 		"GET /api/public/products/{slug}": true,
 		"GET /api/swagger.json":           true,
+		"GET /media/":                     true,
+		"POST /api/support/inbound-email": true,
 	}
 	return pub[method+" "+path]
 }
@@ -71,6 +73,73 @@ func summaryForRoute(method, path string) string {
 		"POST /api/produits":                   "Créer un produit",
 		"PUT /api/produits/{id}":               "Mettre à jour un produit",
 		"DELETE /api/produits/{id}":            "Supprimer un produit",
+		"GET /api/admin/produits/search":       "Recherche produits (administration)",
+		"GET /api/public/search":               "Recherche plein texte et navigation à facettes des produits",
+		"GET /api/public/search/suggest":       "Autocomplétion (produits et catégories)",
+		"GET /api/admin/search/top-queries":    "Rapport : requêtes les plus fréquentes",
+		"GET /api/admin/search/zero-results":   "Rapport : requêtes sans résultat",
+		"GET /api/admin/produits/{id}/variants": "Options et variantes d'un produit",
+		"POST /api/admin/produits/{id}/options": "Ajouter une option produit",
+		"DELETE /api/admin/produits/{id}/options/{optionId}": "Supprimer une option produit",
+		"POST /api/admin/produits/{id}/variants": "Créer une variante (SKU, prix par période)",
+		"PUT /api/admin/produits/{id}/variants/{variantId}": "Mettre à jour une variante",
+		"DELETE /api/admin/produits/{id}/variants/{variantId}": "Désactiver une variante",
+		"GET /api/public/packs":                "Packs (offres groupées) en vente",
+		"GET /api/public/packs/{slug}":         "Détails d'un pack",
+		"GET /api/admin/packs":                 "Liste des packs (administration)",
+		"POST /api/admin/packs":                "Créer un pack (prix fixe ou remise)",
+		"PUT /api/admin/packs/{id}":            "Mettre à jour un pack",
+		"DELETE /api/admin/packs/{id}":         "Désactiver un pack",
+		"GET /api/admin/catalog/drafts":        "Liste des brouillons du catalogue",
+		"POST /api/admin/catalog/drafts":       "Créer un brouillon (produit ou catégorie)",
+		"GET /api/admin/catalog/drafts/{id}":   "Détails d'un brouillon",
+		"PUT /api/admin/catalog/drafts/{id}":   "Modifier ou planifier un brouillon",
+		"DELETE /api/admin/catalog/drafts/{id}": "Annuler un brouillon",
+		"POST /api/admin/catalog/drafts/{id}/publish": "Publier un brouillon immédiatement",
+		"POST /api/admin/catalog/drafts/{id}/preview": "Générer un jeton de prévisualisation",
+		"GET /api/public/catalog/preview":      "Prévisualiser un brouillon (jeton signé)",
+		"GET /api/admin/catalog/export":        "Exporter le catalogue (CSV ou JSON)",
+		"POST /api/admin/catalog/import":       "Importer le catalogue (CSV ou JSON, dry-run)",
+		"GET /api/admin/catalog/history":       "Dernières modifications du catalogue",
+		"GET /api/admin/catalog/history/{type}/{id}": "Versions d'un contenu du catalogue avec diff",
+		"GET /api/admin/catalog/history/{type}/{id}/versions/{version}": "Instantané d'une version et diff",
+		"POST /api/admin/catalog/history/{type}/{id}/versions/{version}/restore": "Restaurer une version",
+		"GET /api/admin/catalog/translations/{type}/{id}": "Contenu français et traductions d'un contenu",
+		"PUT /api/admin/catalog/translations/{type}/{id}/{lang}": "Enregistrer la traduction d'un contenu",
+		"DELETE /api/admin/catalog/translations/{type}/{id}/{lang}": "Supprimer la traduction d'un contenu",
+		"GET /api/admin/media":                 "Liste des médias téléversés",
+		"POST /api/admin/media":                "Téléverser une image (déclinaisons et WebP)",
+		"GET /api/admin/media/{id}":            "Détails d'un média",
+		"DELETE /api/admin/media/{id}":         "Supprimer un média inutilisé",
+		"GET /media/":                          "Fichiers médias (stockage local)",
+		"GET /api/tickets":                     "Mes tickets support",
+		"POST /api/tickets":                    "Ouvrir un ticket support",
+		"GET /api/tickets/{id}":                "Ticket et échanges (notes internes pour le personnel)",
+		"PUT /api/tickets/{id}":                "Statut, priorité, catégorie et affectation d'un ticket",
+		"DELETE /api/tickets/{id}":             "Supprimer un ticket (admin)",
+		"POST /api/tickets/{id}/messages":      "Répondre à un ticket ou ajouter une note interne",
+		"GET /api/tickets/{id}/attachments/{attachmentId}": "Télécharger une pièce jointe",
+		"GET /api/admin/tickets":               "File d'attente du support (statut, affectation, ancienneté)",
+		"POST /api/support/inbound-email":      "Réponse à un ticket reçue par email (relais, MIME brut)",
+		"GET /api/admin/support/sla/policies":  "Politiques SLA par niveau d'abonnement",
+		"PUT /api/admin/support/sla/policies/{tier}": "Créer ou modifier une politique SLA",
+		"GET /api/admin/support/sla/report":    "Respect des SLA par client et par mois",
+		"GET /api/stream":                      "Flux temps réel (Server-Sent Events, Last-Event-ID)",
+		"GET /api/notifications":               "Mes notifications (non lues, type, pagination)",
+		"POST /api/notifications":              "Envoyer une notification à un utilisateur (admin)",
+		"GET /api/notifications/unread-count":  "Nombre de notifications non lues par type",
+		"POST /api/notifications/read-all":     "Tout marquer comme lu",
+		"GET /api/notifications/preferences":   "Préférences de notification par type",
+		"PUT /api/notifications/preferences":   "Modifier les préférences de notification",
+		"GET /api/notifications/devices":       "Appareils mobiles enregistrés pour les pushs",
+		"POST /api/notifications/devices":      "Enregistrer le jeton push d'un appareil (Expo)",
+		"DELETE /api/notifications/devices/{id}": "Retirer un appareil des pushs",
+		"GET /api/notifications/{id}":          "Détails d'une notification",
+		"PUT /api/notifications/{id}":          "Marquer une notification lue ou non lue",
+		"DELETE /api/notifications/{id}":       "Supprimer une notification",
+		"POST /api/notifications/{id}/read":    "Marquer une notification comme lue",
+		"GET /api/legacy/produits":             "Correspondance produits legacy → catalogue (déprécié)",
+		"GET /api/legacy/produits/{id}":        "Résoudre un identifiant produit legacy (déprécié)",
 		"GET /api/tarifications":               "Liste des tarifications",
 		"POST /api/tarifications":              "Créer une tarification",
 		"GET /api/tarifications/{id}":          "Détails d'une tarification",
@@ -95,6 +164,23 @@ func summaryForRoute(method, path string) string {
 		"GET /api/abonnements/{id}":            "Détails d'un abonnement",
 		"PUT /api/abonnements/{id}":            "Mettre à jour un abonnement",
 		"DELETE /api/abonnements/{id}":         "Supprimer un abonnement",
+		"POST /api/mes-abonnements/{id}/change/preview": "Aperçu d'un changement de formule (prorata)",
+		"POST /api/mes-abonnements/{id}/change":         "Changer de formule (postes / tarification)",
+		"GET /api/mes-abonnements/{id}/usage":           "Usage de la période en cours et historique",
+		"POST /api/usage/events":                        "Ingestion d'événements d'usage (clé API)",
+		"POST /api/devis":                               "Demander un devis (besoin)",
+		"GET /api/mes-devis":                            "Mes devis",
+		"GET /api/mes-devis/{id}":                       "Détails d'un devis",
+		"GET /api/mes-devis/{id}/pdf":                   "Télécharger un devis (PDF)",
+		"POST /api/mes-devis/{id}/accept":               "Accepter un devis (commande + abonnement)",
+		"POST /api/mes-devis/{id}/refuse":               "Refuser un devis",
+		"GET /api/admin/devis":                          "Liste des devis (commerciaux)",
+		"POST /api/admin/devis":                         "Rédiger un devis pour un client",
+		"GET /api/admin/devis/{id}":                     "Détails d'un devis (commerciaux)",
+		"PUT /api/admin/devis/{id}":                     "Chiffrer / modifier un devis",
+		"DELETE /api/admin/devis/{id}":                  "Annuler un devis",
+		"POST /api/admin/devis/{id}/send":               "Envoyer un devis par email (PDF)",
+		"GET /api/admin/devis/{id}/pdf":                 "Aperçu PDF d'un devis",
 		"GET /api/commandes":                   "Liste des commandes",
 		"POST /api/commandes":                  "Créer une commande",
 		"GET /api/commandes/{id}":              "Détails d'une commande",
@@ -119,6 +205,14 @@ func summaryForRoute(method, path string) string {
 	return method + " " + path
 }
 
+// isDeprecatedRoute signale les alias du double catalogue conservés pendant la dépréciation.
+func isDeprecatedRoute(path string) bool {
+	for _, prefix := range []string{"/api/web-categories", "/api/web-products", "/api/legacy/"} {
+		if strings.HasPrefix(path, prefix) { return true }
+	}
+	return false
+}
+
 func GetSwaggerSpec(w http.ResponseWriter, r *http.Request) {
 	paths := map[string]interface{}{}
 
@@ -156,6 +250,7 @@ func GetSwaggerSpec(w http.ResponseWriter, r *http.Request) {
 					},
 				}
 				if len(params) > 0 { op["parameters"] = params }
+				if isDeprecatedRoute(path) { op["deprecated"] = true }
 				if !isPublicRoute(path, method) {
 					op["security"] = []interface{}{map[string]interface{}{"BearerAuth": []interface{}{}}}
 				}
@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"api/billing"
+	"api/config"
+	"api/models"
+)
+
+// ===== USAGE (agents de sécurité managée) =====
+
+const maxUsageBatch = 1000
+
+type usageEvent struct {
+	SubscriptionID int       `json:"subscriptionId"`
+	Metric         string    `json:"metric"`
+	Quantity       float64   `json:"quantity"`
+	Timestamp      time.Time `json:"timestamp"`
+	IdempotencyKey string    `json:"idempotencyKey"`
+}
+
+type usageRejection struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// IngestUsage enregistre un lot d'événements d'usage (clé API avec la permission "usage").
+// Chaque événement est idempotent via (subscriptionId, idempotencyKey) et agrégé dans la
+// période de facturation correspondant à son horodatage.
+func IngestUsage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := getUserID(r)
+	if !ok {
+		jsonErr(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	tokenID, _ := r.Context().Value(models.APITokenIDKey).(int)
+
+	var body struct {
+		Events []usageEvent `json:"events"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.Events) == 0 {
+		jsonErr(w, "events required", http.StatusBadRequest)
+		return
+	}
+	if len(body.Events) > maxUsageBatch {
+		jsonErr(w, "Too many events (max "+strconv.Itoa(maxUsageBatch)+")", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	admin := userHasRole(userID, "admin")
+	var companyID int
+	config.DB.QueryRow("SELECT COALESCE(id_entreprise, 0) FROM utilisateur WHERE id_utilisateur = $1", userID).Scan(&companyID)
+
+	accepted, duplicates := 0, 0
+	rejected := []usageRejection{}
+	now := time.Now()
+	for i, ev := range body.Events {
+		dup, msg := recordUsageEvent(ev, admin, companyID, tokenID, now)
+		switch {
+		case msg != "":
+			rejected = append(rejected, usageRejection{Index: i, Error: msg})
+		case dup:
+			duplicates++
+		default:
+			accepted++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"accepted":   accepted,
+		"duplicates": duplicates,
+		"rejected":   rejected,
+	})
+}
+
+// recordUsageEvent insère un événement et met à jour l'agrégat de sa période dans
+// une même transaction. Retourne un message non vide si l'événement est refusé.
+func recordUsageEvent(ev usageEvent, admin bool, companyID, tokenID int, now time.Time) (duplicate bool, rejection string) {
+	if ev.SubscriptionID == 0 || ev.IdempotencyKey == "" || len(ev.IdempotencyKey) > 255 {
+		return false, "subscriptionId and idempotencyKey (max 255) are required"
+	}
+	if ev.Quantity < 0 {
+		return false, "quantity must be positive"
+	}
+	if ev.Timestamp.IsZero() {
+		ev.Timestamp = now
+	}
+	if ev.Timestamp.After(now.Add(billing.MaxUsageLead)) {
+		return false, "timestamp is in the future"
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return false, "internal error"
+	}
+	defer tx.Rollback()
+
+	var subCompany int
+	var statut, unite, periodicite string
+	var dateDebut time.Time
+	var dateFin sql.NullTime
+	var prixUsage sql.NullFloat64
+	err = tx.QueryRow(`
+		SELECT a.id_entreprise, COALESCE(a.statut, ''), a.date_debut, a.date_fin,
+		       COALESCE(t.unite, ''), COALESCE(t.periodicite, 'mensuel'), t.prix_usage
+		FROM abonnement a
+		JOIN tarification t ON t.id_tarification = a.id_tarification
+		WHERE a.id_abonnement = $1`, ev.SubscriptionID).Scan(
+		&subCompany, &statut, &dateDebut, &dateFin, &unite, &periodicite, &prixUsage)
+	if err != nil || (!admin && subCompany != companyID) {
+		return false, "subscription not found"
+	}
+	if !prixUsage.Valid {
+		return false, "subscription is not usage-based"
+	}
+	if statut == billing.StatutResilie || !dateFin.Valid {
+		return false, "subscription is not active"
+	}
+	metric := billing.NormalizeMetric(unite)
+	if ev.Metric != "" && billing.NormalizeMetric(ev.Metric) != metric {
+		return false, "unknown metric for this subscription (expected " + metric + ")"
+	}
+	debut, fin, ok := billing.UsagePeriod(dateDebut, dateFin.Time, periodicite, ev.Timestamp)
+	if !ok {
+		return false, "timestamp outside an open billing period"
+	}
+
+	var tokenRef interface{}
+	if tokenID != 0 {
+		tokenRef = tokenID
+	}
+	res, err := tx.Exec(`
+		INSERT INTO usage_evenement (id_abonnement, metrique, quantite, horodatage, cle_idempotence, id_token)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id_abonnement, cle_idempotence) DO NOTHING`,
+		ev.SubscriptionID, metric, ev.Quantity, ev.Timestamp, ev.IdempotencyKey, tokenRef)
+	if err != nil {
+		log.Printf("usage insert error (abonnement %d): %v", ev.SubscriptionID, err)
+		return false, "internal error"
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return true, ""
+	}
+
+	res, err = tx.Exec(`
+		INSERT INTO usage_periode (id_abonnement, metrique, periode_debut, periode_fin, total, maximum, nb_evenements)
+		VALUES ($1, $2, $3, $4, $5, $5, 1)
+		ON CONFLICT (id_abonnement, metrique, periode_fin) DO UPDATE
+		SET total = usage_periode.total + EXCLUDED.total,
+		    maximum = GREATEST(usage_periode.maximum, EXCLUDED.maximum),
+		    nb_evenements = usage_periode.nb_evenements + 1,
+		    date_maj = NOW()
+		WHERE usage_periode.statut = 'ouvert'`,
+		ev.SubscriptionID, metric, debut, fin, ev.Quantity)
+	if err != nil {
+		log.Printf("usage aggregate error (abonnement %d): %v", ev.SubscriptionID, err)
+		return false, "internal error"
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, "billing period already invoiced"
+	}
+	if err := tx.Commit(); err != nil {
+		return false, "internal error"
+	}
+	return false, ""
+}
+
+type usagePeriodView struct {
+	PeriodStart time.Time  `json:"periodStart"`
+	PeriodEnd   time.Time  `json:"periodEnd"`
+	Metric      string     `json:"metric"`
+	Aggregation string     `json:"aggregation"`
+	Quantity    float64    `json:"quantity"`
+	UnitPrice   float64    `json:"unitPrice"`
+	Amount      float64    `json:"amount"`
+	Events      int        `json:"events"`
+	Status      string     `json:"status"` // ouvert | facture
+	InvoiceID   *int       `json:"invoiceId,omitempty"`
+	UpdatedAt   *time.Time `json:"updatedAt,omitempty"`
+}
+
+// GetMyUsage retourne l'usage de la période en cours et l'historique des périodes
+// d'un abonnement de l'entreprise de l'utilisateur.
+func GetMyUsage(w http.ResponseWriter, r *http.Request) {
+	subID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		jsonErr(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	userID, ok := getUserID(r)
+	if !ok {
+		jsonErr(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var companyID int
+	config.DB.QueryRow("SELECT COALESCE(id_entreprise, 0) FROM utilisateur WHERE id_utilisateur = $1", userID).Scan(&companyID)
+
+	var unite, periodicite, agregation string
+	var dateDebut time.Time
+	var dateFin sql.NullTime
+	var prixUsage sql.NullFloat64
+	err = config.DB.QueryRow(`
+		SELECT a.date_debut, a.date_fin, COALESCE(t.unite, ''), COALESCE(t.periodicite, 'mensuel'),
+		       COALESCE(t.agregation, 'sum'), t.prix_usage
+		FROM abonnement a
+		JOIN tarification t ON t.id_tarification = a.id_tarification
+		WHERE a.id_abonnement = $1 AND a.id_entreprise = $2`, subID, companyID).Scan(
+		&dateDebut, &dateFin, &unite, &periodicite, &agregation, &prixUsage)
+	if err != nil {
+		jsonErr(w, "Abonnement introuvable ou non autorisé", http.StatusNotFound)
+		return
+	}
+	if !prixUsage.Valid {
+		jsonErr(w, "Abonnement non facturé à l'usage", http.StatusNotFound)
+		return
+	}
+	metric := billing.NormalizeMetric(unite)
+
+	rows, err := config.DB.Query(`
+		SELECT periode_debut, periode_fin, total, maximum, nb_evenements, statut, id_facture, date_maj
+		FROM usage_periode
+		WHERE id_abonnement = $1 AND metrique = $2
+		ORDER BY periode_fin DESC LIMIT 12`, subID, metric)
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	periods := []usagePeriodView{}
+	for rows.Next() {
+		var p usagePeriodView
+		var total, maximum float64
+		if err := rows.Scan(&p.PeriodStart, &p.PeriodEnd, &total, &maximum, &p.Events, &p.Status, &p.InvoiceID, &p.UpdatedAt); err != nil {
+			continue
+		}
+		p.Metric, p.Aggregation, p.UnitPrice = metric, agregation, prixUsage.Float64
+		p.Quantity = billing.UsageQuantity(agregation, total, maximum)
+		p.Amount = billing.UsageAmount(p.Quantity, prixUsage.Float64)
+		periods = append(periods, p)
+	}
+
+	// Période en cours (éventuellement sans événement encore).
+	current := usagePeriodView{Metric: metric, Aggregation: agregation, UnitPrice: prixUsage.Float64, Status: "ouvert"}
+	if dateFin.Valid {
+		if start, end, ok := billing.UsagePeriod(dateDebut, dateFin.Time, periodicite, time.Now()); ok {
+			current.PeriodStart, current.PeriodEnd = start, end
+			for _, p := range periods {
+				if p.PeriodEnd.Equal(end) {
+					current = p
+				}
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"subscriptionId": subID,
+		"current":        current,
+		"periods":        periods,
+	})
+}
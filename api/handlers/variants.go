@@ -0,0 +1,681 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"api/billing"
+	"api/cache"
+	"api/catalog"
+	"api/config"
+	apierrors "api/errors"
+	mw "api/middleware"
+	"api/models"
+)
+
+// ===== PRODUITS — OPTIONS ET VARIANTES =====
+//
+// Un produit à options (ex. SOC managé : endpoints × rétention × support) est vendu
+// par variante : chaque variante a son SKU, sa disponibilité et ses prix par période
+// (tarifications rattachées via id_variante).
+
+// loadVariantMatrix charge les options d'un produit et ses variantes avec leurs prix.
+// all = false : variantes et prix actifs uniquement (vitrine).
+func loadVariantMatrix(q dbQuerier, productID int, all bool) ([]models.ProduitOption, []models.ProduitVariante, error) {
+	options := []models.ProduitOption{}
+	rows, err := q.Query(`
+		SELECT o.id_option, o.code, o.nom, COALESCE(o.ordre,0),
+		       v.id_valeur, v.code, v.libelle, COALESCE(v.ordre,0)
+		FROM produit_option o
+		LEFT JOIN produit_option_valeur v ON v.id_option = o.id_option
+		WHERE o.id_produit = $1
+		ORDER BY o.ordre, o.id_option, v.ordre, v.id_valeur`, productID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for rows.Next() {
+		var o models.ProduitOption
+		var vID, vOrdre sql.NullInt64
+		var vCode, vLibelle sql.NullString
+		if err := rows.Scan(&o.ID, &o.Code, &o.Nom, &o.Ordre, &vID, &vCode, &vLibelle, &vOrdre); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		if n := len(options); n == 0 || options[n-1].ID != o.ID {
+			o.Valeurs = []models.OptionValeur{}
+			options = append(options, o)
+		}
+		if vID.Valid {
+			last := &options[len(options)-1]
+			last.Valeurs = append(last.Valeurs, models.OptionValeur{
+				ID: int(vID.Int64), Code: vCode.String, Libelle: vLibelle.String, Ordre: int(vOrdre.Int64)})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	variants := []models.ProduitVariante{}
+	index := map[int]int{}
+	rows, err = q.Query(`
+		SELECT id_variante, id_produit, sku, nom, disponibilite, COALESCE(actif,false), COALESCE(ordre,0)
+		FROM produit_variante
+		WHERE id_produit = $1 AND (actif = TRUE OR $2)
+		ORDER BY ordre, id_variante`, productID, all)
+	if err != nil {
+		return nil, nil, err
+	}
+	for rows.Next() {
+		v := models.ProduitVariante{Options: map[string]string{}, Prix: []models.Tarification{}}
+		if err := rows.Scan(&v.ID, &v.IDProduit, &v.SKU, &v.Nom, &v.Disponibilite, &v.Actif, &v.Ordre); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		index[v.ID] = len(variants)
+		variants = append(variants, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(variants) == 0 {
+		return options, variants, err
+	}
+
+	rows, err = q.Query(`
+		SELECT vv.id_variante, o.code, v.code
+		FROM produit_variante_valeur vv
+		JOIN produit_option_valeur v ON v.id_valeur = vv.id_valeur
+		JOIN produit_option o ON o.id_option = v.id_option
+		WHERE o.id_produit = $1`, productID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for rows.Next() {
+		var id int
+		var opt, val string
+		if err := rows.Scan(&id, &opt, &val); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		if i, ok := index[id]; ok {
+			variants[i].Options[opt] = val
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	rows, err = q.Query(`
+		SELECT id_tarification, COALESCE(prix,0), COALESCE(unite,''), COALESCE(periodicite,''), COALESCE(actif,false),
+		       id_produit, prix_usage, COALESCE(agregation,'sum'), id_variante
+		FROM tarification
+		WHERE id_produit = $1 AND id_variante IS NOT NULL AND (actif = TRUE OR $2)
+		ORDER BY prix ASC, id_tarification ASC`, productID, all)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t models.Tarification
+		if err := rows.Scan(&t.ID, &t.Prix, &t.Unite, &t.Periodicite, &t.Actif, &t.IDProduit, &t.PrixUsage, &t.Agregation, &t.IDVariante); err != nil {
+			return nil, nil, err
+		}
+		if i, ok := index[*t.IDVariante]; ok {
+			variants[i].Prix = append(variants[i].Prix, t)
+		}
+	}
+	return options, variants, rows.Err()
+}
+
+// GetAdminProduitVariants : matrice complète d'un produit, variantes et prix inactifs compris.
+func GetAdminProduitVariants(w http.ResponseWriter, r *http.Request) {
+	productID, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	options, variants, err := loadVariantMatrix(config.DB, productID, true)
+	if err != nil {
+		writeAppError(w, err, "load variants")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"options": options, "variants": variants})
+}
+
+type optionReq struct {
+	Code    string `json:"code"`
+	Nom     string `json:"name"`
+	Ordre   int    `json:"order"`
+	Valeurs []struct {
+		Code    string `json:"code"`
+		Libelle string `json:"label"`
+		Ordre   int    `json:"order"`
+	} `json:"values"`
+}
+
+// CreateProduitOption ajoute une option et ses valeurs. Refusé tant que le produit a des
+// variantes actives : elles n'auraient pas de valeur pour la nouvelle option.
+func CreateProduitOption(w http.ResponseWriter, r *http.Request) {
+	productID, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	var req optionReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Code = strings.TrimSpace(req.Code)
+	req.Nom = mw.SanitizeString(strings.TrimSpace(req.Nom))
+	if !catalog.ValidCode(req.Code) || req.Nom == "" || len(req.Valeurs) == 0 {
+		jsonErr(w, "code (a-z, 0-9, - ou _), name and at least one value are required", http.StatusBadRequest)
+		return
+	}
+	seen := map[string]bool{}
+	for i := range req.Valeurs {
+		v := &req.Valeurs[i]
+		v.Code = strings.TrimSpace(v.Code)
+		v.Libelle = mw.SanitizeString(strings.TrimSpace(v.Libelle))
+		if !catalog.ValidCode(v.Code) || v.Libelle == "" || seen[v.Code] {
+			jsonErr(w, "Each value needs a unique code (a-z, 0-9, - ou _) and a label", http.StatusBadRequest)
+			return
+		}
+		seen[v.Code] = true
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	err = func() error {
+		userID, _ := getUserID(r)
+		if err := setActor(tx, userID); err != nil {
+			return err
+		}
+		if err := lockProduit(tx, productID); err != nil {
+			return err
+		}
+		var active int
+		tx.QueryRow("SELECT COUNT(*) FROM produit_variante WHERE id_produit = $1 AND actif = TRUE", productID).Scan(&active)
+		if active > 0 {
+			return apierrors.NewConflict("Deactivate the product variants before adding an option")
+		}
+		var optionID int
+		err := tx.QueryRow(`
+			INSERT INTO produit_option (id_produit, code, nom, ordre) VALUES ($1,$2,$3,$4)
+			ON CONFLICT (id_produit, code) DO NOTHING RETURNING id_option`,
+			productID, req.Code, req.Nom, req.Ordre).Scan(&optionID)
+		if err == sql.ErrNoRows {
+			return apierrors.NewConflict("Option code already exists for this product")
+		}
+		if err != nil {
+			return err
+		}
+		for _, v := range req.Valeurs {
+			if _, err := tx.Exec("INSERT INTO produit_option_valeur (id_option, code, libelle, ordre) VALUES ($1,$2,$3,$4)",
+				optionID, v.Code, v.Libelle, v.Ordre); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	}()
+	if err != nil {
+		writeAppError(w, err, "create option")
+		return
+	}
+	cache.InvalidateProduits()
+	respondVariantMatrix(w, productID, http.StatusCreated)
+}
+
+// DeleteProduitOption supprime une option qu'aucune variante n'utilise.
+func DeleteProduitOption(w http.ResponseWriter, r *http.Request) {
+	productID, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	optionID, ok := intParam(w, r, "optionId")
+	if !ok {
+		return
+	}
+	var used bool
+	config.DB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM produit_variante_valeur vv
+		              JOIN produit_option_valeur v ON v.id_valeur = vv.id_valeur
+		              WHERE v.id_option = $1)`, optionID).Scan(&used)
+	if used {
+		jsonErr(w, "Option used by variants", http.StatusConflict)
+		return
+	}
+	res, err := config.DB.Exec("DELETE FROM produit_option WHERE id_option = $1 AND id_produit = $2", optionID, productID)
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		jsonErr(w, "Option not found", http.StatusNotFound)
+		return
+	}
+	cache.InvalidateProduits()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type variantPriceReq struct {
+	Prix        float64 `json:"price"`
+	Unite       string  `json:"unit"`
+	Periodicite string  `json:"periodicity"`
+}
+
+type variantReq struct {
+	SKU           string            `json:"sku"`
+	Nom           string            `json:"name"`
+	Disponibilite string            `json:"availability"`
+	Ordre         int               `json:"order"`
+	Actif         *bool             `json:"active"`
+	Options       map[string]string `json:"options"`
+	Prix          []variantPriceReq `json:"prices"`
+}
+
+func (req *variantReq) validate(creating bool) error {
+	req.Nom = mw.SanitizeString(strings.TrimSpace(req.Nom))
+	if creating {
+		req.SKU = catalog.NormalizeSKU(req.SKU)
+		if !catalog.ValidSKU(req.SKU) {
+			return apierrors.NewValidation("sku must be 3-40 characters (A-Z, 0-9, - or _)")
+		}
+		if req.Disponibilite == "" {
+			req.Disponibilite = catalog.DisponibiliteDisponible
+		}
+		if len(req.Prix) == 0 {
+			return apierrors.NewValidation("At least one price is required")
+		}
+		if req.Nom == "" {
+			return apierrors.NewValidation("name is required")
+		}
+	}
+	if req.Disponibilite != "" && !catalog.ValidDisponibilite(req.Disponibilite) {
+		return apierrors.NewValidation("availability must be disponible, sur_devis or indisponible")
+	}
+	for i := range req.Prix {
+		p := &req.Prix[i]
+		p.Periodicite = strings.ToLower(strings.TrimSpace(p.Periodicite))
+		if p.Periodicite == "" {
+			p.Periodicite = "mensuel"
+		}
+		if p.Prix < 0 {
+			return apierrors.NewValidation("Price cannot be negative")
+		}
+		for _, prev := range req.Prix[:i] {
+			if billing.SamePeriod(prev.Periodicite, p.Periodicite) {
+				return apierrors.NewValidation("Only one price per periodicity")
+			}
+		}
+	}
+	return nil
+}
+
+// lockProduit verrouille le produit : les modifications de sa matrice sont sérialisées.
+func lockProduit(tx *sql.Tx, productID int) error {
+	var id int
+	err := tx.QueryRow("SELECT id_produit FROM produits WHERE id_produit = $1 FOR UPDATE", productID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return apierrors.NewNotFound("Product not found")
+	}
+	return err
+}
+
+func respondVariantMatrix(w http.ResponseWriter, productID, status int) {
+	options, variants, err := loadVariantMatrix(config.DB, productID, true)
+	if err != nil {
+		writeAppError(w, err, "load variants")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"options": options, "variants": variants})
+}
+
+// CreateProduitVariant crée une variante : SKU unique, une valeur par option, prix par période.
+func CreateProduitVariant(w http.ResponseWriter, r *http.Request) {
+	productID, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	var req variantReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(true); err != nil {
+		writeAppError(w, err, "create variant")
+		return
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	err = func() error {
+		userID, _ := getUserID(r)
+		if err := setActor(tx, userID); err != nil {
+			return err
+		}
+		if err := lockProduit(tx, productID); err != nil {
+			return err
+		}
+		options, _, err := loadVariantMatrix(tx, productID, false)
+		if err != nil {
+			return err
+		}
+		defs := make([]catalog.OptionDef, 0, len(options))
+		valueIDs := map[string]int{}
+		for _, o := range options {
+			d := catalog.OptionDef{Code: o.Code}
+			for _, v := range o.Valeurs {
+				d.Values = append(d.Values, v.Code)
+				valueIDs[o.Code+"="+v.Code] = v.ID
+			}
+			defs = append(defs, d)
+		}
+		if err := catalog.CheckCombination(defs, req.Options); err != nil {
+			return apierrors.NewValidation(err.Error())
+		}
+
+		var variantID int
+		err = tx.QueryRow(`
+			INSERT INTO produit_variante (id_produit, sku, nom, combinaison, disponibilite, actif, ordre)
+			VALUES ($1,$2,$3,$4,$5,$6,$7)
+			ON CONFLICT DO NOTHING RETURNING id_variante`,
+			productID, req.SKU, req.Nom, catalog.CombinationKey(req.Options), req.Disponibilite,
+			req.Actif == nil || *req.Actif, req.Ordre).Scan(&variantID)
+		if err == sql.ErrNoRows {
+			var skuTaken bool
+			tx.QueryRow("SELECT EXISTS(SELECT 1 FROM produit_variante WHERE sku = $1)", req.SKU).Scan(&skuTaken)
+			if skuTaken {
+				return apierrors.NewConflict("SKU already exists")
+			}
+			return apierrors.NewConflict("An active variant already uses this combination")
+		}
+		if err != nil {
+			return err
+		}
+		for code, value := range req.Options {
+			if _, err := tx.Exec("INSERT INTO produit_variante_valeur (id_variante, id_valeur) VALUES ($1,$2)",
+				variantID, valueIDs[code+"="+value]); err != nil {
+				return err
+			}
+		}
+		if err := syncVariantPrices(tx, productID, variantID, req.Prix); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}()
+	if err != nil {
+		writeAppError(w, err, "create variant")
+		return
+	}
+	cache.InvalidateProduits()
+	cache.InvalidateTarifications()
+	respondVariantMatrix(w, productID, http.StatusCreated)
+}
+
+// UpdateProduitVariant modifie nom, disponibilité, ordre, activation et, si fournis, les prix.
+// La combinaison et le SKU sont figés : ils sont référencés par les commandes.
+func UpdateProduitVariant(w http.ResponseWriter, r *http.Request) {
+	productID, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	variantID, ok := intParam(w, r, "variantId")
+	if !ok {
+		return
+	}
+	var req variantReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(false); err != nil {
+		writeAppError(w, err, "update variant")
+		return
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	err = func() error {
+		userID, _ := getUserID(r)
+		if err := setActor(tx, userID); err != nil {
+			return err
+		}
+		if err := lockProduit(tx, productID); err != nil {
+			return err
+		}
+		var combinaison string
+		var actif bool
+		err := tx.QueryRow("SELECT combinaison, COALESCE(actif,false) FROM produit_variante WHERE id_variante = $1 AND id_produit = $2",
+			variantID, productID).Scan(&combinaison, &actif)
+		if err == sql.ErrNoRows {
+			return apierrors.NewNotFound("Variant not found")
+		}
+		if err != nil {
+			return err
+		}
+		if req.Actif != nil && *req.Actif && !actif {
+			var taken bool
+			tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM produit_variante
+			             WHERE id_produit = $1 AND combinaison = $2 AND actif = TRUE)`, productID, combinaison).Scan(&taken)
+			if taken {
+				return apierrors.NewConflict("An active variant already uses this combination")
+			}
+		}
+		if _, err := tx.Exec(`
+			UPDATE produit_variante SET
+			    nom = COALESCE(NULLIF($1,''), nom),
+			    disponibilite = COALESCE(NULLIF($2,''), disponibilite),
+			    ordre = $3,
+			    actif = COALESCE($4, actif),
+			    date_modification = CURRENT_TIMESTAMP
+			WHERE id_variante = $5`, req.Nom, req.Disponibilite, req.Ordre, req.Actif, variantID); err != nil {
+			return err
+		}
+		if req.Actif != nil && !*req.Actif {
+			if _, err := tx.Exec("UPDATE tarification SET actif = FALSE WHERE id_variante = $1", variantID); err != nil {
+				return err
+			}
+		} else if len(req.Prix) > 0 {
+			if err := syncVariantPrices(tx, productID, variantID, req.Prix); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	}()
+	if err != nil {
+		writeAppError(w, err, "update variant")
+		return
+	}
+	cache.InvalidateProduits()
+	cache.InvalidateTarifications()
+	respondVariantMatrix(w, productID, http.StatusOK)
+}
+
+// DeleteProduitVariant retire une variante de la vente (désactivation, prix compris) ;
+// les abonnements en cours conservent leur tarification.
+func DeleteProduitVariant(w http.ResponseWriter, r *http.Request) {
+	productID, ok := intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	variantID, ok := intParam(w, r, "variantId")
+	if !ok {
+		return
+	}
+	res, err := config.DB.Exec(`UPDATE produit_variante SET actif = FALSE, date_modification = CURRENT_TIMESTAMP
+		WHERE id_variante = $1 AND id_produit = $2`, variantID, productID)
+	if err != nil {
+		jsonErr(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		jsonErr(w, "Variant not found", http.StatusNotFound)
+		return
+	}
+	config.DB.Exec("UPDATE tarification SET actif = FALSE WHERE id_variante = $1", variantID)
+	cache.InvalidateProduits()
+	cache.InvalidateTarifications()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// syncVariantPrices aligne les tarifications actives d'une variante sur les prix demandés :
+// mise à jour de la période existante, création sinon, désactivation des périodes absentes.
+func syncVariantPrices(tx *sql.Tx, productID, variantID int, prices []variantPriceReq) error {
+	rows, err := tx.Query("SELECT id_tarification, COALESCE(periodicite,'') FROM tarification WHERE id_variante = $1 AND actif = TRUE", variantID)
+	if err != nil {
+		return err
+	}
+	existing := map[int]string{}
+	for rows.Next() {
+		var id int
+		var periodicite string
+		if err := rows.Scan(&id, &periodicite); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[id] = periodicite
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range prices {
+		matched := 0
+		for id, periodicite := range existing {
+			if billing.SamePeriod(periodicite, p.Periodicite) {
+				matched = id
+				break
+			}
+		}
+		if matched > 0 {
+			delete(existing, matched)
+			if _, err := tx.Exec("UPDATE tarification SET prix = $1, unite = $2 WHERE id_tarification = $3",
+				p.Prix, p.Unite, matched); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := tx.Exec(`INSERT INTO tarification (prix, unite, periodicite, actif, id_produit, agregation, id_variante)
+			VALUES ($1,$2,$3,TRUE,$4,$5,$6)`, p.Prix, p.Unite, p.Periodicite, productID, billing.AgregationSomme, variantID); err != nil {
+			return err
+		}
+	}
+	for id := range existing {
+		if _, err := tx.Exec("UPDATE tarification SET actif = FALSE WHERE id_tarification = $1", id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveOrderItems rattache chaque ligne de commande à sa variante : un produit qui a des
+// variantes actives exige un variant_sku disponible ; la tarification retenue est celle
+// de la période demandée (duration), à défaut la moins chère. Une ligne de pack
+// (bundle_slug) doit désigner un pack actif.
+func resolveOrderItems(q dbQuerier, items []models.OrderItem) error {
+	for i := range items {
+		it := &items[i]
+		if it.BundleSlug != "" {
+			var ok bool
+			if err := q.QueryRow("SELECT EXISTS(SELECT 1 FROM pack WHERE slug = $1 AND actif = TRUE)", it.BundleSlug).Scan(&ok); err != nil {
+				return err
+			}
+			if !ok {
+				return apierrors.NewValidation("Unknown bundle " + it.BundleSlug)
+			}
+			continue
+		}
+		it.VariantSKU = catalog.NormalizeSKU(it.VariantSKU)
+		if it.VariantSKU == "" {
+			var hasVariants bool
+			if err := q.QueryRow(`SELECT EXISTS(SELECT 1 FROM produit_variante v JOIN produits p ON p.id_produit = v.id_produit
+				WHERE p.slug = $1 AND v.actif = TRUE)`, it.ProductSlug).Scan(&hasVariants); err != nil {
+				return err
+			}
+			if hasVariants {
+				return apierrors.NewValidation("variant_sku required for " + it.ProductSlug)
+			}
+			continue
+		}
+
+		var slug, disponibilite string
+		var actif bool
+		err := q.QueryRow(`
+			SELECT v.id_variante, v.nom, v.disponibilite, COALESCE(v.actif,false), p.slug
+			FROM produit_variante v JOIN produits p ON p.id_produit = v.id_produit
+			WHERE v.sku = $1`, it.VariantSKU).Scan(&it.VariantID, &it.VariantName, &disponibilite, &actif, &slug)
+		if err == sql.ErrNoRows {
+			return apierrors.NewValidation("Unknown variant " + it.VariantSKU)
+		}
+		if err != nil {
+			return err
+		}
+		if it.ProductSlug != "" && it.ProductSlug != slug {
+			return apierrors.NewValidation("Variant " + it.VariantSKU + " does not belong to " + it.ProductSlug)
+		}
+		if !actif || disponibilite != catalog.DisponibiliteDisponible {
+			return apierrors.NewConflict("Variant " + it.VariantSKU + " is not available for online purchase")
+		}
+		it.ProductSlug = slug
+
+		tarifID, err := variantTarification(q, it.VariantID, it.Duration)
+		if err != nil {
+			return err
+		}
+		it.TarificationID = tarifID
+	}
+	return nil
+}
+
+// variantTarification retourne la tarification active d'une variante pour une période
+// (libellé libre : "mois", "mensuel", "an"…). Sans période demandée, la moins chère ;
+// une période que la variante ne propose pas est refusée.
+func variantTarification(q dbQuerier, variantID int, periode string) (int, error) {
+	rows, err := q.Query(`SELECT id_tarification, COALESCE(periodicite,'') FROM tarification
+		WHERE id_variante = $1 AND actif = TRUE ORDER BY prix ASC, id_tarification ASC`, variantID)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	first := 0
+	for rows.Next() {
+		var id int
+		var periodicite string
+		if err := rows.Scan(&id, &periodicite); err != nil {
+			return 0, err
+		}
+		if periode != "" && billing.SamePeriod(periodicite, periode) {
+			return id, nil
+		}
+		if first == 0 {
+			first = id
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if first == 0 {
+		return 0, apierrors.NewConflict("Variant has no active price")
+	}
+	if periode != "" {
+		return 0, apierrors.NewConflict("Variant has no active price for duration " + periode)
+	}
+	return first, nil
+}
@@ -0,0 +1,125 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/smtp"
+	"net/textproto"
+	"os"
+)
+
+// Attachment est une pièce jointe d'email.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Send envoie un email HTML via Gmail SMTP (port 587 / STARTTLS).
+// Si SMTP_FROM ou SMTP_PASSWORD est absent, log un avertissement et retourne nil.
+func Send(to, subject, html string) error {
+	return SendWithAttachments(to, subject, html)
+}
+
+// SendWithAttachments envoie un email HTML avec pièces jointes (multipart/mixed).
+func SendWithAttachments(to, subject, html string, attachments ...Attachment) error {
+	return send(to, "", subject, html, attachments)
+}
+
+// SendReplyTo envoie un email HTML dont les réponses sont adressées à replyTo.
+func SendReplyTo(to, replyTo, subject, html string) error {
+	return send(to, replyTo, subject, html, nil)
+}
+
+func send(to, replyTo, subject, html string, attachments []Attachment) error {
+	from := os.Getenv("SMTP_FROM")
+	password := os.Getenv("SMTP_PASSWORD")
+
+	if from == "" || password == "" {
+		log.Printf("[EMAIL-DEV] SMTP_FROM/SMTP_PASSWORD absents — email non envoyé à %s | sujet: %s", to, subject)
+		return nil
+	}
+
+	host := "smtp.gmail.com"
+	msg := buildMessageReplyTo(from, to, replyTo, subject, html, attachments)
+
+	auth := smtp.PlainAuth("", from, password, host)
+	if err := smtp.SendMail(host+":587", auth, from, []string{to}, msg); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return nil
+}
+
+func buildMessage(from, to, subject, html string, attachments []Attachment) []byte {
+	return buildMessageReplyTo(from, to, "", subject, html, attachments)
+}
+
+func buildMessageReplyTo(from, to, replyTo, subject, html string, attachments []Attachment) []byte {
+	var b bytes.Buffer
+	b.WriteString("From: CYNA <" + from + ">\r\n")
+	b.WriteString("To: " + to + "\r\n")
+	if replyTo != "" {
+		b.WriteString("Reply-To: CYNA Support <" + replyTo + ">\r\n")
+	}
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+
+	if len(attachments) == 0 {
+		b.WriteString("Content-Type: text/html; charset=UTF-8\r\n\r\n")
+		b.WriteString(html)
+		return b.Bytes()
+	}
+
+	mw := multipart.NewWriter(&b)
+	b.WriteString("Content-Type: multipart/mixed; boundary=" + mw.Boundary() + "\r\n\r\n")
+
+	part, _ := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/html; charset=UTF-8"}})
+	part.Write([]byte(html))
+
+	for _, a := range attachments {
+		ct := a.ContentType
+		if ct == "" {
+			ct = "application/octet-stream"
+		}
+		part, _ := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {ct},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+		})
+		encoded := base64.StdEncoding.EncodeToString(a.Data)
+		for len(encoded) > 76 {
+			part.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		part.Write([]byte(encoded + "\r\n"))
+	}
+	mw.Close()
+	return b.Bytes()
+}
+
+// Layout habille un contenu HTML avec l'en-tête et le pied de page CYNA
+// utilisés par tous les emails transactionnels.
+func Layout(title, body string) string {
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<body style="font-family:Arial,sans-serif;background:#f5f5f5;margin:0;padding:24px;">
+  <div style="max-width:480px;margin:0 auto;background:#fff;border-radius:12px;overflow:hidden;box-shadow:0 2px 12px rgba(0,0,0,.08);">
+    <div style="background:#3b12a3;padding:28px;text-align:center;">
+      <h1 style="color:#fff;font-size:26px;letter-spacing:4px;margin:0;">CYNA</h1>
+      <p style="color:rgba(255,255,255,.7);margin:8px 0 0;font-size:13px;">Cybersécurité managée pour les PME</p>
+    </div>
+    <div style="padding:32px;">
+      <h2 style="color:#1a1a1a;margin-top:0;">%s</h2>
+      %s
+    </div>
+    <div style="background:#f9f9f9;padding:16px;text-align:center;border-top:1px solid #eee;">
+      <p style="color:#bbb;font-size:11px;margin:0;">© 2025 CYNA — Tous droits réservés</p>
+    </div>
+  </div>
+</body>
+</html>`, title, body)
+}
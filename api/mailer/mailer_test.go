@@ -0,0 +1,83 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestBuildMessage_HTMLOnly(t *testing.T) {
+	msg := buildMessage("noreply@cyna.fr", "client@example.com", "Bienvenue", "<p>Bonjour</p>", nil)
+	m, err := mail.ReadMessage(bytes.NewReader(msg))
+	if err != nil {
+		t.Fatalf("invalid message: %v", err)
+	}
+	if !strings.HasPrefix(m.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("expected text/html, got %q", m.Header.Get("Content-Type"))
+	}
+	body, _ := io.ReadAll(m.Body)
+	if string(body) != "<p>Bonjour</p>" {
+		t.Errorf("unexpected body %q", body)
+	}
+}
+
+func TestBuildMessage_ReplyTo(t *testing.T) {
+	msg := buildMessageReplyTo("noreply@cyna.fr", "client@example.com", "support+t42-abc@cyna.fr", "[Ticket #42]", "<p>Réponse</p>", nil)
+	m, err := mail.ReadMessage(bytes.NewReader(msg))
+	if err != nil {
+		t.Fatalf("invalid message: %v", err)
+	}
+	addr, err := mail.ParseAddress(m.Header.Get("Reply-To"))
+	if err != nil || addr.Address != "support+t42-abc@cyna.fr" {
+		t.Errorf("unexpected Reply-To %q (%v)", m.Header.Get("Reply-To"), err)
+	}
+	if plain := buildMessage("noreply@cyna.fr", "client@example.com", "s", "b", nil); bytes.Contains(plain, []byte("Reply-To")) {
+		t.Error("no Reply-To expected by default")
+	}
+}
+
+func TestBuildMessage_WithAttachment(t *testing.T) {
+	data := bytes.Repeat([]byte("%PDF-1.4 "), 40)
+	msg := buildMessage("noreply@cyna.fr", "client@example.com", "Votre devis n°1 — CYNA", "<p>Ci-joint</p>",
+		[]Attachment{{Filename: "devis.pdf", ContentType: "application/pdf", Data: data}})
+
+	m, err := mail.ReadMessage(bytes.NewReader(msg))
+	if err != nil {
+		t.Fatalf("invalid message: %v", err)
+	}
+	dec := new(mime.WordDecoder)
+	if subj, _ := dec.DecodeHeader(m.Header.Get("Subject")); subj != "Votre devis n°1 — CYNA" {
+		t.Errorf("subject not round-tripped: %q", subj)
+	}
+	mediaType, params, _ := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if mediaType != "multipart/mixed" {
+		t.Fatalf("expected multipart/mixed, got %q", mediaType)
+	}
+
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	if _, err := mr.NextPart(); err != nil {
+		t.Fatalf("missing html part: %v", err)
+	}
+	att, err := mr.NextPart()
+	if err != nil {
+		t.Fatalf("missing attachment part: %v", err)
+	}
+	if att.FileName() != "devis.pdf" {
+		t.Errorf("expected filename devis.pdf, got %q", att.FileName())
+	}
+	if att.Header.Get("Content-Transfer-Encoding") != "base64" {
+		t.Fatalf("expected base64 encoding")
+	}
+	got, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, att))
+	if err != nil {
+		t.Fatalf("invalid base64: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("attachment data mismatch (%d bytes vs %d)", len(got), len(data))
+	}
+}
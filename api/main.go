@@ -11,22 +11,40 @@ import (
 
 	"github.com/gorilla/mux"
 
+	"api/billing"
 	"api/cache"
 	"api/config"
 	"api/handlers"
 	"api/logger"
 	mw "api/middleware"
+	"api/notify"
+	"api/realtime"
 	"api/routes"
+	"api/services"
 )
 
 func main() {
 	// Charger le fichier .env (ignorer l'erreur si absent, ex: en production avec env vars système)
 	loadEnv(".env")
 
+	if runCommand(os.Args[1:]) {
+		return
+	}
+
 	config.Init()
 	cache.Init()
 	logger.InitLogDB()
+	services.InitSearchLog(config.DB)
+	services.InitTopProducts(config.DB)
+	mw.InitIdempotency()
+	billing.InitWorker()
 	handlers.InitBackupScheduler()
+	handlers.InitCatalogPublisher()
+	handlers.InitMedia()
+	handlers.InitSupportAttachments()
+	handlers.InitSLAMonitor()
+	notify.InitCleanup()
+	realtime.Init()
 
 	// Auto-génération d'un token système s'il n'existe pas déjà.
 	// Important: la table peut déjà contenir des clés de démo, donc COUNT(*) != 0.
@@ -96,6 +114,8 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
+	// Les flux SSE ne se terminent pas d'eux-mêmes : les fermer avant d'attendre les requêtes.
+	realtime.Shutdown()
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced shutdown: %v", err)
 	}
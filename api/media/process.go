@@ -0,0 +1,191 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif" // décodeur GIF pour image.Decode
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+var (
+	ErrUnsupportedType = errors.New("media: unsupported file type")
+	ErrTooManyPixels   = errors.New("media: image dimensions too large")
+)
+
+// MaxPixels borne la taille décodée (une image compressée de quelques Mo peut
+// occuper plusieurs Go une fois décodée).
+const MaxPixels = 50_000_000
+
+// Size : déclinaison redimensionnée, générée seulement si l'image est plus large.
+type Size struct {
+	Name  string
+	Width int
+}
+
+var Sizes = []Size{{"thumb", 320}, {"medium", 800}, {"large", 1600}}
+
+// Variant : un fichier stocké pour un média (original ré-encodé, taille réduite, WebP).
+type Variant struct {
+	Name   string `json:"name"`
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Size   int    `json:"size"`
+	Key    string `json:"key"`
+	URL    string `json:"url"`
+	Data   []byte `json:"-"`
+}
+
+// Image : résultat du traitement d'un fichier téléversé.
+type Image struct {
+	Hash     string // SHA-256 du fichier reçu (déduplication)
+	MIME     string // type détecté à partir du contenu, jamais du nom ou de l'en-tête
+	Width    int    // dimensions après application de l'orientation EXIF
+	Height   int
+	Variants []Variant
+}
+
+// Sniff détecte le type réel du fichier : JPEG, PNG et GIF (première image) sont
+// acceptés ; SVG, WebP en entrée et tout le reste sont refusés.
+func Sniff(data []byte) (string, error) {
+	switch mime := http.DetectContentType(data); mime {
+	case "image/jpeg", "image/png", "image/gif":
+		return mime, nil
+	default:
+		return "", ErrUnsupportedType
+	}
+}
+
+// Process décode l'image, applique l'orientation EXIF puis ré-encode chaque
+// déclinaison : les métadonnées (EXIF, GPS, profils) du fichier d'origine ne sont
+// jamais conservées. webp peut être nil (pas de déclinaison WebP).
+func Process(data []byte, webp Encoder) (*Image, error) {
+	mime, err := Sniff(data)
+	if err != nil {
+		return nil, err
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrTooManyPixels
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+	img := toRGBA(decoded)
+	if mime == "image/jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+
+	sum := sha256.Sum256(data)
+	out := &Image{Hash: hex.EncodeToString(sum[:]), MIME: mime, Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}
+	// Le GIF est ré-encodé en PNG (animation non conservée).
+	format, ext := "image/png", ".png"
+	if mime == "image/jpeg" {
+		format, ext = "image/jpeg", ".jpg"
+	}
+	add := func(name string, v *image.RGBA) error {
+		var buf bytes.Buffer
+		var err error
+		if format == "image/jpeg" {
+			err = jpeg.Encode(&buf, v, &jpeg.Options{Quality: 85})
+		} else {
+			err = png.Encode(&buf, v)
+		}
+		if err != nil {
+			return err
+		}
+		out.Variants = append(out.Variants, out.variant(name, ext, format, v, buf.Bytes()))
+		if webp == nil {
+			return nil
+		}
+		wb, err := webp.EncodeWebP(v)
+		if err != nil {
+			return err
+		}
+		out.Variants = append(out.Variants, out.variant(name, ".webp", "image/webp", v, wb))
+		return nil
+	}
+	if err := add("original", img); err != nil {
+		return nil, err
+	}
+	for _, s := range Sizes {
+		if s.Width < out.Width {
+			if err := add(s.Name, resize(img, s.Width)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return out, nil
+}
+
+func (m *Image) variant(name, ext, format string, img image.Image, data []byte) Variant {
+	b := img.Bounds()
+	return Variant{
+		Name: name, Format: format, Width: b.Dx(), Height: b.Dy(), Size: len(data),
+		Key: m.Hash[:2] + "/" + m.Hash + "/" + name + ext, Data: data,
+	}
+}
+
+// Store enregistre toutes les déclinaisons et renseigne leur URL ; en cas d'échec,
+// les fichiers déjà écrits sont supprimés.
+func (m *Image) Store(ctx context.Context, s Storage) error {
+	for i := range m.Variants {
+		v := &m.Variants[i]
+		if err := s.Put(ctx, v.Key, v.Format, v.Data); err != nil {
+			Remove(ctx, s, m.Variants[:i])
+			return err
+		}
+		v.URL = s.URL(v.Key)
+	}
+	return nil
+}
+
+// Remove supprime les fichiers des déclinaisons et renvoie la première erreur.
+func Remove(ctx context.Context, s Storage, variants []Variant) error {
+	var first error
+	for _, v := range variants {
+		if err := s.Delete(ctx, v.Key); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// DisplayURL : URL à référencer dans le catalogue (images produit, carrousel) — la
+// grande déclinaison JPEG/PNG si elle existe, sinon l'original ré-encodé.
+func DisplayURL(variants []Variant) string {
+	url := ""
+	for _, v := range variants {
+		if v.Format == "image/webp" {
+			continue
+		}
+		if v.Name == "large" {
+			return v.URL
+		}
+		if v.Name == "original" {
+			url = v.URL
+		}
+	}
+	return url
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
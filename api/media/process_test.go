@@ -0,0 +1,161 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+type fakeWebP struct{ calls int }
+
+func (f *fakeWebP) EncodeWebP(img image.Image) ([]byte, error) {
+	f.calls++
+	return []byte("RIFF....WEBP"), nil
+}
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{uint8(x), uint8(y), 200, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// jpegWithOrientation encode un JPEG w×h (moitié gauche rouge) précédé d'un segment
+// EXIF portant l'orientation o.
+func jpegWithOrientation(t *testing.T, w, h, o int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{0, 0, 255, 255}
+			if x < w/2 {
+				c = color.RGBA{255, 0, 0, 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 1, 0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, byte(o), 0, 0, 0, 0, 0, 0, 0, 0}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	seg := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	seg = append(seg, payload...)
+	data := buf.Bytes()
+	return append(append([]byte{0xFF, 0xD8}, seg...), data[2:]...)
+}
+
+func TestSniff(t *testing.T) {
+	if mime, err := Sniff(encodePNG(t, 2, 2)); err != nil || mime != "image/png" {
+		t.Errorf("png: %q, %v", mime, err)
+	}
+	for _, data := range [][]byte{
+		[]byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`),
+		[]byte("%PDF-1.7"),
+		[]byte("RIFF\x00\x00\x00\x00WEBPVP8 "),
+	} {
+		if _, err := Sniff(data); err != ErrUnsupportedType {
+			t.Errorf("%q should be rejected, got %v", data[:8], err)
+		}
+	}
+}
+
+func TestProcessVariants(t *testing.T) {
+	enc := &fakeWebP{}
+	m, err := Process(encodePNG(t, 1000, 500), enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][2]int{"original": {1000, 500}, "thumb": {320, 160}, "medium": {800, 400}}
+	if len(m.Variants) != 2*len(want) || enc.calls != len(want) {
+		t.Fatalf("expected %d variants with WebP, got %d", 2*len(want), len(m.Variants))
+	}
+	for _, v := range m.Variants {
+		dims, ok := want[v.Name]
+		if !ok || v.Width != dims[0] || v.Height != dims[1] {
+			t.Errorf("unexpected variant %s %dx%d", v.Name, v.Width, v.Height)
+		}
+		if v.Size != len(v.Data) || v.Key[:2] != m.Hash[:2] {
+			t.Errorf("bad variant metadata: %+v", v)
+		}
+	}
+	if m.Variants[0].Format != "image/png" || m.Variants[1].Format != "image/webp" {
+		t.Errorf("unexpected formats: %s, %s", m.Variants[0].Format, m.Variants[1].Format)
+	}
+}
+
+func TestProcessAppliesOrientationAndStripsExif(t *testing.T) {
+	src := jpegWithOrientation(t, 64, 32, 6)
+	if o := jpegOrientation(src); o != 6 {
+		t.Fatalf("orientation = %d, want 6", o)
+	}
+	m, err := Process(src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Width != 32 || m.Height != 64 || len(m.Variants) != 1 {
+		t.Fatalf("expected a single 32x64 variant, got %dx%d (%d variants)", m.Width, m.Height, len(m.Variants))
+	}
+	out := m.Variants[0].Data
+	if bytes.Contains(out, []byte("Exif")) {
+		t.Error("EXIF segment should be stripped")
+	}
+	img, err := jpeg.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Rotation horaire : la moitié gauche (rouge) se retrouve en haut.
+	if r, _, b, _ := img.At(16, 5).RGBA(); r < b {
+		t.Error("top half should be red after rotation")
+	}
+	if r, _, b, _ := img.At(16, 58).RGBA(); r > b {
+		t.Error("bottom half should be blue after rotation")
+	}
+}
+
+func TestResizeAveragesArea(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		v := uint8(0)
+		if x%2 == 1 {
+			v = 200
+		}
+		src.Set(x, 0, color.RGBA{v, v, v, 255})
+		src.Set(x, 1, color.RGBA{v, v, v, 255})
+	}
+	dst := resize(src, 2)
+	if dst.Bounds().Dx() != 2 || dst.Bounds().Dy() != 1 {
+		t.Fatalf("unexpected size %v", dst.Bounds())
+	}
+	if c := dst.RGBAAt(0, 0); c.R != 100 || c.A != 255 {
+		t.Errorf("expected averaged pixel, got %+v", c)
+	}
+}
+
+func TestDisplayURL(t *testing.T) {
+	vs := []Variant{
+		{Name: "original", Format: "image/jpeg", URL: "/o.jpg"},
+		{Name: "large", Format: "image/webp", URL: "/l.webp"},
+	}
+	if got := DisplayURL(vs); got != "/o.jpg" {
+		t.Errorf("DisplayURL = %q", got)
+	}
+	vs = append(vs, Variant{Name: "large", Format: "image/jpeg", URL: "/l.jpg"})
+	if got := DisplayURL(vs); got != "/l.jpg" {
+		t.Errorf("DisplayURL = %q", got)
+	}
+}
@@ -0,0 +1,83 @@
+package media
+
+import (
+	"image"
+	"math"
+)
+
+// contribution : pixels sources couverts par un pixel de destination et leur poids.
+type contribution struct {
+	first   int
+	weights []float32
+}
+
+// boxWeights calcule, pour une réduction de n vers m pixels, la part de chaque pixel
+// source recouverte par chaque pixel de destination (moyenne de surface).
+func boxWeights(n, m int) []contribution {
+	scale := float64(n) / float64(m)
+	out := make([]contribution, m)
+	for i := range out {
+		start, end := float64(i)*scale, float64(i+1)*scale
+		first, last := int(math.Floor(start)), int(math.Ceil(end))
+		if last > n {
+			last = n
+		}
+		c := contribution{first: first}
+		var total float32
+		for j := first; j < last; j++ {
+			wt := float32(math.Min(end, float64(j+1)) - math.Max(start, float64(j)))
+			c.weights = append(c.weights, wt)
+			total += wt
+		}
+		for k := range c.weights {
+			c.weights[k] /= total
+		}
+		out[i] = c
+	}
+	return out
+}
+
+// resize réduit src à la largeur width (hauteur proportionnelle) par moyenne de
+// surface, sur des pixels prémultipliés : pas de halo autour des zones transparentes.
+// Une ligne de destination à la fois, pour borner la mémoire sur les grandes images.
+func resize(src *image.RGBA, width int) *image.RGBA {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	if width >= sw {
+		return src
+	}
+	height := int(math.Round(float64(sh) * float64(width) / float64(sw)))
+	if height < 1 {
+		height = 1
+	}
+	cols, rows := boxWeights(sw, width), boxWeights(sh, height)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	acc := make([]float32, width*4)
+	for y, row := range rows {
+		for i := range acc {
+			acc[i] = 0
+		}
+		for k, wy := range row.weights {
+			line := src.Pix[src.PixOffset(b.Min.X, b.Min.Y+row.first+k):]
+			for x, col := range cols {
+				var r, g, bl, a float32
+				for c, wx := range col.weights {
+					p := line[(col.first+c)*4:]
+					r += wx * float32(p[0])
+					g += wx * float32(p[1])
+					bl += wx * float32(p[2])
+					a += wx * float32(p[3])
+				}
+				acc[x*4] += wy * r
+				acc[x*4+1] += wy * g
+				acc[x*4+2] += wy * bl
+				acc[x*4+3] += wy * a
+			}
+		}
+		out := dst.Pix[dst.PixOffset(0, y):]
+		for i, v := range acc {
+			out[i] = uint8(math.Min(255, float64(v)+0.5))
+		}
+	}
+	return dst
+}
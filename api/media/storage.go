@@ -0,0 +1,122 @@
+// Package media traite et stocke les images téléversées depuis le back-office
+// (produits, carrousel) : détection du type, suppression des métadonnées EXIF,
+// déclinaisons redimensionnées et WebP, stockage local ou compatible S3. Le même
+// stockage sert, en privé, aux pièces jointes du support (Blobs).
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Storage range les fichiers d'un média sous une clé ("ab/abcdef…/large.jpg") et
+// fournit l'URL publique correspondante.
+type Storage interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+// Blobs : stockage privé (pièces jointes du support). Les fichiers ne sont pas servis
+// par URL publique ; l'API les relit après avoir contrôlé l'accès.
+type Blobs interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// NewStorageFromEnv construit le stockage décrit par l'environnement :
+//
+//	MEDIA_STORAGE=local (défaut) : MEDIA_DIR, MEDIA_BASE_URL (défaut {API_URL}/media)
+//	MEDIA_STORAGE=s3             : MEDIA_S3_ENDPOINT, MEDIA_S3_REGION, MEDIA_S3_BUCKET,
+//	                               MEDIA_S3_ACCESS_KEY, MEDIA_S3_SECRET_KEY, MEDIA_S3_PUBLIC_URL
+func NewStorageFromEnv() (Storage, error) {
+	switch strings.ToLower(os.Getenv("MEDIA_STORAGE")) {
+	case "", "local":
+		dir := os.Getenv("MEDIA_DIR")
+		if dir == "" {
+			dir = "/data/media"
+		}
+		return NewLocalStorage(dir, localBaseURL())
+	case "s3":
+		cfg := S3Config{
+			Endpoint:  os.Getenv("MEDIA_S3_ENDPOINT"),
+			Region:    os.Getenv("MEDIA_S3_REGION"),
+			Bucket:    os.Getenv("MEDIA_S3_BUCKET"),
+			AccessKey: os.Getenv("MEDIA_S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("MEDIA_S3_SECRET_KEY"),
+			PublicURL: os.Getenv("MEDIA_S3_PUBLIC_URL"),
+		}
+		return NewS3Storage(cfg)
+	default:
+		return nil, fmt.Errorf("MEDIA_STORAGE inconnu : %q (local ou s3)", os.Getenv("MEDIA_STORAGE"))
+	}
+}
+
+// localBaseURL retourne MEDIA_BASE_URL, à défaut l'URL absolue {API_URL}/media : les URLs
+// enregistrées au catalogue sont affichées par la boutique (autre origine que l'API) et
+// par l'application mobile, où une URL relative ne mènerait pas à l'API.
+func localBaseURL() string {
+	if base := os.Getenv("MEDIA_BASE_URL"); base != "" {
+		return base
+	}
+	return strings.TrimRight(os.Getenv("API_URL"), "/") + "/media"
+}
+
+// NewBlobsFromEnv construit un stockage privé décrit par les variables préfixées
+// (prefix "ATTACHMENT" : ATTACHMENT_STORAGE, ATTACHMENT_DIR…) :
+//
+//	{prefix}_STORAGE=local (défaut) : {prefix}_DIR (défaut dir), hors du répertoire servi
+//	{prefix}_STORAGE=s3             : {prefix}_S3_BUCKET (bucket privé) ; endpoint, région
+//	                                  et clés {prefix}_S3_*, à défaut MEDIA_S3_*
+func NewBlobsFromEnv(prefix, dir string) (Blobs, error) {
+	env := func(name string) string {
+		if v := os.Getenv(prefix + "_" + name); v != "" {
+			return v
+		}
+		return os.Getenv("MEDIA_" + name)
+	}
+	switch strings.ToLower(os.Getenv(prefix + "_STORAGE")) {
+	case "", "local":
+		if d := os.Getenv(prefix + "_DIR"); d != "" {
+			dir = d
+		}
+		return NewLocalStorage(dir, "")
+	case "s3":
+		cfg := S3Config{
+			Endpoint:  env("S3_ENDPOINT"),
+			Region:    env("S3_REGION"),
+			Bucket:    os.Getenv(prefix + "_S3_BUCKET"),
+			AccessKey: env("S3_ACCESS_KEY"),
+			SecretKey: env("S3_SECRET_KEY"),
+		}
+		return NewS3Storage(cfg)
+	default:
+		return nil, fmt.Errorf("%s_STORAGE inconnu : %q (local ou s3)", prefix, os.Getenv(prefix+"_STORAGE"))
+	}
+}
+
+// ErrNotFound : fichier absent du stockage.
+var ErrNotFound = errors.New("media: object not found")
+
+// ErrInvalidKey signale une clé vide, absolue ou qui remonte l'arborescence.
+var ErrInvalidKey = errors.New("media: invalid storage key")
+
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
+
+func joinURL(base, key string) string {
+	return strings.TrimRight(base, "/") + "/" + key
+}
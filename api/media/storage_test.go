@@ -0,0 +1,167 @@
+package media
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLocalStorage(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewLocalStorage(dir, "http://localhost:8080/media/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := s.Put(ctx, "ab/abcd/thumb.png", "image/png", []byte("png")); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "ab", "abcd", "thumb.png")); err != nil || string(data) != "png" {
+		t.Fatalf("stored file = %q, %v", data, err)
+	}
+	if got := s.URL("ab/abcd/thumb.png"); got != "http://localhost:8080/media/ab/abcd/thumb.png" {
+		t.Errorf("URL = %q", got)
+	}
+	if data, err := s.Get(ctx, "ab/abcd/thumb.png"); err != nil || string(data) != "png" {
+		t.Errorf("Get = %q, %v", data, err)
+	}
+	if err := s.Delete(ctx, "ab/abcd/thumb.png"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, "ab/abcd/thumb.png"); err != nil {
+		t.Errorf("deleting a missing file should succeed: %v", err)
+	}
+	if _, err := s.Get(ctx, "ab/abcd/thumb.png"); err != ErrNotFound {
+		t.Errorf("Get of a deleted file = %v, want ErrNotFound", err)
+	}
+	for _, key := range []string{"../etc/passwd", "/abs", "a//b", ""} {
+		if err := s.Put(ctx, key, "text/plain", nil); err != ErrInvalidKey {
+			t.Errorf("key %q should be rejected, got %v", key, err)
+		}
+	}
+}
+
+func TestLocalBaseURL(t *testing.T) {
+	t.Setenv("MEDIA_BASE_URL", "")
+	t.Setenv("API_URL", "https://api.cyna.fr/")
+	if got := localBaseURL(); got != "https://api.cyna.fr/media" {
+		t.Errorf("default = %q, want the API origin", got)
+	}
+	t.Setenv("API_URL", "")
+	if got := localBaseURL(); got != "/media" {
+		t.Errorf("without API_URL = %q, want /media", got)
+	}
+	t.Setenv("MEDIA_BASE_URL", "https://cdn.cyna.fr/media")
+	if got := localBaseURL(); got != "https://cdn.cyna.fr/media" {
+		t.Errorf("MEDIA_BASE_URL must win, got %q", got)
+	}
+}
+
+// Exemple de dérivation de clé de la documentation AWS Signature V4.
+func TestSigningKey(t *testing.T) {
+	got := hex.EncodeToString(signingKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam"))
+	if got != "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d" {
+		t.Errorf("signing key = %s", got)
+	}
+}
+
+// s3StandIn imite un serveur S3 : vérifie la signature de chaque requête et garde
+// les objets en mémoire.
+type s3StandIn struct {
+	cfg     S3Config
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *s3StandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if r.Header.Get("X-Amz-Content-Sha256") != sha256Hex(body) {
+		http.Error(w, "XAmzContentSHA256Mismatch", http.StatusBadRequest)
+		return
+	}
+	date, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+	// Recalcule la signature à partir de la requête telle que reçue.
+	check, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	for _, h := range []string{"Content-Type", "Cache-Control"} {
+		if v := r.Header.Get(h); v != "" {
+			check.Header.Set(h, v)
+		}
+	}
+	signRequest(check, body, s.cfg, date)
+	if check.Header.Get("Authorization") != r.Header.Get("Authorization") {
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/"+s.cfg.Bucket+"/")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		s.objects[key] = body
+	case http.MethodGet:
+		data, ok := s.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestS3Storage(t *testing.T) {
+	cfg := S3Config{Region: "eu-west-3", Bucket: "cyna-media", AccessKey: "AKIDEXAMPLE", SecretKey: "secret"}
+	standIn := &s3StandIn{cfg: cfg, objects: map[string][]byte{}}
+	srv := httptest.NewServer(standIn)
+	defer srv.Close()
+
+	cfg.Endpoint = srv.URL
+	s, err := NewS3Storage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := s.Put(ctx, "ab/abcd/large.jpg", "image/jpeg", []byte("jpeg")); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(standIn.objects["ab/abcd/large.jpg"]); got != "jpeg" {
+		t.Fatalf("stored object = %q", got)
+	}
+	if got := s.URL("ab/abcd/large.jpg"); got != srv.URL+"/cyna-media/ab/abcd/large.jpg" {
+		t.Errorf("URL = %q", got)
+	}
+	if data, err := s.Get(ctx, "ab/abcd/large.jpg"); err != nil || string(data) != "jpeg" {
+		t.Errorf("Get = %q, %v", data, err)
+	}
+	if err := s.Delete(ctx, "ab/abcd/large.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if len(standIn.objects) != 0 {
+		t.Error("object should be deleted")
+	}
+	if _, err := s.Get(ctx, "ab/abcd/large.jpg"); err != ErrNotFound {
+		t.Errorf("Get of a deleted object = %v, want ErrNotFound", err)
+	}
+
+	bad := *s
+	bad.cfg.SecretKey = "wrong"
+	if err := bad.Put(ctx, "ab/abcd/thumb.jpg", "image/jpeg", []byte("x")); err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("wrong secret should be rejected, got %v", err)
+	}
+}
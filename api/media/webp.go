@@ -0,0 +1,57 @@
+package media
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// Encoder produit la déclinaison WebP d'une image (la bibliothèque standard ne sait
+// pas écrire ce format).
+type Encoder interface {
+	EncodeWebP(img image.Image) ([]byte, error)
+}
+
+// Cwebp délègue l'encodage au binaire cwebp (paquet libwebp-tools).
+type Cwebp struct {
+	Path    string
+	Quality int
+}
+
+// LookupCwebp renvoie l'encodeur cwebp s'il est installé, nil sinon.
+func LookupCwebp() *Cwebp {
+	path, err := exec.LookPath("cwebp")
+	if err != nil {
+		return nil
+	}
+	return &Cwebp{Path: path, Quality: 80}
+}
+
+func (c *Cwebp) EncodeWebP(img image.Image) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "cwebp-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	in, out := filepath.Join(dir, "in.png"), filepath.Join(dir, "out.webp")
+	f, err := os.Create(in)
+	if err != nil {
+		return nil, err
+	}
+	if err := (&png.Encoder{CompressionLevel: png.BestSpeed}).Encode(f, img); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(c.Path, "-quiet", "-metadata", "none", "-q", strconv.Itoa(c.Quality), in, "-o", out)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("cwebp : %v : %s", err, output)
+	}
+	return os.ReadFile(out)
+}
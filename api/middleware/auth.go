@@ -17,10 +17,10 @@ func Auth(next http.Handler) http.Handler {
 			return
 		}
 
-		var userID int
+		var userID, sessionID int
 		var role string
 		err := config.DB.QueryRow(`
-			SELECT u.id_utilisateur,
+			SELECT u.id_utilisateur, s.id_session,
 			       COALESCE((
 				       SELECT LOWER(r.nom)
 				       FROM user_roles ur
@@ -33,7 +33,7 @@ func Auth(next http.Handler) http.Handler {
 			JOIN utilisateur u ON s.id_utilisateur = u.id_utilisateur
 			WHERE s.token_session = $1
 			  AND s.date_expiration > NOW()
-			  AND COALESCE(u.statut,'actif') = 'actif'`, token).Scan(&userID, &role)
+			  AND COALESCE(u.statut,'actif') = 'actif'`, token).Scan(&userID, &sessionID, &role)
 		if err != nil {
 			http.Error(w, `{"error":"Unauthorized"}`, http.StatusUnauthorized)
 			return
@@ -41,10 +41,26 @@ func Auth(next http.Handler) http.Handler {
 
 		ctx := context.WithValue(r.Context(), models.UserIDKey, userID)
 		ctx = context.WithValue(ctx, models.UserRoleKey, role)
+		ctx = context.WithValue(ctx, models.SessionIDKey, sessionID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// SessionValid indique si le jeton de session de la requête est toujours valide pour
+// userID (ni expiré, ni révoqué, compte actif). Les connexions longues (flux SSE),
+// authentifiées une seule fois à l'ouverture, le vérifient périodiquement.
+func SessionValid(r *http.Request, userID int) (bool, error) {
+	var ok bool
+	err := config.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM session_utilisateur s
+			JOIN utilisateur u ON s.id_utilisateur = u.id_utilisateur
+			WHERE s.token_session = $1 AND s.id_utilisateur = $2
+			  AND s.date_expiration > NOW()
+			  AND COALESCE(u.statut,'actif') = 'actif')`, extractToken(r), userID).Scan(&ok)
+	return ok, err
+}
+
 func Admin(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		role, _ := r.Context().Value(models.UserRoleKey).(string)
@@ -56,6 +72,31 @@ func Admin(next http.Handler) http.Handler {
 	})
 }
 
+// StaffRoles : rôles du personnel (traitement des tickets support).
+var StaffRoles = []string{"admin", "support"}
+
+// IsStaffRole indique si le rôle principal appartient au personnel.
+func IsStaffRole(role string) bool {
+	for _, s := range StaffRoles {
+		if role == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Staff restreint une route au personnel (admin ou support).
+func Staff(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role, _ := r.Context().Value(models.UserRoleKey).(string)
+		if !IsStaffRole(role) {
+			http.Error(w, `{"error":"Forbidden: Staff access required"}`, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // extractToken lit le Bearer token depuis le header Authorization.
 func extractToken(r *http.Request) string {
 	// Priorité : header Authorization
@@ -69,3 +110,63 @@ func extractToken(r *http.Request) string {
 	}
 	return ""
 }
+
+// APIKeyHeader est le header portant une clé api_token (agents, intégrations).
+const APIKeyHeader = "X-API-Key"
+
+// APIKey authentifie une requête machine par clé api_token active. La clé doit
+// porter la permission `scope` (ou "all"). L'utilisateur propriétaire du token
+// est placé dans le contexte comme pour Auth.
+func APIKey(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(APIKeyHeader)
+			if key == "" {
+				http.Error(w, `{"error":"Unauthorized"}`, http.StatusUnauthorized)
+				return
+			}
+
+			var tokenID, userID int
+			var permissions, role string
+			err := config.DB.QueryRow(`
+				SELECT t.id_token, t.id_utilisateur, COALESCE(t.permissions, ''),
+				       COALESCE((
+					       SELECT LOWER(r.nom)
+					       FROM user_roles ur
+					       JOIN roles r ON ur.id_role = r.id_role
+					       WHERE ur.id_utilisateur = t.id_utilisateur
+					       ORDER BY r.id_role
+					       LIMIT 1
+				       ), '')
+				FROM api_token t
+				JOIN utilisateur u ON u.id_utilisateur = t.id_utilisateur
+				WHERE t.cle_api = $1 AND t.est_actif = TRUE
+				  AND COALESCE(u.statut,'actif') = 'actif'`, key).Scan(&tokenID, &userID, &permissions, &role)
+			if err != nil {
+				http.Error(w, `{"error":"Unauthorized"}`, http.StatusUnauthorized)
+				return
+			}
+			if !tokenHasScope(permissions, scope) {
+				http.Error(w, `{"error":"Forbidden: API token lacks permission `+scope+`"}`, http.StatusForbidden)
+				return
+			}
+			config.DB.Exec("UPDATE api_token SET dernier_usage = NOW() WHERE id_token = $1", tokenID)
+
+			ctx := context.WithValue(r.Context(), models.UserIDKey, userID)
+			ctx = context.WithValue(ctx, models.UserRoleKey, role)
+			ctx = context.WithValue(ctx, models.APITokenIDKey, tokenID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// tokenHasScope vérifie la liste de permissions d'un token (séparées par des virgules).
+func tokenHasScope(permissions, scope string) bool {
+	for _, p := range strings.Split(permissions, ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "all" || p == strings.ToLower(scope) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"api/models"
+)
+
+func TestTokenHasScope(t *testing.T) {
+	cases := []struct {
+		permissions, scope string
+		want               bool
+	}{
+		{"all", "usage", true},
+		{"read, usage", "usage", true},
+		{"READ,Usage", "usage", true},
+		{"read", "usage", false},
+		{"", "usage", false},
+		{"usage_admin", "usage", false},
+	}
+	for _, c := range cases {
+		if got := tokenHasScope(c.permissions, c.scope); got != c.want {
+			t.Errorf("tokenHasScope(%q, %q) = %v, want %v", c.permissions, c.scope, got, c.want)
+		}
+	}
+}
+
+func TestAPIKey_MissingHeader(t *testing.T) {
+	handler := APIKey("usage")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not run without an API key")
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/api/usage/events", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", w.Code)
+	}
+}
+
+func TestStaff(t *testing.T) {
+	handler := Staff(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	for role, want := range map[string]int{"admin": 204, "support": 204, "client": 403, "": 403} {
+		req := httptest.NewRequest("GET", "/api/admin/tickets", nil)
+		req = req.WithContext(context.WithValue(req.Context(), models.UserRoleKey, role))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("role %q: expected %d, got %d", role, want, w.Code)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// Deprecated signale une route conservée pour compatibilité (RFC 8594) :
+// en-têtes Deprecation, Sunset et Link vers la route qui la remplace.
+// Chaque appel est journalisé pour suivre les clients restant à migrer.
+func Deprecated(sunset time.Time, successor string) func(http.Handler) http.Handler {
+	sunsetHeader := sunset.UTC().Format(http.TimeFormat)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Sunset", sunsetHeader)
+			if successor != "" {
+				w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+			}
+			log.Printf("[DEPRECATED] %s %s (remplacée par %s, retrait le %s)", r.Method, r.URL.Path, successor, sunset.Format("2006-01-02"))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
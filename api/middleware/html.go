@@ -0,0 +1,301 @@
+package middleware
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// ============================================================
+// SanitizeHTML — nettoyage par liste blanche du HTML riche (éditeur
+// Quill : descriptions produit, contenu des newsletters). Tout ce qui
+// n'est pas explicitement autorisé (balise, attribut, schéma d'URL,
+// propriété CSS) est supprimé ; le texte est ré-échappé.
+// ============================================================
+
+// htmlTags : balises autorisées et attributs propres à chacune. class et style
+// sont admis partout, filtrés par cleanAttr.
+var htmlTags = map[string][]string{
+	"p": nil, "br": nil, "hr": nil, "span": nil,
+	"h1": nil, "h2": nil, "h3": nil, "h4": nil, "h5": nil, "h6": nil,
+	"strong": nil, "b": nil, "em": nil, "i": nil, "u": nil, "s": nil, "strike": nil,
+	"sub": nil, "sup": nil, "code": nil, "pre": nil, "blockquote": nil,
+	"ul": nil, "ol": nil, "li": {"data-list"},
+	"a":   {"href", "target", "title"},
+	"img": {"src", "alt", "title", "width", "height"},
+}
+
+// htmlVoid : balises sans contenu ni balise fermante.
+var htmlVoid = map[string]bool{"br": true, "hr": true, "img": true}
+
+// htmlDropContent : éléments supprimés avec leur contenu (scripts, styles, contenus
+// embarqués, espaces de noms SVG/MathML propices aux mutations).
+var htmlDropContent = map[string]bool{
+	"script": true, "style": true, "iframe": true, "frame": true, "frameset": true,
+	"object": true, "embed": true, "applet": true, "template": true, "noscript": true,
+	"noembed": true, "noframes": true, "textarea": true, "title": true, "xmp": true,
+	"plaintext": true, "select": true, "svg": true, "math": true,
+}
+
+var (
+	htmlClassRe = regexp.MustCompile(`^ql-[a-z0-9-]+$`)
+	htmlColorRe = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|rgba?\(\s*[0-9.]+%?\s*(,\s*[0-9.]+%?\s*){2,3}\)|[a-zA-Z]{3,20})$`)
+	htmlSizeRe  = regexp.MustCompile(`^[0-9]{1,4}$`)
+	htmlDataRe  = regexp.MustCompile(`^data:image/(png|jpeg|gif|webp);base64,[A-Za-z0-9+/=]+$`)
+)
+
+var htmlListTypes = map[string]bool{"bullet": true, "ordered": true, "checked": true, "unchecked": true}
+
+type htmlAttr struct{ name, value string }
+
+// SanitizeHTML renvoie un HTML bien formé ne contenant que les balises, attributs et
+// URLs (http, https, mailto, tel, relatives ; images data: PNG/JPEG/GIF/WebP) autorisés.
+// Les balises restées ouvertes sont refermées.
+func SanitizeHTML(s string) string {
+	var b strings.Builder
+	var open []string
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			writeHTMLText(&b, s)
+			break
+		}
+		writeHTMLText(&b, s[:i])
+		s = s[i:]
+		switch {
+		case strings.HasPrefix(s, "<!--"):
+			if end := strings.Index(s[4:], "-->"); end >= 0 {
+				s = s[4+end+3:]
+			} else {
+				s = ""
+			}
+		case len(s) > 1 && (s[1] == '!' || s[1] == '?'):
+			if end := strings.IndexByte(s, '>'); end >= 0 {
+				s = s[end+1:]
+			} else {
+				s = ""
+			}
+		case len(s) > 2 && s[1] == '/' && isASCIILetter(s[2]):
+			var name string
+			name, s = htmlTagName(s[2:])
+			_, s = parseHTMLAttrs(s)
+			for j := len(open) - 1; j >= 0; j-- {
+				if open[j] == name {
+					for k := len(open) - 1; k >= j; k-- {
+						b.WriteString("</" + open[k] + ">")
+					}
+					open = open[:j]
+					break
+				}
+			}
+		case len(s) > 1 && isASCIILetter(s[1]):
+			var name string
+			var attrs []htmlAttr
+			name, s = htmlTagName(s[1:])
+			attrs, s = parseHTMLAttrs(s)
+			if htmlDropContent[name] {
+				s = skipHTMLElement(s, name)
+				continue
+			}
+			extra, ok := htmlTags[name]
+			if !ok {
+				continue
+			}
+			b.WriteString("<" + name)
+			writeHTMLAttrs(&b, name, extra, attrs)
+			b.WriteByte('>')
+			if !htmlVoid[name] {
+				open = append(open, name)
+			}
+		default:
+			b.WriteString("&lt;")
+			s = s[1:]
+		}
+	}
+	for j := len(open) - 1; j >= 0; j-- {
+		b.WriteString("</" + open[j] + ">")
+	}
+	return b.String()
+}
+
+func writeHTMLText(b *strings.Builder, s string) {
+	b.WriteString(html.EscapeString(html.UnescapeString(s)))
+}
+
+func isASCIILetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// htmlTagName lit un nom de balise (en minuscules) et renvoie la suite.
+func htmlTagName(s string) (string, string) {
+	i := 0
+	for i < len(s) && !isHTMLSpace(s[i]) && s[i] != '/' && s[i] != '>' {
+		i++
+	}
+	return strings.ToLower(s[:i]), s[i:]
+}
+
+// parseHTMLAttrs lit les attributs jusqu'au '>' fermant, comme un navigateur (un
+// '>' entre guillemets ne ferme pas la balise). Une balise non terminée est ignorée
+// avec le reste du document.
+func parseHTMLAttrs(s string) ([]htmlAttr, string) {
+	var attrs []htmlAttr
+	seen := map[string]bool{}
+	for {
+		for len(s) > 0 && (isHTMLSpace(s[0]) || s[0] == '/') {
+			s = s[1:]
+		}
+		if len(s) == 0 {
+			return nil, ""
+		}
+		if s[0] == '>' {
+			return attrs, s[1:]
+		}
+		i := 1 // un '=' initial fait partie du nom
+		for i < len(s) && !isHTMLSpace(s[i]) && s[i] != '/' && s[i] != '>' && s[i] != '=' {
+			i++
+		}
+		name := strings.ToLower(s[:i])
+		s = strings.TrimLeft(s[i:], " \t\n\r\f")
+		value := ""
+		if len(s) > 0 && s[0] == '=' {
+			s = strings.TrimLeft(s[1:], " \t\n\r\f")
+			if len(s) > 0 && (s[0] == '"' || s[0] == '\'') {
+				end := strings.IndexByte(s[1:], s[0])
+				if end < 0 {
+					return nil, ""
+				}
+				value, s = s[1:1+end], s[2+end:]
+			} else {
+				j := 0
+				for j < len(s) && !isHTMLSpace(s[j]) && s[j] != '>' {
+					j++
+				}
+				value, s = s[:j], s[j:]
+			}
+		}
+		if !seen[name] { // le premier attribut d'un nom donné l'emporte
+			seen[name] = true
+			attrs = append(attrs, htmlAttr{name, html.UnescapeString(value)})
+		}
+	}
+}
+
+// skipHTMLElement saute le contenu d'un élément supprimé jusqu'à sa balise fermante.
+func skipHTMLElement(s, name string) string {
+	for i := 0; i+2+len(name) <= len(s); i++ {
+		if s[i] != '<' || s[i+1] != '/' || !strings.EqualFold(s[i+2:i+2+len(name)], name) {
+			continue
+		}
+		rest := s[i+2+len(name):]
+		if len(rest) == 0 || isHTMLSpace(rest[0]) || rest[0] == '/' || rest[0] == '>' {
+			_, rest = parseHTMLAttrs(rest)
+			return rest
+		}
+	}
+	return ""
+}
+
+func writeHTMLAttrs(b *strings.Builder, tag string, extra []string, attrs []htmlAttr) {
+	blank := false
+	for _, a := range attrs {
+		allowed := a.name == "class" || a.name == "style"
+		for _, e := range extra {
+			allowed = allowed || a.name == e
+		}
+		if !allowed {
+			continue
+		}
+		v, ok := cleanHTMLAttr(tag, a.name, a.value)
+		if !ok {
+			continue
+		}
+		blank = blank || a.name == "target"
+		b.WriteString(" " + a.name + `="` + html.EscapeString(v) + `"`)
+	}
+	if blank {
+		b.WriteString(` rel="noopener noreferrer"`)
+	}
+}
+
+func cleanHTMLAttr(tag, name, v string) (string, bool) {
+	switch name {
+	case "class":
+		var keep []string
+		for _, c := range strings.Fields(v) {
+			if htmlClassRe.MatchString(c) {
+				keep = append(keep, c)
+			}
+		}
+		return strings.Join(keep, " "), len(keep) > 0
+	case "style":
+		v = cleanHTMLStyle(v)
+		return v, v != ""
+	case "href", "src":
+		return safeHTMLURL(v, tag == "img")
+	case "target":
+		return v, v == "_blank"
+	case "data-list":
+		return v, htmlListTypes[v]
+	case "width", "height":
+		return v, htmlSizeRe.MatchString(v)
+	default:
+		return v, true
+	}
+}
+
+// cleanHTMLStyle ne conserve que les couleurs et l'alignement produits par l'éditeur.
+func cleanHTMLStyle(v string) string {
+	var keep []string
+	for _, decl := range strings.Split(v, ";") {
+		prop, val, ok := strings.Cut(decl, ":")
+		if !ok {
+			continue
+		}
+		prop, val = strings.ToLower(strings.TrimSpace(prop)), strings.TrimSpace(val)
+		switch prop {
+		case "color", "background-color":
+			ok = htmlColorRe.MatchString(val)
+		case "text-align":
+			ok = val == "left" || val == "right" || val == "center" || val == "justify"
+		default:
+			ok = false
+		}
+		if ok {
+			keep = append(keep, prop+": "+val)
+		}
+	}
+	return strings.Join(keep, "; ")
+}
+
+// safeHTMLURL : URL relative ou de schéma http, https, mailto, tel. Les caractères de
+// contrôle et espaces, ignorés par les navigateurs ("java\tscript:"), sont retirés
+// avant l'analyse.
+func safeHTMLURL(u string, image bool) (string, bool) {
+	u = strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, u)
+	if u == "" {
+		return "", false
+	}
+	i := strings.IndexAny(u, ":/?#")
+	if i < 0 || u[i] != ':' {
+		return u, true
+	}
+	switch strings.ToLower(u[:i]) {
+	case "http", "https", "mailto", "tel":
+		return u, true
+	case "data":
+		meta, payload, _ := strings.Cut(u, ",")
+		return u, image && htmlDataRe.MatchString(strings.ToLower(meta)+","+payload)
+	default:
+		return "", false
+	}
+}
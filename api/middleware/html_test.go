@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeHTML_KeepsEditorMarkup(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"<p><br></p>", "<p><br></p>"},
+		{`<h2 class="ql-align-center">Offre <strong>Pro</strong></h2>`, `<h2 class="ql-align-center">Offre <strong>Pro</strong></h2>`},
+		{`<ol><li data-list="bullet"><span class="ql-ui" contenteditable="false"></span>Un</li></ol>`,
+			`<ol><li data-list="bullet"><span class="ql-ui"></span>Un</li></ol>`},
+		{`<p><span style="color: rgb(230, 0, 0); background-color: #ffff00;">rouge</span></p>`,
+			`<p><span style="color: rgb(230, 0, 0); background-color: #ffff00">rouge</span></p>`},
+		{`<a href="https://example.com/?a=1&amp;b=2" rel="opener" target="_blank">lien</a>`,
+			`<a href="https://example.com/?a=1&amp;b=2" target="_blank" rel="noopener noreferrer">lien</a>`},
+		{`<a href="/offres#pro">Offres</a> <a href="mailto:contact@example.com">@</a>`,
+			`<a href="/offres#pro">Offres</a> <a href="mailto:contact@example.com">@</a>`},
+		{`<img src="data:image/png;base64,iVBORw0KGgo=" alt="logo">`, `<img src="data:image/png;base64,iVBORw0KGgo=" alt="logo">`},
+		{`<pre class="ql-syntax" spellcheck="false">if a &lt; b {}</pre>`, `<pre class="ql-syntax">if a &lt; b {}</pre>`},
+		{"Prix : 10 € &nbsp;HT", "Prix : 10 €  HT"},
+		{"1 < 2 & 3 > 2", "1 &lt; 2 &amp; 3 &gt; 2"},
+		{"<p>non fermé <em>ici", "<p>non fermé <em>ici</em></p>"},
+		{"<p><strong>a</p>b</strong>", "<p><strong>a</strong></p>b"},
+		{"<div><p>texte</p></div><table><tr><td>cellule</td></tr></table>", "<p>texte</p>cellule"},
+	}
+	for _, tt := range tests {
+		if got := SanitizeHTML(tt.input); got != tt.want {
+			t.Errorf("SanitizeHTML(%q)\n got %q\nwant %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeHTML_XSS(t *testing.T) {
+	payloads := []string{
+		`<script>alert(1)</script>`,
+		`<SCRIPT SRC=//xss.example/x.js></SCRIPT>`,
+		`<scr<script>ipt>alert(1)</script>`,
+		`<<script>script>alert(1)<</script>/script>`,
+		`<img src=x onerror=alert(1)>`,
+		`<img src=x onerror=alert(1)//`,
+		`<IMG SRC=JaVaScRiPt:alert('XSS')>`,
+		`<img src="jav&#x09;ascript:alert(1)">`,
+		`<img src="data:image/svg+xml;base64,PHN2ZyBvbmxvYWQ9YWxlcnQoMSk+">`,
+		`<a href="javascript:alert(1)">x</a>`,
+		`<a href=" &#14;  javascript:alert(1)">x</a>`,
+		`<a href="java&#115;cript&colon;alert(1)">x</a>`,
+		`<a href="java&#115cript:alert(1)">x</a>`,
+		`<a href="vbscript:msgbox(1)">x</a>`,
+		`<a href="data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==">x</a>`,
+		`<a href="x" onclick="alert(1)" onmouseover=alert(1)>x</a>`,
+		`<a title="x" href="x"onclick=alert(1)>x</a>`,
+		`<p title="&quot;><script>alert(1)</script>">x</p>`,
+		`<p title='"' onclick='alert(1)'>x</p>`,
+		`<svg onload=alert(1)><script>alert(1)</script></svg>`,
+		`<svg><p><style><img src=x onerror=alert(1)></style></p></svg>`,
+		`<math><mtext><table><mglyph><style><img src=x onerror=alert(1)>`,
+		`<iframe src="javascript:alert(1)"></iframe>`,
+		`<iframe srcdoc="&lt;script&gt;alert(1)&lt;/script&gt;">`,
+		`<object data="javascript:alert(1)"></object><embed src="javascript:alert(1)">`,
+		`<style>@import 'javascript:alert(1)';</style>`,
+		`<p style="background-image: url(javascript:alert(1))">x</p>`,
+		`<p style="color: expression(alert(1))">x</p>`,
+		`<p style="color: red; behavior: url(x.htc)">x</p>`,
+		`<!--<img src=x onerror=alert(1)>-->`,
+		`<!--><script>alert(1)</script>-->`,
+		`<![CDATA[<script>alert(1)</script>]]>`,
+		`<form action="javascript:alert(1)"><input type=submit></form>`,
+		`<meta http-equiv="refresh" content="0;url=javascript:alert(1)">`,
+		`<base href="javascript:alert(1)//">`,
+		`<body onload=alert(1)>`,
+		`<textarea><script>alert(1)</script></textarea>`,
+		`<noscript><p title="</noscript><img src=x onerror=alert(1)>">`,
+		`&lt;script&gt;alert(1)&lt;/script&gt;`,
+		"<img\x00src=x onerror=alert(1)>",
+		"<img/src=x/ onerror=alert(1)>",
+		`<a href="x" =onclick=alert(1)>x</a>`,
+	}
+	forbidden := []string{"<script", "<svg", "<math", "<iframe", "<object", "<embed", "<style", "<form",
+		"<meta", "<base", "<body", "<input", "<textarea", "javascript:", "vbscript:", "data:text", "svg+xml",
+		"onerror", "onload", "onclick", "onmouseover", "expression", "url(", "srcdoc"}
+	for _, p := range payloads {
+		got := strings.ToLower(SanitizeHTML(p))
+		for _, f := range forbidden {
+			if strings.Contains(got, f) {
+				t.Errorf("SanitizeHTML(%q) = %q, contains %q", p, got, f)
+			}
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"api/config"
+	"api/models"
+)
+
+// ============================================================
+// IDEMPOTENCE — header Idempotency-Key sur les routes de paiement
+// ============================================================
+
+const (
+	IdempotencyHeader = "Idempotency-Key"
+	idempotencyTTL    = 24 * time.Hour
+	maxIdempotencyKey = 255
+	// idempotencyLease : au-delà, une réservation sans réponse (crash, redéploiement)
+	// est reprise par la requête suivante portant la même clé et le même corps.
+	idempotencyLease = 2 * time.Minute
+)
+
+// idempotencyRecord est l'état stocké pour une clé. Status == 0 signifie
+// que la première requête est encore en cours de traitement.
+type idempotencyRecord struct {
+	Fingerprint string
+	Status      int
+	ContentType string
+	Body        []byte
+	ReservedAt  time.Time
+}
+
+// IdempotencyStore persiste les clés d'idempotence et la première réponse associée.
+type IdempotencyStore interface {
+	// Reserve crée la clé si elle n'existe pas, ou reprend une réservation du même corps restée
+	// sans réponse depuis plus de lease (created=true) ; sinon retourne l'enregistrement existant.
+	Reserve(scope, key, fingerprint string, ttl, lease time.Duration) (rec idempotencyRecord, created bool, err error)
+	// Complete enregistre la réponse à rejouer.
+	Complete(scope, key string, status int, contentType string, body []byte) error
+	// Release supprime une réservation (échec serveur : le client pourra réessayer).
+	Release(scope, key string) error
+}
+
+var idempotencyStore IdempotencyStore = pgIdempotencyStore{}
+
+// InitIdempotency démarre la purge horaire des clés expirées.
+func InitIdempotency() {
+	go func() {
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			purgeExpiredIdempotencyKeys()
+		}
+	}()
+}
+
+func purgeExpiredIdempotencyKeys() {
+	if config.DB == nil {
+		return
+	}
+	res, err := config.DB.Exec("DELETE FROM idempotency_key WHERE date_expiration < NOW()")
+	if err != nil {
+		log.Printf("[WARN] idempotency purge: %v", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("[INFO] idempotency purge: %d expired keys removed", n)
+	}
+}
+
+// requestFingerprint identifie une requête par méthode, chemin et corps.
+func requestFingerprint(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// idempotencyScope isole les clés par utilisateur (ou par IP pour les routes publiques).
+func idempotencyScope(r *http.Request) string {
+	if userID, ok := r.Context().Value(models.UserIDKey).(int); ok {
+		return "user:" + strconv.Itoa(userID)
+	}
+	return "ip:" + GetClientIP(r)
+}
+
+// idempotencyRecorder transmet la réponse au client tout en la capturant.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *idempotencyRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *idempotencyRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// Idempotent rejoue la première réponse d'une requête portant le même
+// Idempotency-Key pendant 24h. La même clé avec un corps différent renvoie 409.
+// Sans header, la requête est traitée normalement.
+func Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			http.Error(w, `{"error":"Idempotency-Key too long"}`, http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, `{"error":"Request body too large"}`, http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		scope := idempotencyScope(r)
+		fingerprint := requestFingerprint(r.Method, r.URL.Path, body)
+
+		existing, created, err := idempotencyStore.Reserve(scope, key, fingerprint, idempotencyTTL, idempotencyLease)
+		if err != nil {
+			log.Printf("Idempotency reserve error (%s): %v", scope, err)
+			http.Error(w, `{"error":"Internal server error"}`, http.StatusInternalServerError)
+			return
+		}
+		if !created {
+			switch {
+			case existing.Fingerprint != fingerprint:
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(`{"error":"Idempotency-Key already used with a different request"}`))
+			case existing.Status == 0:
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(`{"error":"A request with this Idempotency-Key is still being processed"}`))
+			default:
+				if existing.ContentType != "" {
+					w.Header().Set("Content-Type", existing.ContentType)
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(existing.Status)
+				w.Write(existing.Body)
+			}
+			return
+		}
+
+		rec := &idempotencyRecorder{ResponseWriter: w}
+		defer func() {
+			if p := recover(); p != nil {
+				idempotencyStore.Release(scope, key)
+				panic(p)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		// Les erreurs serveur ne sont pas mémorisées : le client doit pouvoir réessayer.
+		if status >= 500 {
+			if err := idempotencyStore.Release(scope, key); err != nil {
+				log.Printf("Idempotency release error (%s): %v", scope, err)
+			}
+			return
+		}
+		if err := idempotencyStore.Complete(scope, key, status, rec.Header().Get("Content-Type"), rec.body.Bytes()); err != nil {
+			// Sans réponse mémorisée, la réservation bloquerait les nouvelles tentatives.
+			log.Printf("Idempotency complete error (%s): %v", scope, err)
+			if err := idempotencyStore.Release(scope, key); err != nil {
+				log.Printf("Idempotency release error (%s): %v", scope, err)
+			}
+		}
+	})
+}
+
+// ===== STOCKAGE POSTGRESQL =====
+
+type pgIdempotencyStore struct{}
+
+func (pgIdempotencyStore) Reserve(scope, key, fingerprint string, ttl, lease time.Duration) (idempotencyRecord, bool, error) {
+	var rec idempotencyRecord
+	if config.DB == nil {
+		return rec, false, fmt.Errorf("db not initialized")
+	}
+	config.DB.Exec("DELETE FROM idempotency_key WHERE portee=$1 AND cle=$2 AND date_expiration < NOW()", scope, key)
+
+	res, err := config.DB.Exec(`
+		INSERT INTO idempotency_key (portee, cle, empreinte, date_reservation, date_expiration)
+		VALUES ($1, $2, $3, NOW(), NOW() + $4 * INTERVAL '1 second')
+		ON CONFLICT (portee, cle) DO UPDATE
+		   SET date_reservation = NOW(), date_expiration = EXCLUDED.date_expiration
+		 WHERE idempotency_key.statut_reponse IS NULL
+		   AND idempotency_key.empreinte = EXCLUDED.empreinte
+		   AND idempotency_key.date_reservation < NOW() - $5 * INTERVAL '1 second'`,
+		scope, key, fingerprint, int(ttl.Seconds()), int(lease.Seconds()))
+	if err != nil {
+		return rec, false, err
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return rec, true, nil
+	}
+
+	var status sql.NullInt64
+	var contentType sql.NullString
+	err = config.DB.QueryRow(`
+		SELECT empreinte, statut_reponse, content_type, COALESCE(corps_reponse, ''::bytea), date_reservation
+		FROM idempotency_key WHERE portee=$1 AND cle=$2`, scope, key).Scan(
+		&rec.Fingerprint, &status, &contentType, &rec.Body, &rec.ReservedAt)
+	if err != nil {
+		return rec, false, err
+	}
+	rec.Status = int(status.Int64)
+	rec.ContentType = contentType.String
+	return rec, false, nil
+}
+
+func (pgIdempotencyStore) Complete(scope, key string, status int, contentType string, body []byte) error {
+	_, err := config.DB.Exec(`
+		UPDATE idempotency_key SET statut_reponse=$3, content_type=$4, corps_reponse=$5
+		WHERE portee=$1 AND cle=$2`, scope, key, status, contentType, body)
+	return err
+}
+
+func (pgIdempotencyStore) Release(scope, key string) error {
+	_, err := config.DB.Exec("DELETE FROM idempotency_key WHERE portee=$1 AND cle=$2", scope, key)
+	return err
+}
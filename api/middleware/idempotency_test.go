@@ -0,0 +1,249 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"api/models"
+)
+
+// memoryIdempotencyStore remplace le stockage PostgreSQL pendant les tests.
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]idempotencyRecord
+}
+
+func newMemoryIdempotencyStore() *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{records: make(map[string]idempotencyRecord)}
+}
+
+func (m *memoryIdempotencyStore) Reserve(scope, key, fingerprint string, ttl, lease time.Duration) (idempotencyRecord, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rec, ok := m.records[scope+"|"+key]
+	if ok && !(rec.Status == 0 && rec.Fingerprint == fingerprint && time.Since(rec.ReservedAt) > lease) {
+		return rec, false, nil
+	}
+	m.records[scope+"|"+key] = idempotencyRecord{Fingerprint: fingerprint, ReservedAt: time.Now()}
+	return idempotencyRecord{}, true, nil
+}
+
+func (m *memoryIdempotencyStore) Complete(scope, key string, status int, contentType string, body []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rec := m.records[scope+"|"+key]
+	rec.Status = status
+	rec.ContentType = contentType
+	rec.Body = append([]byte(nil), body...)
+	m.records[scope+"|"+key] = rec
+	return nil
+}
+
+func (m *memoryIdempotencyStore) Release(scope, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, scope+"|"+key)
+	return nil
+}
+
+func withMemoryIdempotencyStore(t *testing.T) *memoryIdempotencyStore {
+	t.Helper()
+	store := newMemoryIdempotencyStore()
+	prev := idempotencyStore
+	idempotencyStore = store
+	t.Cleanup(func() { idempotencyStore = prev })
+	return store
+}
+
+func idempotentRequest(body, key string, userID int) *http.Request {
+	req := httptest.NewRequest("POST", "/api/payments/charge", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(IdempotencyHeader, key)
+	}
+	return req.WithContext(context.WithValue(req.Context(), models.UserIDKey, userID))
+}
+
+func TestIdempotent_ReplaysFirstResponse(t *testing.T) {
+	withMemoryIdempotencyStore(t)
+	calls := 0
+	handler := Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		b, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"echo":` + string(b) + `}`))
+	}))
+
+	first := httptest.NewRecorder()
+	handler.ServeHTTP(first, idempotentRequest(`{"amount":100}`, "abc", 1))
+	second := httptest.NewRecorder()
+	handler.ServeHTTP(second, idempotentRequest(`{"amount":100}`, "abc", 1))
+
+	if calls != 1 {
+		t.Fatalf("expected handler to run once, ran %d times", calls)
+	}
+	if second.Code != http.StatusCreated {
+		t.Errorf("expected replayed status 201, got %d", second.Code)
+	}
+	if second.Body.String() != first.Body.String() {
+		t.Errorf("expected replayed body %q, got %q", first.Body.String(), second.Body.String())
+	}
+	if second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("expected Idempotent-Replayed header on replay")
+	}
+	if second.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected replayed content type, got %q", second.Header().Get("Content-Type"))
+	}
+}
+
+func TestIdempotent_DifferentBodyConflicts(t *testing.T) {
+	withMemoryIdempotencyStore(t)
+	handler := Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest(`{"amount":100}`, "abc", 1))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, idempotentRequest(`{"amount":999}`, "abc", 1))
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409 for reused key with different body, got %d", w.Code)
+	}
+}
+
+func TestIdempotent_KeysAreScopedPerUser(t *testing.T) {
+	withMemoryIdempotencyStore(t)
+	calls := 0
+	handler := Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest(`{}`, "same", 1))
+	handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest(`{}`, "same", 2))
+
+	if calls != 2 {
+		t.Errorf("expected each user to get their own key space, handler ran %d times", calls)
+	}
+}
+
+func TestIdempotent_ServerErrorIsNotStored(t *testing.T) {
+	store := withMemoryIdempotencyStore(t)
+	calls := 0
+	handler := Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest(`{}`, "retry", 1))
+	if len(store.records) != 0 {
+		t.Fatalf("expected reservation released after 5xx, got %d records", len(store.records))
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, idempotentRequest(`{}`, "retry", 1))
+	if calls != 2 || w.Code != http.StatusOK {
+		t.Errorf("expected retry to reach handler and succeed, calls=%d code=%d", calls, w.Code)
+	}
+}
+
+func TestIdempotent_InFlightConflicts(t *testing.T) {
+	store := withMemoryIdempotencyStore(t)
+	store.Reserve("user:1", "pending", requestFingerprint("POST", "/api/payments/charge", []byte(`{}`)), idempotencyTTL, idempotencyLease)
+
+	handler := Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not run while the first request is in flight")
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, idempotentRequest(`{}`, "pending", 1))
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409 while in flight, got %d", w.Code)
+	}
+}
+
+func TestIdempotent_StaleReservationTakenOver(t *testing.T) {
+	store := withMemoryIdempotencyStore(t)
+	store.records["user:1|crashed"] = idempotencyRecord{
+		Fingerprint: requestFingerprint("POST", "/api/payments/charge", []byte(`{}`)),
+		ReservedAt:  time.Now().Add(-idempotencyLease - time.Second),
+	}
+
+	calls := 0
+	handler := Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusCreated)
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, idempotentRequest(`{}`, "crashed", 1))
+
+	if calls != 1 || w.Code != http.StatusCreated {
+		t.Errorf("expected the stale reservation to be taken over, calls=%d code=%d", calls, w.Code)
+	}
+	if store.records["user:1|crashed"].Status != http.StatusCreated {
+		t.Errorf("expected the new response to be stored, got %+v", store.records["user:1|crashed"])
+	}
+}
+
+func TestIdempotent_CompleteFailureReleases(t *testing.T) {
+	store := &failingCompleteStore{withMemoryIdempotencyStore(t)}
+	idempotencyStore = store
+
+	handler := Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest(`{}`, "lost", 1))
+
+	if _, ok := store.records["user:1|lost"]; ok {
+		t.Error("expected the reservation to be released when the response cannot be stored")
+	}
+}
+
+// failingCompleteStore simule une erreur d'enregistrement de la réponse.
+type failingCompleteStore struct {
+	*memoryIdempotencyStore
+}
+
+func (failingCompleteStore) Complete(scope, key string, status int, contentType string, body []byte) error {
+	return io.ErrUnexpectedEOF
+}
+
+func TestIdempotent_NoHeaderPassesThrough(t *testing.T) {
+	store := withMemoryIdempotencyStore(t)
+	calls := 0
+	handler := Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest(`{}`, "", 1))
+	handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest(`{}`, "", 1))
+
+	if calls != 2 {
+		t.Errorf("expected 2 calls without Idempotency-Key, got %d", calls)
+	}
+	if len(store.records) != 0 {
+		t.Errorf("expected nothing stored without Idempotency-Key, got %d records", len(store.records))
+	}
+}
+
+func TestRequestFingerprint(t *testing.T) {
+	a := requestFingerprint("POST", "/api/commandes", []byte(`{"a":1}`))
+	if a != requestFingerprint("POST", "/api/commandes", []byte(`{"a":1}`)) {
+		t.Error("expected identical requests to share a fingerprint")
+	}
+	if a == requestFingerprint("POST", "/api/commandes", []byte(`{"a":2}`)) {
+		t.Error("expected different bodies to differ")
+	}
+	if a == requestFingerprint("POST", "/api/payments/charge", []byte(`{"a":1}`)) {
+		t.Error("expected different paths to differ")
+	}
+}
@@ -25,6 +25,11 @@ func (rr *responseRecorder) WriteHeader(code int) {
 	rr.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap expose le writer d'origine à http.ResponseController (Flush, délais des flux SSE).
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
 // routeDescription retourne un libellé métier lisible pour une paire méthode+route.
 func routeDescription(method, path string) string {
 	switch {
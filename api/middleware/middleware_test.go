@@ -5,6 +5,9 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
 
 	apierrors "api/errors"
 )
@@ -115,6 +118,25 @@ func TestMaxBodySize_OverLimit(t *testing.T) {
 	}
 }
 
+func TestMaxBodySize_RouteOverride(t *testing.T) {
+	SetBodyLimit("/upload", 4*maxBodySize)
+	r := mux.NewRouter()
+	r.Use(MaxBodySize)
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	r.HandleFunc("/upload", ok).Methods("POST")
+	r.HandleFunc("/other", ok).Methods("POST")
+
+	for path, want := range map[string]int{"/upload": http.StatusOK, "/other": http.StatusRequestEntityTooLarge} {
+		req := httptest.NewRequest("POST", path, nil)
+		req.ContentLength = 2 * maxBodySize
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("%s: expected %d, got %d", path, want, w.Code)
+		}
+	}
+}
+
 func TestRateLimiter_IsAllowed(t *testing.T) {
 	rl := newRateLimiter(3, 60*1000)
 	for i := 0; i < 3; i++ {
@@ -241,3 +263,25 @@ func TestResponseRecorder(t *testing.T) {
 	}
 }
 
+func TestDeprecated(t *testing.T) {
+	sunset := time.Date(2026, 6, 30, 0, 0, 0, 0, time.UTC)
+	handler := Deprecated(sunset, "/api/produits")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/web-products", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if got := w.Header().Get("Deprecation"); got != "true" {
+		t.Errorf("Deprecation: got %q", got)
+	}
+	if got := w.Header().Get("Sunset"); got != "Tue, 30 Jun 2026 00:00:00 GMT" {
+		t.Errorf("Sunset: got %q", got)
+	}
+	if got := w.Header().Get("Link"); got != `</api/produits>; rel="successor-version"` {
+		t.Errorf("Link: got %q", got)
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
 )
 
 func SecurityHeaders(next http.Handler) http.Handler {
@@ -48,7 +51,7 @@ func CORS(next http.Handler) http.Handler {
 			w.Header().Set("Access-Control-Allow-Origin", origin)
 		}
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
@@ -60,13 +63,47 @@ func CORS(next http.Handler) http.Handler {
 
 const maxBodySize = 1 << 20 // 1 MB
 
+// bodyLimits : plafonds propres à certaines routes (téléversements, imports), indexés
+// par modèle de chemin mux. Les autres routes gardent maxBodySize.
+var (
+	bodyLimitsMu sync.RWMutex
+	bodyLimits   = map[string]int64{}
+)
+
+// SetBodyLimit remplace maxBodySize pour la route de modèle pathTemplate
+// (ex. "/api/admin/catalog/import"). À appeler lors de l'enregistrement des routes.
+func SetBodyLimit(pathTemplate string, limit int64) {
+	bodyLimitsMu.Lock()
+	bodyLimits[pathTemplate] = limit
+	bodyLimitsMu.Unlock()
+}
+
+// bodyLimit renvoie le plafond applicable à la route résolue par mux.
+func bodyLimit(r *http.Request) int64 {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return maxBodySize
+	}
+	tpl, err := route.GetPathTemplate()
+	if err != nil {
+		return maxBodySize
+	}
+	bodyLimitsMu.RLock()
+	defer bodyLimitsMu.RUnlock()
+	if limit, ok := bodyLimits[tpl]; ok {
+		return limit
+	}
+	return maxBodySize
+}
+
 func MaxBodySize(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.ContentLength > maxBodySize {
+		limit := bodyLimit(r)
+		if r.ContentLength > limit {
 			http.Error(w, `{"error":"Request body too large"}`, http.StatusRequestEntityTooLarge)
 			return
 		}
-		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
 		next.ServeHTTP(w, r)
 	})
 }
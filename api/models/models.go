@@ -2,9 +2,14 @@ package models
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 )
 
+// Categorie, Service et Produit décrivent le catalogue legacy (categorie / service / produit).
+//
+// Deprecated: le catalogue canonique est CategorieWeb / ProduitWeb (tables categories / produits) ;
+// ces types ne servent plus qu'aux réponses de compatibilité pendant la période de dépréciation.
 type Categorie struct {
 	ID          int    `json:"id"`
 	Nom         string `json:"name"`
@@ -36,6 +41,11 @@ type Tarification struct {
 	Periodicite string  `json:"periodicity"`
 	Actif       bool    `json:"active"`
 	IDProduit   int     `json:"productId"`
+	// Facturation à l'usage : prix par unité consommée (nil = forfait) et agrégation sum | max.
+	PrixUsage  *float64 `json:"usagePrice,omitempty"`
+	Agregation string   `json:"usageAggregation,omitempty"`
+	// Variante tarifée (nil = prix du produit).
+	IDVariante *int `json:"variantId,omitempty"`
 }
 
 type Entreprise struct {
@@ -81,6 +91,8 @@ type CarouselImage struct {
 	DateCreation          time.Time `json:"date_creation"`
 	DateModification      time.Time `json:"date_modification"`
 	IDUtilisateurCreation *int      `json:"id_utilisateur_creation"`
+	// Média affiché ; url_image en est dérivée.
+	IDMedia *int `json:"id_media"`
 }
 
 type CategorieWeb struct {
@@ -118,6 +130,130 @@ type ProduitWeb struct {
 	DateCreation          time.Time `json:"date_creation"`
 	DateModification      time.Time `json:"date_modification"`
 	IDUtilisateurCreation *int      `json:"id_utilisateur_creation"`
+	// Médias du produit, dans l'ordre d'affichage ; s'ils sont fournis, images en est dérivé.
+	MediaIDs []int64 `json:"media_ids"`
+	// Plans tarifaires actifs (tarification) du produit.
+	Plans []Tarification `json:"plans,omitempty"`
+	// Matrice d'options : options proposées et variantes (une valeur par option).
+	Options   []ProduitOption   `json:"options,omitempty"`
+	Variantes []ProduitVariante `json:"variants,omitempty"`
+	// Produits souvent achetés avec celui-ci (co-occurrence dans les commandes).
+	AchetesEnsemble []ProduitAssocie `json:"frequently_bought_together,omitempty"`
+}
+
+type ProduitAssocie struct {
+	ID        int      `json:"id_produit"`
+	Nom       string   `json:"nom"`
+	Slug      string   `json:"slug"`
+	Images    string   `json:"images"`
+	Prix      *float64 `json:"prix"`
+	Commandes int      `json:"commandes"` // commandes contenant les deux produits
+}
+
+type ProduitOption struct {
+	ID      int            `json:"id"`
+	Code    string         `json:"code"`
+	Nom     string         `json:"name"`
+	Ordre   int            `json:"order"`
+	Valeurs []OptionValeur `json:"values"`
+}
+
+type OptionValeur struct {
+	ID      int    `json:"id"`
+	Code    string `json:"code"`
+	Libelle string `json:"label"`
+	Ordre   int    `json:"order"`
+}
+
+type ProduitVariante struct {
+	ID            int               `json:"id"`
+	IDProduit     int               `json:"productId"`
+	SKU           string            `json:"sku"`
+	Nom           string            `json:"name"`
+	Disponibilite string            `json:"availability"` // disponible | sur_devis | indisponible
+	Actif         bool              `json:"active"`
+	Ordre         int               `json:"order"`
+	Options       map[string]string `json:"options"` // code option → code valeur
+	Prix          []Tarification    `json:"prices"`
+}
+
+// CatalogDraft : modification de produit ou de catégorie préparée avant publication.
+type CatalogDraft struct {
+	ID              int             `json:"id"`
+	TypeContenu     string          `json:"type"` // produit | categorie
+	IDContenu       int             `json:"contentId"`
+	Version         int             `json:"version"`
+	Action          string          `json:"action"` // update | publish | unpublish
+	Donnees         json.RawMessage `json:"content,omitempty"`
+	Statut          string          `json:"status"`
+	DatePublication *time.Time      `json:"publishAt,omitempty"`
+	Erreur          string          `json:"error,omitempty"`
+	IDAuteur        *int            `json:"authorId,omitempty"`
+	DateCreation    time.Time       `json:"createdAt"`
+	DateModif       time.Time       `json:"updatedAt"`
+	DateApplication *time.Time      `json:"appliedAt,omitempty"`
+}
+
+// CatalogVersion : instantané d'un contenu du catalogue après une création, une
+// modification, une suppression ou une restauration.
+type CatalogVersion struct {
+	ID               int             `json:"id"`
+	TypeContenu      string          `json:"type"` // produit | categorie | tarification | carousel_image
+	IDContenu        int             `json:"contentId"`
+	Version          int             `json:"version"`
+	Action           string          `json:"action"` // create | update | delete | restore
+	Donnees          json.RawMessage `json:"data,omitempty"`
+	VersionRestauree *int            `json:"restoredFrom,omitempty"`
+	IDAuteur         *int            `json:"authorId,omitempty"`
+	Auteur           string          `json:"author,omitempty"`
+	DateCreation     time.Time       `json:"createdAt"`
+}
+
+// Media : image téléversée et ses déclinaisons (original ré-encodé, tailles réduites, WebP).
+type Media struct {
+	ID           int             `json:"id"`
+	Empreinte    string          `json:"sha256"`
+	NomOriginal  string          `json:"filename"`
+	TypeMime     string          `json:"mimeType"`
+	Taille       int             `json:"size"`
+	Largeur      int             `json:"width"`
+	Hauteur      int             `json:"height"`
+	AltText      string          `json:"alt"`
+	URL          string          `json:"url"` // déclinaison à référencer dans le catalogue
+	Variantes    json.RawMessage `json:"variants"`
+	IDAuteur     *int            `json:"authorId,omitempty"`
+	DateCreation time.Time       `json:"createdAt"`
+}
+
+// Pack : offre groupée de produits du catalogue, à prix fixe ou avec une remise en pourcentage.
+type Pack struct {
+	ID          int           `json:"id"`
+	Nom         string        `json:"name"`
+	Slug        string        `json:"slug"`
+	Description string        `json:"description"`
+	Prix        *float64      `json:"price,omitempty"`
+	RemisePct   *float64      `json:"discountPct,omitempty"`
+	Periodicite string        `json:"periodicity"`
+	Actif       bool          `json:"active"`
+	Ordre       int           `json:"order"`
+	Elements    []PackElement `json:"items"`
+	SousTotal   float64       `json:"subtotal"`
+	Remise      float64       `json:"discount"`
+	Total       float64       `json:"total"`
+	// Composant sans prix pour la périodicité du pack : le pack n'est pas vendable.
+	ErreurPrix string `json:"pricingError,omitempty"`
+}
+
+type PackElement struct {
+	IDProduit      int     `json:"productId"`
+	Nom            string  `json:"name"`
+	Slug           string  `json:"slug"`
+	IDVariante     *int    `json:"variantId,omitempty"`
+	SKU            string  `json:"sku,omitempty"`
+	Quantite       int     `json:"quantity"`
+	PrixCatalogue  float64 `json:"unitPrice"`       // prix unitaire catalogue pour la période
+	PrixPack       float64 `json:"bundleUnitPrice"` // part du prix du pack
+	IDTarification int     `json:"-"`
 }
 
 type Abonnement struct {
@@ -143,11 +279,56 @@ type Commande struct {
 }
 
 type Facture struct {
-	ID          int       `json:"id"`
-	DateFacture time.Time `json:"invoiceDate"`
-	Montant     float64   `json:"amount"`
-	LienPDF     string    `json:"pdfLink"`
-	IDCommande  int       `json:"orderId"`
+	ID          int            `json:"id"`
+	DateFacture time.Time      `json:"invoiceDate"`
+	Montant     float64        `json:"amount"`
+	LienPDF     string         `json:"pdfLink"`
+	IDCommande  int            `json:"orderId"`
+	Lignes      []FactureLigne `json:"lines,omitempty"`
+}
+
+type FactureLigne struct {
+	ID           int     `json:"id"`
+	Type         string  `json:"type"`
+	Libelle      string  `json:"label"`
+	Quantite     float64 `json:"quantity"`
+	PrixUnitaire float64 `json:"unitPrice"`
+	Montant      float64 `json:"amount"`
+	IDAbonnement *int    `json:"subscriptionId,omitempty"`
+}
+
+type Devis struct {
+	ID            int          `json:"id"`
+	Numero        string       `json:"number"`
+	Statut        string       `json:"status"`
+	Besoin        string       `json:"needs"`
+	IDUtilisateur int          `json:"userId"`
+	IDEntreprise  *int         `json:"companyId,omitempty"`
+	IDProduit     *int         `json:"productId,omitempty"`
+	Periodicite   string       `json:"periodicity"`
+	RemisePct     float64      `json:"discountPercent"`
+	DateValidite  *time.Time   `json:"validUntil,omitempty"`
+	Notes         string       `json:"notes,omitempty"`
+	IDCommercial  *int         `json:"salesUserId,omitempty"`
+	DateCreation  time.Time    `json:"createdAt"`
+	DateEnvoi     *time.Time   `json:"sentAt,omitempty"`
+	DateReponse   *time.Time   `json:"answeredAt,omitempty"`
+	MotifRefus    string       `json:"refusalReason,omitempty"`
+	IDCommande    *int         `json:"orderId,omitempty"`
+	IDAbonnement  *int         `json:"subscriptionId,omitempty"`
+	Lignes        []DevisLigne `json:"lines"`
+	ClientEmail   string       `json:"clientEmail,omitempty"`
+	ClientNom     string       `json:"clientName,omitempty"`
+	NomEntreprise string       `json:"companyName,omitempty"`
+	NomProduit    string       `json:"productName,omitempty"`
+}
+
+type DevisLigne struct {
+	ID           int     `json:"id"`
+	Libelle      string  `json:"label"`
+	Quantite     float64 `json:"quantity"`
+	PrixUnitaire float64 `json:"unitPrice"`
+	Recurrent    bool    `json:"recurring"`
 }
 
 type Paiement struct {
@@ -169,12 +350,16 @@ type TicketSupport struct {
 }
 
 type Notification struct {
-	ID            int       `json:"id"`
-	Type          string    `json:"type"`
-	Message       string    `json:"message"`
-	Lu            bool      `json:"read"`
-	DateCreation  time.Time `json:"createdAt"`
-	IDUtilisateur int       `json:"userId"`
+	ID            int             `json:"id"`
+	Type          string          `json:"type"`
+	Titre         string          `json:"title"`
+	Message       string          `json:"message"`
+	Lien          string          `json:"link,omitempty"`
+	Donnees       json.RawMessage `json:"data,omitempty"`
+	Lu            bool            `json:"read"`
+	DateLecture   *time.Time      `json:"readAt"`
+	DateCreation  time.Time       `json:"createdAt"`
+	IDUtilisateur int             `json:"userId"`
 }
 
 type APILog struct {
@@ -194,11 +379,15 @@ type APILog struct {
 type ContextKey string
 
 const (
-	UserIDKey   ContextKey = "userID"
-	UserRoleKey ContextKey = "userRole"
+	UserIDKey     ContextKey = "userID"
+	UserRoleKey   ContextKey = "userRole"
+	APITokenIDKey ContextKey = "apiTokenID"
+	SessionIDKey  ContextKey = "sessionID"
 )
 
+// TopProductSales : chiffres de vente d'un produit sur une fenêtre (administration).
 type TopProductSales struct {
+	Rang          int      `json:"rang"`
 	ID            int      `json:"id"`
 	Slug          string   `json:"slug,omitempty"`
 	Nom           string   `json:"nom"`
@@ -212,10 +401,34 @@ type TopProductSales struct {
 	Tag           string   `json:"tag,omitempty"`
 }
 
+// TopProduct : entrée du classement public des meilleures ventes, sans les chiffres.
+type TopProduct struct {
+	Rang              int      `json:"rang"`
+	ID                int      `json:"id_produit"`
+	Nom               string   `json:"nom"`
+	Slug              string   `json:"slug"`
+	DescriptionCourte string   `json:"description_courte"`
+	Images            string   `json:"images"`
+	Prix              *float64 `json:"prix"`
+	Devise            string   `json:"devise"`
+	Duree             string   `json:"duree"`
+	Tag               string   `json:"tag"`
+	IDCategorie       int      `json:"id_categorie"`
+	CategorieNom      string   `json:"categorie_nom"`
+	CategorieSlug     string   `json:"categorie_slug"`
+}
+
 type OrderItem struct {
 	ProductSlug string  `json:"product_slug,omitempty"`
 	ProductName string  `json:"product_name,omitempty"`
 	Price       float64 `json:"price,omitempty"`
 	Quantity    int     `json:"quantity,omitempty"`
 	Duration    string  `json:"duration,omitempty"`
+	// Variante choisie (produits à options) et tarification correspondante.
+	VariantSKU     string `json:"variant_sku,omitempty"`
+	VariantID      int    `json:"variant_id,omitempty"`
+	VariantName    string `json:"variant_name,omitempty"`
+	TarificationID int    `json:"tarification_id,omitempty"`
+	// Pack acheté (les composants sont décrits par le pack).
+	BundleSlug string `json:"bundle_slug,omitempty"`
 }
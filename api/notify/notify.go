@@ -0,0 +1,295 @@
+package notify
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"api/config"
+	"api/mailer"
+	"api/models"
+	"api/realtime"
+)
+
+// ============================================================
+// NOTIFICATIONS — centre de notifications des utilisateurs. Les autres
+// modules appellent Send ; les préférences de l'utilisateur décident de
+// l'affichage dans l'application et de l'envoi d'un email.
+// ============================================================
+
+// Types de notification.
+const (
+	TypeSecurite    = "securite"
+	TypeFacturation = "facturation"
+	TypeAbonnement  = "abonnement"
+	TypeSupport     = "support"
+	TypeInfo        = "info"
+)
+
+// Types : types connus, dans l'ordre d'affichage des préférences.
+var Types = []string{TypeSecurite, TypeFacturation, TypeAbonnement, TypeSupport, TypeInfo}
+
+const (
+	maxTitle   = 200
+	maxMessage = 2000
+	maxLink    = 500
+)
+
+var (
+	ErrUnknownType      = errors.New("notify: unknown notification type")
+	ErrPreferenceLocked = errors.New("notify: security notifications cannot be disabled in-app")
+)
+
+// Preference : canaux activés pour un type de notification.
+type Preference struct {
+	Type   string `json:"type"`
+	InApp  bool   `json:"inApp"`
+	Email  bool   `json:"email"`
+	Locked bool   `json:"locked"` // in-app obligatoire
+}
+
+// defaults : préférences sans choix de l'utilisateur. Factures et réponses aux tickets
+// ont déjà leurs propres emails : seule l'alerte in-app est active par défaut.
+var defaults = map[string]Preference{
+	TypeSecurite:    {Type: TypeSecurite, InApp: true, Email: true, Locked: true},
+	TypeFacturation: {Type: TypeFacturation, InApp: true},
+	TypeAbonnement:  {Type: TypeAbonnement, InApp: true, Email: true},
+	TypeSupport:     {Type: TypeSupport, InApp: true},
+	TypeInfo:        {Type: TypeInfo, InApp: true},
+}
+
+// ValidType : typ est un type de notification connu.
+func ValidType(typ string) bool {
+	_, ok := defaults[typ]
+	return ok
+}
+
+// Resolve applique aux préférences enregistrées (nil si aucune) les défauts et les
+// canaux obligatoires.
+func Resolve(typ string, stored *Preference) Preference {
+	p := defaults[typ]
+	if stored != nil {
+		p.InApp, p.Email = stored.InApp, stored.Email
+	}
+	if p.Locked {
+		p.InApp = true
+	}
+	return p
+}
+
+// Payload : contenu d'une notification. Title et Message sont du texte brut ; Link est
+// un chemin du front (/account/invoices/12) ou une URL absolue.
+type Payload struct {
+	Title   string
+	Message string
+	Link    string
+	Data    map[string]interface{}
+	// NoEmail : l'appelant envoie déjà son propre email pour cet événement.
+	NoEmail bool
+	// Urgent : événement aussi poussé sur les appareils mobiles (toujours vrai pour la
+	// sécurité).
+	Urgent bool
+}
+
+var typeTitles = map[string]string{
+	TypeSecurite:    "Sécurité du compte",
+	TypeFacturation: "Facturation",
+	TypeAbonnement:  "Abonnement",
+	TypeSupport:     "Support",
+	TypeInfo:        "Information",
+}
+
+// DefaultTitle : titre d'une notification de type typ créée sans titre.
+func DefaultTitle(typ string) string {
+	if t, ok := typeTitles[typ]; ok {
+		return t
+	}
+	return "Notification"
+}
+
+// Normalize complète le titre par défaut du type, tronque les champs trop longs et
+// écarte les liens invalides.
+func (p Payload) Normalize(typ string) Payload {
+	p.Title = truncate(strings.TrimSpace(p.Title), maxTitle)
+	if p.Title == "" {
+		p.Title = DefaultTitle(typ)
+	}
+	p.Message = truncate(strings.TrimSpace(p.Message), maxMessage)
+	p.Link = strings.TrimSpace(p.Link)
+	if len(p.Link) > maxLink || !safeLink(p.Link) {
+		p.Link = ""
+	}
+	if typ == TypeSecurite {
+		p.Urgent = true
+	}
+	return p
+}
+
+// safeLink : chemin du front ou URL http(s) (pas de javascript:, ni d'URL sans schéma).
+func safeLink(link string) bool {
+	l := strings.ToLower(link)
+	return strings.HasPrefix(l, "/") && !strings.HasPrefix(l, "//") ||
+		strings.HasPrefix(l, "https://") || strings.HasPrefix(l, "http://")
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return strings.TrimSpace(string([]rune(s)[:n-1])) + "…"
+}
+
+// AbsoluteLink rend un lien relatif absolu sur base (FRONTEND_URL) pour les emails.
+func AbsoluteLink(base, link string) string {
+	if link == "" || !strings.HasPrefix(link, "/") || strings.HasPrefix(link, "//") {
+		return link
+	}
+	return strings.TrimRight(base, "/") + link
+}
+
+// Send notifie un utilisateur selon ses préférences : notification in-app et/ou email
+// (envoyé en arrière-plan), push mobile pour les notifications urgentes affichées.
+func Send(userID int, typ string, p Payload) error {
+	if config.DB == nil {
+		return errors.New("notify: db not initialized")
+	}
+	if !ValidType(typ) {
+		return ErrUnknownType
+	}
+	p = p.Normalize(typ)
+	pref, err := userPreference(config.DB, userID, typ)
+	if err != nil {
+		return err
+	}
+	if pref.InApp {
+		n := models.Notification{Type: typ, Titre: p.Title, Message: p.Message, Lien: p.Link, IDUtilisateur: userID}
+		var data interface{}
+		if len(p.Data) > 0 {
+			b, err := json.Marshal(p.Data)
+			if err != nil {
+				return err
+			}
+			data, n.Donnees = string(b), b
+		}
+		if err := config.DB.QueryRow(`
+			INSERT INTO notification (type, titre, message, lien, donnees, id_utilisateur)
+			VALUES ($1, $2, $3, NULLIF($4, ''), $5::jsonb, $6)
+			RETURNING id_notification, date_creation`,
+			typ, p.Title, p.Message, p.Link, data, userID).Scan(&n.ID, &n.DateCreation); err != nil {
+			return err
+		}
+		realtime.Publish(userID, realtime.EventNotification, n)
+		if p.Urgent {
+			go sendPush(n)
+		}
+	}
+	if pref.Email && !p.NoEmail {
+		go sendEmail(userID, p)
+	}
+	return nil
+}
+
+// SendMany notifie plusieurs utilisateurs ; la première erreur est retournée après
+// avoir tenté tous les envois.
+func SendMany(userIDs []int, typ string, p Payload) error {
+	var first error
+	for _, id := range userIDs {
+		if err := Send(id, typ, p); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// SendAsync : Send en arrière-plan pour les événements annexes d'une requête ;
+// l'erreur est seulement journalisée.
+func SendAsync(userID int, typ string, p Payload) {
+	go func() {
+		if err := Send(userID, typ, p); err != nil {
+			log.Printf("[WARN] notify %s user %d: %v", typ, userID, err)
+		}
+	}()
+}
+
+func sendEmail(userID int, p Payload) {
+	var email string
+	if err := config.DB.QueryRow(
+		"SELECT COALESCE(email, '') FROM utilisateur WHERE id_utilisateur = $1 AND COALESCE(statut, 'actif') = 'actif'",
+		userID).Scan(&email); err != nil || email == "" {
+		return
+	}
+	// Les textes saisis par un utilisateur sont stockés échappés (mw.SanitizeString) :
+	// on les ramène au texte brut avant de les échapper pour l'email.
+	title := html.EscapeString(html.UnescapeString(p.Title))
+	body := fmt.Sprintf(`<p style="color:#333;line-height:1.6;">%s</p>`,
+		strings.ReplaceAll(html.EscapeString(html.UnescapeString(p.Message)), "\n", "<br>"))
+	if link := AbsoluteLink(os.Getenv("FRONTEND_URL"), p.Link); strings.HasPrefix(link, "http") {
+		body += fmt.Sprintf(`<p><a href="%s" style="color:#3b12a3;">Voir le détail</a></p>`, html.EscapeString(link))
+	}
+	if err := mailer.Send(email, html.UnescapeString(p.Title), mailer.Layout(title, body)); err != nil {
+		log.Printf("[EMAIL] notification to %s: %v", email, err)
+	}
+}
+
+// ===== PRÉFÉRENCES =====
+
+func userPreference(db *sql.DB, userID int, typ string) (Preference, error) {
+	var stored Preference
+	err := db.QueryRow("SELECT in_app, email FROM notification_preference WHERE id_utilisateur = $1 AND type = $2",
+		userID, typ).Scan(&stored.InApp, &stored.Email)
+	if err == sql.ErrNoRows {
+		return Resolve(typ, nil), nil
+	}
+	if err != nil {
+		return Preference{}, err
+	}
+	return Resolve(typ, &stored), nil
+}
+
+// Preferences : préférences de l'utilisateur pour chaque type, défauts compris.
+func Preferences(userID int) ([]Preference, error) {
+	rows, err := config.DB.Query("SELECT type, in_app, email FROM notification_preference WHERE id_utilisateur = $1", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stored := map[string]*Preference{}
+	for rows.Next() {
+		var p Preference
+		if err := rows.Scan(&p.Type, &p.InApp, &p.Email); err != nil {
+			return nil, err
+		}
+		stored[p.Type] = &p
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	prefs := make([]Preference, 0, len(Types))
+	for _, typ := range Types {
+		prefs = append(prefs, Resolve(typ, stored[typ]))
+	}
+	return prefs, nil
+}
+
+// SetPreference enregistre le choix de l'utilisateur pour un type.
+func SetPreference(userID int, p Preference) error {
+	if !ValidType(p.Type) {
+		return ErrUnknownType
+	}
+	if defaults[p.Type].Locked && !p.InApp {
+		return ErrPreferenceLocked
+	}
+	_, err := config.DB.Exec(`
+		INSERT INTO notification_preference (id_utilisateur, type, in_app, email)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id_utilisateur, type) DO UPDATE SET in_app = EXCLUDED.in_app, email = EXCLUDED.email,
+		       date_modification = NOW()`,
+		userID, p.Type, p.InApp, p.Email)
+	return err
+}
@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolve(t *testing.T) {
+	if p := Resolve(TypeFacturation, nil); !p.InApp || p.Email || p.Locked {
+		t.Errorf("facturation defaults = %+v", p)
+	}
+	if p := Resolve(TypeAbonnement, &Preference{InApp: false, Email: false}); p.InApp || p.Email {
+		t.Errorf("stored preference must override defaults, got %+v", p)
+	}
+	// La notification in-app de sécurité ne peut pas être désactivée, l'email si.
+	p := Resolve(TypeSecurite, &Preference{InApp: false, Email: false})
+	if !p.InApp || p.Email || !p.Locked || p.Type != TypeSecurite {
+		t.Errorf("securite = %+v", p)
+	}
+}
+
+func TestValidType(t *testing.T) {
+	for _, typ := range Types {
+		if !ValidType(typ) {
+			t.Errorf("%s must be valid", typ)
+		}
+	}
+	if ValidType("marketing") || ValidType("") {
+		t.Error("unknown types must be rejected")
+	}
+}
+
+func TestPayloadNormalize(t *testing.T) {
+	p := Payload{Message: "  Nouvelle facture  "}.Normalize(TypeFacturation)
+	if p.Title != "Facturation" || p.Message != "Nouvelle facture" {
+		t.Errorf("Normalize = %+v", p)
+	}
+	long := Payload{Title: strings.Repeat("é", 300), Link: "/" + strings.Repeat("a", 600)}.Normalize(TypeInfo)
+	if n := len([]rune(long.Title)); n != maxTitle || !strings.HasSuffix(long.Title, "…") {
+		t.Errorf("title truncated to %d runes", n)
+	}
+	if long.Link != "" {
+		t.Error("oversized link must be dropped")
+	}
+	for _, link := range []string{"javascript:alert(1)", "//evil.example.com", "account"} {
+		if p := (Payload{Link: link}).Normalize(TypeInfo); p.Link != "" {
+			t.Errorf("link %q must be dropped", link)
+		}
+	}
+	if !(Payload{}).Normalize(TypeSecurite).Urgent || (Payload{}).Normalize(TypeFacturation).Urgent {
+		t.Error("security notifications are always urgent, others only on request")
+	}
+}
+
+func TestAbsoluteLink(t *testing.T) {
+	cases := map[string]string{
+		"/account/invoices/12":     "https://cyna.fr/account/invoices/12",
+		"https://status.cyna.fr/":  "https://status.cyna.fr/",
+		"//evil.example.com/phish": "//evil.example.com/phish",
+		"":                         "",
+	}
+	for in, want := range cases {
+		if got := AbsoluteLink("https://cyna.fr/", in); got != want {
+			t.Errorf("AbsoluteLink(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCutoffs(t *testing.T) {
+	now := time.Date(2026, 6, 30, 12, 0, 0, 0, time.UTC)
+	read, unread := Cutoffs(now, 90)
+	if !read.Equal(time.Date(2026, 4, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("read cutoff = %s", read)
+	}
+	if !unread.Equal(now.AddDate(0, 0, -180)) {
+		t.Errorf("unread cutoff = %s", unread)
+	}
+}
+
+func TestRetentionDays(t *testing.T) {
+	t.Setenv("NOTIFICATION_RETENTION_DAYS", "")
+	if RetentionDays() != DefaultRetentionDays {
+		t.Error("default retention expected")
+	}
+	t.Setenv("NOTIFICATION_RETENTION_DAYS", "30")
+	if RetentionDays() != 30 {
+		t.Error("NOTIFICATION_RETENTION_DAYS ignored")
+	}
+	t.Setenv("NOTIFICATION_RETENTION_DAYS", "-1")
+	if RetentionDays() != DefaultRetentionDays {
+		t.Error("invalid retention must fall back to the default")
+	}
+}
@@ -0,0 +1,241 @@
+package notify
+
+import (
+	"database/sql"
+	"errors"
+	"html"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+
+	"api/config"
+	"api/models"
+	"api/push"
+)
+
+// ===== PUSH MOBILE =====
+
+// Les notifications urgentes (Payload.Urgent : sécurité, échecs de paiement) sont aussi
+// poussées sur les appareils enregistrés par l'application mobile, si l'utilisateur
+// garde ce type affiché dans l'application.
+
+// MaxDevicesPerUser : au-delà, les appareils inactifs depuis le plus longtemps sont retirés.
+const MaxDevicesPerUser = 10
+
+// receiptDelay : délai avant de vérifier les reçus (remise différée par le fournisseur).
+const receiptDelay = 15 * time.Minute
+
+var (
+	ErrInvalidPlatform = errors.New("notify: unknown device platform")
+	ErrInvalidToken    = errors.New("notify: invalid push token")
+	ErrDeviceClaimed   = errors.New("notify: push token registered by another active session")
+)
+
+// PushProvider est le fournisseur utilisé pour les pushs.
+// nil = push.Default(), résolu à chaque envoi (l'environnement est chargé après l'init des paquets).
+var PushProvider push.Provider
+
+func pushProvider() push.Provider {
+	if PushProvider != nil {
+		return PushProvider
+	}
+	return push.Default()
+}
+
+// Device : appareil mobile enregistré pour les pushs.
+type Device struct {
+	ID         int       `json:"id"`
+	Token      string    `json:"token"`
+	Platform   string    `json:"platform"`
+	Name       string    `json:"name,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+}
+
+// RegisterDevice enregistre (ou rafraîchit) le jeton d'un appareil pour userID depuis la
+// session sessionID ; created est faux pour un jeton déjà connu. Un jeton d'un autre
+// utilisateur n'est repris que si la session qui l'a enregistré n'est plus active
+// (déconnexion, expiration, réinitialisation du mot de passe) : ErrDeviceClaimed sinon.
+func RegisterDevice(userID, sessionID int, d Device) (Device, bool, error) {
+	if !push.ValidPlatform(d.Platform) {
+		return d, false, ErrInvalidPlatform
+	}
+	if len(d.Token) > 255 || !pushProvider().ValidToken(d.Token) {
+		return d, false, ErrInvalidToken
+	}
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return d, false, err
+	}
+	defer tx.Rollback()
+	previousOwner := 0
+	err = tx.QueryRow("SELECT id_utilisateur FROM appareil_push WHERE jeton = $1 FOR UPDATE", d.Token).Scan(&previousOwner)
+	if err != nil && err != sql.ErrNoRows {
+		return d, false, err
+	}
+
+	var created bool
+	err = tx.QueryRow(`
+		INSERT INTO appareil_push (id_utilisateur, jeton, plateforme, nom, id_session)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, 0))
+		ON CONFLICT (jeton) DO UPDATE SET id_utilisateur = EXCLUDED.id_utilisateur,
+		       plateforme = EXCLUDED.plateforme, nom = EXCLUDED.nom, id_session = EXCLUDED.id_session,
+		       date_derniere_activite = NOW()
+		WHERE appareil_push.id_utilisateur = EXCLUDED.id_utilisateur
+		   OR NOT EXISTS (SELECT 1 FROM session_utilisateur s
+		                  WHERE s.id_session = appareil_push.id_session AND s.date_expiration > NOW())
+		RETURNING id_appareil, COALESCE(nom, ''), date_creation, date_derniere_activite, xmax = 0`,
+		userID, d.Token, d.Platform, d.Name, sessionID).Scan(&d.ID, &d.Name, &d.CreatedAt, &d.LastSeenAt, &created)
+	if err == sql.ErrNoRows {
+		log.Printf("SECURITY: user %d tried to register the push token of user %d (session still active)", userID, previousOwner)
+		return d, false, ErrDeviceClaimed
+	}
+	if err != nil {
+		return d, false, err
+	}
+	if previousOwner != 0 && previousOwner != userID {
+		log.Printf("SECURITY: push token reassigned from user %d to user %d (previous session ended)", previousOwner, userID)
+	}
+	if _, err := tx.Exec(`
+		DELETE FROM appareil_push WHERE id_utilisateur = $1 AND id_appareil NOT IN (
+			SELECT id_appareil FROM appareil_push WHERE id_utilisateur = $1
+			ORDER BY date_derniere_activite DESC, id_appareil DESC LIMIT $2)`,
+		userID, MaxDevicesPerUser); err != nil {
+		return d, false, err
+	}
+	return d, created, tx.Commit()
+}
+
+// Devices : appareils de l'utilisateur, le plus récemment actif d'abord.
+func Devices(userID int) ([]Device, error) {
+	rows, err := config.DB.Query(`
+		SELECT id_appareil, jeton, plateforme, COALESCE(nom, ''), date_creation, date_derniere_activite
+		FROM appareil_push WHERE id_utilisateur = $1
+		ORDER BY date_derniere_activite DESC, id_appareil DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	devices := []Device{}
+	for rows.Next() {
+		var d Device
+		if err := rows.Scan(&d.ID, &d.Token, &d.Platform, &d.Name, &d.CreatedAt, &d.LastSeenAt); err != nil {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
+
+// RemoveDevice supprime un appareil de l'utilisateur (déconnexion de l'application) ;
+// faux s'il n'existe pas.
+func RemoveDevice(userID, deviceID int) (bool, error) {
+	res, err := config.DB.Exec("DELETE FROM appareil_push WHERE id_appareil = $1 AND id_utilisateur = $2", deviceID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// PushMessage construit le push d'une notification enregistrée ; les données permettent
+// à l'application d'ouvrir la notification.
+func PushMessage(n models.Notification) push.Message {
+	data := map[string]interface{}{"notificationId": n.ID, "type": n.Type}
+	if n.Lien != "" {
+		data["link"] = n.Lien
+	}
+	return push.Message{
+		Title:    html.UnescapeString(n.Titre),
+		Body:     html.UnescapeString(n.Message),
+		Data:     data,
+		Priority: push.PriorityHigh,
+	}
+}
+
+// sendPush envoie la notification aux appareils de l'utilisateur et retire les jetons
+// que le fournisseur déclare invalides, à l'envoi ou à la vérification des reçus.
+func sendPush(n models.Notification) {
+	sentAt := time.Now()
+	rows, err := config.DB.Query("SELECT jeton FROM appareil_push WHERE id_utilisateur = $1", n.IDUtilisateur)
+	if err != nil {
+		log.Printf("[WARN] notify: push devices of user %d: %v", n.IDUtilisateur, err)
+		return
+	}
+	var tokens []string
+	for rows.Next() {
+		var t string
+		if rows.Scan(&t) == nil {
+			tokens = append(tokens, t)
+		}
+	}
+	rows.Close()
+	if len(tokens) == 0 {
+		return
+	}
+
+	provider := pushProvider()
+	invalid, receipts, err := deliver(provider, tokens, PushMessage(n))
+	if err != nil {
+		log.Printf("[WARN] notify: push to user %d: %v", n.IDUtilisateur, err)
+	}
+	pruneTokens(invalid, sentAt)
+
+	checker, ok := provider.(push.ReceiptChecker)
+	if !ok || len(receipts) == 0 {
+		return
+	}
+	time.AfterFunc(receiptDelay, func() {
+		ids := make([]string, 0, len(receipts))
+		for id := range receipts {
+			ids = append(ids, id)
+		}
+		bad, err := checker.CheckReceipts(ids)
+		if err != nil {
+			log.Printf("[WARN] notify: push receipts: %v", err)
+		}
+		var tokens []string
+		for _, id := range bad {
+			tokens = append(tokens, receipts[id])
+		}
+		pruneTokens(tokens, sentAt)
+	})
+}
+
+// deliver envoie m aux jetons : jetons refusés comme invalides, et reçus à vérifier
+// (reçu → jeton). La première erreur d'envoi est retournée.
+func deliver(p push.Provider, tokens []string, m push.Message) (invalid []string, receipts map[string]string, err error) {
+	results, err := p.Send(tokens, m)
+	receipts = map[string]string{}
+	for _, r := range results {
+		switch {
+		case r.Invalid:
+			invalid = append(invalid, r.Token)
+		case r.Err != nil:
+			if err == nil {
+				err = r.Err
+			}
+		case r.ReceiptID != "":
+			receipts[r.ReceiptID] = r.Token
+		}
+	}
+	return invalid, receipts, err
+}
+
+// pruneTokens supprime les jetons que le fournisseur ne reconnaît plus, sauf ceux
+// réenregistrés depuis l'envoi.
+func pruneTokens(tokens []string, sentAt time.Time) {
+	if len(tokens) == 0 {
+		return
+	}
+	res, err := config.DB.Exec("DELETE FROM appareil_push WHERE jeton = ANY($1) AND date_derniere_activite <= $2",
+		pq.Array(tokens), sentAt)
+	if err != nil {
+		log.Printf("[WARN] notify: prune push tokens: %v", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("[INFO] notify: %d push token(s) removed (device no longer registered)", n)
+	}
+}
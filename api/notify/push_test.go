@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"testing"
+
+	"api/models"
+	"api/push"
+)
+
+func TestPushMessage(t *testing.T) {
+	m := PushMessage(models.Notification{ID: 12, Type: TypeSecurite, Titre: "Cl&#39;é ajoutée",
+		Message: "Depuis l&#39;IP 1.2.3.4", Lien: "/parametres.html"})
+	if m.Title != "Cl'é ajoutée" || m.Body != "Depuis l'IP 1.2.3.4" {
+		t.Errorf("stored text must be unescaped, got %q / %q", m.Title, m.Body)
+	}
+	if m.Priority != push.PriorityHigh || m.Data["notificationId"] != 12 || m.Data["link"] != "/parametres.html" {
+		t.Errorf("unexpected message %+v", m)
+	}
+	if _, ok := PushMessage(models.Notification{ID: 1}).Data["link"]; ok {
+		t.Error("empty link must be omitted")
+	}
+}
+
+func TestDeliverWithFake(t *testing.T) {
+	f := push.NewFake("ExponentPushToken[dead]")
+	invalid, receipts, err := deliver(f, []string{"ExponentPushToken[a]", "ExponentPushToken[dead]"},
+		push.Message{Title: "Échec du paiement"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invalid) != 1 || invalid[0] != "ExponentPushToken[dead]" {
+		t.Errorf("invalid = %v", invalid)
+	}
+	if len(receipts) != 1 {
+		t.Fatalf("receipts = %v", receipts)
+	}
+	for _, token := range receipts {
+		if token != "ExponentPushToken[a]" {
+			t.Errorf("receipt mapped to %q", token)
+		}
+	}
+	if sent := f.Messages(); len(sent) != 1 || sent[0].Message.Title != "Échec du paiement" {
+		t.Errorf("sent = %+v", sent)
+	}
+}
@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"api/config"
+)
+
+// DefaultRetentionDays : conservation des notifications lues (NOTIFICATION_RETENTION_DAYS).
+const DefaultRetentionDays = 90
+
+// RetentionDays : durée de conservation configurée, en jours.
+func RetentionDays() int {
+	if d, err := strconv.Atoi(os.Getenv("NOTIFICATION_RETENTION_DAYS")); err == nil && d > 0 {
+		return d
+	}
+	return DefaultRetentionDays
+}
+
+// Cutoffs : les notifications lues créées avant read sont supprimées, toutes celles
+// créées avant unread aussi (une notification jamais lue est gardée deux fois plus longtemps).
+func Cutoffs(now time.Time, days int) (read, unread time.Time) {
+	d := time.Duration(days) * 24 * time.Hour
+	return now.Add(-d), now.Add(-2 * d)
+}
+
+// InitCleanup démarre la purge quotidienne des anciennes notifications.
+func InitCleanup() {
+	days := RetentionDays()
+	go func() {
+		ticker := time.NewTicker(24 * time.Hour)
+		defer ticker.Stop()
+		for {
+			if n, err := Cleanup(time.Now()); err != nil {
+				log.Printf("[WARN] notification cleanup: %v", err)
+			} else if n > 0 {
+				log.Printf("[INFO] notification cleanup: %d notifications supprimées", n)
+			}
+			<-ticker.C
+		}
+	}()
+	log.Printf("[INFO] Notification cleanup ready (retention: %d days)", days)
+}
+
+// Cleanup supprime les notifications arrivées au terme de leur conservation.
+func Cleanup(now time.Time) (int64, error) {
+	if config.DB == nil {
+		return 0, nil
+	}
+	read, unread := Cutoffs(now, RetentionDays())
+	res, err := config.DB.Exec(`
+		DELETE FROM notification
+		WHERE (lu AND date_creation < $1) OR date_creation < $2`, read, unread)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
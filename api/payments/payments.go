@@ -0,0 +1,161 @@
+package payments
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// PAIEMENTS — fournisseur de paiement (Stripe par défaut)
+// ============================================================
+
+// ErrNotConfigured est retourné quand aucune clé fournisseur n'est définie.
+var ErrNotConfigured = errors.New("payment provider not configured")
+
+// DeclinedError signale un paiement refusé par le fournisseur (carte refusée, fonds insuffisants…).
+type DeclinedError struct {
+	Message string
+}
+
+func (e *DeclinedError) Error() string {
+	return "payment declined: " + e.Message
+}
+
+// ChargeRequest décrit un débit. Source (token carte) ou Customer (moyen enregistré) est requis.
+type ChargeRequest struct {
+	AmountCents    int64
+	Currency       string
+	Source         string
+	Customer       string
+	Description    string
+	IdempotencyKey string
+}
+
+// Provider est implémenté par chaque fournisseur de paiement.
+type Provider interface {
+	// Charge débite le montant et retourne l'identifiant de transaction.
+	Charge(req ChargeRequest) (string, error)
+	// CreateCustomer enregistre un moyen de paiement réutilisable (renouvellements).
+	CreateCustomer(email, source string) (string, error)
+}
+
+// Default retourne le fournisseur configuré par l'environnement (STRIPE_SECRET_KEY).
+func Default() Provider {
+	return &Stripe{SecretKey: os.Getenv("STRIPE_SECRET_KEY")}
+}
+
+// ToCents convertit un montant NUMERIC(10,2) en centimes.
+func ToCents(amount float64) int64 {
+	if amount < 0 {
+		return int64(amount*100 - 0.5)
+	}
+	return int64(amount*100 + 0.5)
+}
+
+// ===== STRIPE =====
+
+const stripeBaseURL = "https://api.stripe.com/v1"
+
+type Stripe struct {
+	SecretKey string
+	BaseURL   string
+	Client    *http.Client
+}
+
+func (s *Stripe) configured() bool {
+	return s.SecretKey != "" && !strings.HasPrefix(s.SecretKey, "sk_test_...")
+}
+
+func (s *Stripe) Charge(req ChargeRequest) (string, error) {
+	if req.Currency == "" {
+		req.Currency = "eur"
+	}
+	params := url.Values{}
+	params.Set("amount", fmt.Sprintf("%d", req.AmountCents))
+	params.Set("currency", req.Currency)
+	if req.Customer != "" {
+		params.Set("customer", req.Customer)
+	}
+	if req.Source != "" {
+		params.Set("source", req.Source)
+	}
+	if req.Description != "" {
+		params.Set("description", req.Description)
+	}
+	var resp struct {
+		ID string `json:"id"`
+	}
+	if err := s.post("/charges", params, req.IdempotencyKey, &resp); err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+func (s *Stripe) CreateCustomer(email, source string) (string, error) {
+	params := url.Values{}
+	params.Set("email", email)
+	params.Set("source", source)
+	var resp struct {
+		ID string `json:"id"`
+	}
+	if err := s.post("/customers", params, "", &resp); err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+func (s *Stripe) post(path string, params url.Values, idempotencyKey string, out interface{}) error {
+	if !s.configured() {
+		return ErrNotConfigured
+	}
+	base := s.BaseURL
+	if base == "" {
+		base = stripeBaseURL
+	}
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 20 * time.Second}
+	}
+
+	req, err := http.NewRequest("POST", base+path, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.SecretKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("stripe: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		var stripeErr struct {
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(body, &stripeErr)
+		msg := "Payment failed"
+		if stripeErr.Error != nil && stripeErr.Error.Message != "" {
+			msg = stripeErr.Error.Message
+		}
+		if resp.StatusCode >= 500 {
+			return fmt.Errorf("stripe: %d %s", resp.StatusCode, msg)
+		}
+		return &DeclinedError{Message: msg}
+	}
+	return json.Unmarshal(body, out)
+}
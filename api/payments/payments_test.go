@@ -0,0 +1,73 @@
+package payments
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStripeCharge_SendsCustomerAndIdempotencyKey(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/charges" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer sk_live_x" {
+			t.Errorf("missing bearer auth, got %q", r.Header.Get("Authorization"))
+		}
+		if r.Header.Get("Idempotency-Key") != "renew-1" {
+			t.Errorf("expected idempotency key forwarded, got %q", r.Header.Get("Idempotency-Key"))
+		}
+		r.ParseForm()
+		if r.PostForm.Get("customer") != "cus_1" || r.PostForm.Get("amount") != "1999" || r.PostForm.Get("currency") != "eur" {
+			t.Errorf("unexpected form %v", r.PostForm)
+		}
+		w.Write([]byte(`{"id":"ch_123"}`))
+	}))
+	defer srv.Close()
+
+	s := &Stripe{SecretKey: "sk_live_x", BaseURL: srv.URL}
+	id, err := s.Charge(ChargeRequest{AmountCents: 1999, Customer: "cus_1", IdempotencyKey: "renew-1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != "ch_123" {
+		t.Errorf("expected ch_123, got %q", id)
+	}
+}
+
+func TestStripeCharge_Declined(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusPaymentRequired)
+		w.Write([]byte(`{"error":{"message":"Your card was declined."}}`))
+	}))
+	defer srv.Close()
+
+	s := &Stripe{SecretKey: "sk_live_x", BaseURL: srv.URL}
+	_, err := s.Charge(ChargeRequest{AmountCents: 100, Source: "tok_x"})
+	var declined *DeclinedError
+	if !errors.As(err, &declined) {
+		t.Fatalf("expected DeclinedError, got %v", err)
+	}
+	if declined.Message != "Your card was declined." {
+		t.Errorf("unexpected message %q", declined.Message)
+	}
+}
+
+func TestStripe_NotConfigured(t *testing.T) {
+	for _, key := range []string{"", "sk_test_..."} {
+		s := &Stripe{SecretKey: key}
+		if _, err := s.Charge(ChargeRequest{AmountCents: 100}); !errors.Is(err, ErrNotConfigured) {
+			t.Errorf("key %q: expected ErrNotConfigured, got %v", key, err)
+		}
+	}
+}
+
+func TestToCents(t *testing.T) {
+	cases := map[float64]int64{19.99: 1999, 0.1: 10, 120: 12000, 0: 0}
+	for in, want := range cases {
+		if got := ToCents(in); got != want {
+			t.Errorf("ToCents(%v) = %d, want %d", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// ============================================================
+// PDF — générateur minimal (texte, traits, aplats) sans dépendance.
+// Polices standard Helvetica / Helvetica-Bold en WinAnsiEncoding.
+// ============================================================
+
+// Dimensions A4 en points.
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+type Document struct {
+	pages []*Page
+	title string
+}
+
+// Page accumule les opérateurs de contenu. Les coordonnées sont exprimées
+// depuis le coin supérieur gauche (y vers le bas).
+type Page struct {
+	content bytes.Buffer
+}
+
+func New(title string) *Document {
+	return &Document{title: title}
+}
+
+func (d *Document) AddPage() *Page {
+	p := &Page{}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// Text écrit une ligne de texte ; (x, y) est la ligne de base.
+func (p *Page) Text(x, y, size float64, bold bool, r, g, b float64, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(&p.content, "BT %.3f %.3f %.3f rg /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n",
+		r, g, b, font, size, x, PageHeight-y, escape(encode(s)))
+}
+
+// TextRight écrit un texte aligné à droite sur x.
+func (p *Page) TextRight(x, y, size float64, bold bool, r, g, b float64, s string) {
+	p.Text(x-TextWidth(s, size, bold), y, size, bold, r, g, b, s)
+}
+
+// Line trace un trait gris.
+func (p *Page) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(&p.content, "0.85 0.85 0.85 RG %.2f w %.2f %.2f m %.2f %.2f l S\n",
+		width, x1, PageHeight-y1, x2, PageHeight-y2)
+}
+
+// FillRect peint un rectangle ; (x, y) est le coin supérieur gauche.
+func (p *Page) FillRect(x, y, w, h, r, g, b float64) {
+	fmt.Fprintf(&p.content, "%.3f %.3f %.3f rg %.2f %.2f %.2f %.2f re f\n",
+		r, g, b, x, PageHeight-y-h, w, h)
+}
+
+// Bytes sérialise le document.
+func (d *Document) Bytes() []byte {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+	var out bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// 1 catalogue, 2 arbre des pages, 3-4 polices, 5 infos, puis (page, contenu) par page.
+	const firstPage = 6
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	obj(fmt.Sprintf("<< /Title (%s) /Producer (CYNA) >>", escape(encode(d.title))))
+	for i, p := range d.pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			PageWidth, PageHeight, firstPage+2*i+1))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.content.Len(), p.content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// winAnsi couvre les caractères hors Latin-1 présents dans nos textes.
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92,
+	'“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+	'œ': 0x9C, 'Œ': 0x8C, ' ': 0xA0,
+}
+
+// encode convertit une chaîne UTF-8 en WinAnsi ; les caractères absents deviennent '?'.
+func encode(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r == '\n' || r == '\r' || r == '\t':
+			out = append(out, ' ')
+		case r < 0x80 || (r >= 0xA0 && r <= 0xFF):
+			out = append(out, byte(r))
+		default:
+			if b, ok := winAnsi[r]; ok {
+				out = append(out, b)
+			} else {
+				out = append(out, '?')
+			}
+		}
+	}
+	return out
+}
+
+func escape(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		switch c {
+		case '(', ')', '\\':
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// Largeurs Helvetica (1/1000 em) des caractères courants ; 556 par défaut.
+var widths = map[byte]int{
+	' ': 278, ',': 278, '.': 278, ':': 278, ';': 278, '-': 333, '/': 278, '(': 333, ')': 333,
+	'%': 889, '\'': 191, 'I': 278, 'i': 222, 'j': 222, 'l': 222, 'f': 278, 't': 278, 'r': 333,
+	'm': 833, 'w': 722, 'M': 833, 'W': 944, 0xA0: 278, 0x80: 556,
+}
+
+// TextWidth estime la largeur d'un texte en points (suffisant pour aligner des montants).
+func TextWidth(s string, size float64, bold bool) float64 {
+	total := 0
+	for _, c := range encode(s) {
+		w, ok := widths[c]
+		if !ok {
+			w = 556
+		}
+		if bold && c >= 'a' && c <= 'z' {
+			w += 30
+		}
+		total += w
+	}
+	return float64(total) * size / 1000
+}
+
+// Wrap découpe un texte en lignes d'au plus maxWidth points.
+func Wrap(s string, size, maxWidth float64) []string {
+	var lines []string
+	for _, para := range strings.Split(s, "\n") {
+		words := strings.Fields(para)
+		line := ""
+		for _, w := range words {
+			candidate := w
+			if line != "" {
+				candidate = line + " " + w
+			}
+			if line != "" && TextWidth(candidate, size, false) > maxWidth {
+				lines = append(lines, line)
+				line = w
+				continue
+			}
+			line = candidate
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
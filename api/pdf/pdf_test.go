@@ -0,0 +1,64 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestBytes_StructureAndXref(t *testing.T) {
+	doc := New("Devis DEV-2025-00001")
+	doc.AddPage().Text(40, 60, 12, true, 0, 0, 0, "Bonjour")
+	doc.AddPage().Text(40, 60, 12, false, 0, 0, 0, "Page 2")
+	out := doc.Bytes()
+
+	if !bytes.HasPrefix(out, []byte("%PDF-1.4")) || !bytes.HasSuffix(out, []byte("%%EOF\n")) {
+		t.Fatal("missing PDF header or trailer")
+	}
+	if !bytes.Contains(out, []byte("/Count 2")) {
+		t.Error("expected two pages in page tree")
+	}
+
+	// Chaque entrée xref doit pointer sur "N 0 obj".
+	m := regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(out)
+	if m == nil {
+		t.Fatal("missing startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	entries := regexp.MustCompile(`(\d{10}) 00000 n`).FindAllSubmatch(out[xref:], -1)
+	if len(entries) != 9 {
+		t.Fatalf("expected 9 objects, got %d", len(entries))
+	}
+	for i, e := range entries {
+		off, _ := strconv.Atoi(string(e[1]))
+		want := fmt.Sprintf("%d 0 obj", i+1)
+		if !bytes.HasPrefix(out[off:], []byte(want)) {
+			t.Errorf("xref entry %d does not point to %q", i+1, want)
+		}
+	}
+}
+
+func TestEncodeAndEscape(t *testing.T) {
+	got := escape(encode("Crédit (5 €) \\ œuvre ☃"))
+	want := "Cr\xe9dit \\(5 \x80\\) \\\\ \x9cuvre ?"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTextWidthAndWrap(t *testing.T) {
+	if w := TextWidth("100", 10, false); w != 16.68 {
+		t.Errorf("expected 16.68, got %v", w)
+	}
+	lines := Wrap("un deux trois quatre cinq six sept", 10, 60)
+	if len(lines) < 2 {
+		t.Fatalf("expected wrapping, got %q", lines)
+	}
+	for _, l := range lines {
+		if TextWidth(l, 10, false) > 60 {
+			t.Errorf("line %q exceeds width", l)
+		}
+	}
+}
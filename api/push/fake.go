@@ -0,0 +1,58 @@
+package push
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Fake est un fournisseur en mémoire pour les tests : il enregistre les envois et
+// signale invalides les jetons passés à NewFake.
+type Fake struct {
+	mu       sync.Mutex
+	invalid  map[string]bool
+	sent     []Sent
+	receipts int
+}
+
+// Sent : message envoyé à un jeton par le Fake.
+type Sent struct {
+	Token   string
+	Message Message
+}
+
+// NewFake crée un fournisseur en mémoire ; les jetons invalid sont refusés à l'envoi.
+func NewFake(invalid ...string) *Fake {
+	f := &Fake{invalid: map[string]bool{}}
+	for _, t := range invalid {
+		f.invalid[t] = true
+	}
+	return f
+}
+
+func (f *Fake) ValidToken(token string) bool {
+	return strings.TrimSpace(token) != ""
+}
+
+func (f *Fake) Send(tokens []string, m Message) ([]Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	results := make([]Result, len(tokens))
+	for i, token := range tokens {
+		if f.invalid[token] {
+			results[i] = Result{Token: token, Invalid: true}
+			continue
+		}
+		f.receipts++
+		f.sent = append(f.sent, Sent{Token: token, Message: m})
+		results[i] = Result{Token: token, ReceiptID: "fake-" + strconv.Itoa(f.receipts)}
+	}
+	return results, nil
+}
+
+// Messages retourne une copie des envois réussis.
+func (f *Fake) Messages() []Sent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Sent(nil), f.sent...)
+}
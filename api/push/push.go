@@ -0,0 +1,214 @@
+package push
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// PUSH — notifications mobiles (Expo Push par défaut)
+// ============================================================
+
+// Plateformes d'appareil acceptées à l'enregistrement.
+const (
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+)
+
+// ValidPlatform : plateforme d'appareil connue.
+func ValidPlatform(p string) bool {
+	return p == PlatformIOS || p == PlatformAndroid
+}
+
+// Priorités d'envoi.
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+)
+
+// Message : notification à afficher sur l'appareil.
+type Message struct {
+	Title    string
+	Body     string
+	Data     map[string]interface{}
+	Priority string
+}
+
+// Result : issue de l'envoi vers un jeton. Invalid signale un jeton à supprimer
+// (application désinstallée, jeton expiré) ; ReceiptID permet de vérifier la
+// remise plus tard (ReceiptChecker).
+type Result struct {
+	Token     string
+	ReceiptID string
+	Invalid   bool
+	Err       error
+}
+
+// Provider est implémenté par chaque fournisseur de push.
+type Provider interface {
+	// ValidToken vérifie le format d'un jeton d'appareil avant son enregistrement.
+	ValidToken(token string) bool
+	// Send envoie le message à chaque jeton ; un résultat par jeton, dans l'ordre.
+	Send(tokens []string, m Message) ([]Result, error)
+}
+
+// ReceiptChecker est implémenté par les fournisseurs qui confirment la remise en
+// différé : certains jetons ne sont signalés invalides qu'à ce moment.
+type ReceiptChecker interface {
+	// CheckReceipts retourne les reçus dont l'appareil n'est plus enregistré.
+	CheckReceipts(ids []string) (invalid []string, err error)
+}
+
+// Default retourne le fournisseur configuré par l'environnement (EXPO_ACCESS_TOKEN,
+// facultatif sauf si la sécurité des envois est activée sur le projet Expo).
+func Default() Provider {
+	return &Expo{AccessToken: os.Getenv("EXPO_ACCESS_TOKEN")}
+}
+
+// ===== EXPO =====
+
+const (
+	expoBaseURL = "https://exp.host/--/api/v2/push"
+	// Limites de l'API Expo par requête.
+	expoSendBatch    = 100
+	expoReceiptBatch = 1000
+	// expoDeviceNotRegistered : erreur Expo d'un jeton à supprimer.
+	expoDeviceNotRegistered = "DeviceNotRegistered"
+)
+
+var expoToken = regexp.MustCompile(`^Expo(nent)?PushToken\[[A-Za-z0-9_-]+\]$`)
+
+type Expo struct {
+	AccessToken string
+	BaseURL     string
+	Client      *http.Client
+}
+
+// expoTicket : réponse d'Expo pour un message (envoi) ou un reçu.
+type expoTicket struct {
+	Status  string `json:"status"`
+	ID      string `json:"id"`
+	Message string `json:"message"`
+	Details struct {
+		Error string `json:"error"`
+	} `json:"details"`
+}
+
+func (e *Expo) ValidToken(token string) bool {
+	return expoToken.MatchString(token)
+}
+
+func (e *Expo) Send(tokens []string, m Message) ([]Result, error) {
+	priority := m.Priority
+	if priority == "" {
+		priority = PriorityNormal
+	}
+	results := make([]Result, 0, len(tokens))
+	for start := 0; start < len(tokens); start += expoSendBatch {
+		batch := tokens[start:min(start+expoSendBatch, len(tokens))]
+		messages := make([]map[string]interface{}, len(batch))
+		for i, token := range batch {
+			msg := map[string]interface{}{
+				"to":       token,
+				"title":    m.Title,
+				"body":     m.Body,
+				"priority": priority,
+				"sound":    "default",
+			}
+			if len(m.Data) > 0 {
+				msg["data"] = m.Data
+			}
+			messages[i] = msg
+		}
+		var resp struct {
+			Data []expoTicket `json:"data"`
+		}
+		if err := e.post("/send", messages, &resp); err != nil {
+			return results, err
+		}
+		if len(resp.Data) != len(batch) {
+			return results, fmt.Errorf("expo: %d tickets for %d messages", len(resp.Data), len(batch))
+		}
+		for i, t := range resp.Data {
+			r := Result{Token: batch[i], ReceiptID: t.ID}
+			if t.Status == "error" {
+				r.Invalid = t.Details.Error == expoDeviceNotRegistered
+				r.Err = fmt.Errorf("expo: %s", t.Message)
+			}
+			results = append(results, r)
+		}
+	}
+	return results, nil
+}
+
+func (e *Expo) CheckReceipts(ids []string) ([]string, error) {
+	var invalid []string
+	for start := 0; start < len(ids); start += expoReceiptBatch {
+		batch := ids[start:min(start+expoReceiptBatch, len(ids))]
+		var resp struct {
+			Data map[string]expoTicket `json:"data"`
+		}
+		if err := e.post("/getReceipts", map[string]interface{}{"ids": batch}, &resp); err != nil {
+			return invalid, err
+		}
+		for id, t := range resp.Data {
+			if t.Status == "error" && t.Details.Error == expoDeviceNotRegistered {
+				invalid = append(invalid, id)
+			}
+		}
+	}
+	return invalid, nil
+}
+
+func (e *Expo) post(path string, payload, out interface{}) error {
+	base := e.BaseURL
+	if base == "" {
+		base = expoBaseURL
+	}
+	client := e.Client
+	if client == nil {
+		client = &http.Client{Timeout: 20 * time.Second}
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", base+path, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if e.AccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+e.AccessToken)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("expo: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		var expoErr struct {
+			Errors []struct {
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+		json.Unmarshal(body, &expoErr)
+		var msgs []string
+		for _, m := range expoErr.Errors {
+			msgs = append(msgs, m.Message)
+		}
+		return fmt.Errorf("expo: %d %s", resp.StatusCode, strings.Join(msgs, "; "))
+	}
+	return json.Unmarshal(body, out)
+}
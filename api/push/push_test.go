@@ -0,0 +1,116 @@
+package push
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExpoSend_ReportsInvalidTokens(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/send" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer expo_x" {
+			t.Errorf("missing bearer auth, got %q", r.Header.Get("Authorization"))
+		}
+		var msgs []map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&msgs); err != nil || len(msgs) != 2 {
+			t.Errorf("unexpected body %v (%v)", msgs, err)
+			return
+		}
+		if msgs[0]["priority"] != "high" || msgs[0]["title"] != "Alerte" || msgs[1]["to"] != "ExponentPushToken[b]" {
+			t.Errorf("unexpected messages %v", msgs)
+		}
+		w.Write([]byte(`{"data":[
+			{"status":"ok","id":"r1"},
+			{"status":"error","message":"not registered","details":{"error":"DeviceNotRegistered"}}
+		]}`))
+	}))
+	defer srv.Close()
+
+	e := &Expo{AccessToken: "expo_x", BaseURL: srv.URL}
+	results, err := e.Send([]string{"ExponentPushToken[a]", "ExponentPushToken[b]"},
+		Message{Title: "Alerte", Body: "Mot de passe modifié", Priority: PriorityHigh})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 2 || results[0].ReceiptID != "r1" || results[0].Invalid {
+		t.Errorf("unexpected first result %+v", results)
+	}
+	if !results[1].Invalid || results[1].Err == nil || results[1].Token != "ExponentPushToken[b]" {
+		t.Errorf("DeviceNotRegistered must mark the token invalid, got %+v", results[1])
+	}
+}
+
+func TestExpoSend_RequestError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"errors":[{"code":"UNAUTHORIZED","message":"bad access token"}]}`))
+	}))
+	defer srv.Close()
+
+	e := &Expo{BaseURL: srv.URL}
+	_, err := e.Send([]string{"ExponentPushToken[a]"}, Message{Title: "x"})
+	if err == nil || !strings.Contains(err.Error(), "bad access token") {
+		t.Errorf("expected request error, got %v", err)
+	}
+}
+
+func TestExpoCheckReceipts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/getReceipts" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		w.Write([]byte(`{"data":{
+			"r1":{"status":"ok"},
+			"r2":{"status":"error","details":{"error":"DeviceNotRegistered"}},
+			"r3":{"status":"error","details":{"error":"MessageRateExceeded"}}
+		}}`))
+	}))
+	defer srv.Close()
+
+	invalid, err := (&Expo{BaseURL: srv.URL}).CheckReceipts([]string{"r1", "r2", "r3"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(invalid) != 1 || invalid[0] != "r2" {
+		t.Errorf("only unregistered devices are invalid, got %v", invalid)
+	}
+}
+
+func TestExpoValidToken(t *testing.T) {
+	e := &Expo{}
+	for _, tok := range []string{"ExponentPushToken[xxxxxxxxxxxxxxxxxxxxxx]", "ExpoPushToken[abc-DEF_123]"} {
+		if !e.ValidToken(tok) {
+			t.Errorf("%s must be valid", tok)
+		}
+	}
+	for _, tok := range []string{"", "ExponentPushToken[]", "fcm:abc", "ExponentPushToken[a b]"} {
+		if e.ValidToken(tok) {
+			t.Errorf("%q must be rejected", tok)
+		}
+	}
+}
+
+func TestValidPlatform(t *testing.T) {
+	if !ValidPlatform("ios") || !ValidPlatform("android") || ValidPlatform("web") || ValidPlatform("") {
+		t.Error("only ios and android are accepted")
+	}
+}
+
+func TestFake(t *testing.T) {
+	f := NewFake("dead")
+	results, err := f.Send([]string{"a", "dead"}, Message{Title: "t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Invalid || results[0].ReceiptID == "" || !results[1].Invalid {
+		t.Errorf("unexpected results %+v", results)
+	}
+	if sent := f.Messages(); len(sent) != 1 || sent[0].Token != "a" || sent[0].Message.Title != "t" {
+		t.Errorf("unexpected sent messages %+v", sent)
+	}
+}
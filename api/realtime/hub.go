@@ -0,0 +1,174 @@
+package realtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+)
+
+// ============================================================
+// TEMPS RÉEL — événements poussés aux utilisateurs connectés (SSE).
+// Le Hub distribue les événements aux flux ouverts sur cette réplica ;
+// la diffusion entre réplicas passe par PostgreSQL (LISTEN/NOTIFY).
+// ============================================================
+
+// Types d'événements.
+const (
+	EventNotification  = "notification"
+	EventTicketMessage = "ticket.message"
+	EventTicketUpdate  = "ticket.updated"
+	EventOrderStatus   = "order.status"
+)
+
+// subscriptionBuffer : événements en attente d'écriture par flux. Un client qui ne suit
+// pas est déconnecté ; il reprend avec Last-Event-ID.
+const subscriptionBuffer = 64
+
+var (
+	ErrTooManyStreams = errors.New("realtime: too many open streams for this user")
+	ErrClosed         = errors.New("realtime: hub closed")
+)
+
+// Event : événement destiné à un utilisateur. ID croissant, repris par Last-Event-ID.
+type Event struct {
+	ID     int64
+	UserID int
+	Type   string
+	Data   json.RawMessage
+}
+
+// Format encode l'événement au format text/event-stream.
+func (e Event) Format() []byte {
+	var b bytes.Buffer
+	b.WriteString("id: ")
+	b.WriteString(strconv.FormatInt(e.ID, 10))
+	b.WriteString("\nevent: ")
+	b.WriteString(e.Type)
+	data := e.Data
+	if len(data) == 0 {
+		data = json.RawMessage("{}")
+	}
+	// Un JSON compact ne contient pas de saut de ligne ; par sécurité chaque ligne
+	// devient un champ data.
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		b.WriteString("\ndata: ")
+		b.Write(line)
+	}
+	b.WriteString("\n\n")
+	return b.Bytes()
+}
+
+// Subscription : flux ouvert d'un utilisateur.
+type Subscription struct {
+	UserID int
+	events chan Event
+	done   chan struct{}
+	once   sync.Once
+}
+
+// Events : événements à écrire sur le flux.
+func (s *Subscription) Events() <-chan Event { return s.events }
+
+// Done est fermé quand le hub abandonne le flux (client trop lent, resynchronisation,
+// arrêt du serveur).
+func (s *Subscription) Done() <-chan struct{} { return s.done }
+
+func (s *Subscription) close() { s.once.Do(func() { close(s.done) }) }
+
+// Hub : flux ouverts sur cette réplica, par utilisateur.
+type Hub struct {
+	maxPerUser int
+	mu         sync.Mutex
+	subs       map[int]map[*Subscription]struct{}
+	closed     bool
+}
+
+// NewHub crée un hub limité à maxPerUser flux simultanés par utilisateur (0 = illimité).
+func NewHub(maxPerUser int) *Hub {
+	return &Hub{maxPerUser: maxPerUser, subs: map[int]map[*Subscription]struct{}{}}
+}
+
+// Subscribe ouvre un flux pour userID.
+func (h *Hub) Subscribe(userID int) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, ErrClosed
+	}
+	if h.maxPerUser > 0 && len(h.subs[userID]) >= h.maxPerUser {
+		return nil, ErrTooManyStreams
+	}
+	s := &Subscription{UserID: userID, events: make(chan Event, subscriptionBuffer), done: make(chan struct{})}
+	if h.subs[userID] == nil {
+		h.subs[userID] = map[*Subscription]struct{}{}
+	}
+	h.subs[userID][s] = struct{}{}
+	return s, nil
+}
+
+// Unsubscribe ferme un flux (fin de la requête).
+func (h *Hub) Unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(s)
+}
+
+func (h *Hub) remove(s *Subscription) {
+	if set := h.subs[s.UserID]; set != nil {
+		delete(set, s)
+		if len(set) == 0 {
+			delete(h.subs, s.UserID)
+		}
+	}
+	s.close()
+}
+
+// HasSubscribers : userID a au moins un flux ouvert sur cette réplica.
+func (h *Hub) HasSubscribers(userID int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs[userID]) > 0
+}
+
+// Count : nombre de flux ouverts de userID.
+func (h *Hub) Count(userID int) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs[userID])
+}
+
+// Deliver transmet l'événement aux flux de son destinataire sans jamais bloquer : un flux
+// dont la file est pleine est fermé.
+func (h *Hub) Deliver(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs[e.UserID] {
+		select {
+		case s.events <- e:
+		default:
+			h.remove(s)
+		}
+	}
+}
+
+// DropAll ferme tous les flux ; les clients se reconnectent et rattrapent les événements
+// manqués (après une coupure de l'écoute PostgreSQL).
+func (h *Hub) DropAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, set := range h.subs {
+		for s := range set {
+			h.remove(s)
+		}
+	}
+}
+
+// Close ferme tous les flux et refuse les nouveaux (arrêt du serveur).
+func (h *Hub) Close() {
+	h.mu.Lock()
+	h.closed = true
+	h.mu.Unlock()
+	h.DropAll()
+}
@@ -0,0 +1,117 @@
+package realtime
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestEventFormat(t *testing.T) {
+	e := Event{ID: 42, Type: EventNotification, Data: json.RawMessage(`{"id":7}`)}
+	want := "id: 42\nevent: notification\ndata: {\"id\":7}\n\n"
+	if got := string(e.Format()); got != want {
+		t.Errorf("Format() = %q, want %q", got, want)
+	}
+	// Données vides ou sur plusieurs lignes : le flux reste valide.
+	if got := string(Event{ID: 1, Type: "resync"}.Format()); got != "id: 1\nevent: resync\ndata: {}\n\n" {
+		t.Errorf("empty data = %q", got)
+	}
+	multi := Event{ID: 2, Type: "x", Data: json.RawMessage("{\n\"a\":1\n}")}
+	if got := string(multi.Format()); got != "id: 2\nevent: x\ndata: {\ndata: \"a\":1\ndata: }\n\n" {
+		t.Errorf("multi-line data = %q", got)
+	}
+}
+
+func TestHubPerUserLimit(t *testing.T) {
+	h := NewHub(2)
+	a, _ := h.Subscribe(1)
+	if _, err := h.Subscribe(1); err != nil {
+		t.Fatalf("second stream: %v", err)
+	}
+	if _, err := h.Subscribe(1); !errors.Is(err, ErrTooManyStreams) {
+		t.Fatalf("third stream: err = %v, want ErrTooManyStreams", err)
+	}
+	if _, err := h.Subscribe(2); err != nil {
+		t.Fatalf("limit is per user: %v", err)
+	}
+	h.Unsubscribe(a)
+	if _, err := h.Subscribe(1); err != nil {
+		t.Fatalf("slot must be freed on unsubscribe: %v", err)
+	}
+	if h.Count(1) != 2 {
+		t.Errorf("Count(1) = %d, want 2", h.Count(1))
+	}
+}
+
+func TestHubDeliver(t *testing.T) {
+	h := NewHub(0)
+	a, _ := h.Subscribe(1)
+	b, _ := h.Subscribe(1)
+	other, _ := h.Subscribe(2)
+	h.Deliver(Event{ID: 5, UserID: 1, Type: EventOrderStatus})
+	for _, s := range []*Subscription{a, b} {
+		select {
+		case e := <-s.Events():
+			if e.ID != 5 {
+				t.Errorf("event id = %d, want 5", e.ID)
+			}
+		default:
+			t.Error("event not delivered to every stream of the user")
+		}
+	}
+	select {
+	case <-other.Events():
+		t.Error("event delivered to another user")
+	default:
+	}
+}
+
+func TestHubDropsSlowSubscriber(t *testing.T) {
+	h := NewHub(0)
+	s, _ := h.Subscribe(1)
+	for i := 0; i <= subscriptionBuffer; i++ {
+		h.Deliver(Event{ID: int64(i + 1), UserID: 1})
+	}
+	select {
+	case <-s.Done():
+	default:
+		t.Fatal("a full stream must be closed")
+	}
+	if h.HasSubscribers(1) {
+		t.Error("a dropped stream must be removed")
+	}
+	h.Unsubscribe(s) // sans effet une seconde fois
+}
+
+func TestHubDropAllAndClose(t *testing.T) {
+	h := NewHub(0)
+	a, _ := h.Subscribe(1)
+	b, _ := h.Subscribe(2)
+	h.DropAll()
+	for _, s := range []*Subscription{a, b} {
+		select {
+		case <-s.Done():
+		default:
+			t.Error("DropAll must close every stream")
+		}
+	}
+	if _, err := h.Subscribe(1); err != nil {
+		t.Fatalf("DropAll must accept new streams: %v", err)
+	}
+	h.Close()
+	if _, err := h.Subscribe(1); !errors.Is(err, ErrClosed) {
+		t.Errorf("Subscribe after Close: err = %v, want ErrClosed", err)
+	}
+}
+
+func TestParsePayload(t *testing.T) {
+	id, user, err := ParsePayload("9001:17")
+	if err != nil || id != 9001 || user != 17 {
+		t.Errorf("ParsePayload = %d, %d, %v", id, user, err)
+	}
+	for _, s := range []string{"", "12", "a:1", "1:b", ":"} {
+		if _, _, err := ParsePayload(s); err == nil {
+			t.Errorf("ParsePayload(%q) must fail", s)
+		}
+	}
+}
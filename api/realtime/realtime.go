@@ -0,0 +1,215 @@
+package realtime
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"api/config"
+)
+
+// channel : canal NOTIFY partagé par les réplicas ; la charge utile est "<id>:<utilisateur>".
+const channel = "cyna_evenements"
+
+// ReplayLimit : événements rattrapés au plus lors d'une reprise (Last-Event-ID).
+const ReplayLimit = 500
+
+// ErrUnavailable : flux temps réel non démarré (Init non appelé).
+var ErrUnavailable = errors.New("realtime: not initialized")
+
+var hub *Hub
+
+// MaxStreamsPerUser : flux simultanés par utilisateur et par réplica
+// (STREAM_MAX_CONNECTIONS_PER_USER, 5 par défaut).
+func MaxStreamsPerUser() int {
+	if n, err := strconv.Atoi(os.Getenv("STREAM_MAX_CONNECTIONS_PER_USER")); err == nil && n > 0 {
+		return n
+	}
+	return 5
+}
+
+// Heartbeat : intervalle des commentaires de maintien de connexion (STREAM_HEARTBEAT_SECONDS,
+// 25 s par défaut, sous le délai d'inactivité des proxys).
+func Heartbeat() time.Duration {
+	if s, err := strconv.Atoi(os.Getenv("STREAM_HEARTBEAT_SECONDS")); err == nil && s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	return 25 * time.Second
+}
+
+// ReplayWindow : conservation des événements pour la reprise (STREAM_REPLAY_HOURS, 24 h).
+func ReplayWindow() time.Duration {
+	if h, err := strconv.Atoi(os.Getenv("STREAM_REPLAY_HOURS")); err == nil && h > 0 {
+		return time.Duration(h) * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// Init démarre le hub de cette réplica, l'écoute PostgreSQL et la purge horaire des
+// événements.
+func Init() {
+	hub = NewHub(MaxStreamsPerUser())
+	listener := pq.NewListener(config.ConnString(), time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		switch ev {
+		case pq.ListenerEventConnectionAttemptFailed, pq.ListenerEventDisconnected:
+			log.Printf("[WARN] realtime: listener: %v", err)
+		case pq.ListenerEventReconnected:
+			// Des NOTIFY ont pu être perdus : les clients se reconnectent et rattrapent.
+			hub.DropAll()
+		}
+	})
+	go listen(listener)
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := config.DB.Exec("DELETE FROM evenement_flux WHERE date_creation < $1",
+				time.Now().Add(-ReplayWindow())); err != nil {
+				log.Printf("[WARN] realtime: cleanup: %v", err)
+			}
+		}
+	}()
+	log.Printf("[INFO] Realtime stream ready (max %d streams per user, heartbeat %s)", MaxStreamsPerUser(), Heartbeat())
+}
+
+func listen(l *pq.Listener) {
+	// Listen attend que la connexion soit établie : hors du démarrage du serveur.
+	if err := l.Listen(channel); err != nil {
+		log.Printf("[WARN] realtime: LISTEN %s: %v", channel, err)
+	}
+	for {
+		select {
+		case n := <-l.Notify:
+			if n == nil {
+				continue // reconnexion, traitée par le callback
+			}
+			id, userID, err := ParsePayload(n.Extra)
+			if err != nil {
+				log.Printf("[WARN] realtime: %v", err)
+				continue
+			}
+			if !hub.HasSubscribers(userID) {
+				continue
+			}
+			e, err := load(id)
+			if err != nil {
+				log.Printf("[WARN] realtime: event %d: %v", id, err)
+				continue
+			}
+			hub.Deliver(e)
+		case <-time.After(90 * time.Second):
+			go l.Ping()
+		}
+	}
+}
+
+// ParsePayload lit la charge utile NOTIFY "<id>:<utilisateur>".
+func ParsePayload(s string) (id int64, userID int, err error) {
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		return 0, 0, fmt.Errorf("invalid payload %q", s)
+	}
+	if id, err = strconv.ParseInt(s[:i], 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid payload %q", s)
+	}
+	if userID, err = strconv.Atoi(s[i+1:]); err != nil {
+		return 0, 0, fmt.Errorf("invalid payload %q", s)
+	}
+	return id, userID, nil
+}
+
+func load(id int64) (Event, error) {
+	var e Event
+	var data []byte
+	err := config.DB.QueryRow("SELECT id_evenement, id_utilisateur, type, donnees FROM evenement_flux WHERE id_evenement = $1",
+		id).Scan(&e.ID, &e.UserID, &e.Type, &data)
+	e.Data = data
+	return e, err
+}
+
+// Publish enregistre un événement pour userID et le signale à toutes les réplicas. Les
+// erreurs sont journalisées : le flux temps réel ne bloque jamais l'opération d'origine.
+func Publish(userID int, typ string, data interface{}) {
+	if config.DB == nil || userID <= 0 {
+		return
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("[WARN] realtime: %s: %v", typ, err)
+		return
+	}
+	if _, err := config.DB.Exec(`
+		WITH e AS (
+			INSERT INTO evenement_flux (id_utilisateur, type, donnees) VALUES ($1, $2, $3)
+			RETURNING id_evenement, id_utilisateur
+		)
+		SELECT pg_notify($4, e.id_evenement || ':' || e.id_utilisateur) FROM e`,
+		userID, typ, string(b), channel); err != nil {
+		log.Printf("[WARN] realtime: publish %s to user %d: %v", typ, userID, err)
+	}
+}
+
+// Replay retourne les événements de userID postérieurs à after. Quand la reprise est
+// impossible (événements déjà purgés ou plus de ReplayLimit en attente), resync est l'id
+// à partir duquel reprendre après avoir rechargé l'état par l'API.
+func Replay(userID int, after int64) (events []Event, resync int64, err error) {
+	var oldest, latest sql.NullInt64
+	if err := config.DB.QueryRow("SELECT MIN(id_evenement), MAX(id_evenement) FROM evenement_flux").Scan(
+		&oldest, &latest); err != nil {
+		return nil, 0, err
+	}
+	if oldest.Valid && oldest.Int64 > after+1 {
+		return nil, latest.Int64, nil
+	}
+	rows, err := config.DB.Query(`
+		SELECT id_evenement, id_utilisateur, type, donnees FROM evenement_flux
+		WHERE id_utilisateur = $1 AND id_evenement > $2
+		ORDER BY id_evenement LIMIT $3`, userID, after, ReplayLimit+1)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e Event
+		var data []byte
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Type, &data); err != nil {
+			return nil, 0, err
+		}
+		e.Data = data
+		events = append(events, e)
+	}
+	if len(events) > ReplayLimit {
+		return nil, latest.Int64, rows.Err()
+	}
+	return events, 0, rows.Err()
+}
+
+// Subscribe ouvre un flux pour userID sur le hub de cette réplica.
+func Subscribe(userID int) (*Subscription, error) {
+	if hub == nil {
+		return nil, ErrUnavailable
+	}
+	return hub.Subscribe(userID)
+}
+
+// Unsubscribe ferme un flux ouvert par Subscribe.
+func Unsubscribe(s *Subscription) {
+	if hub != nil {
+		hub.Unsubscribe(s)
+	}
+}
+
+// Shutdown ferme les flux ouverts pour que l'arrêt du serveur ne les attende pas.
+func Shutdown() {
+	if hub != nil {
+		hub.Close()
+	}
+}
@@ -2,8 +2,8 @@ package repositories
 
 import (
 	"database/sql"
-	"strings"
 
+	"api/catalog"
 	"api/models"
 )
 
@@ -143,101 +143,6 @@ func (r *CatalogRepo) FindActiveProduitsByCategory(slug string) ([]models.Produi
 	return produits, nil
 }
 
-func (r *CatalogRepo) SearchProduits(query string) ([]SearchResult, error) {
-	results := []SearchResult{}
-	cleanQuery := strings.TrimSpace(strings.TrimPrefix(strings.TrimSuffix(query, "%"), "%"))
-	likePattern := "%" + cleanQuery + "%"
-	startsWith := cleanQuery + "%"
-	rows, err := r.DB.Query(`
-			SELECT p.id_produit, p.nom, p.slug,
-			       COALESCE(p.description_courte,''), COALESCE(p.description_longue,''),
-			       COALESCE(p.description_html,''), COALESCE(p.images::text,'[]'),
-			       COALESCE(p.prix,0), COALESCE(p.devise,'EUR'), COALESCE(p.duree,''),
-			       COALESCE(p.tag,''), COALESCE(p.statut,'actif'), COALESCE(p.type_achat,''),
-			       COALESCE(p.ordre_affichage,0),
-			       COALESCE(c.nom,''), COALESCE(c.slug,'')
-			FROM produits p JOIN categories c ON p.id_categorie=c.id_categorie
-			WHERE p.actif=TRUE AND c.actif=TRUE
-			  AND (p.nom ILIKE $1 OR p.description_courte ILIKE $1
-			    OR p.description_longue ILIKE $1 OR p.tag ILIKE $1
-			    OR c.nom ILIKE $1 OR p.description_html ILIKE $1)
-			ORDER BY CASE
-						    WHEN LOWER(p.nom) = LOWER($2) THEN 1
-						    WHEN LOWER(p.nom) LIKE LOWER($3) THEN 2
-						    WHEN p.nom ILIKE $2 THEN 3
-						    WHEN p.tag ILIKE $2 THEN 4
-						    WHEN p.description_courte ILIKE $1 THEN 5
-						    WHEN c.nom ILIKE $1 THEN 6
-						    ELSE 7
-						END, p.ordre_affichage ASC LIMIT 50`, likePattern, cleanQuery, startsWith)
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var p SearchResult
-			if err := rows.Scan(&p.ID, &p.Nom, &p.Slug, &p.DescriptionCourte, &p.DescriptionLongue,
-				&p.DescriptionHTML, &p.Images, &p.Prix, &p.Devise, &p.Duree, &p.Tag,
-				&p.Statut, &p.TypeAchat, &p.OrdreAffichage, &p.CategorieNom, &p.CategorieSlug); err != nil {
-				continue
-			}
-			p.Type = "product"
-			results = append(results, p)
-		}
-	}
-
-	// Catégories correspondantes
-	catRows, errCat := r.DB.Query(`
-		SELECT id_categorie, nom, slug, COALESCE(description,''), COALESCE(couleur,'')
-		FROM categories
-		WHERE actif = TRUE AND (nom ILIKE $1 OR slug ILIKE $1)
-		ORDER BY ordre_affichage ASC LIMIT 10`, likePattern)
-	if errCat == nil {
-		defer catRows.Close()
-		for catRows.Next() {
-			var c SearchResult
-			var couleur string
-			if err := catRows.Scan(&c.ID, &c.Nom, &c.Slug, &c.DescriptionCourte, &couleur); err != nil {
-				continue
-			}
-			c.Type = "service"
-			c.CategorieNom = c.Nom
-			c.CategorieSlug = c.Slug
-			c.DescriptionLongue = ""
-			c.DescriptionHTML = ""
-			c.Images = "[]"
-			c.Prix = 0
-			c.Devise = "EUR"
-			c.Duree = ""
-			c.Tag = ""
-			c.Statut = "actif"
-			c.TypeAchat = ""
-			c.OrdreAffichage = 0
-			results = append(results, c)
-		}
-	}
-
-	return results, nil
-}
-
-type SearchResult struct {
-	Type              string  `json:"type"`
-	ID                int     `json:"id_produit"`
-	Nom               string  `json:"nom"`
-	Slug              string  `json:"slug"`
-	DescriptionCourte string  `json:"description_courte"`
-	DescriptionLongue string  `json:"description_longue"`
-	DescriptionHTML   string  `json:"description_html"`
-	Images            string  `json:"images"`
-	Prix              float64 `json:"prix"`
-	Devise            string  `json:"devise"`
-	Duree             string  `json:"duree"`
-	Tag               string  `json:"tag"`
-	Statut            string  `json:"statut"`
-	TypeAchat         string  `json:"type_achat"`
-	OrdreAffichage    int     `json:"ordre_affichage"`
-	CategorieNom      string  `json:"categorie_nom"`
-	CategorieSlug     string  `json:"categorie_slug"`
-}
-
 func (r *CatalogRepo) CreateProduit(p *models.ProduitWeb, creatorID int) error {
 	images := p.Images
 	if images == "" {
@@ -382,3 +287,74 @@ func scanProduits(rows *sql.Rows) ([]models.ProduitWeb, error) {
 	}
 	return produits, nil
 }
+
+// SuggestEntries charge les catégories et produits actifs indexés par l'autocomplétion,
+// nommés dans la langue locale (repli sur le français).
+func (r *CatalogRepo) SuggestEntries(locale string) ([]catalog.Suggestion, error) {
+	rows, err := r.DB.Query(`
+		SELECT 'category', c.id_categorie, COALESCE(ct.nom, c.nom), c.slug, '', '', NULL::numeric, COALESCE(c.ordre_affichage,0)
+		FROM categories c
+		LEFT JOIN categorie_traduction ct ON ct.id_categorie = c.id_categorie AND ct.langue = $1
+		WHERE c.actif = TRUE
+		UNION ALL
+		SELECT 'product', p.id_produit, COALESCE(t.nom, p.nom), p.slug, COALESCE(ct.nom, c.nom), c.slug, p.prix, COALESCE(p.ordre_affichage,0)
+		FROM produits p JOIN categories c ON p.id_categorie = c.id_categorie
+		LEFT JOIN produit_traduction t ON t.id_produit = p.id_produit AND t.langue = $1
+		LEFT JOIN categorie_traduction ct ON ct.id_categorie = c.id_categorie AND ct.langue = $1
+		WHERE p.actif = TRUE AND c.actif = TRUE`, locale)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []catalog.Suggestion
+	for rows.Next() {
+		var s catalog.Suggestion
+		var prix sql.NullFloat64
+		if err := rows.Scan(&s.Type, &s.ID, &s.Nom, &s.Slug, &s.CategorieNom, &s.CategorieSlug, &prix, &s.Ordre); err != nil {
+			return nil, err
+		}
+		if prix.Valid {
+			s.Prix = &prix.Float64
+		}
+		items = append(items, s)
+	}
+	return items, rows.Err()
+}
+
+// CoPurchased retourne les produits actifs les plus souvent commandés avec le produit slug
+// (commandes payées des 12 derniers mois), à partir de minOrders commandes communes.
+func (r *CatalogRepo) CoPurchased(slug string, minOrders, limit int) ([]models.ProduitAssocie, error) {
+	rows, err := r.DB.Query(`
+		WITH lignes AS (
+			SELECT DISTINCT co.id_commande, it->>'product_slug' AS slug
+			FROM commande co, jsonb_array_elements(COALESCE(co.items, '[]'::jsonb)) it
+			WHERE co.statut IN (`+paidOrderStatuses+`) AND co.date_commande >= NOW() - INTERVAL '12 months'
+			  AND COALESCE(it->>'product_slug', '') <> ''
+		)
+		SELECT p.id_produit, p.nom, p.slug, COALESCE(p.images::text,'[]'), p.prix, COUNT(*) AS n
+		FROM lignes a
+		JOIN lignes b ON b.id_commande = a.id_commande AND b.slug <> a.slug
+		JOIN produits p ON p.slug = b.slug AND p.actif = TRUE
+		WHERE a.slug = $1
+		GROUP BY p.id_produit, p.nom, p.slug, p.images, p.prix, p.ordre_affichage
+		HAVING COUNT(*) >= $2
+		ORDER BY n DESC, p.ordre_affichage ASC, p.id_produit ASC
+		LIMIT $3`, slug, minOrders, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []models.ProduitAssocie{}
+	for rows.Next() {
+		var p models.ProduitAssocie
+		var prix sql.NullFloat64
+		if err := rows.Scan(&p.ID, &p.Nom, &p.Slug, &p.Images, &prix, &p.Commandes); err != nil {
+			return nil, err
+		}
+		if prix.Valid {
+			p.Prix = &prix.Float64
+		}
+		items = append(items, p)
+	}
+	return items, rows.Err()
+}
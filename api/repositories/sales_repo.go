@@ -0,0 +1,143 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"api/models"
+)
+
+// ============================================================
+// Ventes par produit : synthèse (produit_ventes) des lignes de
+// commandes payées par fenêtre glissante, et classements lus
+// depuis cette synthèse.
+// ============================================================
+
+// paidOrderStatuses : commandes réglées (payée par le worker de facturation, ou confirmée
+// après le paiement Stripe du panier).
+const paidOrderStatuses = `'paye', 'confirmee'`
+
+// Les lignes de pack (bundle_slug) ne comptent pas dans les ventes par produit : la
+// composition d'un pack peut changer après la vente et son prix n'est pas réparti par
+// produit dans la ligne de commande. Seuls les produits achetés à l'unité sont classés.
+
+// topProductsLockID sérialise le recalcul entre réplicas (pg_try_advisory_xact_lock).
+const topProductsLockID int64 = 0x0C1A_70B5
+
+type SalesRepo struct {
+	DB *sql.DB
+}
+
+func NewSalesRepo(db *sql.DB) *SalesRepo { return &SalesRepo{DB: db} }
+
+// RefreshTopProducts recalcule la synthèse pour chaque fenêtre (en jours), en une transaction.
+// Retourne false sans rien modifier si une autre réplica est en train de la recalculer.
+func (r *SalesRepo) RefreshTopProducts(windows []int) (bool, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	var locked bool
+	if err := tx.QueryRow("SELECT pg_try_advisory_xact_lock($1)", topProductsLockID).Scan(&locked); err != nil || !locked {
+		return false, err
+	}
+	for _, days := range windows {
+		if _, err := tx.Exec("DELETE FROM produit_ventes WHERE fenetre_jours = $1", days); err != nil {
+			return false, err
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO produit_ventes (fenetre_jours, id_produit, nb_commandes, quantite, chiffre_affaires, rang, date_calcul)
+			SELECT $1::int, p.id_produit, COUNT(DISTINCT l.id_commande), SUM(l.quantite), SUM(l.montant),
+			       ROW_NUMBER() OVER (ORDER BY COUNT(DISTINCT l.id_commande) DESC, SUM(l.quantite) DESC,
+			                                   SUM(l.montant) DESC, p.id_produit ASC),
+			       NOW()
+			FROM (
+				SELECT co.id_commande, it->>'product_slug' AS slug, q.quantite,
+				       COALESCE(CASE WHEN it->>'price' ~ '^[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?$'
+				                     THEN (it->>'price')::numeric END, 0) * q.quantite AS montant
+				FROM commande co
+				CROSS JOIN LATERAL jsonb_array_elements(
+				    CASE WHEN jsonb_typeof(co.items) = 'array' THEN co.items ELSE '[]'::jsonb END) it
+				-- Quantité absente, invalide ou nulle : 1 (lignes saisies à la main ou anciennes).
+				CROSS JOIN LATERAL (
+				    SELECT GREATEST(CASE WHEN it->>'quantity' ~ '^[0-9]{1,6}$'
+				                         THEN (it->>'quantity')::int END, 1) AS quantite) q
+				WHERE co.statut IN (`+paidOrderStatuses+`)
+				  AND co.date_commande >= NOW() - make_interval(days => $1::int)
+				  AND COALESCE(it->>'product_slug', '') <> ''
+				  AND COALESCE(it->>'bundle_slug', '') = ''
+			) l
+			JOIN produits p ON p.slug = l.slug
+			GROUP BY p.id_produit`, days); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
+// TopProducts retourne le classement complet d'une fenêtre (produits inactifs compris)
+// et la date du dernier calcul (zéro si la fenêtre n'a jamais été calculée).
+func (r *SalesRepo) TopProducts(days, limit int) ([]models.TopProductSales, time.Time, error) {
+	var computed time.Time
+	rows, err := r.DB.Query(`
+		SELECT v.rang, p.id_produit, p.slug, p.nom, v.nb_commandes, v.quantite, v.chiffre_affaires::float8,
+		       COALESCE(p.images::text,'[]'), p.prix, COALESCE(p.devise,'EUR'), COALESCE(p.duree,''),
+		       COALESCE(p.tag,''), v.date_calcul
+		FROM produit_ventes v JOIN produits p ON p.id_produit = v.id_produit
+		WHERE v.fenetre_jours = $1
+		ORDER BY v.rang
+		LIMIT $2`, days, limit)
+	if err != nil {
+		return nil, computed, err
+	}
+	defer rows.Close()
+	items := []models.TopProductSales{}
+	for rows.Next() {
+		var t models.TopProductSales
+		var prix sql.NullFloat64
+		if err := rows.Scan(&t.Rang, &t.ID, &t.Slug, &t.Nom, &t.TotalSales, &t.TotalQuantity, &t.TotalAmount,
+			&t.Images, &prix, &t.Devise, &t.Duree, &t.Tag, &computed); err != nil {
+			return nil, computed, err
+		}
+		if prix.Valid {
+			t.Prix = &prix.Float64
+		}
+		items = append(items, t)
+	}
+	return items, computed, rows.Err()
+}
+
+// PublicTopProducts retourne le classement des produits actifs, renuméroté sans les
+// produits retirés de la vente.
+func (r *SalesRepo) PublicTopProducts(days, limit int) ([]models.TopProduct, error) {
+	rows, err := r.DB.Query(`
+		SELECT ROW_NUMBER() OVER (ORDER BY v.rang), p.id_produit, p.nom, p.slug,
+		       COALESCE(p.description_courte,''), COALESCE(p.images::text,'[]'), p.prix,
+		       COALESCE(p.devise,'EUR'), COALESCE(p.duree,''), COALESCE(p.tag,''),
+		       p.id_categorie, COALESCE(c.nom,''), COALESCE(c.slug,'')
+		FROM produit_ventes v
+		JOIN produits p ON p.id_produit = v.id_produit AND p.actif = TRUE
+		JOIN categories c ON c.id_categorie = p.id_categorie AND c.actif = TRUE
+		WHERE v.fenetre_jours = $1
+		ORDER BY v.rang
+		LIMIT $2`, days, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []models.TopProduct{}
+	for rows.Next() {
+		var t models.TopProduct
+		var prix sql.NullFloat64
+		if err := rows.Scan(&t.Rang, &t.ID, &t.Nom, &t.Slug, &t.DescriptionCourte, &t.Images, &prix,
+			&t.Devise, &t.Duree, &t.Tag, &t.IDCategorie, &t.CategorieNom, &t.CategorieSlug); err != nil {
+			return nil, err
+		}
+		if prix.Valid {
+			t.Prix = &prix.Float64
+		}
+		items = append(items, t)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,98 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"api/catalog"
+)
+
+// ============================================================
+// Journal des recherches (recherche_log) et rapports associés :
+// requêtes les plus fréquentes, requêtes sans résultat.
+// ============================================================
+
+type SearchLogEntry struct {
+	Query   string
+	Mode    string
+	Results int
+	At      time.Time
+}
+
+type QueryStat struct {
+	Query        string    `json:"query"`
+	Searches     int       `json:"searches"`
+	ZeroResults  int       `json:"zero_results"`
+	AvgResults   float64   `json:"avg_results"`
+	LastSearched time.Time `json:"last_searched"`
+}
+
+type SearchLogRepo struct {
+	DB *sql.DB
+}
+
+func NewSearchLogRepo(db *sql.DB) *SearchLogRepo { return &SearchLogRepo{DB: db} }
+
+// InsertBatch enregistre un lot de recherches en une seule requête.
+func (r *SearchLogRepo) InsertBatch(entries []SearchLogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	args := make([]interface{}, 0, len(entries)*5)
+	values := make([]string, 0, len(entries))
+	for i, e := range entries {
+		n := i * 5
+		values = append(values, fmt.Sprintf("($%d,$%d,$%d,$%d,$%d)", n+1, n+2, n+3, n+4, n+5))
+		args = append(args, e.Query, catalog.Normalize(e.Query), e.Mode, e.Results, e.At)
+	}
+	_, err := r.DB.Exec(`INSERT INTO recherche_log (requete, requete_normalisee, mode, nb_resultats, date_recherche)
+		VALUES `+strings.Join(values, ","), args...)
+	return err
+}
+
+// Purge supprime les recherches de plus de days jours.
+func (r *SearchLogRepo) Purge(days int) (int64, error) {
+	res, err := r.DB.Exec(`DELETE FROM recherche_log WHERE date_recherche < NOW() - make_interval(days => $1)`, days)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// TopQueries : requêtes les plus fréquentes sur la période, regroupées sans casse ni accents.
+func (r *SearchLogRepo) TopQueries(days, limit int) ([]QueryStat, error) {
+	return r.queryStats(`TRUE`, days, limit)
+}
+
+// ZeroResultQueries : requêtes restées sans résultat (ni plein texte ni repli trigramme),
+// c'est-à-dire les services recherchés que le catalogue ne propose pas.
+func (r *SearchLogRepo) ZeroResultQueries(days, limit int) ([]QueryStat, error) {
+	return r.queryStats(`nb_resultats = 0`, days, limit)
+}
+
+func (r *SearchLogRepo) queryStats(cond string, days, limit int) ([]QueryStat, error) {
+	rows, err := r.DB.Query(`
+		SELECT mode() WITHIN GROUP (ORDER BY requete), COUNT(*),
+		       COUNT(*) FILTER (WHERE nb_resultats = 0), AVG(nb_resultats)::float8, MAX(date_recherche)
+		FROM recherche_log
+		WHERE `+cond+` AND requete_normalisee <> ''
+		  AND date_recherche >= NOW() - make_interval(days => $1)
+		GROUP BY requete_normalisee
+		ORDER BY 2 DESC, 5 DESC
+		LIMIT $2`, days, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stats := []QueryStat{}
+	for rows.Next() {
+		var s QueryStat
+		if err := rows.Scan(&s.Query, &s.Searches, &s.ZeroResults, &s.AvgResults, &s.LastSearched); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
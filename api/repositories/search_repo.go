@@ -0,0 +1,609 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"html"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+// ============================================================
+// Recherche produits — plein texte PostgreSQL
+// produits.search_vector (configuration french_unaccent, index GIN),
+// classement pondéré nom > tag / catégorie > descriptions, extraits
+// surlignés, et repli trigramme (pg_trgm) pour les fautes de frappe.
+// ============================================================
+
+const (
+	SearchModeBrowse   = "browse"
+	SearchModeFullText = "fulltext"
+	SearchModeFuzzy    = "fuzzy"
+
+	// Seuil word_similarity du repli trigramme.
+	fuzzyThreshold = "0.4"
+
+	// Délimiteurs internes de ts_headline, remplacés par <mark> après échappement HTML.
+	markStart = "\x02"
+	markStop  = "\x03"
+)
+
+type SearchOptions struct {
+	Query           string
+	Category        string // slug
+	IncludeInactive bool   // écrans d'administration
+	Limit, Offset   int
+
+	// Filtres à facettes (vides = non filtré). Les valeurs sont comparées sans casse.
+	PrixMin, PrixMax *float64
+	Tags             []string // Prioritaire | Standard | Premium
+	Durees           []string
+	TypesAchat       []string // panier | devis
+	Statuts          []string
+
+	Sort   string // relevance | featured | price_asc | price_desc | newest | popular
+	Cursor string // curseur opaque retourné par la page précédente (prioritaire sur Offset)
+	Facets bool   // calculer les compteurs de facettes
+	Locale string // langue des résultats (vide ou "fr" : contenu de référence)
+}
+
+type SearchResult struct {
+	Type              string  `json:"type"`
+	ID                int     `json:"id_produit"`
+	Nom               string  `json:"nom"`
+	Slug              string  `json:"slug"`
+	DescriptionCourte string  `json:"description_courte"`
+	DescriptionLongue string  `json:"description_longue"`
+	Images            string  `json:"images"`
+	Prix              float64 `json:"prix"`
+	Devise            string  `json:"devise"`
+	Duree             string  `json:"duree"`
+	Tag               string  `json:"tag"`
+	Statut            string  `json:"statut"`
+	TypeAchat         string  `json:"type_achat"`
+	OrdreAffichage    int     `json:"ordre_affichage"`
+	Actif             bool    `json:"actif"`
+	CategorieNom      string  `json:"categorie_nom"`
+	CategorieSlug     string  `json:"categorie_slug"`
+	NomCategorie      string  `json:"nom_categorie"`
+	Rank              float64 `json:"rank,omitempty"`
+	NomSurligne       string  `json:"nom_highlight,omitempty"`
+	Extrait           string  `json:"snippet,omitempty"`
+}
+
+type SearchPage struct {
+	Mode       string         `json:"mode"`
+	Sort       string         `json:"sort"`
+	Total      int            `json:"total"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+	Results    []SearchResult `json:"results"`
+	Facets     *SearchFacets  `json:"facets,omitempty"`
+}
+
+// SearchFacets : compteurs par valeur. Chaque facette est calculée avec tous les filtres
+// sauf le sien, pour que l'interface puisse proposer les valeurs alternatives.
+type SearchFacets struct {
+	Categorie []FacetValue `json:"categorie"`
+	Tag       []FacetValue `json:"tag"`
+	Duree     []FacetValue `json:"duree"`
+	TypeAchat []FacetValue `json:"type_achat"`
+	Statut    []FacetValue `json:"statut"`
+	Prix      PriceRange   `json:"prix"`
+}
+
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type PriceRange struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int     `json:"count"`
+}
+
+const (
+	SortRelevance = "relevance"
+	SortFeatured  = "featured"
+	SortPriceAsc  = "price_asc"
+	SortPriceDesc = "price_desc"
+	SortNewest    = "newest"
+	SortPopular   = "popular"
+)
+
+var (
+	ErrInvalidSort   = errors.New("invalid sort")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// searchSorts : clé de tri (toujours NUMERIC, pour le curseur) et sens.
+// L'identifiant produit départage les égalités dans le même sens.
+var searchSorts = map[string]struct {
+	key  string
+	desc bool
+}{
+	SortRelevance: {"", true}, // score du mode (voir searchMatch)
+	SortFeatured:  {"COALESCE(p.ordre_affichage,0)", false},
+	SortPriceAsc:  {"COALESCE(p.prix,0)", false},
+	SortPriceDesc: {"COALESCE(p.prix,0)", true},
+	SortNewest:    {"COALESCE(EXTRACT(EPOCH FROM p.date_creation),0)", true},
+	SortPopular:   {"COALESCE(pop.ventes,0) + (SELECT COUNT(*) FROM abonnement a WHERE a.id_produit = p.id_produit AND a.statut = 'actif')", true},
+}
+
+// Popularité : quantités vendues (commandes payées, 90 derniers jours) + abonnements actifs.
+const popularityJoin = `
+	LEFT JOIN (SELECT it->>'product_slug' AS slug, SUM(GREATEST(COALESCE((it->>'quantity')::int, 1), 1)) AS ventes
+	           FROM commande co, jsonb_array_elements(COALESCE(co.items, '[]'::jsonb)) it
+	           WHERE co.statut IN (` + paidOrderStatuses + `) AND co.date_commande >= NOW() - INTERVAL '90 days'
+	           GROUP BY 1) pop ON pop.slug = p.slug`
+
+// facetColumns : expression SQL de chaque facette, dans l'ordre des filtres.
+var facetColumns = []struct{ name, expr string }{
+	{"categorie", "c.slug"},
+	{"prix", "COALESCE(p.prix,0)"},
+	{"tag", "COALESCE(p.tag,'')"},
+	{"duree", "COALESCE(p.duree,'')"},
+	{"type_achat", "COALESCE(p.type_achat,'')"},
+	{"statut", "COALESCE(p.statut,'actif')"},
+}
+
+const searchColumns = `
+	p.id_produit, p.nom, p.slug,
+	COALESCE(p.description_courte,''), COALESCE(p.description_longue,''),
+	COALESCE(p.images::text,'[]'), COALESCE(p.prix,0), COALESCE(p.devise,'EUR'), COALESCE(p.duree,''),
+	COALESCE(p.tag,''), COALESCE(p.statut,'actif'), COALESCE(p.type_achat,''),
+	COALESCE(p.ordre_affichage,0), COALESCE(p.actif,false),
+	COALESCE(c.nom,''), COALESCE(c.slug,''),
+	COUNT(*) OVER()`
+
+// searchQuerier est satisfait par *sql.DB et *sql.Tx (le repli trigramme s'exécute en transaction).
+type searchQuerier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// searchCursor : position dans un parcours trié (mode, tri, clé du dernier résultat, id).
+type searchCursor struct {
+	Mode, Sort, Key string
+	ID              int
+}
+
+// SearchProduits recherche dans le catalogue. Sans texte : parcours du catalogue filtré.
+// Avec texte : plein texte classé ; si rien ne correspond, repli trigramme sur le nom.
+// La pagination par curseur (keyset sur clé de tri + id) reste stable entre les pages.
+// La correspondance porte sur le contenu français ; les résultats sont ensuite traduits
+// dans opts.Locale.
+func (r *CatalogRepo) SearchProduits(opts SearchOptions) (SearchPage, error) {
+	page, err := r.searchProduits(opts)
+	if err != nil || opts.Locale == "" || opts.Locale == "fr" || len(page.Results) == 0 {
+		return page, err
+	}
+	return page, r.translateResults(opts.Locale, page.Results)
+}
+
+// translateResults remplace noms et descriptions par leur traduction, champ par champ
+// (repli sur le français). Les extraits surlignés, calculés sur le français, sont retirés.
+func (r *CatalogRepo) translateResults(locale string, results []SearchResult) error {
+	ids := make([]int64, len(results))
+	for i, p := range results {
+		ids[i] = int64(p.ID)
+	}
+	rows, err := r.DB.Query(`
+		SELECT p.id_produit, t.nom, t.description_courte, t.description_longue, ct.nom
+		FROM produits p
+		LEFT JOIN produit_traduction t ON t.id_produit = p.id_produit AND t.langue = $1
+		LEFT JOIN categorie_traduction ct ON ct.id_categorie = p.id_categorie AND ct.langue = $1
+		WHERE p.id_produit = ANY($2)`, locale, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	type translation struct{ nom, courte, longue, categorie sql.NullString }
+	byID := map[int]translation{}
+	for rows.Next() {
+		var id int
+		var t translation
+		if err := rows.Scan(&id, &t.nom, &t.courte, &t.longue, &t.categorie); err != nil {
+			return err
+		}
+		byID[id] = t
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for i := range results {
+		t, ok := byID[results[i].ID]
+		if !ok {
+			continue
+		}
+		p := &results[i]
+		if t.nom.Valid {
+			p.Nom, p.NomSurligne = t.nom.String, ""
+		}
+		if t.courte.Valid {
+			p.DescriptionCourte, p.Extrait = t.courte.String, ""
+		}
+		if t.longue.Valid {
+			p.DescriptionLongue = t.longue.String
+		}
+		if t.categorie.Valid {
+			p.CategorieNom, p.NomCategorie = t.categorie.String, t.categorie.String
+		}
+	}
+	return nil
+}
+
+func (r *CatalogRepo) searchProduits(opts SearchOptions) (SearchPage, error) {
+	tsq := PrefixTSQuery(opts.Query)
+	sort, err := ResolveSort(opts.Sort, tsq != "")
+	if err != nil {
+		return SearchPage{}, err
+	}
+	mode := SearchModeBrowse
+	if tsq != "" {
+		mode = SearchModeFullText
+	}
+	var cur *searchCursor
+	if opts.Cursor != "" {
+		c, err := decodeCursor(opts.Cursor)
+		if err != nil || c.Sort != sort || (c.Mode == SearchModeBrowse) != (tsq == "") {
+			return SearchPage{}, ErrInvalidCursor
+		}
+		cur, mode = &c, c.Mode
+	}
+
+	if mode == SearchModeFuzzy {
+		return r.fuzzySearch(opts, sort, cur)
+	}
+	page, err := searchPage(r.DB, mode, tsq, sort, opts, cur)
+	if err != nil || mode == SearchModeBrowse || page.Total > 0 || opts.Offset > 0 || cur != nil {
+		return page, err
+	}
+	return r.fuzzySearch(opts, sort, nil)
+}
+
+func (r *CatalogRepo) fuzzySearch(opts SearchOptions, sort string, cur *searchCursor) (SearchPage, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return SearchPage{}, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`SET LOCAL pg_trgm.word_similarity_threshold = ` + fuzzyThreshold); err != nil {
+		return SearchPage{}, err
+	}
+	return searchPage(tx, SearchModeFuzzy, strings.TrimSpace(opts.Query), sort, opts, cur)
+}
+
+// searchMatch retourne, pour un mode, la jointure, la condition de correspondance ($1 = texte),
+// l'expression du score et les extraits surlignés.
+func searchMatch(mode string) (from, match, rank, headlines string) {
+	switch mode {
+	case SearchModeFullText:
+		return `, to_tsquery('french_unaccent', $1) AS q(tsq)`, `p.search_vector @@ q.tsq`,
+			`ts_rank_cd(p.search_vector, q.tsq, 32)`, `
+			ts_headline('french_unaccent', p.nom, q.tsq, 'HighlightAll=true, StartSel="` + markStart + `", StopSel="` + markStop + `"'),
+			ts_headline('french_unaccent', COALESCE(NULLIF(p.description_courte,''), p.description_longue, ''), q.tsq,
+			            'MaxWords=30, MinWords=12, MaxFragments=2, FragmentDelimiter=" … ", StartSel="` + markStart + `", StopSel="` + markStop + `"')`
+	case SearchModeFuzzy:
+		return "", `immutable_unaccent(lower($1)) <% immutable_unaccent(lower(p.nom))`,
+			`word_similarity(immutable_unaccent(lower($1)), immutable_unaccent(lower(p.nom)))`, `'', ''`
+	}
+	return "", "TRUE", "0", `'', ''`
+}
+
+// searchPage exécute une page de recherche : sous-requête filtrée (total avant curseur),
+// puis keyset sur (sort_key, id) et LIMIT+1 pour savoir s'il existe une page suivante.
+func searchPage(q searchQuerier, mode, text, sort string, opts SearchOptions, cur *searchCursor) (SearchPage, error) {
+	f := searchFilters(opts)
+	args := f.args
+	n := 0
+	if mode != SearchModeBrowse {
+		args = append([]interface{}{text}, args...)
+		n = 1
+	}
+	from, match, rank, headlines := searchMatch(mode)
+	s := searchSorts[sort]
+	key := s.key
+	if sort == SortRelevance {
+		key = rank
+	}
+	joins := ""
+	if sort == SortPopular {
+		joins = popularityJoin
+	}
+
+	op, dir := ">", "ASC"
+	if s.desc {
+		op, dir = "<", "DESC"
+	}
+	query := `SELECT * FROM (
+		SELECT ` + searchColumns + `, ` + rank + `, ` + headlines + `, (` + key + `)::numeric AS sort_key
+		FROM produits p JOIN categories c ON p.id_categorie = c.id_categorie` + joins + from + `
+		WHERE ` + match + ` AND ` + shift(f.where(), n) + `
+	) s`
+	if cur != nil {
+		query += ` WHERE (s.sort_key, s.id_produit) ` + op + ` (` +
+			placeholder(&args, cur.Key) + `::numeric, ` + placeholder(&args, cur.ID) + `)`
+	}
+	query += ` ORDER BY s.sort_key ` + dir + `, s.id_produit ` + dir + ` LIMIT ` + placeholder(&args, opts.Limit+1)
+	if cur == nil && opts.Offset > 0 {
+		query += ` OFFSET ` + placeholder(&args, opts.Offset)
+	}
+
+	rows, err := q.Query(query, args...)
+	page, err := scanSearchPage(mode, sort, opts.Limit, rows, err)
+	if err != nil || !opts.Facets {
+		return page, err
+	}
+	facets, err := searchFacets(q, from, match, n, text, f)
+	page.Facets = facets
+	return page, err
+}
+
+// searchFacets calcule toutes les facettes en une requête : chaque ligne de base porte un
+// drapeau par filtre, et chaque facette agrège les lignes qui passent tous les autres filtres.
+func searchFacets(q searchQuerier, from, match string, n int, text string, f filterSet) (*SearchFacets, error) {
+	args := f.args
+	if n > 0 {
+		args = append([]interface{}{text}, args...)
+	}
+	cols := make([]string, 0, len(facetColumns)*2)
+	for i, fc := range facetColumns {
+		cols = append(cols, fc.expr+" AS "+fc.name, "("+shift(f.facets[i], n)+") AS f_"+fc.name)
+	}
+	var parts []string
+	for _, fc := range facetColumns {
+		var others []string
+		for _, o := range facetColumns {
+			if o.name != fc.name {
+				others = append(others, "f_"+o.name)
+			}
+		}
+		where := strings.Join(others, " AND ")
+		if fc.name == "prix" {
+			parts = append(parts, `SELECT 'prix', '', COUNT(*), COALESCE(MIN(prix),0), COALESCE(MAX(prix),0) FROM base WHERE `+where)
+			continue
+		}
+		parts = append(parts, `SELECT '`+fc.name+`', `+fc.name+`, COUNT(*), 0, 0 FROM base WHERE `+where+
+			` AND `+fc.name+` <> '' GROUP BY `+fc.name)
+	}
+	rows, err := q.Query(`WITH base AS (
+			SELECT `+strings.Join(cols, ", ")+`
+			FROM produits p JOIN categories c ON p.id_categorie = c.id_categorie`+from+`
+			WHERE `+match+` AND `+shift(f.base, n)+`
+		)
+		`+strings.Join(parts, "\n\t\tUNION ALL ")+`
+		ORDER BY 1, 3 DESC, 2`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	facets := &SearchFacets{Categorie: []FacetValue{}, Tag: []FacetValue{}, Duree: []FacetValue{},
+		TypeAchat: []FacetValue{}, Statut: []FacetValue{}}
+	for rows.Next() {
+		var name string
+		var v FacetValue
+		var min, max float64
+		if err := rows.Scan(&name, &v.Value, &v.Count, &min, &max); err != nil {
+			return nil, err
+		}
+		switch name {
+		case "prix":
+			facets.Prix = PriceRange{Min: min, Max: max, Count: v.Count}
+		case "categorie":
+			facets.Categorie = append(facets.Categorie, v)
+		case "tag":
+			facets.Tag = append(facets.Tag, v)
+		case "duree":
+			facets.Duree = append(facets.Duree, v)
+		case "type_achat":
+			facets.TypeAchat = append(facets.TypeAchat, v)
+		case "statut":
+			facets.Statut = append(facets.Statut, v)
+		}
+	}
+	return facets, rows.Err()
+}
+
+// filterSet : visibilité (base) et une condition par facette, alignée sur facetColumns
+// ("TRUE" quand la facette n'est pas filtrée). Paramètres numérotés à partir de $1.
+type filterSet struct {
+	base   string
+	facets []string
+	args   []interface{}
+}
+
+// where combine la visibilité et les conditions de facettes actives.
+func (f filterSet) where() string {
+	conds := []string{f.base}
+	for i := range facetColumns {
+		if f.facets[i] != "TRUE" {
+			conds = append(conds, f.facets[i])
+		}
+	}
+	return strings.Join(conds, " AND ")
+}
+
+func searchFilters(opts SearchOptions) filterSet {
+	f := filterSet{base: "TRUE", facets: make([]string, len(facetColumns))}
+	if !opts.IncludeInactive {
+		f.base = "p.actif = TRUE AND c.actif = TRUE"
+	}
+	anyOf := func(expr string, values []string) string {
+		var vals []string
+		for _, v := range values {
+			if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+				vals = append(vals, v)
+			}
+		}
+		if len(vals) == 0 {
+			return "TRUE"
+		}
+		return "lower(" + expr + ") = ANY(" + placeholder(&f.args, pq.Array(vals)) + ")"
+	}
+	for i, fc := range facetColumns {
+		cond := "TRUE"
+		switch fc.name {
+		case "categorie":
+			if opts.Category != "" {
+				cond = fc.expr + " = " + placeholder(&f.args, opts.Category)
+			}
+		case "prix":
+			var c []string
+			if opts.PrixMin != nil {
+				c = append(c, fc.expr+" >= "+placeholder(&f.args, *opts.PrixMin))
+			}
+			if opts.PrixMax != nil {
+				c = append(c, fc.expr+" <= "+placeholder(&f.args, *opts.PrixMax))
+			}
+			if len(c) > 0 {
+				cond = strings.Join(c, " AND ")
+			}
+		case "tag":
+			cond = anyOf(fc.expr, opts.Tags)
+		case "duree":
+			cond = anyOf(fc.expr, opts.Durees)
+		case "type_achat":
+			cond = anyOf(fc.expr, opts.TypesAchat)
+		case "statut":
+			cond = anyOf(fc.expr, opts.Statuts)
+		}
+		f.facets[i] = cond
+	}
+	return f
+}
+
+// ResolveSort valide le tri demandé ; par défaut pertinence avec texte, ordre d'affichage sinon.
+func ResolveSort(sort string, hasQuery bool) (string, error) {
+	switch {
+	case sort == "" && hasQuery:
+		return SortRelevance, nil
+	case sort == "" || (sort == SortRelevance && !hasQuery):
+		return SortFeatured, nil
+	}
+	if _, ok := searchSorts[sort]; !ok {
+		return "", ErrInvalidSort
+	}
+	return sort, nil
+}
+
+// encodeCursor / decodeCursor : curseur opaque (base64 URL) "mode|tri|clé|id".
+func encodeCursor(mode, sort, key string, id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(mode + "|" + sort + "|" + key + "|" + strconv.Itoa(id)))
+}
+
+func decodeCursor(s string) (searchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return searchCursor{}, ErrInvalidCursor
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 4 {
+		return searchCursor{}, ErrInvalidCursor
+	}
+	c := searchCursor{Mode: parts[0], Sort: parts[1], Key: parts[2]}
+	switch c.Mode {
+	case SearchModeBrowse, SearchModeFullText, SearchModeFuzzy:
+	default:
+		return c, ErrInvalidCursor
+	}
+	if _, ok := searchSorts[c.Sort]; !ok {
+		return c, ErrInvalidCursor
+	}
+	if _, err := strconv.ParseFloat(c.Key, 64); err != nil {
+		return c, ErrInvalidCursor
+	}
+	if c.ID, err = strconv.Atoi(parts[3]); err != nil || c.ID <= 0 {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// placeholder ajoute v aux arguments et retourne son paramètre positionnel ($n).
+func placeholder(args *[]interface{}, v interface{}) string {
+	*args = append(*args, v)
+	return "$" + strconv.Itoa(len(*args))
+}
+
+// shift décale de n les paramètres positionnels d'une clause ($1 → $1+n).
+func shift(clause string, n int) string {
+	var b strings.Builder
+	for i := 0; i < len(clause); i++ {
+		if clause[i] != '$' {
+			b.WriteByte(clause[i])
+			continue
+		}
+		j := i + 1
+		num := 0
+		for j < len(clause) && clause[j] >= '0' && clause[j] <= '9' {
+			num = num*10 + int(clause[j]-'0')
+			j++
+		}
+		b.WriteString("$" + strconv.Itoa(num+n))
+		i = j - 1
+	}
+	return b.String()
+}
+
+// scanSearchPage lit au plus limit résultats ; une ligne supplémentaire signale une page suivante.
+func scanSearchPage(mode, sort string, limit int, rows *sql.Rows, err error) (SearchPage, error) {
+	page := SearchPage{Mode: mode, Sort: sort, Results: []SearchResult{}}
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+	var lastKey string
+	for rows.Next() {
+		var p SearchResult
+		var nomHL, extrait, key string
+		if err := rows.Scan(&p.ID, &p.Nom, &p.Slug, &p.DescriptionCourte, &p.DescriptionLongue,
+			&p.Images, &p.Prix, &p.Devise, &p.Duree, &p.Tag, &p.Statut, &p.TypeAchat,
+			&p.OrdreAffichage, &p.Actif, &p.CategorieNom, &p.CategorieSlug, &page.Total,
+			&p.Rank, &nomHL, &extrait, &key); err != nil {
+			return page, err
+		}
+		if len(page.Results) == limit {
+			last := page.Results[limit-1]
+			page.NextCursor = encodeCursor(mode, sort, lastKey, last.ID)
+			break
+		}
+		p.Type = "product"
+		p.NomCategorie = p.CategorieNom
+		if nomHL != "" {
+			p.NomSurligne = Highlight(nomHL)
+		}
+		if extrait != "" {
+			p.Extrait = Highlight(extrait)
+		}
+		page.Results = append(page.Results, p)
+		lastKey = key
+	}
+	return page, rows.Err()
+}
+
+// PrefixTSQuery transforme une saisie libre en tsquery préfixée ("pare feu" → "pare:* & feu:*").
+// Seuls lettres et chiffres sont conservés : la saisie ne peut pas injecter d'opérateur.
+func PrefixTSQuery(q string) string {
+	terms := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(terms) > 8 {
+		terms = terms[:8]
+	}
+	for i, t := range terms {
+		terms[i] = t + ":*"
+	}
+	return strings.Join(terms, " & ")
+}
+
+// Highlight échappe un fragment issu de ts_headline et remplace les délimiteurs par <mark>.
+// Le texte stocké est déjà échappé (SanitizeString) : il est normalisé avant ré-échappement.
+func Highlight(s string) string {
+	s = html.EscapeString(html.UnescapeString(s))
+	s = strings.ReplaceAll(s, markStart, "<mark>")
+	return strings.ReplaceAll(s, markStop, "</mark>")
+}
@@ -0,0 +1,89 @@
+package repositories
+
+import "testing"
+
+func TestPrefixTSQuery(t *testing.T) {
+	cases := map[string]string{
+		"":                      "",
+		"   ":                   "",
+		"EDR":                   "edr:*",
+		"pare-feu  managé":      "pare:* & feu:* & managé:*",
+		"soc' | !x & (y:*)":     "soc:* & x:* & y:*",
+		"a b c d e f g h i j k": "a:* & b:* & c:* & d:* & e:* & f:* & g:* & h:*",
+	}
+	for in, want := range cases {
+		if got := PrefixTSQuery(in); got != want {
+			t.Errorf("PrefixTSQuery(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	in := "Offre " + markStart + "EDR" + markStop + " &amp; <script>"
+	want := "Offre <mark>EDR</mark> &amp; &lt;script&gt;"
+	if got := Highlight(in); got != want {
+		t.Errorf("Highlight = %q, want %q", got, want)
+	}
+}
+
+func TestShift(t *testing.T) {
+	if got := shift("c.slug = $1 AND x = $12", 1); got != "c.slug = $2 AND x = $13" {
+		t.Errorf("shift = %q", got)
+	}
+}
+
+func TestResolveSort(t *testing.T) {
+	cases := []struct {
+		sort     string
+		hasQuery bool
+		want     string
+	}{
+		{"", true, SortRelevance},
+		{"", false, SortFeatured},
+		{SortRelevance, false, SortFeatured},
+		{SortPopular, true, SortPopular},
+		{SortPriceAsc, false, SortPriceAsc},
+	}
+	for _, c := range cases {
+		if got, err := ResolveSort(c.sort, c.hasQuery); err != nil || got != c.want {
+			t.Errorf("ResolveSort(%q, %v) = %q, %v", c.sort, c.hasQuery, got, err)
+		}
+	}
+	if _, err := ResolveSort("nom; DROP", false); err != ErrInvalidSort {
+		t.Errorf("expected ErrInvalidSort, got %v", err)
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	c, err := decodeCursor(encodeCursor(SearchModeFullText, SortPriceDesc, "49.90", 12))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Mode != SearchModeFullText || c.Sort != SortPriceDesc || c.Key != "49.90" || c.ID != 12 {
+		t.Errorf("decodeCursor = %+v", c)
+	}
+	for _, bad := range []string{"", "%%%", encodeCursor("x", SortNewest, "1", 1),
+		encodeCursor(SearchModeBrowse, SortNewest, "1); --", 1), encodeCursor(SearchModeBrowse, SortNewest, "1", 0)} {
+		if _, err := decodeCursor(bad); err != ErrInvalidCursor {
+			t.Errorf("decodeCursor(%q) error = %v", bad, err)
+		}
+	}
+}
+
+func TestSearchFilters(t *testing.T) {
+	min := 10.0
+	f := searchFilters(SearchOptions{Category: "edr", PrixMin: &min, Tags: []string{" Premium ", ""}})
+	want := "p.actif = TRUE AND c.actif = TRUE AND c.slug = $1 AND COALESCE(p.prix,0) >= $2 AND lower(COALESCE(p.tag,'')) = ANY($3)"
+	if got := f.where(); got != want {
+		t.Errorf("where = %q", got)
+	}
+	if len(f.args) != 3 {
+		t.Errorf("args = %v", f.args)
+	}
+	if f.facets[3] != "TRUE" {
+		t.Errorf("unfiltered facet = %q", f.facets[3])
+	}
+	if got := searchFilters(SearchOptions{IncludeInactive: true}).where(); got != "TRUE" {
+		t.Errorf("admin where = %q", got)
+	}
+}
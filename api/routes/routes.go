@@ -2,6 +2,7 @@ package routes
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 
@@ -14,11 +15,19 @@ import (
 func Register(r *mux.Router) {
 	// ── Aliases pratiques ──────────────────────────────────────────────────────
 	auth := mw.Auth
+	authIdem := func(h http.Handler) http.Handler { return mw.Auth(mw.Idempotent(h)) }
 	adminRaw := func(h http.Handler) http.Handler { return mw.Auth(mw.Admin(h)) }
+	staff := func(h http.Handler) http.Handler { return mw.Auth(mw.Staff(h)) }
 	adminLim := func(h http.Handler) http.Handler {
 		return mw.RateLimitAdmin(mw.Auth(mw.Admin(h)))
 	}
 
+	// Fin de la période de dépréciation des routes du double catalogue (legacy / web-*).
+	catalogSunset := time.Date(2027, time.March, 31, 0, 0, 0, 0, time.UTC)
+	deprecated := func(successor string, h http.HandlerFunc) http.Handler {
+		return mw.Deprecated(catalogSunset, successor)(mw.Auth(h))
+	}
+
 	// ── Public ─────────────────────────────────────────────────────────────────
 	r.Handle("/api/login", mw.RateLimitLogin(http.HandlerFunc(handlers.Login))).Methods("POST")
 	r.Handle("/api/password-reset/request", mw.RateLimitRegister(http.HandlerFunc(handlers.RequestPasswordReset))).Methods("POST")
@@ -34,10 +43,17 @@ func Register(r *mux.Router) {
 	r.HandleFunc("/api/public/carousel-images", handlers.GetActiveCarouselImages).Methods("GET")
 	r.HandleFunc("/api/public/categories", handlers.GetActiveCategories).Methods("GET")
 	r.HandleFunc("/api/public/products/{slug}", handlers.GetActiveProduitsByCategory).Methods("GET")
-	r.HandleFunc("/api/public/produits/{id}", handlers.GetProduit).Methods("GET")
+	r.HandleFunc("/api/public/produits/{id}", handlers.GetPublicProduit).Methods("GET")
 	r.HandleFunc("/api/public/search", handlers.SearchProduits).Methods("GET")
+	r.HandleFunc("/api/public/search/suggest", handlers.SearchSuggest).Methods("GET")
 	r.HandleFunc("/api/public/top-products", handlers.GetTopProductsLast3Months).Methods("GET")
+	r.HandleFunc("/api/public/packs", handlers.GetPublicPacks).Methods("GET")
+	r.HandleFunc("/api/public/packs/{slug}", handlers.GetPublicPack).Methods("GET")
+	r.HandleFunc("/api/public/catalog/preview", handlers.GetCatalogPreview).Methods("GET")
 	r.HandleFunc("/api/public/contact", handlers.CreateTicketSupport).Methods("POST")
+	mw.SetBodyLimit("/api/public/contact", handlers.AttachmentMaxRequestSize())
+	r.HandleFunc("/api/support/inbound-email", handlers.InboundTicketEmail).Methods("POST")
+	mw.SetBodyLimit("/api/support/inbound-email", handlers.InboundEmailMaxSize)
 
 	// ── Categories ─────────────────────────────────────────────────────────────
 	r.Handle("/api/categories", auth(http.HandlerFunc(handlers.GetCategories))).Methods("GET")
@@ -45,11 +61,11 @@ func Register(r *mux.Router) {
 	r.Handle("/api/categories/{id}", auth(http.HandlerFunc(handlers.UpdateCategorie))).Methods("PUT")
 	r.Handle("/api/categories/{id}", auth(http.HandlerFunc(handlers.DeleteCategorie))).Methods("DELETE")
 
-	// Web Categories aliases
-	r.Handle("/api/web-categories", auth(http.HandlerFunc(handlers.GetCategories))).Methods("GET")
-	r.Handle("/api/web-categories", auth(http.HandlerFunc(handlers.CreateCategorie))).Methods("POST")
-	r.Handle("/api/web-categories/{id}", auth(http.HandlerFunc(handlers.UpdateCategorie))).Methods("PUT")
-	r.Handle("/api/web-categories/{id}", auth(http.HandlerFunc(handlers.DeleteCategorie))).Methods("DELETE")
+	// Web Categories aliases (dépréciés : catalogue unifié sous /api/categories)
+	r.Handle("/api/web-categories", deprecated("/api/categories", handlers.GetCategories)).Methods("GET")
+	r.Handle("/api/web-categories", deprecated("/api/categories", handlers.CreateCategorie)).Methods("POST")
+	r.Handle("/api/web-categories/{id}", deprecated("/api/categories", handlers.UpdateCategorie)).Methods("PUT")
+	r.Handle("/api/web-categories/{id}", deprecated("/api/categories", handlers.DeleteCategorie)).Methods("DELETE")
 
 	// ── Produits ───────────────────────────────────────────────────────────────
 	r.Handle("/api/produits", auth(http.HandlerFunc(handlers.GetProduits))).Methods("GET")
@@ -57,12 +73,62 @@ func Register(r *mux.Router) {
 	r.Handle("/api/produits/{id}", auth(http.HandlerFunc(handlers.GetProduit))).Methods("GET")
 	r.Handle("/api/produits/{id}", auth(http.HandlerFunc(handlers.UpdateProduit))).Methods("PUT")
 	r.Handle("/api/produits/{id}", auth(http.HandlerFunc(handlers.DeleteProduit))).Methods("DELETE")
+	r.Handle("/api/admin/produits/search", adminRaw(http.HandlerFunc(handlers.AdminSearchProduits))).Methods("GET")
+	r.Handle("/api/admin/produits/{id}/variants", adminRaw(http.HandlerFunc(handlers.GetAdminProduitVariants))).Methods("GET")
+	r.Handle("/api/admin/produits/{id}/variants", adminRaw(http.HandlerFunc(handlers.CreateProduitVariant))).Methods("POST")
+	r.Handle("/api/admin/produits/{id}/variants/{variantId}", adminRaw(http.HandlerFunc(handlers.UpdateProduitVariant))).Methods("PUT")
+	r.Handle("/api/admin/produits/{id}/variants/{variantId}", adminRaw(http.HandlerFunc(handlers.DeleteProduitVariant))).Methods("DELETE")
+	r.Handle("/api/admin/produits/{id}/options", adminRaw(http.HandlerFunc(handlers.CreateProduitOption))).Methods("POST")
+	r.Handle("/api/admin/produits/{id}/options/{optionId}", adminRaw(http.HandlerFunc(handlers.DeleteProduitOption))).Methods("DELETE")
+	r.Handle("/api/admin/packs", adminRaw(http.HandlerFunc(handlers.GetAdminPacks))).Methods("GET")
+	r.Handle("/api/admin/packs", adminRaw(http.HandlerFunc(handlers.CreatePack))).Methods("POST")
+	r.Handle("/api/admin/packs/{id}", adminRaw(http.HandlerFunc(handlers.UpdatePack))).Methods("PUT")
+	r.Handle("/api/admin/packs/{id}", adminRaw(http.HandlerFunc(handlers.DeletePack))).Methods("DELETE")
+
+	// Brouillons du catalogue : prévisualisation signée et publication planifiée
+	r.Handle("/api/admin/catalog/drafts", adminRaw(http.HandlerFunc(handlers.GetCatalogDrafts))).Methods("GET")
+	r.Handle("/api/admin/catalog/drafts", adminRaw(http.HandlerFunc(handlers.CreateCatalogDraft))).Methods("POST")
+	r.Handle("/api/admin/catalog/drafts/{id}", adminRaw(http.HandlerFunc(handlers.GetCatalogDraft))).Methods("GET")
+	r.Handle("/api/admin/catalog/drafts/{id}", adminRaw(http.HandlerFunc(handlers.UpdateCatalogDraft))).Methods("PUT")
+	r.Handle("/api/admin/catalog/drafts/{id}", adminRaw(http.HandlerFunc(handlers.DeleteCatalogDraft))).Methods("DELETE")
+	r.Handle("/api/admin/catalog/drafts/{id}/publish", adminRaw(http.HandlerFunc(handlers.PublishCatalogDraft))).Methods("POST")
+	r.Handle("/api/admin/catalog/drafts/{id}/preview", adminRaw(http.HandlerFunc(handlers.CreateCatalogDraftPreview))).Methods("POST")
+
+	// Import / export du catalogue (CSV ou JSON)
+	r.Handle("/api/admin/catalog/export", adminLim(http.HandlerFunc(handlers.ExportCatalog))).Methods("GET")
+	r.Handle("/api/admin/catalog/import", adminLim(http.HandlerFunc(handlers.ImportCatalog))).Methods("POST")
+	mw.SetBodyLimit("/api/admin/catalog/import", handlers.MaxImportSize)
+
+	// Traductions du catalogue (EN, DE ; le français est édité sur le contenu)
+	r.Handle("/api/admin/catalog/translations/{type}/{id}", adminRaw(http.HandlerFunc(handlers.GetCatalogTranslations))).Methods("GET")
+	r.Handle("/api/admin/catalog/translations/{type}/{id}/{lang}", adminRaw(http.HandlerFunc(handlers.PutCatalogTranslation))).Methods("PUT")
+	r.Handle("/api/admin/catalog/translations/{type}/{id}/{lang}", adminRaw(http.HandlerFunc(handlers.DeleteCatalogTranslation))).Methods("DELETE")
+
+	// Médias : téléversement d'images (produits, carrousel) et fichiers du stockage local
+	r.Handle("/api/admin/media", adminRaw(http.HandlerFunc(handlers.GetMediaList))).Methods("GET")
+	r.Handle("/api/admin/media", adminLim(http.HandlerFunc(handlers.UploadMedia))).Methods("POST")
+	mw.SetBodyLimit("/api/admin/media", handlers.MediaMaxRequestSize())
+	r.Handle("/api/admin/media/{id}", adminRaw(http.HandlerFunc(handlers.GetMedia))).Methods("GET")
+	r.Handle("/api/admin/media/{id}", adminRaw(http.HandlerFunc(handlers.DeleteMedia))).Methods("DELETE")
+	r.PathPrefix("/media/").Handler(handlers.ServeMedia()).Methods("GET", "HEAD")
 
-	// Web Products aliases
-	r.Handle("/api/web-products", auth(http.HandlerFunc(handlers.GetProduits))).Methods("GET")
-	r.Handle("/api/web-products", auth(http.HandlerFunc(handlers.CreateProduit))).Methods("POST")
-	r.Handle("/api/web-products/{id}", auth(http.HandlerFunc(handlers.UpdateProduit))).Methods("PUT")
-	r.Handle("/api/web-products/{id}", auth(http.HandlerFunc(handlers.DeleteProduit))).Methods("DELETE")
+	// Historique du catalogue : versions, diff et restauration
+	r.Handle("/api/admin/catalog/history", adminRaw(http.HandlerFunc(handlers.GetCatalogHistory))).Methods("GET")
+	r.Handle("/api/admin/catalog/history/{type}/{id}", adminRaw(http.HandlerFunc(handlers.GetCatalogContentHistory))).Methods("GET")
+	r.Handle("/api/admin/catalog/history/{type}/{id}/versions/{version}", adminRaw(http.HandlerFunc(handlers.GetCatalogVersion))).Methods("GET")
+	r.Handle("/api/admin/catalog/history/{type}/{id}/versions/{version}/restore", adminRaw(http.HandlerFunc(handlers.RestoreCatalogVersion))).Methods("POST")
+	r.Handle("/api/admin/search/top-queries", adminRaw(http.HandlerFunc(handlers.GetSearchTopQueries))).Methods("GET")
+	r.Handle("/api/admin/search/zero-results", adminRaw(http.HandlerFunc(handlers.GetSearchZeroResults))).Methods("GET")
+
+	// Web Products aliases (dépréciés : catalogue unifié sous /api/produits)
+	r.Handle("/api/web-products", deprecated("/api/produits", handlers.GetProduits)).Methods("GET")
+	r.Handle("/api/web-products", deprecated("/api/produits", handlers.CreateProduit)).Methods("POST")
+	r.Handle("/api/web-products/{id}", deprecated("/api/produits", handlers.UpdateProduit)).Methods("PUT")
+	r.Handle("/api/web-products/{id}", deprecated("/api/produits", handlers.DeleteProduit)).Methods("DELETE")
+
+	// Identifiants du catalogue legacy (table produit) → produit canonique
+	r.Handle("/api/legacy/produits", deprecated("/api/produits", handlers.GetLegacyProduits)).Methods("GET")
+	r.Handle("/api/legacy/produits/{id}", deprecated("/api/produits", handlers.GetLegacyProduit)).Methods("GET")
 
 	// ── Tarifications ──────────────────────────────────────────────────────────
 	r.Handle("/api/tarifications", auth(http.HandlerFunc(handlers.GetTarifications))).Methods("GET")
@@ -109,7 +175,7 @@ func Register(r *mux.Router) {
 	r.Handle("/api/abonnements/{id}", auth(http.HandlerFunc(handlers.DeleteAbonnement))).Methods("DELETE")
 
 	r.Handle("/api/commandes", auth(http.HandlerFunc(handlers.GetCommandes))).Methods("GET")
-	r.Handle("/api/commandes", auth(http.HandlerFunc(handlers.CreateCommande))).Methods("POST")
+	r.Handle("/api/commandes", authIdem(http.HandlerFunc(handlers.CreateCommande))).Methods("POST")
 	r.Handle("/api/commandes/{id}", auth(http.HandlerFunc(handlers.GetCommande))).Methods("GET")
 	r.Handle("/api/commandes/{id}", auth(http.HandlerFunc(handlers.UpdateCommande))).Methods("PUT")
 	r.Handle("/api/commandes/{id}", auth(http.HandlerFunc(handlers.DeleteCommande))).Methods("DELETE")
@@ -117,7 +183,13 @@ func Register(r *mux.Router) {
 	// Client billing (mes abonnements)
 	r.Handle("/api/mes-abonnements", auth(http.HandlerFunc(handlers.GetMesAbonnements))).Methods("GET")
 	r.Handle("/api/mes-abonnements/{id}/cancel", auth(http.HandlerFunc(handlers.CancelAbonnement))).Methods("PUT")
-	r.Handle("/api/abonnements/from-purchase", auth(http.HandlerFunc(handlers.CreateAbonnementFromPurchase))).Methods("POST")
+	r.Handle("/api/mes-abonnements/{id}/change/preview", auth(http.HandlerFunc(handlers.PreviewPlanChange))).Methods("POST")
+	r.Handle("/api/mes-abonnements/{id}/change", authIdem(http.HandlerFunc(handlers.ChangePlan))).Methods("POST")
+	r.Handle("/api/mes-abonnements/{id}/usage", auth(http.HandlerFunc(handlers.GetMyUsage))).Methods("GET")
+
+	// Usage — ingestion par les agents (clé API, permission "usage")
+	r.Handle("/api/usage/events", mw.APIKey("usage")(http.HandlerFunc(handlers.IngestUsage))).Methods("POST")
+	r.Handle("/api/abonnements/from-purchase", authIdem(http.HandlerFunc(handlers.CreateAbonnementFromPurchase))).Methods("POST")
 
 	// Admin Billing (admin only)
 	r.Handle("/api/admin/abonnements", adminRaw(http.HandlerFunc(handlers.GetAbonnements))).Methods("GET")
@@ -125,6 +197,23 @@ func Register(r *mux.Router) {
 	r.Handle("/api/admin/abonnements/{id}", adminRaw(http.HandlerFunc(handlers.UpdateAbonnement))).Methods("PUT")
 	r.Handle("/api/admin/abonnements/{id}", adminRaw(http.HandlerFunc(handlers.DeleteAbonnement))).Methods("DELETE")
 
+	// Devis — produits sur devis (client)
+	r.Handle("/api/devis", auth(http.HandlerFunc(handlers.RequestDevis))).Methods("POST")
+	r.Handle("/api/mes-devis", auth(http.HandlerFunc(handlers.GetMesDevis))).Methods("GET")
+	r.Handle("/api/mes-devis/{id}", auth(http.HandlerFunc(handlers.GetMonDevis))).Methods("GET")
+	r.Handle("/api/mes-devis/{id}/pdf", auth(http.HandlerFunc(handlers.GetMonDevisPDF))).Methods("GET")
+	r.Handle("/api/mes-devis/{id}/accept", authIdem(http.HandlerFunc(handlers.AcceptDevis))).Methods("POST")
+	r.Handle("/api/mes-devis/{id}/refuse", auth(http.HandlerFunc(handlers.RefuseDevis))).Methods("POST")
+
+	// Devis — commerciaux (admin only)
+	r.Handle("/api/admin/devis", adminRaw(http.HandlerFunc(handlers.GetAdminDevis))).Methods("GET")
+	r.Handle("/api/admin/devis", adminRaw(http.HandlerFunc(handlers.CreateDevis))).Methods("POST")
+	r.Handle("/api/admin/devis/{id}", adminRaw(http.HandlerFunc(handlers.GetAdminDevisByID))).Methods("GET")
+	r.Handle("/api/admin/devis/{id}", adminRaw(http.HandlerFunc(handlers.UpdateDevis))).Methods("PUT")
+	r.Handle("/api/admin/devis/{id}", adminRaw(http.HandlerFunc(handlers.CancelDevis))).Methods("DELETE")
+	r.Handle("/api/admin/devis/{id}/send", adminRaw(http.HandlerFunc(handlers.SendDevis))).Methods("POST")
+	r.Handle("/api/admin/devis/{id}/pdf", adminRaw(http.HandlerFunc(handlers.GetAdminDevisPDF))).Methods("GET")
+
 	r.Handle("/api/factures", auth(http.HandlerFunc(handlers.GetFactures))).Methods("GET")
 	r.Handle("/api/factures", auth(http.HandlerFunc(handlers.CreateFacture))).Methods("POST")
 	r.Handle("/api/factures/{id}", auth(http.HandlerFunc(handlers.GetFacture))).Methods("GET")
@@ -140,14 +229,31 @@ func Register(r *mux.Router) {
 	// ── Support & Notifications ────────────────────────────────────────────────
 	r.Handle("/api/tickets", auth(http.HandlerFunc(handlers.GetTicketSupports))).Methods("GET")
 	r.Handle("/api/tickets", auth(http.HandlerFunc(handlers.CreateTicketSupport))).Methods("POST")
+	mw.SetBodyLimit("/api/tickets", handlers.AttachmentMaxRequestSize())
 	r.Handle("/api/tickets/{id}", auth(http.HandlerFunc(handlers.GetTicketSupport))).Methods("GET")
 	r.Handle("/api/tickets/{id}", auth(http.HandlerFunc(handlers.UpdateTicketSupport))).Methods("PUT")
 	r.Handle("/api/tickets/{id}", auth(http.HandlerFunc(handlers.DeleteTicketSupport))).Methods("DELETE")
+	r.Handle("/api/tickets/{id}/messages", auth(http.HandlerFunc(handlers.AddTicketMessage))).Methods("POST")
+	mw.SetBodyLimit("/api/tickets/{id}/messages", handlers.AttachmentMaxRequestSize())
+	r.Handle("/api/tickets/{id}/attachments/{attachmentId}", auth(http.HandlerFunc(handlers.GetTicketAttachment))).Methods("GET")
+	r.Handle("/api/admin/tickets", staff(http.HandlerFunc(handlers.GetAdminTickets))).Methods("GET")
+	r.Handle("/api/admin/support/sla/policies", staff(http.HandlerFunc(handlers.GetSLAPolicies))).Methods("GET")
+	r.Handle("/api/admin/support/sla/policies/{tier}", adminRaw(http.HandlerFunc(handlers.PutSLAPolicy))).Methods("PUT")
+	r.Handle("/api/admin/support/sla/report", staff(http.HandlerFunc(handlers.GetSLAReport))).Methods("GET")
 
+	r.Handle("/api/stream", auth(http.HandlerFunc(handlers.Stream))).Methods("GET")
 	r.Handle("/api/notifications", auth(http.HandlerFunc(handlers.GetNotifications))).Methods("GET")
-	r.Handle("/api/notifications", auth(http.HandlerFunc(handlers.CreateNotification))).Methods("POST")
+	r.Handle("/api/notifications", adminRaw(http.HandlerFunc(handlers.CreateNotification))).Methods("POST")
+	r.Handle("/api/notifications/unread-count", auth(http.HandlerFunc(handlers.GetUnreadNotificationCount))).Methods("GET")
+	r.Handle("/api/notifications/read-all", auth(http.HandlerFunc(handlers.MarkAllNotificationsRead))).Methods("POST")
+	r.Handle("/api/notifications/preferences", auth(http.HandlerFunc(handlers.GetNotificationPreferences))).Methods("GET")
+	r.Handle("/api/notifications/preferences", auth(http.HandlerFunc(handlers.UpdateNotificationPreferences))).Methods("PUT")
+	r.Handle("/api/notifications/devices", auth(http.HandlerFunc(handlers.GetPushDevices))).Methods("GET")
+	r.Handle("/api/notifications/devices", auth(http.HandlerFunc(handlers.RegisterPushDevice))).Methods("POST")
+	r.Handle("/api/notifications/devices/{id}", auth(http.HandlerFunc(handlers.DeletePushDevice))).Methods("DELETE")
 	r.Handle("/api/notifications/{id}", auth(http.HandlerFunc(handlers.GetNotification))).Methods("GET")
 	r.Handle("/api/notifications/{id}", auth(http.HandlerFunc(handlers.UpdateNotification))).Methods("PUT")
+	r.Handle("/api/notifications/{id}/read", auth(http.HandlerFunc(handlers.MarkNotificationRead))).Methods("POST")
 	r.Handle("/api/notifications/{id}", auth(http.HandlerFunc(handlers.DeleteNotification))).Methods("DELETE")
 
 	// ── Carousel Images ────────────────────────────────────────────────────────
@@ -179,7 +285,7 @@ func Register(r *mux.Router) {
 	r.Handle("/api/admin/backup", adminRaw(http.HandlerFunc(handlers.DeleteBackup))).Methods("DELETE")
 
 	// ── Stripe ─────────────────────────────────────────────────────────
-	r.Handle("/api/payments/charge", auth(http.HandlerFunc(handlers.CreateStripeCharge))).Methods("POST")
+	r.Handle("/api/payments/charge", authIdem(http.HandlerFunc(handlers.CreateStripeCharge))).Methods("POST")
 
 	// ── Newsletter ──────────────────────────────────────────────────
 	r.HandleFunc("/api/newsletter/subscribe", handlers.SubscribeNewsletter).Methods("POST")
@@ -192,7 +298,7 @@ func Register(r *mux.Router) {
 	r.Handle("/api/admin/newsletter/subscribers/{email}", adminRaw(http.HandlerFunc(handlers.DeleteNewsletterSubscriber))).Methods("DELETE")
 
 	// ── Stats & Analytics ────────────────────────────────────────────
-	r.Handle("/api/admin/stats/top-products", adminRaw(http.HandlerFunc(handlers.GetTopProductsLast3Months))).Methods("GET")
+	r.Handle("/api/admin/stats/top-products", adminRaw(http.HandlerFunc(handlers.GetTopProductsStats))).Methods("GET")
 
 	// ── Roles & Permissions ──────────────────────────────────────────
 	r.Handle("/api/admin/roles", adminRaw(http.HandlerFunc(handlers.GetRoles))).Methods("GET")
@@ -1,10 +1,16 @@
 package services
 
 import (
+	"encoding/json"
 	"errors"
+	"log"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"api/cache"
+	"api/catalog"
 	"api/models"
 	mw "api/middleware"
 	"api/repositories"
@@ -22,8 +28,9 @@ func (s *CatalogService) GetAllCategories() ([]models.CategorieWeb, error) {
 	return s.repo.FindAllCategories()
 }
 
+// GetActiveCategories et GetActiveProduitsByCategory servent le contenu de référence (français).
 func (s *CatalogService) GetActiveCategories() ([]byte, []models.CategorieWeb, error) {
-	if cached := cache.CatalogCache.Get(cache.KeyActiveCategories); cached != nil {
+	if cached := cache.CatalogCache.Get(cache.KeyActiveCategoriesLocale(catalog.DefaultLocale)); cached != nil {
 		return cached, nil, nil
 	}
 	cats, err := s.repo.FindActiveCategories()
@@ -34,7 +41,7 @@ func (s *CatalogService) GetActiveCategories() ([]byte, []models.CategorieWeb, e
 }
 
 func (s *CatalogService) SetActiveCategoriesCache(cats []models.CategorieWeb) {
-	cache.SetJSON(cache.CatalogCache, cache.KeyActiveCategories, cats)
+	cache.SetJSON(cache.CatalogCache, cache.KeyActiveCategoriesLocale(catalog.DefaultLocale), cats)
 }
 
 func (s *CatalogService) CreateCategorie(c *models.CategorieWeb, creatorID int) error {
@@ -80,7 +87,7 @@ func (s *CatalogService) GetAllProduits(categorySlug string) ([]models.ProduitWe
 }
 
 func (s *CatalogService) GetActiveProduitsByCategory(slug string) ([]byte, []models.ProduitWeb, error) {
-	cacheKey := cache.KeyProduitsByCategory(slug)
+	cacheKey := cache.KeyProduitsByCategory(catalog.DefaultLocale, slug)
 	if cached := cache.CatalogCache.Get(cacheKey); cached != nil {
 		return cached, nil, nil
 	}
@@ -92,35 +99,152 @@ func (s *CatalogService) GetActiveProduitsByCategory(slug string) ([]byte, []mod
 }
 
 func (s *CatalogService) SetProduitsByCategoryCache(slug string, produits []models.ProduitWeb) {
-	cache.SetJSON(cache.CatalogCache, cache.KeyProduitsByCategory(slug), produits)
+	cache.SetJSON(cache.CatalogCache, cache.KeyProduitsByCategory(catalog.DefaultLocale, slug), produits)
 }
 
-func (s *CatalogService) Search(q string) ([]byte, []repositories.SearchResult, error) {
-	q = strings.TrimSpace(q)
-	if q == "" {
-		return nil, []repositories.SearchResult{}, nil
+// ErrSearchQueryTooLong est retournée pour une saisie de plus de 100 caractères.
+var ErrSearchQueryTooLong = errors.New("search query too long")
+
+// Search est le point d'entrée unique de la recherche produits, pour la vitrine
+// (produits actifs, mis en cache) comme pour les écrans d'administration (IncludeInactive).
+func (s *CatalogService) Search(opts repositories.SearchOptions) (repositories.SearchPage, error) {
+	opts.Query = strings.TrimSpace(opts.Query)
+	if len(opts.Query) > 100 {
+		return repositories.SearchPage{}, ErrSearchQueryTooLong
 	}
-	if len(q) > 100 {
-		return nil, nil, errors.New("search query too long")
+	if opts.Limit <= 0 || opts.Limit > 100 {
+		opts.Limit = 20
 	}
-	cacheKey := cache.KeySearchResults(q)
-	if cached := cache.SearchCache.Get(cacheKey); cached != nil {
-		return cached, nil, nil
+	if opts.Offset < 0 {
+		opts.Offset = 0
+	}
+
+	// Première page publique uniquement : les pages suivantes dépendent du curseur.
+	useCache := !opts.IncludeInactive && opts.Offset == 0 && opts.Cursor == ""
+	cacheKey := cache.KeySearchResults(searchLocale(opts.Locale), searchCacheKey(opts))
+	if useCache {
+		if cached := cache.SearchCache.Get(cacheKey); cached != nil {
+			var page repositories.SearchPage
+			if json.Unmarshal(cached, &page) == nil {
+				logPublicSearch(opts, page)
+				return page, nil
+			}
+		}
+	}
+	page, err := s.repo.SearchProduits(opts)
+	if err == repositories.ErrInvalidSort || err == repositories.ErrInvalidCursor {
+		return page, err
 	}
-	results, err := s.repo.SearchProduits("%" + q + "%")
 	if err != nil {
-		return nil, nil, errors.New("internal server error")
+		log.Printf("[search] %q: %v", opts.Query, err)
+		return page, errors.New("internal server error")
+	}
+	if useCache {
+		cache.SetJSON(cache.SearchCache, cacheKey, page)
+		logPublicSearch(opts, page)
+	}
+	return page, nil
+}
+
+// logPublicSearch journalise une recherche texte de la vitrine (une fois, à la première page).
+func logPublicSearch(opts repositories.SearchOptions, page repositories.SearchPage) {
+	if opts.Query != "" {
+		logSearch(opts.Query, page.Mode, page.Total)
+	}
+}
+
+// suggestIndex : index d'autocomplétion par langue, reconstruit quand le marqueur
+// cache.KeySuggestIndexLocale a expiré (TTL du catalogue) ou a été invalidé.
+var suggestIndex struct {
+	sync.Mutex
+	byLocale map[string]*catalog.SuggestIndex
+}
+
+// Suggest retourne les complétions de noms de produits et de catégories pour une saisie,
+// dans la langue locale (noms non traduits en français). L'index est en mémoire : aucune
+// requête SQL hors reconstruction.
+func (s *CatalogService) Suggest(locale, prefix string, limit int) ([]catalog.Suggestion, error) {
+	if len(prefix) > 100 {
+		return nil, ErrSearchQueryTooLong
+	}
+	if limit <= 0 || limit > 20 {
+		limit = 8
+	}
+	locale = searchLocale(locale)
+	key := cache.KeySuggestIndexLocale(locale)
+	suggestIndex.Lock()
+	if suggestIndex.byLocale == nil {
+		suggestIndex.byLocale = map[string]*catalog.SuggestIndex{}
+	}
+	idx := suggestIndex.byLocale[locale]
+	if idx == nil || cache.CatalogCache.Get(key) == nil {
+		items, err := s.repo.SuggestEntries(locale)
+		switch {
+		case err == nil:
+			idx = catalog.NewSuggestIndex(items)
+			suggestIndex.byLocale[locale] = idx
+			cache.CatalogCache.Set(key, []byte(strconv.Itoa(len(items))))
+		case idx == nil:
+			suggestIndex.Unlock()
+			log.Printf("[suggest] index %s: %v", locale, err)
+			return nil, errors.New("internal server error")
+		default:
+			// On continue de servir l'index précédent, nouvel essai dans 30 s.
+			log.Printf("[suggest] index %s rebuild: %v", locale, err)
+			cache.CatalogCache.SetWithTTL(key, []byte("stale"), 30*time.Second)
+		}
+	}
+	suggestIndex.Unlock()
+	return idx.Lookup(prefix, limit), nil
+}
+
+// FrequentlyBoughtWith retourne les produits souvent achetés avec le produit id (au moins deux
+// commandes communes). Le calcul parcourt les lignes de commande : résultat gardé une heure.
+func (s *CatalogService) FrequentlyBoughtWith(id int, slug string) []models.ProduitAssocie {
+	key := cache.KeyCrossSell(id)
+	if cached := cache.CatalogCache.Get(key); cached != nil {
+		var items []models.ProduitAssocie
+		if json.Unmarshal(cached, &items) == nil {
+			return items
+		}
 	}
-	return nil, results, nil
+	items, err := s.repo.CoPurchased(slug, 2, 4)
+	if err != nil {
+		log.Printf("[cross-sell] %s: %v", slug, err)
+		return nil
+	}
+	cache.SetJSONWithTTL(cache.CatalogCache, key, items, time.Hour)
+	return items
 }
 
-func (s *CatalogService) SetSearchCache(q string, results []repositories.SearchResult) {
-	cache.SetJSON(cache.SearchCache, cache.KeySearchResults(q), results)
+// searchLocale : langue des résultats, le français par défaut.
+func searchLocale(l string) string {
+	if l == "" {
+		return catalog.DefaultLocale
+	}
+	return l
+}
+
+// searchCacheKey sérialise toutes les options qui influencent la première page.
+func searchCacheKey(opts repositories.SearchOptions) string {
+	price := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	}
+	list := func(v []string) string {
+		return strings.ToLower(strings.Join(v, ","))
+	}
+	return strings.Join([]string{strings.ToLower(opts.Query), opts.Category, strconv.Itoa(opts.Limit),
+		price(opts.PrixMin), price(opts.PrixMax), list(opts.Tags), list(opts.Durees),
+		list(opts.TypesAchat), list(opts.Statuts), opts.Sort, strconv.FormatBool(opts.Facets)}, "|")
 }
 
 func (s *CatalogService) CreateProduit(p *models.ProduitWeb, creatorID int) error {
 	p.Nom = mw.SanitizeString(p.Nom)
 	p.DescriptionCourte = mw.SanitizeString(p.DescriptionCourte)
+	p.DescriptionHTML = mw.SanitizeHTML(p.DescriptionHTML)
 	if p.Nom == "" || p.Slug == "" {
 		return errors.New("name and slug are required")
 	}
@@ -134,6 +258,7 @@ func (s *CatalogService) CreateProduit(p *models.ProduitWeb, creatorID int) erro
 func (s *CatalogService) UpdateProduit(p *models.ProduitWeb) error {
 	p.Nom = mw.SanitizeString(p.Nom)
 	p.DescriptionCourte = mw.SanitizeString(p.DescriptionCourte)
+	p.DescriptionHTML = mw.SanitizeHTML(p.DescriptionHTML)
 	if err := s.repo.UpdateProduit(p); err != nil {
 		return errors.New("internal server error")
 	}
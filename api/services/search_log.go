@@ -0,0 +1,79 @@
+package services
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"api/repositories"
+)
+
+// ============================================================
+// Journal des recherches — écriture asynchrone par lots,
+// sur le modèle du writer de api_logs : la recherche publique
+// ne bloque jamais sur l'insertion.
+// ============================================================
+
+const (
+	searchLogChanSize   = 1000
+	searchLogRetentDays = 180
+)
+
+var searchLogChan chan repositories.SearchLogEntry
+
+// InitSearchLog purge les entrées expirées puis démarre le writer.
+func InitSearchLog(db *sql.DB) {
+	if db == nil {
+		return
+	}
+	repo := repositories.NewSearchLogRepo(db)
+	if n, err := repo.Purge(searchLogRetentDays); err != nil {
+		log.Printf("[WARN] InitSearchLog: purge: %v", err)
+	} else if n > 0 {
+		log.Printf("[INFO] InitSearchLog: purged %d old searches (>%d days)", n, searchLogRetentDays)
+	}
+	searchLogChan = make(chan repositories.SearchLogEntry, searchLogChanSize)
+	go searchLogWriter(repo)
+}
+
+// logSearch enregistre une recherche ; l'entrée est abandonnée si le canal est plein.
+func logSearch(query, mode string, results int) {
+	if searchLogChan == nil {
+		return
+	}
+	select {
+	case searchLogChan <- repositories.SearchLogEntry{Query: query, Mode: mode, Results: results, At: time.Now()}:
+	default:
+	}
+}
+
+func searchLogWriter(repo *repositories.SearchLogRepo) {
+	const batchSize = 50
+	const flushInterval = 5 * time.Second
+
+	batch := make([]repositories.SearchLogEntry, 0, batchSize)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := repo.InsertBatch(batch); err != nil {
+			log.Printf("[WARN] searchLogWriter: INSERT batch failed: %v", err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case e := <-searchLogChan:
+			batch = append(batch, e)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
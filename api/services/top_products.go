@@ -0,0 +1,74 @@
+package services
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"api/repositories"
+)
+
+// ============================================================
+// Meilleures ventes — la synthèse produit_ventes est recalculée
+// au démarrage puis à intervalle régulier ; les classements sont
+// lus depuis la synthèse, jamais depuis les commandes.
+// ============================================================
+
+var (
+	topProductsWindow  = 90
+	topProductsWindows = []int{30, 90, 365}
+)
+
+// InitTopProducts lit la configuration et démarre le recalcul périodique.
+//
+//	TOP_PRODUCTS_WINDOW_DAYS      fenêtre du classement public (défaut 90)
+//	TOP_PRODUCTS_REFRESH_MINUTES  intervalle de recalcul (défaut 60)
+func InitTopProducts(db *sql.DB) {
+	if db == nil {
+		return
+	}
+	if d, err := strconv.Atoi(os.Getenv("TOP_PRODUCTS_WINDOW_DAYS")); err == nil && d > 0 && d <= 730 {
+		topProductsWindow = d
+	}
+	if !IsTopProductsWindow(topProductsWindow) {
+		topProductsWindows = append(topProductsWindows, topProductsWindow)
+		sort.Ints(topProductsWindows)
+	}
+	minutes := 60
+	if m, err := strconv.Atoi(os.Getenv("TOP_PRODUCTS_REFRESH_MINUTES")); err == nil && m > 0 {
+		minutes = m
+	}
+
+	repo := repositories.NewSalesRepo(db)
+	go func() {
+		ticker := time.NewTicker(time.Duration(minutes) * time.Minute)
+		defer ticker.Stop()
+		for {
+			if _, err := repo.RefreshTopProducts(topProductsWindows); err != nil {
+				log.Printf("[WARN] top products refresh: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+	log.Printf("[INFO] Top products ready (windows: %v days, public: %d, refresh: %d minutes)",
+		topProductsWindows, topProductsWindow, minutes)
+}
+
+// TopProductsWindow retourne la fenêtre (en jours) du classement public.
+func TopProductsWindow() int { return topProductsWindow }
+
+// TopProductsWindows retourne les fenêtres précalculées.
+func TopProductsWindows() []int { return topProductsWindows }
+
+// IsTopProductsWindow indique si la fenêtre fait partie des fenêtres précalculées.
+func IsTopProductsWindow(days int) bool {
+	for _, d := range topProductsWindows {
+		if d == days {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package support
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ============================================================
+// PIÈCES JOINTES — captures d'écran et exports de journaux joints aux tickets.
+// Le type est détecté sur le contenu et doit correspondre à l'extension.
+// ============================================================
+
+// MaxAttachments : nombre maximal de pièces jointes par message.
+const MaxAttachments = 5
+
+var (
+	ErrAttachmentEmpty = errors.New("support: empty attachment")
+	ErrAttachmentType  = errors.New("support: attachment type not allowed")
+)
+
+// attachmentTypes : extensions acceptées et type détecté attendu (http.DetectContentType).
+var attachmentTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".pdf":  "application/pdf",
+	".txt":  "text/plain",
+	".log":  "text/plain",
+	".csv":  "text/plain",
+	".json": "text/plain",
+	".zip":  "application/zip",
+	".gz":   "application/x-gzip",
+}
+
+// AttachmentExtensions : extensions acceptées, pour les messages d'erreur.
+func AttachmentExtensions() []string {
+	exts := make([]string, 0, len(attachmentTypes))
+	for ext := range attachmentTypes {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+// CheckAttachment contrôle une pièce jointe et retourne le type sous lequel la servir.
+// Les fichiers texte (journaux, CSV, JSON) sont toujours servis en text/plain.
+func CheckAttachment(filename string, data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", ErrAttachmentEmpty
+	}
+	want, ok := attachmentTypes[strings.ToLower(filepath.Ext(filename))]
+	if !ok {
+		return "", ErrAttachmentType
+	}
+	sniffed := http.DetectContentType(data)
+	if i := strings.Index(sniffed, ";"); i >= 0 {
+		sniffed = sniffed[:i]
+	}
+	if sniffed != want {
+		return "", ErrAttachmentType
+	}
+	if want == "text/plain" {
+		return "text/plain; charset=utf-8", nil
+	}
+	return want, nil
+}
+
+// SafeFilename réduit un nom de fichier fourni par le client à un nom affichable et
+// sûr dans un en-tête Content-Disposition.
+func SafeFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`"/\<>:|?*`, r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == ".." {
+		return "piece-jointe"
+	}
+	if r := []rune(name); len(r) > 150 {
+		ext := []rune(filepath.Ext(name))
+		if len(ext) > 10 {
+			ext = nil
+		}
+		name = string(r[:150-len(ext)]) + string(ext)
+	}
+	return name
+}
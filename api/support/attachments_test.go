@@ -0,0 +1,64 @@
+package support
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckAttachment(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	ok := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"capture.PNG", png, "image/png"},
+		{"rapport.pdf", []byte("%PDF-1.7\n"), "application/pdf"},
+		{"sync.log", []byte("2026-03-02 10:00 error: timeout\n"), "text/plain; charset=utf-8"},
+		{"export.json", []byte(`{"error":"timeout"}`), "text/plain; charset=utf-8"},
+		{"logs.zip", []byte("PK\x03\x04rest"), "application/zip"},
+	}
+	for _, c := range ok {
+		if got, err := CheckAttachment(c.name, c.data); err != nil || got != c.want {
+			t.Errorf("CheckAttachment(%s) = %q, %v; want %q", c.name, got, err, c.want)
+		}
+	}
+	denied := []struct {
+		name string
+		data []byte
+	}{
+		{"outil.exe", []byte("MZ\x90\x00")},
+		{"capture.png", []byte("%PDF-1.7\n")},                          // extension trompeuse
+		{"page.txt", []byte("<html><script>alert(1)</script></html>")}, // HTML déguisé en texte
+		{"image.svg", []byte("<svg xmlns='http://www.w3.org/2000/svg'/>")},
+		{"sans-extension", png},
+	}
+	for _, c := range denied {
+		if _, err := CheckAttachment(c.name, c.data); err != ErrAttachmentType {
+			t.Errorf("CheckAttachment(%s) = %v, want ErrAttachmentType", c.name, err)
+		}
+	}
+	if _, err := CheckAttachment("vide.txt", nil); err != ErrAttachmentEmpty {
+		t.Errorf("empty file: %v", err)
+	}
+}
+
+func TestSafeFilename(t *testing.T) {
+	cases := map[string]string{
+		"capture.png":                 "capture.png",
+		`C:\Users\marc\Desktop\a.png`: "a.png",
+		"../../etc/passwd":            "passwd",
+		"rap\"port\r\n.pdf":           "rapport.pdf",
+		"":                            "piece-jointe",
+		"..":                          "piece-jointe",
+	}
+	for in, want := range cases {
+		if got := SafeFilename(in); got != want {
+			t.Errorf("SafeFilename(%q) = %q, want %q", in, got, want)
+		}
+	}
+	long := SafeFilename(strings.Repeat("é", 200) + ".log")
+	if r := []rune(long); len(r) != 150 || !strings.HasSuffix(long, ".log") {
+		t.Errorf("long name not shortened keeping its extension: %d runes", len(r))
+	}
+}
@@ -0,0 +1,315 @@
+package support
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ============================================================
+// EMAIL — réponses aux tickets par email.
+// Les emails sortants portent une adresse de réponse "support+t<ticket>-<signature>@…" ;
+// le relais de messagerie renvoie les réponses en MIME brut, dont on extrait le texte
+// ajouté par le client (historique cité retiré).
+// ============================================================
+
+// ReplyMarker : ligne placée en tête des emails sortants ; tout ce qui suit dans une
+// réponse est de l'historique.
+const ReplyMarker = "Répondez au-dessus de cette ligne"
+
+var (
+	ErrNoReplyAddress    = errors.New("support: no ticket reply address")
+	ErrReplyTokenInvalid = errors.New("support: invalid reply token")
+)
+
+// replyMAC : signature hexadécimale tronquée (80 bits) ; en minuscules car certains
+// relais ne respectent pas la casse de la partie locale.
+func replyMAC(secret []byte, ticketID int) string {
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte("ticket-reply:" + strconv.Itoa(ticketID)))
+	return hex.EncodeToString(m.Sum(nil))[:20]
+}
+
+// ReplyAddress dérive de l'adresse du support (support@cyna.fr) l'adresse de réponse
+// signée d'un ticket (support+t42-<signature>@cyna.fr).
+func ReplyAddress(secret []byte, ticketID int, base string) string {
+	at := strings.LastIndex(base, "@")
+	if at <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s+t%d-%s%s", base[:at], ticketID, replyMAC(secret, ticketID), base[at:])
+}
+
+var replyToken = regexp.MustCompile(`\+t(\d+)-([0-9a-z]*)@`)
+
+// ParseReplyAddress vérifie une adresse de réponse et retourne le ticket désigné.
+func ParseReplyAddress(secret []byte, addr string) (int, error) {
+	match := replyToken.FindStringSubmatch(strings.ToLower(strings.TrimSpace(addr)))
+	if match == nil {
+		return 0, ErrNoReplyAddress
+	}
+	id, err := strconv.Atoi(match[1])
+	if err != nil || id <= 0 || !hmac.Equal([]byte(match[2]), []byte(replyMAC(secret, id))) {
+		return 0, ErrReplyTokenInvalid
+	}
+	return id, nil
+}
+
+// InboundEmail : email reçu du relais de messagerie.
+type InboundEmail struct {
+	From        string   // adresse de l'expéditeur, en minuscules
+	Recipients  []string // To, Cc, Delivered-To, X-Original-To
+	Subject     string
+	MessageID   string
+	Text        string // corps en texte brut (HTML converti), historique compris
+	Auto        bool   // réponse automatique (absence, accusé de réception) : à ignorer
+	Attachments []InboundAttachment
+}
+
+// InboundAttachment : pièce jointe (ou image insérée) d'un email reçu, non contrôlée.
+type InboundAttachment struct {
+	Filename string
+	Data     []byte
+}
+
+// MaxInboundText : taille maximale d'une partie texte lue.
+const MaxInboundText = 1 << 20
+
+// ParseInbound lit un email MIME brut : en-têtes utiles et corps texte (partie text/plain
+// de préférence, sinon text/html convertie ; pièces jointes ignorées).
+func ParseInbound(r io.Reader) (*InboundEmail, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	from, err := msg.Header.AddressList("From")
+	if err != nil || len(from) == 0 {
+		return nil, errors.New("support: missing or invalid From header")
+	}
+	m := &InboundEmail{
+		From:      strings.ToLower(from[0].Address),
+		MessageID: strings.Trim(strings.TrimSpace(msg.Header.Get("Message-Id")), "<>"),
+	}
+	dec := new(mime.WordDecoder)
+	if m.Subject, err = dec.DecodeHeader(msg.Header.Get("Subject")); err != nil {
+		m.Subject = msg.Header.Get("Subject")
+	}
+	for _, h := range []string{"To", "Cc"} {
+		list, _ := msg.Header.AddressList(h)
+		for _, a := range list {
+			m.Recipients = append(m.Recipients, a.Address)
+		}
+	}
+	for _, h := range []string{"Delivered-To", "X-Original-To"} {
+		for _, v := range msg.Header[h] {
+			m.Recipients = append(m.Recipients, strings.Trim(strings.TrimSpace(v), "<>"))
+		}
+	}
+	auto := strings.ToLower(msg.Header.Get("Auto-Submitted"))
+	precedence := strings.ToLower(msg.Header.Get("Precedence"))
+	m.Auto = auto != "" && auto != "no" || precedence == "bulk" || precedence == "junk" ||
+		precedence == "auto_reply" || msg.Header.Get("X-Autoreply") != "" || msg.Header.Get("X-Autorespond") != ""
+
+	plain, htm, err := textParts(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), "",
+		msg.Body, 0, &m.Attachments)
+	if err != nil {
+		return nil, err
+	}
+	if plain != "" {
+		m.Text = plain
+	} else {
+		m.Text = htmlToText(htm)
+	}
+	return m, nil
+}
+
+// ReplyTicket retrouve le ticket à partir des destinataires. Une adresse de réponse dont
+// la signature est fausse fait échouer la recherche.
+func (m *InboundEmail) ReplyTicket(secret []byte) (int, error) {
+	for _, addr := range m.Recipients {
+		id, err := ParseReplyAddress(secret, addr)
+		if err != ErrNoReplyAddress {
+			return id, err
+		}
+	}
+	return 0, ErrNoReplyAddress
+}
+
+// Reply : texte ajouté par l'expéditeur (voir StripQuoted).
+func (m *InboundEmail) Reply() string {
+	return StripQuoted(m.Text)
+}
+
+// textParts parcourt l'arborescence MIME et retourne la première partie text/plain et
+// la première partie text/html qui ne sont pas des pièces jointes ; les pièces jointes
+// et les fichiers nommés (images insérées) sont ajoutés à atts.
+func textParts(contentType, encoding, disposition string, body io.Reader, depth int, atts *[]InboundAttachment) (plain, htm string, err error) {
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth > 5 || params["boundary"] == "" {
+			return "", "", errors.New("support: invalid multipart message")
+		}
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return plain, htm, nil
+			}
+			if err != nil {
+				return plain, htm, err
+			}
+			p, h, err := textParts(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"),
+				part.Header.Get("Content-Disposition"), part, depth+1, atts)
+			if err != nil {
+				return plain, htm, err
+			}
+			if plain == "" {
+				plain = p
+			}
+			if htm == "" {
+				htm = h
+			}
+		}
+	}
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	disp, dispParams, _ := mime.ParseMediaType(disposition)
+	filename := dispParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	isText := mediaType == "text/plain" || mediaType == "text/html"
+	if disp == "attachment" || filename != "" && !isText {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return "", "", err
+		}
+		dec := new(mime.WordDecoder)
+		if decoded, err := dec.DecodeHeader(filename); err == nil {
+			filename = decoded
+		}
+		*atts = append(*atts, InboundAttachment{Filename: filename, Data: data})
+		return "", "", nil
+	}
+	if !isText {
+		return "", "", nil
+	}
+	raw, err := io.ReadAll(io.LimitReader(body, MaxInboundText))
+	if err != nil {
+		return "", "", err
+	}
+	text := decodeCharset(raw, params["charset"])
+	if mediaType == "text/html" {
+		return "", text, nil
+	}
+	return text, "", nil
+}
+
+// cp1252 : caractères de windows-1252 absents de latin-1 (0x80-0x9F).
+var cp1252 = map[byte]rune{
+	0x80: '€', 0x85: '…', 0x8C: 'Œ', 0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”',
+	0x95: '•', 0x96: '–', 0x97: '—', 0x99: '™', 0x9C: 'œ',
+}
+
+// decodeCharset convertit en UTF-8 les jeux de caractères courants (utf-8, us-ascii,
+// iso-8859-1/15, windows-1252) ; les autres sont lus comme de l'UTF-8.
+func decodeCharset(raw []byte, charset string) string {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "iso-8859-15", "latin1", "windows-1252", "cp1252":
+		var b strings.Builder
+		for _, c := range raw {
+			if r, ok := cp1252[c]; ok {
+				b.WriteRune(r)
+			} else {
+				b.WriteRune(rune(c))
+			}
+		}
+		return b.String()
+	}
+	if utf8.Valid(raw) {
+		return string(raw)
+	}
+	return strings.ToValidUTF8(string(raw), "�")
+}
+
+var (
+	// Début de l'historique cité dans les clients de messagerie courants.
+	htmlQuoteStart = regexp.MustCompile(`(?i)<blockquote|<[^>]*(class="?gmail_quote|id="?divRplyFwdMsg|id="?appendonsend)|<hr\b`)
+	htmlDropBlock  = regexp.MustCompile(`(?is)<(head|style|script)\b.*?</(head|style|script)\s*>`)
+	htmlBreak      = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|li|tr|h[1-6])\s*>`)
+	htmlTag        = regexp.MustCompile(`(?s)<[^>]*>`)
+	blankLines     = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlToText réduit un corps HTML à son texte, historique cité exclu.
+func htmlToText(s string) string {
+	if loc := htmlQuoteStart.FindStringIndex(s); loc != nil {
+		s = s[:loc[0]]
+	}
+	s = htmlDropBlock.ReplaceAllString(s, "")
+	s = strings.NewReplacer("\r\n", " ", "\n", " ").Replace(s)
+	s = htmlBreak.ReplaceAllString(s, "\n")
+	s = html.UnescapeString(htmlTag.ReplaceAllString(s, ""))
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSpace(strings.ReplaceAll(l, " ", " "))
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+var (
+	// "On Mon, 2 Mar 2026 at 10:00, X <x@y> wrote:" / "Le lun. 2 mars 2026 à 10:00, X a écrit :"
+	quoteAttribution = regexp.MustCompile(`(?i)^(on|le)\s.+(wrote|a écrit)\s*:$`)
+	quoteSeparator   = regexp.MustCompile(`(?i)^(-{2,}\s*(original message|message d'origine|forwarded message|message transféré)|_{10,}$)`)
+	quoteHeaderFrom  = regexp.MustCompile(`(?i)^(from|de)\s*:\s*\S`)
+	quoteHeaderNext  = regexp.MustCompile(`(?i)^(sent|date|envoyé|to|à|subject|objet)\s*:`)
+	mobileSignature  = regexp.MustCompile(`(?i)^(sent from my |envoyé de mon |envoyé depuis mon )`)
+)
+
+// StripQuoted retire d'une réponse l'historique cité (lignes "> ", attribution "… a
+// écrit :", en-têtes Outlook, marqueur des emails sortants) et la signature "-- ".
+func StripQuoted(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	end := len(lines)
+	for i, l := range lines {
+		t := strings.TrimSpace(l)
+		next := ""
+		if i+1 < len(lines) {
+			next = strings.TrimSpace(lines[i+1])
+		}
+		if strings.Contains(t, ReplyMarker) || strings.HasPrefix(t, ">") ||
+			quoteAttribution.MatchString(t) || quoteAttribution.MatchString(t+" "+next) ||
+			quoteSeparator.MatchString(t) || l == "-- " || t == "--" || mobileSignature.MatchString(t) {
+			end = i
+			break
+		}
+		if quoteHeaderFrom.MatchString(t) && quoteHeaderNext.MatchString(next) {
+			end = i
+			break
+		}
+	}
+	return blankLines.ReplaceAllString(strings.TrimSpace(strings.Join(lines[:end], "\n")), "\n\n")
+}
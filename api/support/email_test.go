@@ -0,0 +1,114 @@
+package support
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testSecret = []byte("test-secret")
+
+func parseFixture(t *testing.T, name string) *InboundEmail {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	m, err := ParseInbound(f)
+	if err != nil {
+		t.Fatalf("ParseInbound(%s): %v", name, err)
+	}
+	return m
+}
+
+func TestReplyAddress(t *testing.T) {
+	addr := ReplyAddress(testSecret, 42, "support@cyna.fr")
+	if addr != "support+t42-3b2f42cd84bd49d66d04@cyna.fr" {
+		t.Fatalf("ReplyAddress = %s", addr)
+	}
+	if id, err := ParseReplyAddress(testSecret, "Support+T42-3B2F42CD84BD49D66D04@CYNA.fr"); err != nil || id != 42 {
+		t.Errorf("case-folded address: %d, %v", id, err)
+	}
+	forged := []string{
+		"support+t43-3b2f42cd84bd49d66d04@cyna.fr", // autre ticket, même signature
+		"support+t42-3b2f42cd84bd49d66d05@cyna.fr",
+		"support+t42-@cyna.fr",
+	}
+	for _, a := range forged {
+		if _, err := ParseReplyAddress(testSecret, a); err != ErrReplyTokenInvalid {
+			t.Errorf("ParseReplyAddress(%s) = %v, want ErrReplyTokenInvalid", a, err)
+		}
+	}
+	if _, err := ParseReplyAddress([]byte("other"), addr); err != ErrReplyTokenInvalid {
+		t.Errorf("token signed with another secret must be rejected, got %v", err)
+	}
+	for _, a := range []string{"support@cyna.fr", "jean+test@example.com"} {
+		if _, err := ParseReplyAddress(testSecret, a); err != ErrNoReplyAddress {
+			t.Errorf("ParseReplyAddress(%s) = %v, want ErrNoReplyAddress", a, err)
+		}
+	}
+	if ReplyAddress(testSecret, 1, "invalid") != "" {
+		t.Error("base address without @ must give no reply address")
+	}
+}
+
+func TestParseInbound_GmailReply(t *testing.T) {
+	m := parseFixture(t, "gmail_reply.eml")
+	if m.From != "marc.dupont@example.com" {
+		t.Errorf("From = %q", m.From)
+	}
+	if m.Subject != "Re: [Ticket #42] Accès au tableau de bord" {
+		t.Errorf("Subject = %q", m.Subject)
+	}
+	if m.MessageID != "CAF=abc123@mail.gmail.com" || m.Auto {
+		t.Errorf("MessageID = %q, Auto = %v", m.MessageID, m.Auto)
+	}
+	if id, err := m.ReplyTicket(testSecret); err != nil || id != 42 {
+		t.Errorf("ReplyTicket = %d, %v", id, err)
+	}
+	want := "Merci, ça fonctionne de nouveau depuis ce matin.\n\nJe ferme le ticket de mon côté si c'est bon pour vous."
+	if got := m.Reply(); got != want {
+		t.Errorf("Reply = %q\nwant   %q", got, want)
+	}
+}
+
+func TestParseInbound_OutlookHTML(t *testing.T) {
+	m := parseFixture(t, "outlook_reply.eml")
+	if id, err := m.ReplyTicket(testSecret); err != nil || id != 7 {
+		t.Errorf("ReplyTicket = %d, %v", id, err)
+	}
+	want := "Bonjour,\nLe problème persiste après la mise à jour – voir le journal ci-joint.\nCordialement,\nAmélie"
+	if got := m.Reply(); got != want {
+		t.Errorf("Reply = %q\nwant   %q", got, want)
+	}
+	if len(m.Attachments) != 1 || m.Attachments[0].Filename != "sync.log" || string(m.Attachments[0].Data) != "error: timeout\n" {
+		t.Errorf("Attachments = %+v", m.Attachments)
+	}
+}
+
+func TestParseInbound_ForgedAndAutoReplies(t *testing.T) {
+	if _, err := parseFixture(t, "forged_token.eml").ReplyTicket(testSecret); err != ErrReplyTokenInvalid {
+		t.Errorf("forged token: %v, want ErrReplyTokenInvalid", err)
+	}
+	if m := parseFixture(t, "auto_reply.eml"); !m.Auto {
+		t.Error("Auto-Submitted message must be flagged as automatic")
+	}
+}
+
+func TestStripQuoted(t *testing.T) {
+	cases := map[string]string{
+		"Oui merci\n\nOn Mon, Mar 2, 2026 at 10:15 AM Support <s@cyna.fr> wrote:\n> old": "Oui merci",
+		"C'est réglé.\n-----Original Message-----\nFrom: x":                              "C'est réglé.",
+		"Ok\r\n\r\nDe : Support CYNA\r\nEnvoyé : lundi\r\nÀ : moi":                       "Ok",
+		"Parfait\n-- \nMarc Dupont\nDirecteur":                                           "Parfait",
+		"Reçu\n\nEnvoyé de mon iPhone":                                                   "Reçu",
+		"Ligne 1\nDe : la part de Marc, merci":                                           "Ligne 1\nDe : la part de Marc, merci",
+		"> tout est cité":                                                                "",
+	}
+	for in, want := range cases {
+		if got := StripQuoted(in); got != want {
+			t.Errorf("StripQuoted(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
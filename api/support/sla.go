@@ -0,0 +1,131 @@
+package support
+
+import "time"
+
+// ============================================================
+// SLA — objectifs de première réponse et de résolution par niveau
+// d'abonnement (tag produit). Temps calendaire ; le chronomètre ne
+// tourne que lorsque le ticket attend le support (ouvert, en_cours).
+// ============================================================
+
+// NiveauDefaut : politique des clients sans abonnement actif (et des invités).
+const NiveauDefaut = "defaut"
+
+// Policy : objectifs d'une politique SLA.
+type Policy struct {
+	Niveau        string
+	FirstResponse time.Duration
+	Resolution    time.Duration
+}
+
+// SelectPolicy retient, parmi les politiques des niveaux souscrits, la plus exigeante
+// (première réponse la plus courte, puis résolution) ; à défaut la politique par défaut.
+func SelectPolicy(policies []Policy, niveaux []string) (Policy, bool) {
+	var best, fallback Policy
+	found, hasFallback := false, false
+	for _, p := range policies {
+		if p.Niveau == NiveauDefaut {
+			fallback, hasFallback = p, true
+		}
+		if !contains(niveaux, p.Niveau) {
+			continue
+		}
+		if !found || p.FirstResponse < best.FirstResponse ||
+			p.FirstResponse == best.FirstResponse && p.Resolution < best.Resolution {
+			best, found = p, true
+		}
+	}
+	if found {
+		return best, true
+	}
+	return fallback, hasFallback
+}
+
+// Running : le chronomètre SLA tourne (ticket en attente du support).
+func Running(statut string) bool {
+	return statut == StatutOuvert || statut == StatutEnCours
+}
+
+// Clock : temps de traitement d'un ticket, pauses déduites.
+type Clock struct {
+	Start       time.Time
+	Paused      time.Duration // pauses terminées
+	PausedSince *time.Time    // pause en cours
+}
+
+// Elapsed : temps écoulé chronomètre en marche.
+func (c Clock) Elapsed(now time.Time) time.Duration {
+	end := now
+	if c.PausedSince != nil && c.PausedSince.Before(now) {
+		end = *c.PausedSince
+	}
+	if e := end.Sub(c.Start) - c.Paused; e > 0 {
+		return e
+	}
+	return 0
+}
+
+// Due : échéance d'un objectif. Pendant une pause l'échéance n'est pas fixée (ok=false) :
+// elle sera repoussée de la durée de la pause.
+func (c Clock) Due(target time.Duration) (time.Time, bool) {
+	return c.Start.Add(c.Paused + target), c.PausedSince == nil
+}
+
+// Transition met le chronomètre en pause ou le relance selon le changement de statut.
+func (c Clock) Transition(from, to string, at time.Time) Clock {
+	switch {
+	case Running(from) && !Running(to):
+		c.PausedSince = &at
+	case !Running(from) && Running(to) && c.PausedSince != nil:
+		if at.After(*c.PausedSince) {
+			c.Paused += at.Sub(*c.PausedSince)
+		}
+		c.PausedSince = nil
+	}
+	return c
+}
+
+// Niveaux d'alerte d'un objectif.
+const (
+	LevelOK       = 0
+	LevelWarning  = 1 // échéance proche (WarnRatio de l'objectif consommé)
+	LevelBreached = 2
+)
+
+// WarnRatio : part de l'objectif à partir de laquelle le ticket est signalé.
+const WarnRatio = 0.8
+
+// Level situe un temps écoulé par rapport à un objectif.
+func Level(elapsed, target time.Duration) int {
+	switch {
+	case target <= 0:
+		return LevelOK
+	case elapsed > target:
+		return LevelBreached
+	case float64(elapsed) >= WarnRatio*float64(target):
+		return LevelWarning
+	}
+	return LevelOK
+}
+
+// Escalate : priorité d'un ticket après dépassement d'un objectif (un cran au-dessus).
+func Escalate(priorite string) string {
+	for i, p := range Priorites {
+		if p == priorite && i > 0 {
+			return Priorites[i-1]
+		}
+	}
+	if ValidPriorite(priorite) {
+		return priorite
+	}
+	return PrioriteDefaut
+}
+
+// Compliance : taux de respect (en %) parmi les objectifs tenus ou dépassés ; -1 sans
+// ticket évalué.
+func Compliance(met, breached int) float64 {
+	if met+breached == 0 {
+		return -1
+	}
+	return float64(int(float64(met)/float64(met+breached)*1000+0.5)) / 10
+}
@@ -0,0 +1,98 @@
+package support
+
+import (
+	"testing"
+	"time"
+)
+
+var testPolicies = []Policy{
+	{"Prioritaire", time.Hour, 8 * time.Hour},
+	{"Premium", 4 * time.Hour, 24 * time.Hour},
+	{"Standard", 8 * time.Hour, 72 * time.Hour},
+	{NiveauDefaut, 24 * time.Hour, 120 * time.Hour},
+}
+
+func TestSelectPolicy(t *testing.T) {
+	cases := []struct {
+		niveaux []string
+		want    string
+	}{
+		{[]string{"Standard", "Prioritaire"}, "Prioritaire"},
+		{[]string{"Premium"}, "Premium"},
+		{[]string{"Inconnu"}, NiveauDefaut},
+		{nil, NiveauDefaut},
+	}
+	for _, c := range cases {
+		p, ok := SelectPolicy(testPolicies, c.niveaux)
+		if !ok || p.Niveau != c.want {
+			t.Errorf("SelectPolicy(%v) = %v, %v; want %s", c.niveaux, p.Niveau, ok, c.want)
+		}
+	}
+	if _, ok := SelectPolicy(testPolicies[:1], []string{"Standard"}); ok {
+		t.Error("no policy expected without a default policy")
+	}
+}
+
+func TestClock_PausesWhileWaitingOnCustomer(t *testing.T) {
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	c := Clock{Start: start}
+	c = c.Transition(StatutOuvert, StatutEnCours, start.Add(30*time.Minute))
+	c = c.Transition(StatutEnCours, StatutAttenteClient, start.Add(time.Hour))
+	if _, ok := c.Due(4 * time.Hour); ok {
+		t.Error("due date must not be fixed while paused")
+	}
+	if got := c.Elapsed(start.Add(5 * time.Hour)); got != time.Hour {
+		t.Errorf("elapsed while paused = %v, want 1h", got)
+	}
+	c = c.Transition(StatutAttenteClient, StatutEnCours, start.Add(3*time.Hour))
+	if got := c.Elapsed(start.Add(4 * time.Hour)); got != 2*time.Hour {
+		t.Errorf("elapsed after resume = %v, want 2h", got)
+	}
+	due, ok := c.Due(4 * time.Hour)
+	if !ok || !due.Equal(start.Add(6*time.Hour)) {
+		t.Errorf("due = %v, %v; want %v", due, ok, start.Add(6*time.Hour))
+	}
+	// Fermeture puis réouverture : le temps fermé ne compte pas.
+	c = c.Transition(StatutEnCours, StatutFerme, start.Add(5*time.Hour))
+	c = c.Transition(StatutFerme, StatutOuvert, start.Add(29*time.Hour))
+	if got := c.Elapsed(start.Add(30 * time.Hour)); got != 4*time.Hour {
+		t.Errorf("elapsed after reopen = %v, want 4h", got)
+	}
+}
+
+func TestLevel(t *testing.T) {
+	target := 10 * time.Hour
+	cases := map[time.Duration]int{
+		time.Hour:                  LevelOK,
+		8 * time.Hour:              LevelWarning,
+		10 * time.Hour:             LevelWarning,
+		10*time.Hour + time.Second: LevelBreached,
+		100 * time.Hour:            LevelBreached,
+	}
+	for elapsed, want := range cases {
+		if got := Level(elapsed, target); got != want {
+			t.Errorf("Level(%v) = %d, want %d", elapsed, got, want)
+		}
+	}
+	if Level(time.Hour, 0) != LevelOK {
+		t.Error("no target means no alert")
+	}
+}
+
+func TestEscalate(t *testing.T) {
+	cases := map[string]string{"basse": "normale", "normale": "haute", "haute": "urgente", "urgente": "urgente", "": "normale"}
+	for in, want := range cases {
+		if got := Escalate(in); got != want {
+			t.Errorf("Escalate(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCompliance(t *testing.T) {
+	if got := Compliance(2, 1); got != 66.7 {
+		t.Errorf("Compliance(2, 1) = %v, want 66.7", got)
+	}
+	if got := Compliance(0, 0); got != -1 {
+		t.Errorf("Compliance(0, 0) = %v, want -1", got)
+	}
+}
@@ -0,0 +1,98 @@
+package support
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// TICKETS — cycle de vie, priorités et catégories
+// ouvert → en_cours → en_attente_client → ferme ; un ticket fermé peut être rouvert
+// ============================================================
+
+const (
+	StatutOuvert        = "ouvert"
+	StatutEnCours       = "en_cours"
+	StatutAttenteClient = "en_attente_client"
+	StatutFerme         = "ferme"
+)
+
+// Statuts : ordre du cycle de vie.
+var Statuts = []string{StatutOuvert, StatutEnCours, StatutAttenteClient, StatutFerme}
+
+// Priorites : de la plus urgente à la moins urgente (ordre de la file d'attente).
+var Priorites = []string{"urgente", "haute", "normale", "basse"}
+
+const PrioriteDefaut = "normale"
+
+var Categories = []string{"general", "technique", "facturation", "compte"}
+
+const CategorieDefaut = "general"
+
+var transitions = map[string][]string{
+	StatutOuvert:        {StatutEnCours, StatutAttenteClient, StatutFerme},
+	StatutEnCours:       {StatutAttenteClient, StatutFerme},
+	StatutAttenteClient: {StatutEnCours, StatutFerme},
+	StatutFerme:         {StatutOuvert},
+}
+
+// CanTransition indique si un ticket peut passer de `from` à `to`. Rester dans le
+// même statut n'est pas une transition.
+func CanTransition(from, to string) bool {
+	return contains(transitions[from], to)
+}
+
+// CustomerCanSet : statuts que le client peut demander lui-même (fermer, rouvrir).
+func CustomerCanSet(to string) bool {
+	return to == StatutFerme || to == StatutOuvert
+}
+
+func ValidStatut(s string) bool    { return contains(Statuts, s) }
+func ValidPriorite(s string) bool  { return contains(Priorites, s) }
+func ValidCategorie(s string) bool { return contains(Categories, s) }
+
+// AfterReply : statut d'un ticket après un message visible du client. La première
+// réponse du support prend le ticket en charge ; une réponse du client relance un
+// ticket en attente et rouvre un ticket fermé.
+func AfterReply(statut string, staff bool) string {
+	switch {
+	case staff && statut == StatutOuvert:
+		return StatutEnCours
+	case !staff && statut == StatutAttenteClient:
+		return StatutEnCours
+	case !staff && statut == StatutFerme:
+		return StatutOuvert
+	}
+	return statut
+}
+
+var ErrInvalidAge = errors.New("support: invalid age (expected e.g. 90m, 48h or 7d)")
+
+// ParseAge lit une ancienneté de file d'attente : durée Go ("90m", "48h") ou nombre
+// de jours ("7d").
+func ParseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || days < 0 {
+			return 0, ErrInvalidAge
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, ErrInvalidAge
+	}
+	return d, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package support
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCanTransition(t *testing.T) {
+	allowed := [][2]string{
+		{StatutOuvert, StatutEnCours},
+		{StatutEnCours, StatutAttenteClient},
+		{StatutAttenteClient, StatutEnCours},
+		{StatutAttenteClient, StatutFerme},
+		{StatutOuvert, StatutFerme},
+		{StatutFerme, StatutOuvert},
+	}
+	for _, c := range allowed {
+		if !CanTransition(c[0], c[1]) {
+			t.Errorf("expected %s → %s to be allowed", c[0], c[1])
+		}
+	}
+	denied := [][2]string{
+		{StatutEnCours, StatutOuvert},
+		{StatutFerme, StatutEnCours},
+		{StatutFerme, StatutFerme},
+		{StatutOuvert, "resolu"},
+		{"", StatutOuvert},
+	}
+	for _, c := range denied {
+		if CanTransition(c[0], c[1]) {
+			t.Errorf("expected %s → %s to be denied", c[0], c[1])
+		}
+	}
+}
+
+func TestAfterReply(t *testing.T) {
+	cases := []struct {
+		statut string
+		staff  bool
+		want   string
+	}{
+		{StatutOuvert, true, StatutEnCours},
+		{StatutAttenteClient, true, StatutAttenteClient},
+		{StatutOuvert, false, StatutOuvert},
+		{StatutAttenteClient, false, StatutEnCours},
+		{StatutFerme, false, StatutOuvert},
+		{StatutFerme, true, StatutFerme},
+	}
+	for _, c := range cases {
+		if got := AfterReply(c.statut, c.staff); got != c.want {
+			t.Errorf("AfterReply(%s, staff=%v) = %s, want %s", c.statut, c.staff, got, c.want)
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	cases := map[string]time.Duration{
+		"90m": 90 * time.Minute,
+		"48h": 48 * time.Hour,
+		"7d":  7 * 24 * time.Hour,
+		"0d":  0,
+	}
+	for in, want := range cases {
+		if got, err := ParseAge(in); err != nil || got != want {
+			t.Errorf("ParseAge(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "abc", "-1d", "-2h", "1.5d"} {
+		if _, err := ParseAge(in); err != ErrInvalidAge {
+			t.Errorf("ParseAge(%q) should fail", in)
+		}
+	}
+}
@@ -153,7 +153,8 @@ CREATE INDEX IF NOT EXISTS idx_produits_categorie_actif   ON produits(id_categor
 
 
 -- ============================================================
--- 8. CATALOGUE — Tables legacy (compatibilité API existante)
+-- 8. CATALOGUE — Tables legacy (dépréciées, migrées vers categories / produits
+--    par `./api migrate-catalog` ; conservées pendant la période de dépréciation)
 -- ============================================================
 CREATE TABLE IF NOT EXISTS categorie (
     id_categorie  SERIAL PRIMARY KEY,
@@ -179,13 +180,14 @@ CREATE TABLE IF NOT EXISTS produit (
     id_service    INT          NOT NULL REFERENCES service(id_service)
 );
 
+-- Tarifications (plans) rattachées aux produits du catalogue unifié
 CREATE TABLE IF NOT EXISTS tarification (
     id_tarification SERIAL PRIMARY KEY,
     prix            NUMERIC(10,2),
     unite           VARCHAR(30),
     periodicite     VARCHAR(20),
     actif           BOOLEAN      DEFAULT TRUE,
-    id_produit      INT          NOT NULL REFERENCES produit(id_produit)
+    id_produit      INT          NOT NULL REFERENCES produits(id_produit)
 );
 
 
@@ -197,10 +199,10 @@ CREATE TABLE IF NOT EXISTS abonnement (
     date_debut          DATE         NOT NULL,
     date_fin            DATE,
     quantite            INT,
-    statut              VARCHAR(30),           -- actif | suspendu | resilie
+    statut              VARCHAR(30),           -- actif | impaye | suspendu | resilie
     renouvellement_auto BOOLEAN      DEFAULT TRUE,
     id_entreprise       INT          NOT NULL REFERENCES entreprise(id_entreprise),
-    id_produit          INT          NOT NULL REFERENCES produit(id_produit),
+    id_produit          INT          NOT NULL REFERENCES produits(id_produit),
     id_tarification     INT          NOT NULL REFERENCES tarification(id_tarification)
 );
 
@@ -242,14 +244,14 @@ CREATE TABLE IF NOT EXISTS ticket_support (
     id_ticket       SERIAL PRIMARY KEY,
     sujet           VARCHAR(150),
     message         TEXT,
-    statut          VARCHAR(30)  DEFAULT 'ouvert', -- ouvert | en_cours | ferme
+    statut          VARCHAR(30)  DEFAULT 'ouvert', -- ouvert | en_cours | en_attente_client | ferme
     date_creation   TIMESTAMP    DEFAULT CURRENT_TIMESTAMP,
     id_utilisateur  INT          NOT NULL REFERENCES utilisateur(id_utilisateur)
 );
 
 CREATE TABLE IF NOT EXISTS notification (
     id_notification SERIAL PRIMARY KEY,
-    type            VARCHAR(50),               -- securite | facturation | info
+    type            VARCHAR(50),               -- securite | facturation | abonnement | support | info
     message         TEXT,
     lu              BOOLEAN      DEFAULT FALSE,
     date_creation   TIMESTAMP    DEFAULT CURRENT_TIMESTAMP,
@@ -429,3 +431,690 @@ CREATE TABLE IF NOT EXISTS user_roles (
 CREATE INDEX IF NOT EXISTS idx_user_role_user ON user_roles(id_utilisateur);
 CREATE INDEX IF NOT EXISTS idx_user_role_role ON user_roles(id_role);
 
+
+
+-- ============================================================
+-- 22. IDEMPOTENCY KEYS (header Idempotency-Key, rétention 24h)
+-- ============================================================
+CREATE TABLE IF NOT EXISTS idempotency_key (
+    portee                VARCHAR(100) NOT NULL,           -- user:<id> | ip:<addr>
+    cle                   VARCHAR(255) NOT NULL,
+    empreinte             CHAR(64)     NOT NULL,           -- sha256(méthode, chemin, corps)
+    statut_reponse        INT,                             -- NULL tant que la requête est en cours
+    content_type          VARCHAR(100),
+    corps_reponse         BYTEA,
+    date_creation         TIMESTAMP    DEFAULT CURRENT_TIMESTAMP,
+    date_reservation      TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP, -- reprise après 2 min sans réponse
+    date_expiration       TIMESTAMP    NOT NULL,
+    PRIMARY KEY (portee, cle)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_expiration ON idempotency_key(date_expiration);
+
+
+-- ============================================================
+-- 23. RENOUVELLEMENTS D'ABONNEMENTS (worker de facturation)
+-- ============================================================
+ALTER TABLE IF EXISTS entreprise ADD COLUMN IF NOT EXISTS stripe_customer_id VARCHAR(100);
+ALTER TABLE IF EXISTS abonnement ADD COLUMN IF NOT EXISTS date_statut TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS abonnement_renouvellement (
+    id_renouvellement     SERIAL PRIMARY KEY,
+    id_abonnement         INT           NOT NULL REFERENCES abonnement(id_abonnement) ON DELETE CASCADE,
+    periode_debut         DATE          NOT NULL,          -- = date_fin de la période précédente
+    periode_fin           DATE          NOT NULL,
+    montant               NUMERIC(10,2) NOT NULL,
+    id_commande           INT           REFERENCES commande(id_commande),
+    statut                VARCHAR(30)   DEFAULT 'attente', -- attente | en_cours | paye | echec | annule
+    tentatives            INT           DEFAULT 0,         -- refus de paiement uniquement
+    prochaine_tentative   TIMESTAMP,
+    derniere_erreur       TEXT,
+    date_creation         TIMESTAMP     DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(id_abonnement, periode_debut)
+);
+
+CREATE INDEX IF NOT EXISTS idx_renouvellement_echeance ON abonnement_renouvellement(statut, prochaine_tentative);
+
+-- Débit réservé par le worker (statut en_cours) : l'appel au fournisseur se fait hors transaction
+ALTER TABLE IF EXISTS abonnement_renouvellement ADD COLUMN IF NOT EXISTS date_reservation TIMESTAMP;
+
+
+-- ============================================================
+-- 24. CHANGEMENTS DE FORMULE & LIGNES DE FACTURE
+-- ============================================================
+-- Baisse de formule programmée, appliquée au prochain renouvellement
+ALTER TABLE IF EXISTS abonnement ADD COLUMN IF NOT EXISTS quantite_prochaine INT;
+ALTER TABLE IF EXISTS abonnement ADD COLUMN IF NOT EXISTS id_tarification_prochaine INT REFERENCES tarification(id_tarification);
+
+-- Formule facturée pour la période renouvelée
+ALTER TABLE IF EXISTS abonnement_renouvellement ADD COLUMN IF NOT EXISTS quantite INT;
+ALTER TABLE IF EXISTS abonnement_renouvellement ADD COLUMN IF NOT EXISTS id_tarification INT REFERENCES tarification(id_tarification);
+
+CREATE TABLE IF NOT EXISTS facture_ligne (
+    id_ligne              SERIAL PRIMARY KEY,
+    id_facture            INT           NOT NULL REFERENCES facture(id_facture) ON DELETE CASCADE,
+    type_ligne            VARCHAR(30)   NOT NULL,          -- abonnement | prorata_credit | prorata_debit | usage | frais | remise
+    libelle               TEXT          NOT NULL,
+    quantite              NUMERIC(12,3) DEFAULT 1,
+    prix_unitaire         NUMERIC(10,2) DEFAULT 0,
+    montant               NUMERIC(10,2) NOT NULL,          -- négatif pour un crédit
+    id_abonnement         INT           REFERENCES abonnement(id_abonnement) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_facture_ligne_facture ON facture_ligne(id_facture);
+
+
+-- ============================================================
+-- 25. USAGE — facturation à l'usage (agents de sécurité managée)
+-- ============================================================
+-- prix_usage NULL = tarification forfaitaire ; sinon prix par unité (tarification.unite)
+ALTER TABLE IF EXISTS tarification ADD COLUMN IF NOT EXISTS prix_usage NUMERIC(10,4);
+ALTER TABLE IF EXISTS tarification ADD COLUMN IF NOT EXISTS agregation VARCHAR(10) DEFAULT 'sum';   -- sum | max
+
+CREATE TABLE IF NOT EXISTS usage_evenement (
+    id_usage_evenement    BIGSERIAL PRIMARY KEY,
+    id_abonnement         INT           NOT NULL REFERENCES abonnement(id_abonnement) ON DELETE CASCADE,
+    metrique              VARCHAR(50)   NOT NULL,
+    quantite              NUMERIC(14,4) NOT NULL,
+    horodatage            TIMESTAMP     NOT NULL,
+    cle_idempotence       VARCHAR(255)  NOT NULL,
+    id_token              INT           REFERENCES api_token(id_token) ON DELETE SET NULL,
+    date_reception        TIMESTAMP     DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(id_abonnement, cle_idempotence)
+);
+
+-- Agrégat par période de facturation (identifiée par sa date de fin = date_fin de l'abonnement)
+CREATE TABLE IF NOT EXISTS usage_periode (
+    id_usage_periode      SERIAL PRIMARY KEY,
+    id_abonnement         INT           NOT NULL REFERENCES abonnement(id_abonnement) ON DELETE CASCADE,
+    metrique              VARCHAR(50)   NOT NULL,
+    periode_debut         DATE          NOT NULL,
+    periode_fin           DATE          NOT NULL,
+    total                 NUMERIC(14,4) DEFAULT 0,
+    maximum               NUMERIC(14,4) DEFAULT 0,
+    nb_evenements         INT           DEFAULT 0,
+    statut                VARCHAR(20)   DEFAULT 'ouvert',  -- ouvert | facture
+    id_facture            INT           REFERENCES facture(id_facture) ON DELETE SET NULL,
+    date_maj              TIMESTAMP     DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(id_abonnement, metrique, periode_fin)
+);
+
+CREATE INDEX IF NOT EXISTS idx_usage_evenement_abonnement ON usage_evenement(id_abonnement, horodatage);
+
+-- ============================================================
+-- 26. DEVIS — produits sur devis (demande, chiffrage, acceptation en ligne)
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS devis (
+    id_devis              SERIAL PRIMARY KEY,
+    numero                VARCHAR(30)   UNIQUE,            -- DEV-AAAA-00001
+    statut                VARCHAR(20)   NOT NULL DEFAULT 'demande',  -- demande | brouillon | envoye | accepte | refuse | expire | annule
+    besoin                TEXT,
+    id_utilisateur        INT           NOT NULL REFERENCES utilisateur(id_utilisateur) ON DELETE CASCADE,
+    id_entreprise         INT           REFERENCES entreprise(id_entreprise) ON DELETE SET NULL,
+    id_produit            INT           REFERENCES produits(id_produit) ON DELETE SET NULL,  -- produit demandé puis chiffré
+    periodicite           VARCHAR(20)   DEFAULT 'mensuel',
+    remise_pct            NUMERIC(5,2)  DEFAULT 0,
+    date_validite         DATE,
+    notes                 TEXT,
+    id_commercial         INT           REFERENCES utilisateur(id_utilisateur) ON DELETE SET NULL,
+    date_creation         TIMESTAMP     DEFAULT CURRENT_TIMESTAMP,
+    date_modification     TIMESTAMP     DEFAULT CURRENT_TIMESTAMP,
+    date_envoi            TIMESTAMP,
+    date_reponse          TIMESTAMP,
+    motif_refus           TEXT,
+    id_commande           INT           REFERENCES commande(id_commande) ON DELETE SET NULL,
+    id_abonnement         INT           REFERENCES abonnement(id_abonnement) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS devis_ligne (
+    id_ligne              SERIAL PRIMARY KEY,
+    id_devis              INT           NOT NULL REFERENCES devis(id_devis) ON DELETE CASCADE,
+    libelle               TEXT          NOT NULL,
+    quantite              NUMERIC(12,3) DEFAULT 1,
+    prix_unitaire         NUMERIC(10,2) DEFAULT 0,
+    recurrent             BOOLEAN       DEFAULT FALSE,     -- TRUE = facturé à chaque période (abonnement)
+    ordre                 INT           DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_devis_utilisateur ON devis(id_utilisateur);
+CREATE INDEX IF NOT EXISTS idx_devis_statut ON devis(statut, date_validite);
+CREATE INDEX IF NOT EXISTS idx_devis_ligne_devis ON devis_ligne(id_devis);
+
+-- ============================================================
+-- 27. CATALOGUE UNIFIÉ — correspondance legacy → canonique
+-- ============================================================
+-- Catalogue canonique : categories / produits. Les tarifications, abonnements et devis
+-- référencent produits(id_produit). Sur une base existante, `./api migrate-catalog`
+-- rapproche ou recrée les lignes legacy et repointe les clés étrangères.
+
+ALTER TABLE IF EXISTS categories ADD COLUMN IF NOT EXISTS id_categorie_legacy INT UNIQUE;
+ALTER TABLE IF EXISTS produits ADD COLUMN IF NOT EXISTS id_produit_legacy INT UNIQUE;
+
+-- ============================================================
+-- 28. RECHERCHE PLEIN TEXTE — produits (tsvector français sans accents + trigrammes)
+-- ============================================================
+CREATE EXTENSION IF NOT EXISTS unaccent;
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- unaccent() n'est pas IMMUTABLE : enveloppe utilisable dans un index d'expression
+CREATE OR REPLACE FUNCTION immutable_unaccent(TEXT) RETURNS TEXT
+AS $$ SELECT public.unaccent('public.unaccent'::regdictionary, $1) $$
+LANGUAGE sql IMMUTABLE PARALLEL SAFE STRICT;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = 'french_unaccent') THEN
+        CREATE TEXT SEARCH CONFIGURATION french_unaccent (COPY = french);
+        ALTER TEXT SEARCH CONFIGURATION french_unaccent
+            ALTER MAPPING FOR hword, hword_part, word WITH unaccent, french_stem;
+    END IF;
+END $$;
+
+ALTER TABLE IF EXISTS produits ADD COLUMN IF NOT EXISTS search_vector TSVECTOR;
+
+-- Pondération : nom (A) > tag, catégorie (B) > description courte (C) > description longue (D)
+CREATE OR REPLACE FUNCTION produits_search_vector_maj() RETURNS TRIGGER AS $$
+DECLARE
+    cat TEXT;
+BEGIN
+    SELECT nom INTO cat FROM categories WHERE id_categorie = NEW.id_categorie;
+    NEW.search_vector :=
+        setweight(to_tsvector('french_unaccent', COALESCE(NEW.nom, '')), 'A') ||
+        setweight(to_tsvector('french_unaccent', COALESCE(NEW.tag, '')), 'B') ||
+        setweight(to_tsvector('french_unaccent', COALESCE(cat, '')), 'B') ||
+        setweight(to_tsvector('french_unaccent', COALESCE(NEW.description_courte, '')), 'C') ||
+        setweight(to_tsvector('french_unaccent', COALESCE(NEW.description_longue, '')), 'D');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_produits_search_vector ON produits;
+CREATE TRIGGER trg_produits_search_vector
+    BEFORE INSERT OR UPDATE OF nom, tag, description_courte, description_longue, id_categorie ON produits
+    FOR EACH ROW EXECUTE FUNCTION produits_search_vector_maj();
+
+-- Renommer une catégorie réindexe ses produits
+CREATE OR REPLACE FUNCTION categories_search_vector_maj() RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.nom IS DISTINCT FROM OLD.nom THEN
+        UPDATE produits SET id_categorie = id_categorie WHERE id_categorie = NEW.id_categorie;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_categories_search_vector ON categories;
+CREATE TRIGGER trg_categories_search_vector
+    AFTER UPDATE OF nom ON categories
+    FOR EACH ROW EXECUTE FUNCTION categories_search_vector_maj();
+
+-- Rattrapage des lignes existantes
+UPDATE produits SET nom = nom WHERE search_vector IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_produits_search_vector ON produits USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_produits_nom_trgm ON produits USING GIN (immutable_unaccent(lower(nom)) gin_trgm_ops);
+
+-- ============================================================
+-- 29. RECHERCHE — journal des recherches (rapports top / sans résultat)
+-- ============================================================
+CREATE TABLE IF NOT EXISTS recherche_log (
+    id_recherche       BIGSERIAL    PRIMARY KEY,
+    requete            VARCHAR(100) NOT NULL,
+    requete_normalisee VARCHAR(100) NOT NULL,   -- minuscules, sans accents ni ponctuation
+    mode               VARCHAR(20)  NOT NULL,   -- browse | fulltext | fuzzy
+    nb_resultats       INT          NOT NULL DEFAULT 0,
+    date_recherche     TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_recherche_log_date ON recherche_log(date_recherche);
+CREATE INDEX IF NOT EXISTS idx_recherche_log_zero ON recherche_log(date_recherche) WHERE nb_resultats = 0;
+
+-- ============================================================
+-- 30. PRODUITS — options et variantes (taille, rétention, niveau de support)
+-- ============================================================
+-- Une option (ex. endpoints) propose des valeurs (50, 100, 250) ; une variante combine
+-- une valeur par option, porte son SKU, sa disponibilité et ses prix par période
+-- (tarification.id_variante). Les variantes retirées sont désactivées, jamais supprimées :
+-- commandes et abonnements y font référence.
+CREATE TABLE IF NOT EXISTS produit_option (
+    id_option      SERIAL PRIMARY KEY,
+    id_produit     INT          NOT NULL REFERENCES produits(id_produit) ON DELETE CASCADE,
+    code           VARCHAR(50)  NOT NULL,
+    nom            VARCHAR(100) NOT NULL,
+    ordre          INT          DEFAULT 0,
+    UNIQUE(id_produit, code)
+);
+
+CREATE TABLE IF NOT EXISTS produit_option_valeur (
+    id_valeur      SERIAL PRIMARY KEY,
+    id_option      INT          NOT NULL REFERENCES produit_option(id_option) ON DELETE CASCADE,
+    code           VARCHAR(50)  NOT NULL,
+    libelle        VARCHAR(100) NOT NULL,
+    ordre          INT          DEFAULT 0,
+    UNIQUE(id_option, code)
+);
+
+CREATE TABLE IF NOT EXISTS produit_variante (
+    id_variante       SERIAL PRIMARY KEY,
+    id_produit        INT          NOT NULL REFERENCES produits(id_produit),
+    sku               VARCHAR(40)  NOT NULL UNIQUE,
+    nom               VARCHAR(150) NOT NULL,
+    combinaison       TEXT         NOT NULL,            -- clé canonique "option=valeur;…"
+    disponibilite     VARCHAR(20)  NOT NULL DEFAULT 'disponible', -- disponible | sur_devis | indisponible
+    actif             BOOLEAN      DEFAULT TRUE,
+    ordre             INT          DEFAULT 0,
+    date_creation     TIMESTAMP    DEFAULT CURRENT_TIMESTAMP,
+    date_modification TIMESTAMP    DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_produit_variante_combinaison
+    ON produit_variante(id_produit, combinaison) WHERE actif = TRUE;
+
+CREATE TABLE IF NOT EXISTS produit_variante_valeur (
+    id_variante    INT NOT NULL REFERENCES produit_variante(id_variante) ON DELETE CASCADE,
+    id_valeur      INT NOT NULL REFERENCES produit_option_valeur(id_valeur),
+    PRIMARY KEY (id_variante, id_valeur)
+);
+
+-- Prix d'une variante par période ; NULL = tarification du produit
+ALTER TABLE IF EXISTS tarification ADD COLUMN IF NOT EXISTS id_variante INT REFERENCES produit_variante(id_variante);
+CREATE INDEX IF NOT EXISTS idx_tarification_variante ON tarification(id_variante) WHERE id_variante IS NOT NULL;
+
+-- ============================================================
+-- 31. PACKS — offres groupées de produits existants
+-- ============================================================
+-- Un pack regroupe des produits (ou variantes) du catalogue pour une périodicité, à prix
+-- fixe OU avec une remise en pourcentage sur la somme des prix catalogue. L'achat crée un
+-- abonnement par composant, chacun sur une tarification privée (inactive) au prix réparti.
+CREATE TABLE IF NOT EXISTS pack (
+    id_pack           SERIAL PRIMARY KEY,
+    nom               VARCHAR(255)  NOT NULL,
+    slug              VARCHAR(255)  NOT NULL UNIQUE,
+    description       TEXT,
+    prix              NUMERIC(10,2) CHECK (prix IS NULL OR prix >= 0),
+    remise_pct        NUMERIC(5,2)  CHECK (remise_pct IS NULL OR (remise_pct > 0 AND remise_pct < 100)),
+    periodicite       VARCHAR(20)   NOT NULL DEFAULT 'mensuel',
+    actif             BOOLEAN       DEFAULT TRUE,
+    ordre_affichage   INT           DEFAULT 0,
+    date_creation     TIMESTAMP     DEFAULT CURRENT_TIMESTAMP,
+    date_modification TIMESTAMP     DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((prix IS NULL) <> (remise_pct IS NULL))
+);
+
+CREATE TABLE IF NOT EXISTS pack_element (
+    id_element     SERIAL PRIMARY KEY,
+    id_pack        INT NOT NULL REFERENCES pack(id_pack) ON DELETE CASCADE,
+    id_produit     INT NOT NULL REFERENCES produits(id_produit),
+    id_variante    INT REFERENCES produit_variante(id_variante),
+    quantite       INT NOT NULL DEFAULT 1 CHECK (quantite > 0),
+    ordre          INT DEFAULT 0,
+    UNIQUE(id_pack, id_produit)
+);
+
+ALTER TABLE IF EXISTS abonnement ADD COLUMN IF NOT EXISTS id_pack INT REFERENCES pack(id_pack) ON DELETE SET NULL;
+
+-- ============================================================
+-- 32. STATISTIQUES — ventes par produit (classement des meilleures ventes)
+-- ============================================================
+-- Table de synthèse recalculée périodiquement par l'API (services.InitTopProducts) à partir
+-- des lignes des commandes payées, pour chaque fenêtre glissante (30, 90, 365 jours…).
+CREATE TABLE IF NOT EXISTS produit_ventes (
+    fenetre_jours     INT           NOT NULL,
+    id_produit        INT           NOT NULL REFERENCES produits(id_produit) ON DELETE CASCADE,
+    nb_commandes      INT           NOT NULL,
+    quantite          INT           NOT NULL,
+    chiffre_affaires  NUMERIC(12,2) NOT NULL,
+    rang              INT           NOT NULL,
+    date_calcul       TIMESTAMP     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (fenetre_jours, id_produit)
+);
+
+CREATE INDEX IF NOT EXISTS idx_produit_ventes_rang ON produit_ventes(fenetre_jours, rang);
+
+-- ============================================================
+-- 33. CATALOGUE — brouillons, prévisualisation et publication planifiée
+-- ============================================================
+-- Une modification de produit ou de catégorie est préparée en brouillon (contenu complet
+-- en JSON, ou simple publication / dépublication), prévisualisée par jeton signé, puis
+-- publiée à la main ou à date_publication par le job de publication. Les brouillons
+-- planifiés au même instant sont appliqués dans une seule transaction.
+CREATE TABLE IF NOT EXISTS catalogue_brouillon (
+    id_brouillon      SERIAL PRIMARY KEY,
+    type_contenu      VARCHAR(20)  NOT NULL,                      -- produit | categorie
+    id_contenu        INT          NOT NULL,
+    version           INT          NOT NULL,                      -- numéro de version du contenu
+    action            VARCHAR(20)  NOT NULL DEFAULT 'update',     -- update | publish | unpublish
+    donnees           JSONB,                                      -- contenu complet (action update)
+    statut            VARCHAR(20)  NOT NULL DEFAULT 'brouillon',  -- brouillon | planifie | publie | annule | echec
+    date_publication  TIMESTAMP,                                  -- publication planifiée
+    base_modification TIMESTAMP,                                  -- date_modification du contenu à la création
+    erreur            TEXT,
+    id_auteur         INT          REFERENCES utilisateur(id_utilisateur) ON DELETE SET NULL,
+    date_creation     TIMESTAMP    DEFAULT CURRENT_TIMESTAMP,
+    date_modification TIMESTAMP    DEFAULT CURRENT_TIMESTAMP,
+    date_application  TIMESTAMP,
+    UNIQUE(type_contenu, id_contenu, version)
+);
+
+CREATE INDEX IF NOT EXISTS idx_catalogue_brouillon_planifie
+    ON catalogue_brouillon(date_publication) WHERE statut = 'planifie';
+
+-- ============================================================
+-- 34. CATALOGUE — historique des versions
+-- ============================================================
+-- Chaque création, modification ou suppression sur produits, categories, tarification et
+-- carousel_images enregistre un instantané complet de la ligne (trigger), numéroté par
+-- contenu. L'auteur est lu dans le paramètre de transaction cyna.id_utilisateur, positionné
+-- par l'API ; une restauration positionne cyna.version_restauree.
+CREATE TABLE IF NOT EXISTS catalogue_version (
+    id_version         SERIAL PRIMARY KEY,
+    type_contenu       VARCHAR(20)  NOT NULL,                 -- produit | categorie | tarification | carousel_image
+    id_contenu         INT          NOT NULL,
+    version            INT          NOT NULL,
+    action             VARCHAR(10)  NOT NULL,                 -- create | update | delete | restore
+    donnees            JSONB        NOT NULL,                 -- ligne après l'opération (avant pour delete)
+    version_restauree  INT,
+    id_auteur          INT          REFERENCES utilisateur(id_utilisateur) ON DELETE SET NULL,
+    date_creation      TIMESTAMP    DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(type_contenu, id_contenu, version)
+);
+
+CREATE INDEX IF NOT EXISTS idx_catalogue_version_date ON catalogue_version(date_creation DESC);
+
+CREATE OR REPLACE FUNCTION catalogue_version_enregistrer() RETURNS TRIGGER AS $$
+DECLARE
+    ligne     JSONB;
+    operation VARCHAR(10);
+    ident     INT;
+    restauree INT;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        ligne := to_jsonb(OLD) - 'search_vector';
+        operation := 'delete';
+    ELSE
+        ligne := to_jsonb(NEW) - 'search_vector';
+        operation := CASE TG_OP WHEN 'INSERT' THEN 'create' ELSE 'update' END;
+        -- Une mise à jour sans effet (hors date_modification) ne crée pas de version.
+        IF TG_OP = 'UPDATE' AND ligne - 'date_modification' = (to_jsonb(OLD) - 'search_vector') - 'date_modification' THEN
+            RETURN NULL;
+        END IF;
+    END IF;
+    restauree := NULLIF(current_setting('cyna.version_restauree', true), '')::int;
+    IF restauree IS NOT NULL AND TG_OP <> 'DELETE' THEN
+        operation := 'restore';
+    END IF;
+    ident := (ligne ->> TG_ARGV[1])::int;
+    -- Sérialise la numérotation par contenu jusqu'à la fin de la transaction : deux
+    -- transactions concurrentes ne peuvent pas lire le même MAX(version).
+    PERFORM pg_advisory_xact_lock(hashtext('catalogue_version:' || TG_ARGV[0]), ident);
+    INSERT INTO catalogue_version (type_contenu, id_contenu, version, action, donnees, version_restauree, id_auteur)
+    SELECT TG_ARGV[0], ident, COALESCE(MAX(version), 0) + 1, operation, ligne,
+           CASE WHEN operation = 'restore' THEN restauree END,
+           NULLIF(current_setting('cyna.id_utilisateur', true), '')::int
+    FROM catalogue_version WHERE type_contenu = TG_ARGV[0] AND id_contenu = ident;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_produits_version ON produits;
+CREATE TRIGGER trg_produits_version
+    AFTER INSERT OR UPDATE OR DELETE ON produits
+    FOR EACH ROW EXECUTE FUNCTION catalogue_version_enregistrer('produit', 'id_produit');
+
+DROP TRIGGER IF EXISTS trg_categories_version ON categories;
+CREATE TRIGGER trg_categories_version
+    AFTER INSERT OR UPDATE OR DELETE ON categories
+    FOR EACH ROW EXECUTE FUNCTION catalogue_version_enregistrer('categorie', 'id_categorie');
+
+DROP TRIGGER IF EXISTS trg_tarification_version ON tarification;
+CREATE TRIGGER trg_tarification_version
+    AFTER INSERT OR UPDATE OR DELETE ON tarification
+    FOR EACH ROW EXECUTE FUNCTION catalogue_version_enregistrer('tarification', 'id_tarification');
+
+DROP TRIGGER IF EXISTS trg_carousel_images_version ON carousel_images;
+CREATE TRIGGER trg_carousel_images_version
+    AFTER INSERT OR UPDATE OR DELETE ON carousel_images
+    FOR EACH ROW EXECUTE FUNCTION catalogue_version_enregistrer('carousel_image', 'id_image');
+
+-- Version de départ des contenus antérieurs à l'historique.
+INSERT INTO catalogue_version (type_contenu, id_contenu, version, action, donnees, id_auteur)
+SELECT 'produit', p.id_produit, 1, 'create', to_jsonb(p) - 'search_vector', p.id_utilisateur_creation
+FROM produits p
+WHERE NOT EXISTS (SELECT 1 FROM catalogue_version v WHERE v.type_contenu = 'produit' AND v.id_contenu = p.id_produit);
+INSERT INTO catalogue_version (type_contenu, id_contenu, version, action, donnees, id_auteur)
+SELECT 'categorie', c.id_categorie, 1, 'create', to_jsonb(c) - 'search_vector', c.id_utilisateur_creation
+FROM categories c
+WHERE NOT EXISTS (SELECT 1 FROM catalogue_version v WHERE v.type_contenu = 'categorie' AND v.id_contenu = c.id_categorie);
+INSERT INTO catalogue_version (type_contenu, id_contenu, version, action, donnees)
+SELECT 'tarification', t.id_tarification, 1, 'create', to_jsonb(t)
+FROM tarification t
+WHERE NOT EXISTS (SELECT 1 FROM catalogue_version v WHERE v.type_contenu = 'tarification' AND v.id_contenu = t.id_tarification);
+INSERT INTO catalogue_version (type_contenu, id_contenu, version, action, donnees, id_auteur)
+SELECT 'carousel_image', i.id_image, 1, 'create', to_jsonb(i), i.id_utilisateur_creation
+FROM carousel_images i
+WHERE NOT EXISTS (SELECT 1 FROM catalogue_version v WHERE v.type_contenu = 'carousel_image' AND v.id_contenu = i.id_image);
+
+-- ============================================================
+-- 35. MÉDIAS — images téléversées (produits, carrousel)
+-- ============================================================
+-- Un média regroupe les fichiers générés à partir d'un envoi (original ré-encodé sans
+-- EXIF, tailles réduites, WebP) ; variantes décrit chaque fichier (nom, format,
+-- dimensions, clé de stockage, URL). Les produits et le carrousel référencent des
+-- médias : produits.images et carousel_images.url_image en sont dérivés.
+CREATE TABLE IF NOT EXISTS media (
+    id_media                SERIAL PRIMARY KEY,
+    empreinte               CHAR(64)     NOT NULL UNIQUE,         -- SHA-256 du fichier reçu (déduplication)
+    nom_original            VARCHAR(255),
+    type_mime               VARCHAR(50)  NOT NULL,
+    taille                  INT          NOT NULL,
+    largeur                 INT          NOT NULL,
+    hauteur                 INT          NOT NULL,
+    alt_text                VARCHAR(255),
+    variantes               JSONB        NOT NULL DEFAULT '[]',
+    id_utilisateur_creation INT          REFERENCES utilisateur(id_utilisateur) ON DELETE SET NULL,
+    date_creation           TIMESTAMP    DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_date ON media(date_creation DESC);
+
+ALTER TABLE IF EXISTS produits ADD COLUMN IF NOT EXISTS media_ids INT[] NOT NULL DEFAULT '{}';
+ALTER TABLE IF EXISTS carousel_images ADD COLUMN IF NOT EXISTS id_media INT REFERENCES media(id_media);
+
+CREATE INDEX IF NOT EXISTS idx_produits_media ON produits USING GIN (media_ids);
+
+-- ============================================================
+-- 36. CATALOGUE — traductions (EN, DE)
+-- ============================================================
+-- Le français reste dans les tables produits, categories et carousel_images ; une ligne
+-- de traduction par contenu et par langue. Un champ NULL retombe sur le français.
+CREATE TABLE IF NOT EXISTS produit_traduction (
+    id_produit          INT          NOT NULL REFERENCES produits(id_produit) ON DELETE CASCADE,
+    langue              VARCHAR(5)   NOT NULL CHECK (langue IN ('en', 'de')),
+    nom                 VARCHAR(150),
+    description_courte  TEXT,
+    description_longue  TEXT,
+    description_html    TEXT,
+    date_modification   TIMESTAMP    DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id_produit, langue)
+);
+
+CREATE TABLE IF NOT EXISTS categorie_traduction (
+    id_categorie        INT          NOT NULL REFERENCES categories(id_categorie) ON DELETE CASCADE,
+    langue              VARCHAR(5)   NOT NULL CHECK (langue IN ('en', 'de')),
+    nom                 VARCHAR(100),
+    description         TEXT,
+    date_modification   TIMESTAMP    DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id_categorie, langue)
+);
+
+CREATE TABLE IF NOT EXISTS carousel_image_traduction (
+    id_image            INT          NOT NULL REFERENCES carousel_images(id_image) ON DELETE CASCADE,
+    langue              VARCHAR(5)   NOT NULL CHECK (langue IN ('en', 'de')),
+    titre               VARCHAR(255),
+    description         TEXT,
+    alt_text            VARCHAR(255),
+    date_modification   TIMESTAMP    DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id_image, langue)
+);
+
+-- ============================================================
+-- 37. SUPPORT — conversations, workflow et affectation
+-- ============================================================
+-- ticket_support.message reste le message initial ; les échanges suivants sont dans
+-- ticket_message. Les notes internes (interne = TRUE) ne sont visibles que du personnel.
+-- Les tickets du formulaire de contact public n'ont pas d'utilisateur (email_expediteur).
+ALTER TABLE IF EXISTS ticket_support ALTER COLUMN id_utilisateur DROP NOT NULL;
+ALTER TABLE IF EXISTS ticket_support ADD COLUMN IF NOT EXISTS email_expediteur VARCHAR(254);
+ALTER TABLE IF EXISTS ticket_support ADD COLUMN IF NOT EXISTS priorite VARCHAR(20) NOT NULL DEFAULT 'normale';   -- urgente | haute | normale | basse
+ALTER TABLE IF EXISTS ticket_support ADD COLUMN IF NOT EXISTS categorie VARCHAR(30) NOT NULL DEFAULT 'general';  -- general | technique | facturation | compte
+ALTER TABLE IF EXISTS ticket_support ADD COLUMN IF NOT EXISTS id_assigne INT REFERENCES utilisateur(id_utilisateur) ON DELETE SET NULL;
+ALTER TABLE IF EXISTS ticket_support ADD COLUMN IF NOT EXISTS date_modification TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE IF EXISTS ticket_support ADD COLUMN IF NOT EXISTS date_fermeture TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_ticket_support_statut ON ticket_support(statut, date_creation);
+CREATE INDEX IF NOT EXISTS idx_ticket_support_assigne ON ticket_support(id_assigne);
+CREATE INDEX IF NOT EXISTS idx_ticket_support_utilisateur ON ticket_support(id_utilisateur);
+
+CREATE TABLE IF NOT EXISTS ticket_message (
+    id_message      SERIAL PRIMARY KEY,
+    id_ticket       INT          NOT NULL REFERENCES ticket_support(id_ticket) ON DELETE CASCADE,
+    id_auteur       INT          REFERENCES utilisateur(id_utilisateur) ON DELETE SET NULL,
+    staff           BOOLEAN      NOT NULL DEFAULT FALSE,   -- message du personnel
+    interne         BOOLEAN      NOT NULL DEFAULT FALSE,   -- note interne (jamais visible du client)
+    message         TEXT         NOT NULL,
+    date_creation   TIMESTAMP    DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_ticket_message_ticket ON ticket_message(id_ticket, date_creation);
+
+-- ============================================================
+-- 38. SUPPORT — SLA par niveau d'abonnement et escalade
+-- ============================================================
+-- Une politique par niveau (tag produit : Prioritaire | Premium | Standard) et une
+-- politique 'defaut' (sans abonnement actif, invités). Objectifs en minutes de temps
+-- calendaire ; le chronomètre est en pause hors des statuts ouvert et en_cours.
+CREATE TABLE IF NOT EXISTS sla_politique (
+    niveau                  VARCHAR(50)  PRIMARY KEY,
+    premiere_reponse_min    INT          NOT NULL CHECK (premiere_reponse_min > 0),
+    resolution_min          INT          NOT NULL CHECK (resolution_min > 0),
+    actif                   BOOLEAN      NOT NULL DEFAULT TRUE,
+    date_modification       TIMESTAMP    DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO sla_politique (niveau, premiere_reponse_min, resolution_min) VALUES
+    ('Prioritaire', 60, 480),
+    ('Premium', 240, 1440),
+    ('Standard', 480, 4320),
+    ('defaut', 1440, 7200)
+ON CONFLICT (niveau) DO NOTHING;
+
+-- Objectifs figés à l'ouverture du ticket ; temps de traitement mesurés (pauses
+-- déduites) à la première réponse et à la fermeture. Alertes : 0 | 1 proche | 2 dépassé.
+ALTER TABLE IF EXISTS ticket_support ADD COLUMN IF NOT EXISTS sla_niveau VARCHAR(50);
+ALTER TABLE IF EXISTS ticket_support ADD COLUMN IF NOT EXISTS sla_premiere_reponse_min INT;
+ALTER TABLE IF EXISTS ticket_support ADD COLUMN IF NOT EXISTS sla_resolution_min INT;
+ALTER TABLE IF EXISTS ticket_support ADD COLUMN IF NOT EXISTS sla_pause_secondes INT NOT NULL DEFAULT 0;
+ALTER TABLE IF EXISTS ticket_support ADD COLUMN IF NOT EXISTS sla_pause_depuis TIMESTAMP;
+ALTER TABLE IF EXISTS ticket_support ADD COLUMN IF NOT EXISTS date_premiere_reponse TIMESTAMP;
+ALTER TABLE IF EXISTS ticket_support ADD COLUMN IF NOT EXISTS sla_reponse_secondes INT;
+ALTER TABLE IF EXISTS ticket_support ADD COLUMN IF NOT EXISTS sla_resolution_secondes INT;
+ALTER TABLE IF EXISTS ticket_support ADD COLUMN IF NOT EXISTS sla_alerte_reponse SMALLINT NOT NULL DEFAULT 0;
+ALTER TABLE IF EXISTS ticket_support ADD COLUMN IF NOT EXISTS sla_alerte_resolution SMALLINT NOT NULL DEFAULT 0;
+
+-- ============================================================
+-- 39. SUPPORT — Réponses aux tickets par email
+-- ============================================================
+-- Les réponses reçues par email (relais → POST /api/support/inbound-email) sont des
+-- messages canal = 'email' ; le Message-ID évite les doublons quand le relais réessaie.
+ALTER TABLE IF EXISTS ticket_message ADD COLUMN IF NOT EXISTS canal VARCHAR(10) NOT NULL DEFAULT 'web';   -- web | email
+ALTER TABLE IF EXISTS ticket_message ADD COLUMN IF NOT EXISTS message_id_email VARCHAR(255);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_ticket_message_email ON ticket_message(message_id_email);
+
+-- ============================================================
+-- 40. SUPPORT — Pièces jointes des tickets
+-- ============================================================
+-- Fichiers du message initial (id_message NULL) ou d'un échange, rangés dans le
+-- stockage privé (ATTACHMENT_STORAGE) sous cle_stockage ; téléchargés via l'API après
+-- contrôle d'accès. Ceux d'une note interne ne sont visibles que du personnel.
+CREATE TABLE IF NOT EXISTS ticket_piece_jointe (
+    id_piece_jointe SERIAL PRIMARY KEY,
+    id_ticket       INT          NOT NULL REFERENCES ticket_support(id_ticket) ON DELETE CASCADE,
+    id_message      INT          REFERENCES ticket_message(id_message) ON DELETE CASCADE,
+    nom_fichier     VARCHAR(255) NOT NULL,
+    type_mime       VARCHAR(100) NOT NULL,
+    taille          INT          NOT NULL,
+    empreinte       CHAR(64)     NOT NULL,   -- SHA-256 du contenu
+    cle_stockage    VARCHAR(255) NOT NULL UNIQUE,
+    id_auteur       INT          REFERENCES utilisateur(id_utilisateur) ON DELETE SET NULL,
+    date_creation   TIMESTAMP    DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_ticket_piece_jointe_ticket ON ticket_piece_jointe(id_ticket);
+
+-- ============================================================
+-- 41. NOTIFICATIONS — Centre de notifications
+-- ============================================================
+-- Notifications créées par notify.Send : titre, lien vers le front et données de
+-- l'événement (ids de facture, de ticket…). Les notifications lues sont purgées après
+-- NOTIFICATION_RETENTION_DAYS, les autres après le double.
+ALTER TABLE IF EXISTS notification ADD COLUMN IF NOT EXISTS titre VARCHAR(200);
+ALTER TABLE IF EXISTS notification ADD COLUMN IF NOT EXISTS lien VARCHAR(500);
+ALTER TABLE IF EXISTS notification ADD COLUMN IF NOT EXISTS donnees JSONB;
+ALTER TABLE IF EXISTS notification ADD COLUMN IF NOT EXISTS date_lecture TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_notification_utilisateur ON notification(id_utilisateur, lu, date_creation DESC);
+
+-- Date de fin pour laquelle le client a été prévenu de l'expiration (abonnements sans
+-- renouvellement automatique, billing.ExpiryNotice).
+ALTER TABLE IF EXISTS abonnement ADD COLUMN IF NOT EXISTS date_rappel_fin DATE;
+
+-- Choix de l'utilisateur par type (défauts dans notify.Resolve) ; la notification
+-- in-app de sécurité reste obligatoire.
+CREATE TABLE IF NOT EXISTS notification_preference (
+    id_utilisateur    INT         NOT NULL REFERENCES utilisateur(id_utilisateur) ON DELETE CASCADE,
+    type              VARCHAR(50) NOT NULL,
+    in_app            BOOLEAN     NOT NULL DEFAULT TRUE,
+    email             BOOLEAN     NOT NULL DEFAULT FALSE,
+    date_modification TIMESTAMP   DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id_utilisateur, type)
+);
+
+-- ============================================================
+-- 42. TEMPS RÉEL — Événements des flux SSE
+-- ============================================================
+-- Événements poussés sur GET /api/stream (realtime.Publish) : l'id sert de
+-- Last-Event-ID pour la reprise après reconnexion, le NOTIFY cyna_evenements ne
+-- transporte que "<id>:<utilisateur>". Purgés après STREAM_REPLAY_HOURS.
+CREATE TABLE IF NOT EXISTS evenement_flux (
+    id_evenement   BIGSERIAL   PRIMARY KEY,
+    id_utilisateur INT         NOT NULL REFERENCES utilisateur(id_utilisateur) ON DELETE CASCADE,
+    type           VARCHAR(50) NOT NULL,
+    donnees        JSONB       NOT NULL,
+    date_creation  TIMESTAMP   DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_evenement_flux_utilisateur ON evenement_flux(id_utilisateur, id_evenement);
+CREATE INDEX IF NOT EXISTS idx_evenement_flux_date ON evenement_flux(date_creation);
+
+-- ============================================================
+-- 43. PUSH — Appareils mobiles
+-- ============================================================
+-- Jetons Expo enregistrés par l'application mobile (un jeton appartient au dernier
+-- utilisateur connecté sur l'appareil). Les notifications urgentes (sécurité, échecs de
+-- paiement) y sont poussées ; les jetons déclarés invalides par le fournisseur sont
+-- supprimés.
+CREATE TABLE IF NOT EXISTS appareil_push (
+    id_appareil            SERIAL       PRIMARY KEY,
+    id_utilisateur         INT          NOT NULL REFERENCES utilisateur(id_utilisateur) ON DELETE CASCADE,
+    jeton                  VARCHAR(255) NOT NULL UNIQUE,
+    plateforme             VARCHAR(20)  NOT NULL,   -- ios | android
+    nom                    VARCHAR(100),
+    -- Session qui a enregistré le jeton : tant qu'elle est active, un autre compte ne peut pas le reprendre.
+    id_session             INT          REFERENCES session_utilisateur(id_session) ON DELETE SET NULL,
+    date_creation          TIMESTAMP    DEFAULT CURRENT_TIMESTAMP,
+    date_derniere_activite TIMESTAMP    DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_appareil_push_utilisateur ON appareil_push(id_utilisateur);
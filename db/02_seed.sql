@@ -206,30 +206,26 @@ FROM categories c
 WHERE c.slug = 'xdr'
     AND NOT EXISTS (SELECT 1 FROM produits WHERE slug = 'xdr-enterprise' AND id_categorie = c.id_categorie);
 
--- Donnees legacy (compatibilite API existante)
-INSERT INTO categorie (nom, description, actif)
-SELECT 'Protection Endpoint', 'Services EDR et antivirus nouvelle generation', TRUE
-WHERE NOT EXISTS (SELECT 1 FROM categorie WHERE nom = 'Protection Endpoint');
-
-INSERT INTO service (nom, description, actif, id_categorie)
-SELECT 'EDR Managed', 'Service EDR manage avec supervision', TRUE, c.id_categorie
-FROM categorie c
-WHERE c.nom = 'Protection Endpoint'
-    AND NOT EXISTS (SELECT 1 FROM service WHERE nom = 'EDR Managed');
-
-INSERT INTO produit (nom, description, sur_devis, actif, id_service)
-SELECT 'Pack EDR 50 postes', 'Protection et monitoring pour 50 endpoints', FALSE, TRUE, s.id_service
-FROM service s
-WHERE s.nom = 'EDR Managed'
-    AND NOT EXISTS (SELECT 1 FROM produit WHERE nom = 'Pack EDR 50 postes');
+INSERT INTO produits (nom, slug, description_courte, prix, devise, duree, id_categorie, tag, statut, type_achat, ordre_affichage, actif, id_utilisateur_creation)
+SELECT 'Pack EDR 50 postes', 'pack-edr-50-postes',
+             'Protection et monitoring pour 50 endpoints',
+             990.00, 'EUR', 'mois', c.id_categorie, 'Standard', 'Disponible', 'panier', 3, TRUE,
+             (SELECT id_utilisateur FROM utilisateur WHERE email = 'admin@cyna.fr' LIMIT 1)
+FROM categories c
+WHERE c.slug = 'edr'
+    AND NOT EXISTS (SELECT 1 FROM produits WHERE slug = 'pack-edr-50-postes' AND id_categorie = c.id_categorie);
 
+-- Tarifications (plans rattachés aux produits du catalogue)
 INSERT INTO tarification (prix, unite, periodicite, actif, id_produit)
-SELECT 990.00, 'licence', 'mensuel', TRUE, p.id_produit
-FROM produit p
-WHERE p.nom = 'Pack EDR 50 postes'
-    AND NOT EXISTS (
+SELECT v.prix, v.unite, 'mensuel', TRUE, p.id_produit
+FROM (VALUES ('soc-essentials', 499.00, 'forfait'),
+             ('edr-pro', 19.90, 'poste'),
+             ('xdr-enterprise', 2499.00, 'forfait'),
+             ('pack-edr-50-postes', 990.00, 'licence')) AS v(slug, prix, unite)
+JOIN produits p ON p.slug = v.slug
+WHERE NOT EXISTS (
             SELECT 1 FROM tarification t
-            WHERE t.id_produit = p.id_produit AND t.prix = 990.00 AND t.periodicite = 'mensuel'
+            WHERE t.id_produit = p.id_produit AND t.prix = v.prix AND t.periodicite = 'mensuel'
     );
 
 -- Commandes, factures et paiements de démonstration
@@ -267,7 +263,7 @@ INSERT INTO abonnement (date_debut, date_fin, quantite, statut, renouvellement_a
 SELECT CURRENT_DATE, CURRENT_DATE + INTERVAL '30 day', 50, 'actif', TRUE,
              e.id_entreprise, p.id_produit, t.id_tarification
 FROM entreprise e
-JOIN produit p ON p.nom = 'Pack EDR 50 postes'
+JOIN produits p ON p.slug = 'pack-edr-50-postes'
 JOIN tarification t ON t.id_produit = p.id_produit
 WHERE e.nom = 'CYNA Demo Corp'
     AND NOT EXISTS (
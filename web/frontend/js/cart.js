@@ -440,8 +440,10 @@ function renderCart() {
         if (data.url) {
           // Sauvegarder le montant + code promo dans sessionStorage pour confirm-order
           const normalized = items.map((it) => ({
-            product_slug: it.slug || it.id || it.name,
+            product_slug: it.bundleSlug ? "" : it.slug || it.id || it.name,
+            bundle_slug: it.bundleSlug || "",
             product_name: it.name,
+            variant_sku: it.variantSku || it.variant_sku || "",
             price: Number(it.price) || 0,
             quantity: Number(it.qty) || 1,
             duration: it.duration || "",
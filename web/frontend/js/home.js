@@ -94,7 +94,8 @@ async function loadTopProducts() {
     const response = await fetch('/api/public/top-products');
     if (!response.ok) throw new Error(`HTTP ${response.status}`);
     const data = await response.json();
-    const top = Array.isArray(data.top_products) ? data.top_products : [];
+    // Classement public : tableau ordonné par rang (sans chiffres de vente)
+    const top = Array.isArray(data) ? data : Array.isArray(data.top_products) ? data.top_products : [];
     renderTopProducts(top);
   } catch (error) {
     console.error('Erreur lors du chargement des top produits:', error);
@@ -47,7 +47,7 @@ async function fetchSuggestions(query) {
   try {
     abortController = new AbortController();
     
-    const response = await fetch(`/api/public/search?q=${encodeURIComponent(query)}`, {
+    const response = await fetch(`/api/public/search/suggest?q=${encodeURIComponent(query)}&limit=5`, {
       signal: abortController.signal
     });
     
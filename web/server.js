@@ -498,10 +498,25 @@ app.post("/api/auth/resend-verification-email", async (req, res) => {
 // =============================================================================
 // Au lieu d'un proxy générique, on expose seulement les endpoints nécessaires
 
+// Langue du visiteur transmise à l'API (?lang= ou Accept-Language, repli sur le français)
+function localeOptions(req) {
+  const options = { headers: {}, params: {} };
+  if (req.headers["accept-language"]) {
+    options.headers["Accept-Language"] = req.headers["accept-language"];
+  }
+  if (req.query.lang) {
+    options.params.lang = String(req.query.lang);
+  }
+  return options;
+}
+
 // Routes publiques (catalogue, carrousel)
 app.get("/api/public/categories", async (req, res) => {
   try {
-    const response = await axios.get("http://api:8080/api/public/categories");
+    const response = await axios.get(
+      "http://api:8080/api/public/categories",
+      localeOptions(req),
+    );
     res.json(response.data);
   } catch (error) {
     res.status(error.response?.status || 500).json({
@@ -514,6 +529,7 @@ app.get("/api/public/products/:slug", async (req, res) => {
   try {
     const response = await axios.get(
       `http://api:8080/api/public/products/${req.params.slug}`,
+      localeOptions(req),
     );
     res.json(response.data);
   } catch (error) {
@@ -527,6 +543,7 @@ app.get("/api/public/carousel-images", async (req, res) => {
   try {
     const response = await axios.get(
       "http://api:8080/api/public/carousel-images",
+      localeOptions(req),
     );
     res.json(response.data);
   } catch (error) {
@@ -541,6 +558,7 @@ app.get("/api/public/search", async (req, res) => {
     const q = req.query.q || "";
     const response = await axios.get(
       `http://api:8080/api/public/search?q=${encodeURIComponent(q)}`,
+      localeOptions(req),
     );
     res.json(response.data);
   } catch (error) {
@@ -550,6 +568,38 @@ app.get("/api/public/search", async (req, res) => {
   }
 });
 
+app.get("/api/public/catalog/preview", async (req, res) => {
+  try {
+    const token = req.query.token || "";
+    const response = await axios.get(
+      `http://api:8080/api/public/catalog/preview?token=${encodeURIComponent(token)}`,
+    );
+    res.set("Cache-Control", "no-store");
+    res.set("X-Robots-Tag", "noindex");
+    res.json(response.data);
+  } catch (error) {
+    res.status(error.response?.status || 500).json({
+      error: error.response?.data?.error || "Preview failed",
+    });
+  }
+});
+
+app.get("/api/public/search/suggest", async (req, res) => {
+  try {
+    const q = req.query.q || "";
+    const limit = req.query.limit || "";
+    const response = await axios.get(
+      `http://api:8080/api/public/search/suggest?q=${encodeURIComponent(q)}&limit=${encodeURIComponent(limit)}`,
+      localeOptions(req),
+    );
+    res.json(response.data);
+  } catch (error) {
+    res.status(error.response?.status || 500).json({
+      error: error.response?.data?.error || "Suggest failed",
+    });
+  }
+});
+
 // Routes d'inscription (publiques)
 app.post("/api/users", async (req, res) => {
   try {
@@ -2369,15 +2419,19 @@ app.post("/api/confirm-order", checkAuth, async (req, res) => {
   try {
     const normalized = Array.isArray(items)
       ? items.map((it) => ({
+          bundle_slug: it.bundle_slug || it.bundleSlug || "",
           product_slug:
-            it.product_slug ||
-            it.slug ||
-            it.id ||
-            it.productName ||
-            it.product_name ||
-            "",
+            it.bundle_slug || it.bundleSlug
+              ? ""
+              : it.product_slug ||
+                it.slug ||
+                it.id ||
+                it.productName ||
+                it.product_name ||
+                "",
           product_name:
             it.product_name || it.productName || it.name || "Produit",
+          variant_sku: it.variant_sku || it.variantSku || "",
           price: Number(it.price) || 0,
           quantity: Number(it.quantity || it.qty || 1) || 1,
           duration: it.duration || "",
@@ -2398,13 +2452,16 @@ app.post("/api/confirm-order", checkAuth, async (req, res) => {
 
     // Creer automatiquement les abonnements pour chaque article
     for (const item of normalized) {
-      const slug = item.product_slug || item.slug || "";
+      const slug = item.bundle_slug || item.product_slug || item.slug || "";
       if (slug) {
         try {
           await axios.post(
             "http://api:8080/api/abonnements/from-purchase",
             {
-              product_slug: slug,
+              product_slug: item.bundle_slug ? "" : slug,
+              bundle_slug: item.bundle_slug || "",
+              variant_sku: item.variant_sku || "",
+              duration: item.duration || "",
               user_id: userId,
               quantity: item.quantity || 1,
             },